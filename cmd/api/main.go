@@ -1,9 +1,12 @@
 package main
 
 import (
+	"ClassConnect/internal/api/handlers"
 	mw "ClassConnect/internal/api/middlewares"
 	"ClassConnect/internal/api/routers"
+	"ClassConnect/internal/jobs"
 	"ClassConnect/internal/repository/sqlconnect"
+	"ClassConnect/internal/webhooks"
 	"ClassConnect/pkg/utils"
 	"os"
 
@@ -36,13 +39,32 @@ func main() {
 
 	router := routers.Router()
 
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatalln("Error connecting to the database: ", err)
+	}
+
+	// Run background jobs and queue the recurring ones, such as purging soft-deleted records past their retention period
+	err = handlers.RegisterJobs(db)
+	if err != nil {
+		log.Fatalln("Error registering the background jobs: ", err)
+	}
+	jobs.StartWorkers(db)
+	jobs.StartScheduler(db)
+
+	// Send queued webhook deliveries and retry the failed ones
+	webhooks.StartDispatcher(db)
+
 	// Set a rate limiter of 5 requests per minute
 	// rl := mw.NewRateLimiter(50, time.Minute)
 
 	// Chaining all of our middlewares
 	// Note that the first argument will be the innermost middleware and the last will be the outermost
-	jwtMiddleware := mw.MiddlewareExcludePaths(mw.JWTMiddleware, "/execs/login/", "/execs/forgotPassword/", "/execs/resetPassword/", "/execs/")
-	secureMux := utils.ApplyMiddlewares(router, mw.SecurityHeaders, mw.Compress, jwtMiddleware, mw.ResponseTime, mw.Cors)
+	jwtMiddleware := mw.MiddlewareExcludePaths(mw.JWTMiddleware, "/execs/login/", "/execs/forgotPassword/", "/execs/resetPassword/", "/calendar/feed/", "/transcripts/verify/", "/admissions/apply")
+	// Guardian accounts only reach the paths allowed here
+	guardianScope := mw.RoleScope(utils.GuardianRole, "/messages/", "/events/", "/announcements/", "/calendar/", "/fees/statement", "/leave/requests", "/execs/logout/", "/execs/updatePassword/")
+	// The tenant and role scope middlewares run inside the JWT middleware so they can read the token's claims
+	secureMux := utils.ApplyMiddlewares(router, mw.SecurityHeaders, mw.Compress, guardianScope, mw.TenantMiddleware(db), jwtMiddleware, mw.ResponseTime, mw.RequestID, mw.Cors)
 
 	// Create custom server
 	server := &http.Server{
@@ -51,7 +73,7 @@ func main() {
 	}
 
 	fmt.Println("Server running on port:", port, "(HTTPS)")
-	err := server.ListenAndServeTLS("/app/server.crt", "/app/server.key")
+	err = server.ListenAndServeTLS("/app/server.crt", "/app/server.key")
 	if err != nil {
 		log.Fatalln("Error starting new server: ", err)
 	}
@@ -2,13 +2,16 @@ module ClassConnect
 
 go 1.24.4
 
+require (
+	github.com/go-mail/mail/v2 v2.3.0
+	github.com/go-sql-driver/mysql v1.9.3
+	github.com/golang-jwt/jwt/v5 v5.3.0
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/crypto v0.45.0
+)
+
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/go-mail/mail/v2 v2.3.0 // indirect
-	github.com/go-sql-driver/mysql v1.9.3 // indirect
-	github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	golang.org/x/crypto v0.45.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 )
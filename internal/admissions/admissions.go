@@ -0,0 +1,273 @@
+package admissions
+
+import (
+	"ClassConnect/internal/models"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Application statuses, an application starts as submitted and ends accepted or rejected
+const (
+	StatusSubmitted   = "submitted"
+	StatusUnderReview = "under_review"
+	StatusInterview   = "interview"
+	StatusOffered     = "offered"
+	StatusAccepted    = "accepted"
+	StatusRejected    = "rejected"
+	StatusWaitlisted  = "waitlisted"
+)
+
+// Statuses lists every status in pipeline order
+var Statuses = []string{StatusSubmitted, StatusUnderReview, StatusInterview, StatusOffered, StatusAccepted, StatusRejected, StatusWaitlisted}
+
+// transitions are the statuses an application may move to from each status. Accepted applications are final, and
+// rejected ones may only be reopened for review
+var transitions = map[string][]string{
+	StatusSubmitted:   {StatusUnderReview, StatusRejected, StatusWaitlisted},
+	StatusUnderReview: {StatusInterview, StatusOffered, StatusRejected, StatusWaitlisted},
+	StatusInterview:   {StatusOffered, StatusRejected, StatusWaitlisted},
+	StatusWaitlisted:  {StatusUnderReview, StatusInterview, StatusOffered, StatusRejected},
+	StatusOffered:     {StatusAccepted, StatusRejected, StatusWaitlisted},
+	StatusRejected:    {StatusUnderReview},
+}
+
+var ErrApplicationNotFound = errors.New("application not found")
+
+// codeAlphabet leaves out the letters and digits that are easily confused when a reference is typed from paper
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Columns are the columns Scan reads from Tables
+const Columns = "a.id, a.reference, a.status, a.first_name, a.last_name, a.date_of_birth, a.email, a.class, COALESCE(a.academic_year_id, 0), COALESCE(a.previous_school, ''), " +
+	"COALESCE(a.assigned_to, 0), COALESCE(TRIM(CONCAT(e.first_name, ' ', e.last_name)), ''), COALESCE(a.student_id, 0), a.submitted_at, a.updated_at, COALESCE(a.converted_at, '')"
+
+// Tables are admission_applications a joined with execs e, the reviewer
+const Tables = "admission_applications a LEFT JOIN execs e ON e.id = a.assigned_to"
+
+// CanMove reports whether an application may move from one status to another
+func CanMove(from, to string) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// Next lists the statuses an application may move to from a status
+func Next(status string) []string {
+	next := transitions[status]
+	if next == nil {
+		return []string{}
+	}
+	return next
+}
+
+// Open reports whether applicants may still add documents to an application in a status
+func Open(status string) bool {
+	return status != StatusAccepted && status != StatusRejected
+}
+
+// Load reads the applications matching a condition on admission_applications a and execs e, newest first, with their
+// guardians and documents. Notes and history are only read by LoadDetail
+func Load(db *sql.DB, condition string, args ...any) ([]models.Application, error) {
+	rows, err := db.Query("SELECT "+Columns+" FROM "+Tables+" WHERE "+condition+" ORDER BY a.submitted_at DESC, a.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applications := make([]models.Application, 0)
+	for rows.Next() {
+		application, err := Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, application)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return applications, LoadDetails(db, applications)
+}
+
+// Scan reads a row of Columns
+func Scan(row interface{ Scan(dest ...any) error }) (models.Application, error) {
+	var application models.Application
+	err := row.Scan(&application.Id, &application.Reference, &application.Status, &application.FirstName, &application.LastName, &application.DateOfBirth,
+		&application.Email, &application.Class, &application.AcademicYearId, &application.PreviousSchool, &application.AssignedTo, &application.AssignedName,
+		&application.StudentId, &application.SubmittedAt, &application.UpdatedAt, &application.ConvertedAt,
+	)
+	application.Guardians = make([]models.ApplicationGuardian, 0)
+	application.Documents = make([]models.ApplicationDocument, 0)
+	return application, err
+}
+
+// LoadDetails reads the guardians and documents of scanned applications
+func LoadDetails(db *sql.DB, applications []models.Application) error {
+	if len(applications) == 0 {
+		return nil
+	}
+	byId := make(map[int]int, len(applications))
+	ids := make([]any, 0, len(applications))
+	for i, application := range applications {
+		byId[application.Id] = i
+		ids = append(ids, application.Id)
+	}
+	placeholders := "(?" + strings.Repeat(",?", len(ids)-1) + ")"
+
+	guardianRows, err := db.Query("SELECT application_id, first_name, last_name, email, COALESCE(phone, ''), COALESCE(relationship, '') FROM admission_guardians WHERE application_id IN "+placeholders+" ORDER BY id", ids...)
+	if err != nil {
+		return err
+	}
+	defer guardianRows.Close()
+	for guardianRows.Next() {
+		var id int
+		var guardian models.ApplicationGuardian
+		err = guardianRows.Scan(&id, &guardian.FirstName, &guardian.LastName, &guardian.Email, &guardian.Phone, &guardian.Relationship)
+		if err != nil {
+			return err
+		}
+		application := &applications[byId[id]]
+		application.Guardians = append(application.Guardians, guardian)
+	}
+	if err = guardianRows.Err(); err != nil {
+		return err
+	}
+
+	documentRows, err := db.Query("SELECT application_id, id, kind, filename, content_type, size, uploaded_at FROM admission_documents WHERE application_id IN "+placeholders+" ORDER BY id", ids...)
+	if err != nil {
+		return err
+	}
+	defer documentRows.Close()
+	for documentRows.Next() {
+		var id int
+		var document models.ApplicationDocument
+		err = documentRows.Scan(&id, &document.Id, &document.Kind, &document.Filename, &document.ContentType, &document.Size, &document.UploadedAt)
+		if err != nil {
+			return err
+		}
+		application := &applications[byId[id]]
+		application.Documents = append(application.Documents, document)
+	}
+	return documentRows.Err()
+}
+
+// LoadDetail reads one application with its reviewer notes and the history of its statuses
+func LoadDetail(db *sql.DB, id int) (models.Application, error) {
+	applications, err := Load(db, "a.id = ?", id)
+	if err != nil {
+		return models.Application{}, err
+	}
+	if len(applications) == 0 {
+		return models.Application{}, ErrApplicationNotFound
+	}
+	application := applications[0]
+
+	application.Notes = make([]models.ApplicationNote, 0)
+	rows, err := db.Query("SELECT id, author, body, created_at FROM admission_notes WHERE application_id = ? ORDER BY id", id)
+	if err != nil {
+		return application, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var note models.ApplicationNote
+		err = rows.Scan(&note.Id, &note.Author, &note.Body, &note.CreatedAt)
+		if err != nil {
+			return application, err
+		}
+		application.Notes = append(application.Notes, note)
+	}
+	if err = rows.Err(); err != nil {
+		return application, err
+	}
+
+	application.History = make([]models.ApplicationStage, 0)
+	stageRows, err := db.Query("SELECT COALESCE(from_status, ''), to_status, COALESCE(reason, ''), COALESCE(changed_by, ''), changed_at FROM admission_stages WHERE application_id = ? ORDER BY id", id)
+	if err != nil {
+		return application, err
+	}
+	defer stageRows.Close()
+	for stageRows.Next() {
+		var stage models.ApplicationStage
+		err = stageRows.Scan(&stage.From, &stage.To, &stage.Reason, &stage.ChangedBy, &stage.ChangedAt)
+		if err != nil {
+			return application, err
+		}
+		application.History = append(application.History, stage)
+	}
+	return application, stageRows.Err()
+}
+
+// Receipt is what the applicant is shown of an application
+func Receipt(application models.Application) models.ApplicationReceipt {
+	return models.ApplicationReceipt{
+		Reference:   application.Reference,
+		Status:      application.Status,
+		FirstName:   application.FirstName,
+		LastName:    application.LastName,
+		Class:       application.Class,
+		Documents:   len(application.Documents),
+		SubmittedAt: application.SubmittedAt,
+		UpdatedAt:   application.UpdatedAt,
+	}
+}
+
+// NewReference returns a random reference, such as "K7QM2-XW9PA", that applicants use to follow their application.
+// It is the only thing protecting the application from strangers, so it is long enough not to be guessed
+func NewReference() (string, error) {
+	random := make([]byte, 10)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+	reference := make([]byte, 0, 11)
+	for i, b := range random {
+		if i == 5 {
+			reference = append(reference, '-')
+		}
+		reference = append(reference, codeAlphabet[int(b)%len(codeAlphabet)])
+	}
+	return string(reference), nil
+}
+
+// NormalizeReference uppercases a reference typed by an applicant and restores its dash
+func NormalizeReference(reference string) string {
+	reference = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(reference))
+	if len(reference) == 10 {
+		reference = reference[:5] + "-" + reference[5:]
+	}
+	return reference
+}
+
+// SubmittedEmail writes the subject and plain text body of the email confirming an application was received
+func SubmittedEmail(application models.Application, school string) (string, string) {
+	subject := fmt.Sprintf("Application %s received", application.Reference)
+	body := fmt.Sprintf("Dear parent or guardian,\n\n%s received the application of %s %s for %s.\n\n"+
+		"Its reference is %s, keep it to follow the application and to send further documents.\n",
+		school, application.FirstName, application.LastName, application.Class, application.Reference)
+	return subject, body
+}
+
+// StatusEmail writes the subject and plain text body of the email telling the applicant their application moved on
+func StatusEmail(application models.Application, school string) (string, string) {
+	var news string
+	switch application.Status {
+	case StatusUnderReview:
+		news = "is now being reviewed"
+	case StatusInterview:
+		news = "has been selected for an interview, the school will contact you to arrange it"
+	case StatusOffered:
+		news = "has been offered a place, please contact the school to accept it"
+	case StatusAccepted:
+		news = "has been accepted, welcome to the school"
+	case StatusRejected:
+		news = "has unfortunately not been successful"
+	case StatusWaitlisted:
+		news = "has been placed on the waiting list, the school will contact you if a place becomes available"
+	default:
+		news = "is now " + strings.ReplaceAll(application.Status, "_", " ")
+	}
+	subject := fmt.Sprintf("Application %s: %s", application.Reference, strings.ReplaceAll(application.Status, "_", " "))
+	body := fmt.Sprintf("Dear parent or guardian,\n\nThe application of %s %s to %s (reference %s) %s.\n",
+		application.FirstName, application.LastName, school, application.Reference, news)
+	return subject, body
+}
@@ -0,0 +1,102 @@
+package admissions
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxDocuments is how many documents an application may hold
+	MaxDocuments = 10
+	// MaxDocumentSize is the size of the largest document accepted
+	MaxDocumentSize = 5 << 20
+	// MaxUploadSize is the size of the largest request carrying documents
+	MaxUploadSize = 25 << 20
+)
+
+// documentTypes are the content types accepted, detected from the content rather than trusted from the upload
+var documentTypes = []string{"application/pdf", "image/jpeg", "image/png"}
+
+// documentKind matches the form field names that carry documents, which name their kind
+var documentKind = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// unsafeFilename matches what is dropped from uploaded file names
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._ -]+`)
+
+// Upload is a document read from a multipart form
+type Upload struct {
+	Kind        string
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// ReadUploads reads the documents of a multipart form, each file field naming the kind of its documents such as
+// birth_certificate or school_report. The "application" field is not a document and is skipped
+func ReadUploads(form *multipart.Form) ([]Upload, error) {
+	kinds := make([]string, 0, len(form.File))
+	for kind := range form.File {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	uploads := make([]Upload, 0)
+	for _, kind := range kinds {
+		if !documentKind.MatchString(kind) {
+			return nil, fmt.Errorf("%q is not a document kind, use lower case letters, digits and underscores", kind)
+		}
+		for _, header := range form.File[kind] {
+			if header.Size > MaxDocumentSize {
+				return nil, fmt.Errorf("%s is larger than %dMB", header.Filename, MaxDocumentSize>>20)
+			}
+			file, err := header.Open()
+			if err != nil {
+				return nil, err
+			}
+			data, err := io.ReadAll(io.LimitReader(file, MaxDocumentSize+1))
+			file.Close()
+			if err != nil {
+				return nil, err
+			}
+			if len(data) > MaxDocumentSize {
+				return nil, fmt.Errorf("%s is larger than %dMB", header.Filename, MaxDocumentSize>>20)
+			}
+
+			contentType := strings.Split(http.DetectContentType(data), ";")[0]
+			if !slices.Contains(documentTypes, contentType) {
+				return nil, fmt.Errorf("%s is not a PDF, JPEG or PNG file", header.Filename)
+			}
+			uploads = append(uploads, Upload{Kind: kind, Filename: Filename(header.Filename, contentType), ContentType: contentType, Data: data})
+		}
+	}
+	return uploads, nil
+}
+
+// Filename cleans the name an applicant gave a file so that it can be sent back in a Content-Disposition header
+func Filename(name, contentType string) string {
+	name = strings.TrimSpace(unsafeFilename.ReplaceAllString(filepath.Base(strings.ReplaceAll(name, `\`, "/")), ""))
+	if name == "" || name == "." {
+		name = "document"
+	}
+	if len(name) > 100 {
+		name = name[len(name)-100:]
+	}
+	if filepath.Ext(name) == "" {
+		switch contentType {
+		case "application/pdf":
+			name += ".pdf"
+		case "image/jpeg":
+			name += ".jpg"
+		case "image/png":
+			name += ".png"
+		}
+	}
+	return name
+}
@@ -0,0 +1,581 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/models"
+	"ClassConnect/internal/webhooks"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Outcomes of a promotion, also used as the status of the archived enrollment
+const (
+	outcomePromoted  = "promoted"
+	outcomeHeldBack  = "held_back"
+	outcomeGraduated = "graduated"
+
+	enrollmentActive = "active"
+
+	// graduatedClass is the class of students who left the school by graduating
+	graduatedClass = "graduated"
+)
+
+// promotionError is a promotion request that cannot be carried out, reported with its HTTP status
+type promotionError struct {
+	status  int
+	message string
+}
+
+func (e promotionError) Error() string {
+	return e.message
+}
+
+// academicYearsAccess guards creating years, terms and sections and promoting classes
+var academicYearsAccess = roleAccess{roles: []string{"admin", "manager"}, denied: "Only admins and managers may manage academic years"}
+
+type AcademicYearsHandler struct {
+	db *sql.DB
+}
+
+func NewAcademicYearsHandler(db *sql.DB) *AcademicYearsHandler {
+	return &AcademicYearsHandler{db: db}
+}
+
+func (h *AcademicYearsHandler) GetAcademicYearsHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, tenantArgs := tenantCondition(r)
+	rows, err := h.db.Query("SELECT id, name, start_date, end_date, is_current FROM academic_years WHERE 1 = 1"+tenant+" ORDER BY start_date DESC", tenantArgs...)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the academic years", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	years := make([]models.AcademicYear, 0)
+	for rows.Next() {
+		var year models.AcademicYear
+		err = rows.Scan(&year.Id, &year.Name, &year.StartDate, &year.EndDate, &year.IsCurrent)
+		if err != nil {
+			log.Println("Scan error:", err)
+			http.Error(w, "Error retrieving the academic years", http.StatusInternalServerError)
+			return
+		}
+		years = append(years, year)
+	}
+
+	writeList(w, r, years)
+}
+
+func (h *AcademicYearsHandler) GetAcademicYearByIdHandler(w http.ResponseWriter, r *http.Request) {
+	year, _, ok := h.loadAcademicYear(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, "", year)
+}
+
+// CreateAcademicYearHandler adds an academic year. Marking it current clears the flag on the school's other years
+func (h *AcademicYearsHandler) CreateAcademicYearHandler(w http.ResponseWriter, r *http.Request) {
+	if !academicYearsAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var year models.AcademicYear
+	err := json.NewDecoder(r.Body).Decode(&year)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	year.Name = strings.TrimSpace(year.Name)
+	if year.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateDateRange(year.StartDate, year.EndDate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error creating the academic year", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if year.IsCurrent {
+		_, err = tx.Exec("UPDATE academic_years SET is_current = FALSE WHERE school_id = ?", schoolId)
+		if err != nil {
+			log.Println("Update error:", err)
+			http.Error(w, "Error creating the academic year", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	res, err := tx.Exec("INSERT INTO academic_years(school_id, name, start_date, end_date, is_current) VALUES(?,?,?,?,?)",
+		schoolId, year.Name, year.StartDate, year.EndDate, year.IsCurrent,
+	)
+	if isDuplicateEntry(err) {
+		http.Error(w, "An academic year with that name already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the academic year", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Error creating the academic year", http.StatusInternalServerError)
+		return
+	}
+	year.Id = int(id)
+
+	audit.Record(h.db, r, audit.ActionCreate, "academic_years", year.Id, nil, year)
+	writeCreated(w, year)
+}
+
+func (h *AcademicYearsHandler) GetTermsHandler(w http.ResponseWriter, r *http.Request) {
+	year, _, ok := h.loadAcademicYear(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query("SELECT id, academic_year_id, name, start_date, end_date FROM terms WHERE academic_year_id = ? ORDER BY start_date", year.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the terms", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	terms := make([]models.Term, 0)
+	for rows.Next() {
+		var term models.Term
+		err = rows.Scan(&term.Id, &term.AcademicYearId, &term.Name, &term.StartDate, &term.EndDate)
+		if err != nil {
+			log.Println("Scan error:", err)
+			http.Error(w, "Error retrieving the terms", http.StatusInternalServerError)
+			return
+		}
+		terms = append(terms, term)
+	}
+
+	writeList(w, r, terms)
+}
+
+// CreateTermHandler adds a term, which has to fall within its academic year
+func (h *AcademicYearsHandler) CreateTermHandler(w http.ResponseWriter, r *http.Request) {
+	if !academicYearsAccess.allow(w, r) {
+		return
+	}
+	year, schoolId, ok := h.loadAcademicYear(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var term models.Term
+	err := json.NewDecoder(r.Body).Decode(&term)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	term.AcademicYearId = year.Id
+	term.Name = strings.TrimSpace(term.Name)
+	if term.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateDateRange(term.StartDate, term.EndDate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Dates are YYYY-MM-DD, so they compare correctly as strings
+	if term.StartDate < year.StartDate || term.EndDate > year.EndDate {
+		http.Error(w, "The term must fall within its academic year", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.db.Exec("INSERT INTO terms(school_id, academic_year_id, name, start_date, end_date) VALUES(?,?,?,?,?)",
+		schoolId, term.AcademicYearId, term.Name, term.StartDate, term.EndDate,
+	)
+	if isDuplicateEntry(err) {
+		http.Error(w, "A term with that name already exists in the academic year", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the term", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error creating the term", http.StatusInternalServerError)
+		return
+	}
+	term.Id = int(id)
+
+	audit.Record(h.db, r, audit.ActionCreate, "terms", term.Id, nil, term)
+	writeCreated(w, term)
+}
+
+func (h *AcademicYearsHandler) GetSectionsHandler(w http.ResponseWriter, r *http.Request) {
+	year, _, ok := h.loadAcademicYear(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query("SELECT id, academic_year_id, name, COALESCE(next_class, '') FROM class_sections WHERE academic_year_id = ? ORDER BY name", year.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the class sections", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sections := make([]models.ClassSection, 0)
+	for rows.Next() {
+		var section models.ClassSection
+		err = rows.Scan(&section.Id, &section.AcademicYearId, &section.Name, &section.NextClass)
+		if err != nil {
+			log.Println("Scan error:", err)
+			http.Error(w, "Error retrieving the class sections", http.StatusInternalServerError)
+			return
+		}
+		sections = append(sections, section)
+	}
+
+	writeList(w, r, sections)
+}
+
+// CreateSectionHandler adds a class section to an academic year
+func (h *AcademicYearsHandler) CreateSectionHandler(w http.ResponseWriter, r *http.Request) {
+	if !academicYearsAccess.allow(w, r) {
+		return
+	}
+	year, schoolId, ok := h.loadAcademicYear(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var section models.ClassSection
+	err := json.NewDecoder(r.Body).Decode(&section)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	section.AcademicYearId = year.Id
+	section.Name = strings.TrimSpace(section.Name)
+	section.NextClass = strings.TrimSpace(section.NextClass)
+	if section.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	var nextClass any
+	if section.NextClass != "" {
+		nextClass = section.NextClass
+	}
+	res, err := h.db.Exec("INSERT INTO class_sections(school_id, academic_year_id, name, next_class) VALUES(?,?,?,?)",
+		schoolId, section.AcademicYearId, section.Name, nextClass,
+	)
+	if isDuplicateEntry(err) {
+		http.Error(w, "That class already exists in the academic year", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the class section", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error creating the class section", http.StatusInternalServerError)
+		return
+	}
+	section.Id = int(id)
+
+	audit.Record(h.db, r, audit.ActionCreate, "class_sections", section.Id, nil, section)
+	writeCreated(w, section)
+}
+
+// PromoteClassHandler moves every student of a class into the next academic year.
+// Students go to the section's next class unless they are held back, which keeps their class, or graduate, which
+// happens to everyone in a final year class. Each student's enrollment in the old year is archived with its outcome
+// and an active enrollment is opened in the new year. With dry_run the moves are only previewed
+func (h *AcademicYearsHandler) PromoteClassHandler(w http.ResponseWriter, r *http.Request) {
+	if !academicYearsAccess.allow(w, r) {
+		return
+	}
+	fromYear, schoolId, ok := h.loadAcademicYear(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var req models.PromotionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Class = strings.TrimSpace(req.Class)
+	if req.Class == "" || req.ToYearId == 0 {
+		http.Error(w, "class and to_year_id are required", http.StatusBadRequest)
+		return
+	}
+
+	toYear, toSchoolId, ok := h.loadAcademicYear(w, r, strconv.Itoa(req.ToYearId))
+	if !ok {
+		return
+	}
+	if toSchoolId != schoolId || toYear.StartDate <= fromYear.StartDate {
+		http.Error(w, "to_year_id must be a later academic year of the same school", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.runPromotion(r, schoolId, fromYear, toYear, req)
+	var promotionErr promotionError
+	if errors.As(err, &promotionErr) {
+		http.Error(w, promotionErr.message, promotionErr.status)
+		return
+	} else if err != nil {
+		log.Println("Promotion error:", err)
+		http.Error(w, "Error promoting the class, no students were moved", http.StatusInternalServerError)
+		return
+	}
+
+	if !req.DryRun {
+		audit.Record(h.db, r, audit.ActionPromote, "academic_years", fromYear.Id, nil, result)
+		for _, move := range result.Moves {
+			toClass := move.ToClass
+			if move.Outcome == outcomeGraduated {
+				toClass = graduatedClass
+			}
+			if toClass != move.FromClass {
+				before := models.Student{Id: move.StudentId, FirstName: move.FirstName, LastName: move.LastName, Class: move.FromClass}
+				after := before
+				after.Class = toClass
+				webhooks.NotifyChange(h.db, schoolId, "student.class_changed", before, after)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// runPromotion plans the moves and, unless it is a dry run, applies them in a single transaction
+func (h *AcademicYearsHandler) runPromotion(r *http.Request, schoolId int, fromYear, toYear models.AcademicYear, req models.PromotionRequest) (models.PromotionResult, error) {
+	result := models.PromotionResult{
+		Status:     "completed",
+		Class:      req.Class,
+		FromYearId: fromYear.Id,
+		ToYearId:   toYear.Id,
+		DryRun:     req.DryRun,
+		Moves:      make([]models.PromotionMove, 0),
+	}
+	if req.DryRun {
+		result.Status = "preview"
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	var nextClass sql.NullString
+	err = tx.QueryRow("SELECT next_class FROM class_sections WHERE academic_year_id = ? AND name = ?", fromYear.Id, req.Class).Scan(&nextClass)
+	if err == sql.ErrNoRows {
+		return result, promotionError{http.StatusNotFound, fmt.Sprintf("class %q is not a section of academic year %q", req.Class, fromYear.Name)}
+	} else if err != nil {
+		return result, err
+	}
+
+	rows, err := tx.Query("SELECT id, first_name, last_name FROM students WHERE school_id = ? AND class = ? AND "+notDeleted+" ORDER BY last_name, first_name FOR UPDATE", schoolId, req.Class)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		move := models.PromotionMove{FromClass: req.Class}
+		err = rows.Scan(&move.StudentId, &move.FirstName, &move.LastName)
+		if err != nil {
+			rows.Close()
+			return result, err
+		}
+		result.Moves = append(result.Moves, move)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return result, err
+	}
+
+	inClass := make(map[int]bool, len(result.Moves))
+	for _, move := range result.Moves {
+		inClass[move.StudentId] = true
+	}
+	holdBack, err := exceptionSet(req.HoldBack, inClass, "hold_back")
+	if err != nil {
+		return result, err
+	}
+	graduate, err := exceptionSet(req.Graduate, inClass, "graduate")
+	if err != nil {
+		return result, err
+	}
+	for id := range holdBack {
+		if graduate[id] {
+			return result, promotionError{http.StatusBadRequest, fmt.Sprintf("student %d cannot be both held back and graduated", id)}
+		}
+	}
+
+	// Decide every student's outcome and make sure the classes they move into exist in the new year
+	targets := make(map[string]bool)
+	for i := range result.Moves {
+		move := &result.Moves[i]
+		switch {
+		case holdBack[move.StudentId]:
+			move.Outcome, move.ToClass = outcomeHeldBack, req.Class
+			result.HeldBack++
+		case graduate[move.StudentId] || !nextClass.Valid:
+			move.Outcome = outcomeGraduated
+			result.Graduated++
+			continue
+		default:
+			move.Outcome, move.ToClass = outcomePromoted, nextClass.String
+			result.Promoted++
+		}
+		targets[move.ToClass] = true
+	}
+
+	missing := make([]string, 0)
+	for class := range targets {
+		var exists int
+		err = tx.QueryRow("SELECT 1 FROM class_sections WHERE academic_year_id = ? AND name = ?", toYear.Id, class).Scan(&exists)
+		if err == sql.ErrNoRows {
+			missing = append(missing, class)
+		} else if err != nil {
+			return result, err
+		}
+	}
+	if len(missing) > 0 {
+		return result, promotionError{http.StatusUnprocessableEntity, fmt.Sprintf("academic year %q has no section for %s", toYear.Name, strings.Join(missing, ", "))}
+	}
+
+	if len(result.Moves) > 0 {
+		args := []any{toYear.Id}
+		for _, move := range result.Moves {
+			args = append(args, move.StudentId)
+		}
+		var enrolled int
+		err = tx.QueryRow("SELECT COUNT(*) FROM enrollments WHERE academic_year_id = ? AND student_id IN (?"+strings.Repeat(",?", len(result.Moves)-1)+")", args...).Scan(&enrolled)
+		if err != nil {
+			return result, err
+		}
+		if enrolled > 0 {
+			return result, promotionError{http.StatusConflict, fmt.Sprintf("%d students of the class are already enrolled in %q", enrolled, toYear.Name)}
+		}
+	}
+
+	if req.DryRun {
+		return result, nil
+	}
+
+	username := contextUsername(r)
+	for _, move := range result.Moves {
+		_, err = tx.Exec(`INSERT INTO enrollments(school_id, student_id, academic_year_id, class, status, archived_at) VALUES(?,?,?,?,?,CURRENT_TIMESTAMP)
+			ON DUPLICATE KEY UPDATE status = VALUES(status), archived_at = CURRENT_TIMESTAMP`,
+			schoolId, move.StudentId, fromYear.Id, move.FromClass, move.Outcome,
+		)
+		if err != nil {
+			return result, err
+		}
+
+		toClass := move.ToClass
+		if move.Outcome == outcomeGraduated {
+			toClass = graduatedClass
+		} else {
+			_, err = tx.Exec("INSERT INTO enrollments(school_id, student_id, academic_year_id, class, status) VALUES(?,?,?,?,?)",
+				schoolId, move.StudentId, toYear.Id, toClass, enrollmentActive,
+			)
+			if err != nil {
+				return result, err
+			}
+		}
+
+		if toClass != move.FromClass {
+			_, err = tx.Exec("UPDATE students SET class = ?, version = version + 1, updated_by = ? WHERE id = ?", toClass, username, move.StudentId)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+// exceptionSet turns a list of student IDs into a set, rejecting students that are not in the class
+func exceptionSet(ids []int, inClass map[int]bool, field string) (map[int]bool, error) {
+	set := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if !inClass[id] {
+			return nil, promotionError{http.StatusBadRequest, fmt.Sprintf("%s: student %d is not in the class", field, id)}
+		}
+		set[id] = true
+	}
+	return set, nil
+}
+
+// loadAcademicYear reads an academic year of the current school along with the school it belongs to,
+// writing the error response itself when it cannot
+func (h *AcademicYearsHandler) loadAcademicYear(w http.ResponseWriter, r *http.Request, idStr string) (models.AcademicYear, int, bool) {
+	var year models.AcademicYear
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid academic year ID", http.StatusBadRequest)
+		return year, 0, false
+	}
+
+	var schoolId int
+	tenant, tenantArgs := tenantCondition(r)
+	err = h.db.QueryRow("SELECT id, name, start_date, end_date, is_current, school_id FROM academic_years WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...).Scan(
+		&year.Id, &year.Name, &year.StartDate, &year.EndDate, &year.IsCurrent, &schoolId,
+	)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Academic year with that ID does not exist", http.StatusNotFound)
+		return year, 0, false
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return year, 0, false
+	}
+	return year, schoolId, true
+}
+
+// validateDateRange checks two YYYY-MM-DD dates and that the range is not reversed
+func validateDateRange(start, end string) error {
+	startDate, err := time.Parse(dateLayout, start)
+	if err != nil {
+		return errors.New("start_date must be a YYYY-MM-DD date")
+	}
+	endDate, err := time.Parse(dateLayout, end)
+	if err != nil {
+		return errors.New("end_date must be a YYYY-MM-DD date")
+	}
+	if endDate.Before(startDate) {
+		return errors.New("end_date cannot be before start_date")
+	}
+	return nil
+}
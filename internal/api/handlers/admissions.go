@@ -0,0 +1,816 @@
+package handlers
+
+import (
+	"ClassConnect/internal/admissions"
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/jobs"
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxApplicationGuardians is how many guardians an application may name
+const maxApplicationGuardians = 4
+
+// applicationListColumns whitelists the application fields the list may filter, sort and select on
+var applicationListColumns = map[string]listColumn{
+	"id":               {column: "a.id", numeric: true},
+	"reference":        {column: "a.reference"},
+	"status":           {column: "a.status"},
+	"last_name":        {column: "a.last_name"},
+	"class":            {column: "a.class"},
+	"academic_year_id": {column: "a.academic_year_id", numeric: true},
+	"assigned_to":      {column: "a.assigned_to", numeric: true},
+	"submitted_at":     {column: "a.submitted_at"},
+	"updated_at":       {column: "a.updated_at"},
+}
+
+type AdmissionsHandler struct {
+	db *sql.DB
+}
+
+func NewAdmissionsHandler(db *sql.DB) *AdmissionsHandler {
+	return &AdmissionsHandler{db: db}
+}
+
+// SubmitApplicationHandler receives an application from the public, either as JSON or as a multipart form with the
+// application's JSON in the "application" field and its documents in file fields named after their kind
+func (h *AdmissionsHandler) SubmitApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var application models.Application
+	var uploads []admissions.Upload
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		r.Body = http.MaxBytesReader(w, r.Body, admissions.MaxUploadSize)
+		err := r.ParseMultipartForm(8 << 20)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid upload, expected a multipart form of at most %dMB", admissions.MaxUploadSize>>20), http.StatusBadRequest)
+			return
+		}
+		err = json.Unmarshal([]byte(r.FormValue("application")), &application)
+		if err != nil {
+			http.Error(w, "The application field must hold the application as JSON", http.StatusBadRequest)
+			return
+		}
+		uploads, err = admissions.ReadUploads(r.MultipartForm)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		err := json.NewDecoder(r.Body).Decode(&application)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if len(uploads) > admissions.MaxDocuments {
+		http.Error(w, fmt.Sprintf("An application holds at most %d documents", admissions.MaxDocuments), http.StatusBadRequest)
+		return
+	}
+	err := h.validateApplication(schoolId, &application)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	application.Reference, err = admissions.NewReference()
+	if err != nil {
+		http.Error(w, "Error submitting the application", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error submitting the application", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	academicYear := sql.NullInt64{Int64: int64(application.AcademicYearId), Valid: application.AcademicYearId != 0}
+	res, err := tx.Exec(`INSERT INTO admission_applications(school_id, reference, status, first_name, last_name, date_of_birth, email, class, academic_year_id, previous_school)
+		VALUES(?,?,?,?,?,?,?,?,?,?)`,
+		schoolId, application.Reference, admissions.StatusSubmitted, application.FirstName, application.LastName, application.DateOfBirth, application.Email,
+		application.Class, academicYear, application.PreviousSchool,
+	)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error submitting the application", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	for _, guardian := range application.Guardians {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT INTO admission_guardians(application_id, first_name, last_name, email, phone, relationship) VALUES(?,?,?,?,?,?)",
+			id, guardian.FirstName, guardian.LastName, guardian.Email, guardian.Phone, guardian.Relationship,
+		)
+	}
+	if err == nil {
+		err = insertDocuments(tx, int(id), uploads)
+	}
+	if err == nil {
+		_, err = tx.Exec("INSERT INTO admission_stages(application_id, to_status, changed_by) VALUES(?,?,?)", id, admissions.StatusSubmitted, "applicant")
+	}
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error submitting the application", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error submitting the application", http.StatusInternalServerError)
+		return
+	}
+
+	submitted, err := admissions.LoadDetail(h.db, int(id))
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error submitting the application", http.StatusInternalServerError)
+		return
+	}
+	subject, body := admissions.SubmittedEmail(submitted, h.schoolName(schoolId))
+	h.notifyApplicant(schoolId, submitted, subject, body)
+
+	audit.RecordAs(h.db, r, audit.Actor{}, audit.ActionCreate, "admission_applications", submitted.Id, nil, submitted)
+	writeCreated(w, admissions.Receipt(submitted))
+}
+
+// GetApplicationStatusHandler lets applicants follow their application by its reference
+func (h *AdmissionsHandler) GetApplicationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	application, ok := h.loadByReference(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(admissions.Receipt(application))
+}
+
+// UploadDocumentsHandler lets applicants send further documents, as a multipart form of file fields named after the
+// kind of their documents, until the application is accepted or rejected
+func (h *AdmissionsHandler) UploadDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	application, ok := h.loadByReference(w, r)
+	if !ok {
+		return
+	}
+	if !admissions.Open(application.Status) {
+		http.Error(w, "The application is "+application.Status+" and no longer takes documents", http.StatusConflict)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, admissions.MaxUploadSize)
+	err := r.ParseMultipartForm(8 << 20)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid upload, expected a multipart form of at most %dMB", admissions.MaxUploadSize>>20), http.StatusBadRequest)
+		return
+	}
+	uploads, err := admissions.ReadUploads(r.MultipartForm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(uploads) == 0 {
+		http.Error(w, "At least one document is required", http.StatusBadRequest)
+		return
+	}
+	if len(application.Documents)+len(uploads) > admissions.MaxDocuments {
+		http.Error(w, fmt.Sprintf("An application holds at most %d documents, it has %d", admissions.MaxDocuments, len(application.Documents)), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error saving the documents", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	err = insertDocuments(tx, application.Id, uploads)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error saving the documents", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := admissions.LoadDetail(h.db, application.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error saving the documents", http.StatusInternalServerError)
+		return
+	}
+	audit.RecordAs(h.db, r, audit.Actor{}, audit.ActionUpdate, "admission_applications", application.Id,
+		map[string]any{"documents": application.Documents}, map[string]any{"documents": updated.Documents},
+	)
+	writeCreated(w, admissions.Receipt(updated))
+}
+
+// GetApplicationsHandler lists the applications of the school, newest first, filtered by ?year=, ?assigned= (an exec
+// ID, "me" or "none") and the fields of applicationListColumns. Reviewers outside the admissions staff only see those
+// assigned to them
+func (h *AdmissionsHandler) GetApplicationsHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListQuery(listValues(r.URL.Query(), "year", "assigned"), applicationListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("-submitted_at", applicationListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	applyTenantScopeOn(r, &params, "a.school_id")
+	if year := r.URL.Query().Get("year"); year != "" {
+		params.addScope("a.academic_year_id = ?", year)
+	}
+
+	assigned := r.URL.Query().Get("assigned")
+	if !isAdmissionsStaff(r) {
+		assigned = "me"
+	}
+	switch assigned {
+	case "":
+	case "none":
+		params.addScope("a.assigned_to IS NULL")
+	case "me":
+		params.addScope("a.assigned_to = ?", contextUserId(r))
+	default:
+		if _, err := strconv.Atoi(assigned); err != nil {
+			http.Error(w, "assigned must be an exec ID, me or none", http.StatusBadRequest)
+			return
+		}
+		params.addScope("a.assigned_to = ?", assigned)
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, admissions.Tables, admissions.Columns, params, pageParams, func(row rowScanner) (models.Application, error) {
+		return admissions.Scan(row)
+	})
+	if err == nil {
+		err = admissions.LoadDetails(h.db, result.records)
+	}
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the applications", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// GetApplicationHandler returns an application with its guardians, documents, notes and history
+func (h *AdmissionsHandler) GetApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	application, _, ok := h.loadApplication(w, r, true)
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, "", application)
+}
+
+// SetStatusHandler moves an application to another stage, {status, reason}, and tells the applicant
+func (h *AdmissionsHandler) SetStatusHandler(w http.ResponseWriter, r *http.Request) {
+	before, schoolId, ok := h.loadApplication(w, r, false)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+	if !slices.Contains(admissions.Statuses, request.Status) {
+		http.Error(w, "status must be one of "+strings.Join(admissions.Statuses, ", "), http.StatusBadRequest)
+		return
+	}
+	if len(request.Reason) > 500 {
+		http.Error(w, "reason must be at most 500 characters", http.StatusBadRequest)
+		return
+	}
+	if !admissions.CanMove(before.Status, request.Status) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":   fmt.Sprintf("An application that is %s cannot become %s", before.Status, request.Status),
+			"allowed": admissions.Next(before.Status),
+		})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error updating the application", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Matching the current status keeps two reviewers from moving the application at once
+	res, err := tx.Exec("UPDATE admission_applications SET status = ? WHERE id = ? AND status = ?", request.Status, before.Id, before.Status)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error updating the application", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		http.Error(w, "The application was moved by someone else, reload it and try again", http.StatusConflict)
+		return
+	}
+	_, err = tx.Exec("INSERT INTO admission_stages(application_id, from_status, to_status, reason, changed_by) VALUES(?,?,?,?,?)",
+		before.Id, before.Status, request.Status, request.Reason, contextUsername(r),
+	)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error updating the application", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := admissions.LoadDetail(h.db, before.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error updating the application", http.StatusInternalServerError)
+		return
+	}
+	subject, body := admissions.StatusEmail(updated, h.schoolName(schoolId))
+	h.notifyApplicant(schoolId, updated, subject, body)
+
+	audit.Record(h.db, r, audit.ActionUpdate, "admission_applications", updated.Id, map[string]any{"status": before.Status}, map[string]any{"status": updated.Status, "reason": request.Reason})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// SetAssigneeHandler assigns an application to a reviewer, {exec_id}, or unassigns it with 0. The reviewer is emailed
+func (h *AdmissionsHandler) SetAssigneeHandler(w http.ResponseWriter, r *http.Request) {
+	before, schoolId, ok := h.loadApplication(w, r, false)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		ExecId int `json:"exec_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var reviewerEmail string
+	if request.ExecId != 0 {
+		var role string
+		var inactive bool
+		err = h.db.QueryRow("SELECT email, role, inactive_status FROM execs WHERE id = ? AND school_id = ? AND "+notDeleted, request.ExecId, schoolId).Scan(&reviewerEmail, &role, &inactive)
+		if err == sql.ErrNoRows || (err == nil && (role == utils.GuardianRole || inactive)) {
+			http.Error(w, "exec_id must be an active staff account of the school", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	assignee := sql.NullInt64{Int64: int64(request.ExecId), Valid: request.ExecId != 0}
+	_, err = h.db.Exec("UPDATE admission_applications SET assigned_to = ? WHERE id = ?", assignee, before.Id)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error assigning the application", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := admissions.LoadDetail(h.db, before.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error assigning the application", http.StatusInternalServerError)
+		return
+	}
+	if reviewerEmail != "" && request.ExecId != before.AssignedTo {
+		body := fmt.Sprintf("%s assigned you the application %s of %s %s for %s.\n", contextUsername(r), updated.Reference, updated.FirstName, updated.LastName, updated.Class)
+		_, err = jobs.Enqueue(h.db, schoolId, jobSendEmail, emailPayload{To: reviewerEmail, Subject: "Application " + updated.Reference + " assigned to you", Body: body}, contextUsername(r))
+		if err != nil {
+			log.Println("Email job error:", err)
+		}
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "admission_applications", updated.Id, map[string]any{"assigned_to": before.AssignedTo}, map[string]any{"assigned_to": updated.AssignedTo})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// CreateNoteHandler adds a reviewer note to an application, {body}. Assigned reviewers may add notes too
+func (h *AdmissionsHandler) CreateNoteHandler(w http.ResponseWriter, r *http.Request) {
+	application, _, ok := h.loadApplication(w, r, true)
+	if !ok {
+		return
+	}
+
+	var note models.ApplicationNote
+	err := json.NewDecoder(r.Body).Decode(&note)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	note.Body = strings.TrimSpace(note.Body)
+	if note.Body == "" || len(note.Body) > 2000 {
+		http.Error(w, "body is required and must be at most 2000 characters", http.StatusBadRequest)
+		return
+	}
+	note.Author = contextUsername(r)
+
+	res, err := h.db.Exec("INSERT INTO admission_notes(application_id, author, body) VALUES(?,?,?)", application.Id, note.Author, note.Body)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error adding the note", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error adding the note", http.StatusInternalServerError)
+		return
+	}
+	note.Id = int(id)
+	note.CreatedAt = time.Now().UTC().Format(time.DateTime)
+
+	audit.Record(h.db, r, audit.ActionCreate, "admission_notes", note.Id, nil, note)
+	writeCreated(w, note)
+}
+
+// DownloadDocumentHandler sends a document of an application as it was uploaded
+func (h *AdmissionsHandler) DownloadDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	application, _, ok := h.loadApplication(w, r, true)
+	if !ok {
+		return
+	}
+	documentId, err := strconv.Atoi(r.PathValue("documentId"))
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	var filename, contentType string
+	var content []byte
+	err = h.db.QueryRow("SELECT filename, content_type, content FROM admission_documents WHERE id = ? AND application_id = ?", documentId, application.Id).Scan(&filename, &contentType, &content)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Document with that ID does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Write(content)
+}
+
+// ConvertApplicationHandler turns an accepted application into a student of the school, enrolled in the application's
+// academic year, and links its guardians. Guardians are matched to guardian accounts by email, and accounts are
+// created for the others, who are emailed a link to set their password
+func (h *AdmissionsHandler) ConvertApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	application, schoolId, ok := h.loadApplication(w, r, false)
+	if !ok {
+		return
+	}
+	if application.StudentId != 0 {
+		http.Error(w, fmt.Sprintf("The application was already converted into student %d", application.StudentId), http.StatusConflict)
+		return
+	}
+	if application.Status != admissions.StatusAccepted {
+		http.Error(w, "Only accepted applications can be converted, this one is "+application.Status, http.StatusConflict)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error converting the application", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	student := models.Student{FirstName: application.FirstName, LastName: application.LastName, Email: application.Email, Class: application.Class}
+	res, err := tx.Exec("INSERT INTO students(first_name, last_name, email, class, updated_by, school_id) VALUES(?,?,?,?,?,?)",
+		student.FirstName, student.LastName, student.Email, student.Class, contextUsername(r), schoolId,
+	)
+	if isDuplicateEntry(err) {
+		http.Error(w, "A student of the school already has the email "+student.Email, http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error converting the application", http.StatusInternalServerError)
+		return
+	}
+	studentId, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error converting the application", http.StatusInternalServerError)
+		return
+	}
+	student.Id = int(studentId)
+	student.Version = 1
+
+	if application.AcademicYearId != 0 {
+		_, err = tx.Exec("INSERT INTO enrollments(school_id, student_id, academic_year_id, class, status) VALUES(?,?,?,?,?)",
+			schoolId, student.Id, application.AcademicYearId, student.Class, enrollmentActive,
+		)
+		if err != nil {
+			log.Println("Insert error:", err)
+			http.Error(w, "Error converting the application", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	type invitation struct {
+		execId int
+		email  string
+		token  string
+	}
+	invitations := make([]invitation, 0)
+	linked := make(map[string]bool)
+	for i, guardian := range application.Guardians {
+		email := strings.ToLower(guardian.Email)
+		if linked[email] {
+			continue
+		}
+		linked[email] = true
+
+		var execId, execSchool int
+		var role string
+		var deleted bool
+		err = tx.QueryRow("SELECT id, school_id, role, deleted_at IS NOT NULL FROM execs WHERE email = ?", guardian.Email).Scan(&execId, &execSchool, &role, &deleted)
+		if err == nil && (execSchool != schoolId || role != utils.GuardianRole || deleted) {
+			http.Error(w, fmt.Sprintf("guardian %d: %s belongs to an account that is not a guardian of the school", i, guardian.Email), http.StatusConflict)
+			return
+		} else if err == sql.ErrNoRows {
+			var token string
+			execId, token, err = createGuardianAccount(tx, schoolId, guardian, contextUsername(r))
+			if isDuplicateEntry(err) {
+				http.Error(w, fmt.Sprintf("guardian %d: the username %s is taken by another account", i, guardian.Email), http.StatusConflict)
+				return
+			}
+			invitations = append(invitations, invitation{execId: execId, email: guardian.Email, token: token})
+		}
+		if err == nil {
+			_, err = tx.Exec("INSERT INTO student_guardians(student_id, exec_id, school_id, relationship) VALUES(?,?,?,?)", student.Id, execId, schoolId, guardian.Relationship)
+		}
+		if err != nil {
+			log.Println("Insert error:", err)
+			http.Error(w, "Error converting the application", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	res, err = tx.Exec("UPDATE admission_applications SET student_id = ?, converted_at = NOW(), converted_by = ? WHERE id = ? AND student_id IS NULL", student.Id, contextUsername(r), application.Id)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error converting the application", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		http.Error(w, "The application is being converted by another request", http.StatusConflict)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error converting the application", http.StatusInternalServerError)
+		return
+	}
+
+	admission := models.Admission{Student: student, Invited: make([]string, 0, len(invitations))}
+	for _, invite := range invitations {
+		resetURL := fmt.Sprintf("http://localhost:3000/execs/resetPassword/%s", invite.token)
+		body := fmt.Sprintf("A guardian account was created for you at %s with the username %s.\n\nChoose your password using the following link:\n%s\n",
+			h.schoolName(schoolId), invite.email, resetURL)
+		_, err = jobs.Enqueue(h.db, schoolId, jobSendEmail, emailPayload{To: invite.email, Subject: "Your guardian account", Body: body}, contextUsername(r))
+		if err != nil {
+			log.Println("Email job error:", err)
+		}
+		audit.Record(h.db, r, audit.ActionCreate, "execs", invite.execId, nil, map[string]any{"email": invite.email, "role": utils.GuardianRole})
+		admission.Invited = append(admission.Invited, invite.email)
+	}
+	recordChange(h.db, r, audit.ActionCreate, "students", student.Id, nil, student)
+
+	admission.Guardians, err = studentGuardians(h.db, student.Id)
+	if err == nil {
+		admission.Application, err = admissions.LoadDetail(h.db, application.Id)
+	}
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error converting the application", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionUpdate, "student_guardians", student.Id, nil, admission.Guardians)
+	audit.Record(h.db, r, audit.ActionUpdate, "admission_applications", application.Id, map[string]any{"student_id": nil}, map[string]any{"student_id": student.Id})
+	writeCreated(w, admission)
+}
+
+// loadApplication reads the application of the path's {id} within the current school with its notes and history and
+// returns it with its school. Admissions staff may act on any application, other staff only read and annotate those
+// assigned to them when reviewers is set. The error response is written when it returns false
+func (h *AdmissionsHandler) loadApplication(w http.ResponseWriter, r *http.Request, reviewers bool) (models.Application, int, bool) {
+	staff := isAdmissionsStaff(r)
+	if !staff && !reviewers {
+		http.Error(w, "Only admins, managers and admissions staff may manage applications", http.StatusForbidden)
+		return models.Application{}, 0, false
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid application ID", http.StatusBadRequest)
+		return models.Application{}, 0, false
+	}
+
+	var schoolId int
+	tenant, tenantArgs := tenantCondition(r)
+	err = h.db.QueryRow("SELECT school_id FROM admission_applications WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...).Scan(&schoolId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Application with that ID does not exist", http.StatusNotFound)
+		return models.Application{}, 0, false
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return models.Application{}, 0, false
+	}
+
+	application, err := admissions.LoadDetail(h.db, id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return application, 0, false
+	}
+	if !staff && strconv.Itoa(application.AssignedTo) != contextUserId(r) {
+		http.Error(w, "The application is not assigned to you", http.StatusForbidden)
+		return application, 0, false
+	}
+	return application, schoolId, true
+}
+
+// loadByReference reads the application of the path's {reference} within the school the request names, writing a
+// 404 for references of other schools so that they cannot be probed
+func (h *AdmissionsHandler) loadByReference(w http.ResponseWriter, r *http.Request) (models.Application, bool) {
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return models.Application{}, false
+	}
+	applications, err := admissions.Load(h.db, "a.reference = ? AND a.school_id = ?", admissions.NormalizeReference(r.PathValue("reference")), schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return models.Application{}, false
+	}
+	if len(applications) == 0 {
+		http.Error(w, "No application has that reference", http.StatusNotFound)
+		return models.Application{}, false
+	}
+	return applications[0], true
+}
+
+// validateApplication checks and normalizes an application submitted to a school
+func (h *AdmissionsHandler) validateApplication(schoolId int, application *models.Application) error {
+	application.FirstName = strings.TrimSpace(application.FirstName)
+	application.LastName = strings.TrimSpace(application.LastName)
+	application.Email = strings.TrimSpace(application.Email)
+	application.Class = strings.TrimSpace(application.Class)
+	application.PreviousSchool = strings.TrimSpace(application.PreviousSchool)
+	if application.FirstName == "" || application.LastName == "" || application.Class == "" {
+		return errors.New("first_name, last_name and class are required")
+	}
+	if !strings.Contains(application.Email, "@") {
+		return errors.New("email must be the student's email address")
+	}
+	for _, field := range []string{application.FirstName, application.LastName, application.Email, application.Class, application.PreviousSchool} {
+		if len(field) > 255 {
+			return errors.New("fields must be at most 255 characters")
+		}
+	}
+	birth, err := time.Parse(time.DateOnly, application.DateOfBirth)
+	if err != nil || birth.After(time.Now()) {
+		return errors.New("date_of_birth must be a YYYY-MM-DD date in the past")
+	}
+
+	if len(application.Guardians) == 0 || len(application.Guardians) > maxApplicationGuardians {
+		return fmt.Errorf("between 1 and %d guardians are required, the first one is contacted about the application", maxApplicationGuardians)
+	}
+	for i := range application.Guardians {
+		guardian := &application.Guardians[i]
+		guardian.FirstName = strings.TrimSpace(guardian.FirstName)
+		guardian.LastName = strings.TrimSpace(guardian.LastName)
+		guardian.Email = strings.TrimSpace(guardian.Email)
+		guardian.Phone = strings.TrimSpace(guardian.Phone)
+		guardian.Relationship = strings.TrimSpace(guardian.Relationship)
+		if guardian.FirstName == "" || guardian.LastName == "" || !strings.Contains(guardian.Email, "@") {
+			return fmt.Errorf("guardian %d: first_name, last_name and email are required", i)
+		}
+		if len(guardian.FirstName) > 255 || len(guardian.LastName) > 255 || len(guardian.Email) > 255 || len(guardian.Phone) > 50 || len(guardian.Relationship) > 50 {
+			return fmt.Errorf("guardian %d: names and email must be at most 255 characters, phone and relationship 50", i)
+		}
+	}
+
+	if application.AcademicYearId != 0 {
+		var exists int
+		err = h.db.QueryRow("SELECT COUNT(*) FROM academic_years WHERE id = ? AND school_id = ?", application.AcademicYearId, schoolId).Scan(&exists)
+		if err != nil {
+			log.Println("Query error:", err)
+			return errors.New("unable to check the academic year, try again")
+		}
+		if exists == 0 {
+			return errors.New("academic_year_id must be an academic year of the school")
+		}
+	}
+	return nil
+}
+
+// notifyApplicant emails the first guardian of an application
+func (h *AdmissionsHandler) notifyApplicant(schoolId int, application models.Application, subject, body string) {
+	if len(application.Guardians) == 0 {
+		return
+	}
+	_, err := jobs.Enqueue(h.db, schoolId, jobSendEmail, emailPayload{To: application.Guardians[0].Email, Subject: subject, Body: body}, "")
+	if err != nil {
+		log.Println("Email job error:", err)
+	}
+}
+
+func (h *AdmissionsHandler) schoolName(schoolId int) string {
+	var name string
+	err := h.db.QueryRow("SELECT name FROM schools WHERE id = ?", schoolId).Scan(&name)
+	if err != nil {
+		return "The school"
+	}
+	return name
+}
+
+func insertDocuments(tx *sql.Tx, applicationId int, uploads []admissions.Upload) error {
+	for _, upload := range uploads {
+		_, err := tx.Exec("INSERT INTO admission_documents(application_id, kind, filename, content_type, size, content) VALUES(?,?,?,?,?,?)",
+			applicationId, upload.Kind, upload.Filename, upload.ContentType, len(upload.Data), upload.Data,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createGuardianAccount creates the guardian account of a guardian named on an application, with an unusable
+// password and a reset token whose plain value is returned for the invitation email
+func createGuardianAccount(tx *sql.Tx, schoolId int, guardian models.ApplicationGuardian, createdBy string) (int, string, error) {
+	random := make([]byte, 32)
+	_, err := rand.Read(random)
+	if err != nil {
+		return 0, "", err
+	}
+	password, err := utils.HashPassword(hex.EncodeToString(random))
+	if err != nil {
+		return 0, "", err
+	}
+	tokenBytes := make([]byte, 32)
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return 0, "", err
+	}
+	hashedToken := sha256.Sum256(tokenBytes)
+
+	res, err := tx.Exec("INSERT INTO execs(first_name, last_name, email, username, password, password_reset_token, inactive_status, role, updated_by, school_id) VALUES(?,?,?,?,?,?,?,?,?,?)",
+		guardian.FirstName, guardian.LastName, guardian.Email, guardian.Email, password, hex.EncodeToString(hashedToken[:]), false, utils.GuardianRole, createdBy, schoolId,
+	)
+	if err != nil {
+		return 0, "", err
+	}
+	id, err := res.LastInsertId()
+	return int(id), hex.EncodeToString(tokenBytes), err
+}
+
+// isAdmissionsStaff reports whether the caller manages admissions: admins, managers and the admissions role
+func isAdmissionsStaff(r *http.Request) bool {
+	_, err := utils.AuthorizeUser(contextRole(r), "admin", "manager", "admissions")
+	return err == nil
+}
@@ -0,0 +1,601 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/events"
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dbTimeLayout is how DATETIME columns are written and read back, always in UTC
+const dbTimeLayout = "2006-01-02 15:04:05"
+
+// audienceTypes are the selectors an announcement can be addressed with
+var audienceTypes = map[string]bool{"all": true, "role": true, "class": true, "course": true, "user": true}
+
+// announcementListColumns whitelists the announcement fields the lists may filter, sort and select on. Times are
+// compared as the RFC 3339 strings clients see, so cursors taken from a page match the column
+var announcementListColumns = map[string]listColumn{
+	"id":         {column: "a.id", numeric: true},
+	"title":      {column: "a.title"},
+	"publish_at": {column: "DATE_FORMAT(a.publish_at, '%Y-%m-%dT%H:%i:%sZ')"},
+	"created_by": {column: "a.created_by"},
+	"created_at": {column: "a.created_at"},
+}
+
+// announcementColumns are the columns scanAnnouncement scans, read_count counts the receipts
+const announcementColumns = "a.id, a.title, a.body, COALESCE(a.attachments, ''), a.publish_at, COALESCE(a.expire_at, ''), COALESCE(a.created_by, ''), a.created_at, (SELECT COUNT(*) FROM announcement_reads ar WHERE ar.announcement_id = a.id)"
+
+// announcementPublished keeps announcements that are past their publish time and not expired
+const announcementPublished = " AND a.publish_at <= UTC_TIMESTAMP() AND (a.expire_at IS NULL OR a.expire_at > UTC_TIMESTAMP())"
+
+// announcementsAccess guards publishing and deleting announcements and seeing all of them with their receipts
+var announcementsAccess = roleAccess{roles: []string{"admin", "manager"}, denied: "Only admins and managers may manage announcements"}
+
+type AnnouncementsHandler struct {
+	db *sql.DB
+}
+
+func NewAnnouncementsHandler(db *sql.DB) *AnnouncementsHandler {
+	return &AnnouncementsHandler{db: db}
+}
+
+// GetAnnouncementsHandler lists every announcement of the school, including scheduled and expired ones, for admins and managers
+func (h *AnnouncementsHandler) GetAnnouncementsHandler(w http.ResponseWriter, r *http.Request) {
+	if !announcementsAccess.allow(w, r) {
+		return
+	}
+
+	params, err := parseListQuery(r.URL.Query(), announcementListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("-publish_at,-id", announcementListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	applyTenantScopeOn(r, &params, "a.school_id")
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "announcements a", announcementColumns, params, pageParams, scanAnnouncement)
+	if err == nil {
+		err = h.loadAudiences(result.records)
+	}
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the announcements", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// GetFeedHandler lists the published announcements addressed to the caller, newest first, each flagged as read or not.
+// ?unread=true leaves out the ones already read
+func (h *AnnouncementsHandler) GetFeedHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListQuery(listValues(r.URL.Query(), "unread"), announcementListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("-publish_at,-id", announcementListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+
+	unread := false
+	if unreadStr := r.URL.Query().Get("unread"); unreadStr != "" {
+		var err error
+		unread, err = strconv.ParseBool(unreadStr)
+		if err != nil {
+			http.Error(w, "unread must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	match, matchArgs, err := h.audienceMatch(r)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the announcements", http.StatusInternalServerError)
+		return
+	}
+	userId, _ := strconv.Atoi(contextUserId(r))
+
+	params.bindTable(userId)
+	params.addScope(match, matchArgs...)
+	params.addScope(strings.TrimPrefix(announcementPublished, " AND "))
+	applyTenantScopeOn(r, &params, "a.school_id")
+	if unread {
+		params.addScope("r.read_at IS NULL")
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "announcements a LEFT JOIN announcement_reads r ON r.announcement_id = a.id AND r.user_id = ?",
+		announcementColumns+", r.read_at IS NOT NULL", params, pageParams, scanFeedAnnouncement,
+	)
+	if err == nil {
+		err = h.loadAudiences(result.records)
+	}
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the announcements", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// GetAnnouncementByIdHandler returns an announcement to admins and managers, or to callers it is published to
+func (h *AnnouncementsHandler) GetAnnouncementByIdHandler(w http.ResponseWriter, r *http.Request) {
+	announcement, ok := h.loadVisibleAnnouncement(w, r)
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, "", announcement)
+}
+
+// CreateAnnouncementHandler publishes an announcement, right away unless publish_at is in the future
+func (h *AnnouncementsHandler) CreateAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	if !announcementsAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var announcement models.Announcement
+	err := json.NewDecoder(r.Body).Decode(&announcement)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	publishAt, expireAt, err := validateAnnouncement(&announcement)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	announcement.CreatedBy = contextUsername(r)
+
+	attachments, err := json.Marshal(announcement.Attachments)
+	if err != nil {
+		http.Error(w, "Invalid attachments", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error creating the announcement", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Scheduled announcements are announced by the announcements.publish job once their publish time passes
+	announced := announcement.PublishAt <= time.Now().UTC().Format(time.RFC3339)
+	res, err := tx.Exec("INSERT INTO announcements(school_id, title, body, attachments, publish_at, expire_at, created_by, announced) VALUES(?,?,?,?,?,?,?,?)",
+		schoolId, announcement.Title, announcement.Body, string(attachments), publishAt, expireAt, announcement.CreatedBy, announced,
+	)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the announcement", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error creating the announcement", http.StatusInternalServerError)
+		return
+	}
+	announcement.Id = int(id)
+
+	for _, audience := range announcement.Audiences {
+		_, err = tx.Exec("INSERT IGNORE INTO announcement_audiences(announcement_id, type, value) VALUES(?,?,?)", announcement.Id, audience.Type, audience.Value)
+		if err != nil {
+			log.Println("Insert error:", err)
+			http.Error(w, "Error creating the announcement", http.StatusInternalServerError)
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error creating the announcement", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionCreate, "announcements", announcement.Id, nil, announcement)
+	if announced {
+		h.publishEvent(schoolId, announcement)
+	}
+	writeCreated(w, announcement)
+}
+
+// DeleteAnnouncementHandler removes an announcement along with its read receipts
+func (h *AnnouncementsHandler) DeleteAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	if !announcementsAccess.allow(w, r) {
+		return
+	}
+	before, ok := h.loadVisibleAnnouncement(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := h.db.Exec("DELETE FROM announcements WHERE id = ?", before.Id)
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, "Error deleting the announcement", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionDelete, "announcements", before.Id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MarkAnnouncementReadHandler records a read receipt for the caller. Marking an announcement read twice keeps the first receipt
+func (h *AnnouncementsHandler) MarkAnnouncementReadHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(contextUserId(r))
+	if err != nil {
+		http.Error(w, "Read receipts need a logged in user", http.StatusUnauthorized)
+		return
+	}
+	announcement, ok := h.loadVisibleAnnouncement(w, r)
+	if !ok {
+		return
+	}
+
+	_, err = h.db.Exec("INSERT IGNORE INTO announcement_reads(announcement_id, user_id, username) VALUES(?,?,?)", announcement.Id, userId, contextUsername(r))
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error recording the read receipt", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetReadReceiptsHandler lists who has read an announcement, for admins and managers
+func (h *AnnouncementsHandler) GetReadReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	if !announcementsAccess.allow(w, r) {
+		return
+	}
+	announcement, ok := h.loadVisibleAnnouncement(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query("SELECT user_id, username, read_at FROM announcement_reads WHERE announcement_id = ? ORDER BY read_at", announcement.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the read receipts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	receipts := make([]models.ReadReceipt, 0)
+	for rows.Next() {
+		var receipt models.ReadReceipt
+		err = rows.Scan(&receipt.UserId, &receipt.Username, &receipt.ReadAt)
+		if err != nil {
+			log.Println("Scan error:", err)
+			http.Error(w, "Error retrieving the read receipts", http.StatusInternalServerError)
+			return
+		}
+		receipts = append(receipts, receipt)
+	}
+	writeList(w, r, receipts)
+}
+
+// loadVisibleAnnouncement reads the announcement of the path's {id}. Admins and managers see every announcement of their
+// school, everyone else only the published ones addressed to them. It writes the error response itself when it fails
+func (h *AnnouncementsHandler) loadVisibleAnnouncement(w http.ResponseWriter, r *http.Request) (models.Announcement, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid announcement ID", http.StatusBadRequest)
+		return models.Announcement{}, false
+	}
+
+	tenant, tenantArgs := tenantCondition(r)
+	query := "SELECT " + announcementColumns + " FROM announcements a WHERE a.id = ?" + tenant
+	args := append([]any{id}, tenantArgs...)
+	if !announcementsAccess.grants(contextRole(r)) {
+		match, matchArgs, err := h.audienceMatch(r)
+		if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+			return models.Announcement{}, false
+		}
+		query += " AND " + match + announcementPublished
+		args = append(args, matchArgs...)
+	}
+
+	announcements, err := h.queryAnnouncements(query, args...)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return models.Announcement{}, false
+	}
+	if len(announcements) == 0 {
+		http.Error(w, "Announcement with that ID does not exist", http.StatusNotFound)
+		return models.Announcement{}, false
+	}
+	return announcements[0], true
+}
+
+// queryAnnouncements runs a query selecting announcementColumns and loads the audiences
+func (h *AnnouncementsHandler) queryAnnouncements(query string, args ...any) ([]models.Announcement, error) {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	announcements := make([]models.Announcement, 0)
+	for rows.Next() {
+		announcement, err := scanAnnouncement(rows)
+		if err != nil {
+			return nil, err
+		}
+		announcements = append(announcements, announcement)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return announcements, h.loadAudiences(announcements)
+}
+
+// scanAnnouncement reads a row of announcementColumns
+func scanAnnouncement(row rowScanner) (models.Announcement, error) {
+	return scanAnnouncementRow(row, nil)
+}
+
+// scanFeedAnnouncement reads a row of announcementColumns followed by the caller's read flag
+func scanFeedAnnouncement(row rowScanner) (models.Announcement, error) {
+	var read bool
+	return scanAnnouncementRow(row, &read)
+}
+
+func scanAnnouncementRow(row rowScanner, read *bool) (models.Announcement, error) {
+	var announcement models.Announcement
+	var attachments, publishAt, expireAt string
+	dest := []any{&announcement.Id, &announcement.Title, &announcement.Body, &attachments, &publishAt, &expireAt, &announcement.CreatedBy, &announcement.CreatedAt, &announcement.ReadCount}
+	if read != nil {
+		dest = append(dest, read)
+	}
+	err := row.Scan(dest...)
+	if err != nil {
+		return announcement, err
+	}
+
+	announcement.Attachments = make([]models.Attachment, 0)
+	if attachments != "" {
+		err = json.Unmarshal([]byte(attachments), &announcement.Attachments)
+		if err != nil {
+			return announcement, err
+		}
+	}
+	announcement.PublishAt = rfc3339FromDB(publishAt)
+	announcement.ExpireAt = rfc3339FromDB(expireAt)
+	announcement.Audiences = make([]models.Audience, 0)
+	announcement.Read = read
+	return announcement, nil
+}
+
+// loadAudiences fills in the audiences of the announcements
+func (h *AnnouncementsHandler) loadAudiences(announcements []models.Announcement) error {
+	if len(announcements) == 0 {
+		return nil
+	}
+	byId := make(map[int]int, len(announcements))
+	ids := make([]any, 0, len(announcements))
+	for i, announcement := range announcements {
+		byId[announcement.Id] = i
+		ids = append(ids, announcement.Id)
+	}
+	audienceRows, err := h.db.Query("SELECT announcement_id, type, value FROM announcement_audiences WHERE announcement_id IN (?"+strings.Repeat(",?", len(ids)-1)+") ORDER BY type, value", ids...)
+	if err != nil {
+		return err
+	}
+	defer audienceRows.Close()
+	for audienceRows.Next() {
+		var id int
+		var audience models.Audience
+		err = audienceRows.Scan(&id, &audience.Type, &audience.Value)
+		if err != nil {
+			return err
+		}
+		i := byId[id]
+		announcements[i].Audiences = append(announcements[i].Audiences, audience)
+	}
+	return audienceRows.Err()
+}
+
+// audienceMatch builds the condition selecting announcements addressed to the caller: everyone, the caller's role,
+// the caller's exec ID, a class or course the caller teaches, or for guardians the class of one of their children
+func (h *AnnouncementsHandler) audienceMatch(r *http.Request) (string, []any, error) {
+	conditions := []string{"au.type = 'all'", "(au.type = 'role' AND au.value = ?)", "(au.type = 'user' AND au.value = ?)"}
+	args := []any{contextRole(r), contextUserId(r)}
+
+	var classes, subjects []string
+	var err error
+	if contextRole(r) == utils.GuardianRole {
+		classes, err = guardianClasses(h.db, contextUserId(r), contextSchool(r))
+	} else {
+		classes, subjects, err = callerTeaching(h.db, r)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	for _, class := range classes {
+		conditions = append(conditions, "(au.type = 'class' AND au.value = ?)")
+		args = append(args, class)
+	}
+	for _, subject := range subjects {
+		conditions = append(conditions, "(au.type = 'course' AND au.value = ?)")
+		args = append(args, subject)
+	}
+
+	return "EXISTS (SELECT 1 FROM announcement_audiences au WHERE au.announcement_id = a.id AND (" + strings.Join(conditions, " OR ") + "))", args, nil
+}
+
+// publishEvent emits announcement.published. Guardians of the students in an addressed class are added by their user
+// ids, since their subscriptions carry no classes
+func (h *AnnouncementsHandler) publishEvent(schoolId int, announcement models.Announcement) {
+	audience := eventAudience(announcement.Audiences)
+	if len(audience.Classes) > 0 {
+		guardians, err := classGuardianIds(h.db, schoolId, audience.Classes)
+		if err != nil {
+			log.Println("Query error:", err)
+		}
+		audience.UserIds = append(audience.UserIds, guardians...)
+	}
+	events.Publish(events.TypeAnnouncementPublished, schoolId, audience, announcement)
+}
+
+// publishDueAnnouncements announces the scheduled announcements whose publish time has passed. Each one is claimed
+// before its event is emitted so that only one instance announces it
+func publishDueAnnouncements(db *sql.DB) (int, error) {
+	h := NewAnnouncementsHandler(db)
+	rows, err := db.Query("SELECT a.id, a.school_id FROM announcements a WHERE a.announced = FALSE" + announcementPublished)
+	if err != nil {
+		return 0, err
+	}
+	due := make(map[int]int)
+	for rows.Next() {
+		var id, schoolId int
+		err = rows.Scan(&id, &schoolId)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due[id] = schoolId
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for id, schoolId := range due {
+		res, err := db.Exec("UPDATE announcements SET announced = TRUE WHERE id = ? AND announced = FALSE", id)
+		if err != nil {
+			return published, err
+		}
+		if claimed, err := res.RowsAffected(); err != nil || claimed == 0 {
+			continue
+		}
+		announcements, err := h.queryAnnouncements("SELECT "+announcementColumns+" FROM announcements a WHERE a.id = ?", id)
+		if err != nil {
+			return published, err
+		}
+		if len(announcements) == 0 {
+			continue
+		}
+		h.publishEvent(schoolId, announcements[0])
+		published++
+	}
+	return published, nil
+}
+
+// eventAudience converts announcement audiences into the event bus selectors
+func eventAudience(audiences []models.Audience) events.Audience {
+	var audience events.Audience
+	for _, selector := range audiences {
+		switch selector.Type {
+		case "all":
+			audience.All = true
+		case "role":
+			audience.Roles = append(audience.Roles, selector.Value)
+		case "class":
+			audience.Classes = append(audience.Classes, selector.Value)
+		case "course":
+			audience.Courses = append(audience.Courses, selector.Value)
+		case "user":
+			audience.UserIds = append(audience.UserIds, selector.Value)
+		}
+	}
+	return audience
+}
+
+// validateAnnouncement checks the fields of a new announcement and returns its publish and expire times as DATETIME values
+func validateAnnouncement(announcement *models.Announcement) (string, any, error) {
+	announcement.Title = strings.TrimSpace(announcement.Title)
+	if announcement.Title == "" || strings.TrimSpace(announcement.Body) == "" {
+		return "", nil, errors.New("title and body are required")
+	}
+
+	if len(announcement.Audiences) == 0 {
+		return "", nil, errors.New("at least one audience is required")
+	}
+	for i := range announcement.Audiences {
+		audience := &announcement.Audiences[i]
+		audience.Value = strings.TrimSpace(audience.Value)
+		if !audienceTypes[audience.Type] {
+			return "", nil, fmt.Errorf("audience %d: type must be all, role, class, course or user", i)
+		}
+		if audience.Type == "all" {
+			audience.Value = ""
+		} else if audience.Value == "" {
+			return "", nil, fmt.Errorf("audience %d: a value is required for %s", i, audience.Type)
+		}
+		if audience.Type == "user" {
+			if _, err := strconv.Atoi(audience.Value); err != nil {
+				return "", nil, fmt.Errorf("audience %d: user audiences take an exec ID", i)
+			}
+		}
+	}
+
+	var err error
+	announcement.Attachments, err = validateAttachments(announcement.Attachments)
+	if err != nil {
+		return "", nil, err
+	}
+
+	publishAt := time.Now().UTC()
+	if announcement.PublishAt != "" {
+		t, err := time.Parse(time.RFC3339, announcement.PublishAt)
+		if err != nil {
+			return "", nil, errors.New("publish_at must be an RFC 3339 timestamp")
+		}
+		publishAt = t.UTC()
+	}
+	announcement.PublishAt = publishAt.Format(time.RFC3339)
+
+	var expireAt any
+	if announcement.ExpireAt != "" {
+		t, err := time.Parse(time.RFC3339, announcement.ExpireAt)
+		if err != nil {
+			return "", nil, errors.New("expire_at must be an RFC 3339 timestamp")
+		}
+		if !t.After(publishAt) {
+			return "", nil, errors.New("expire_at must be after publish_at")
+		}
+		announcement.ExpireAt = t.UTC().Format(time.RFC3339)
+		expireAt = t.UTC().Format(dbTimeLayout)
+	}
+	return publishAt.Format(dbTimeLayout), expireAt, nil
+}
+
+// rfc3339FromDB converts a UTC DATETIME value into RFC 3339, leaving empty values empty
+func rfc3339FromDB(value string) string {
+	t, err := time.Parse(dbTimeLayout, value)
+	if err != nil {
+		return value
+	}
+	return t.Format(time.RFC3339)
+}
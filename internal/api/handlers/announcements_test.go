@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"ClassConnect/internal/events"
+	"database/sql/driver"
+	"testing"
+)
+
+func TestPublishDueAnnouncements(t *testing.T) {
+	const schoolId = 41
+	due := fakeStatement{sql: "WHERE a.announced = FALSE", columns: []string{"id", "school_id"}, rows: [][]driver.Value{{int64(3), int64(schoolId)}}}
+	announcement := fakeStatement{
+		sql:     "FROM announcements a WHERE a.id = ?",
+		columns: []string{"id", "title", "body", "attachments", "publish_at", "expire_at", "created_by", "created_at", "read_count"},
+		rows:    [][]driver.Value{{int64(3), "Sports day", "Bring trainers", "", "2026-10-19 08:00:00", "", "principal", "2026-10-12 09:00:00", int64(0)}},
+	}
+	audiences := fakeStatement{sql: "FROM announcement_audiences", columns: []string{"announcement_id", "type", "value"}, rows: [][]driver.Value{{int64(3), "class", "5A"}}}
+	guardians := fakeStatement{sql: "SELECT DISTINCT g.exec_id", columns: []string{"exec_id"}, rows: [][]driver.Value{{int64(9)}}}
+
+	tests := []struct {
+		name          string
+		script        []fakeStatement
+		wantPublished int
+		wantEvent     bool
+	}{
+		{"due announcement reaches the class guardians", []fakeStatement{due, {sql: "UPDATE announcements SET announced", affected: 1}, announcement, audiences, guardians}, 1, true},
+		{"claimed by another instance", []fakeStatement{due, {sql: "UPDATE announcements SET announced", affected: 0}, announcement, audiences, guardians}, 0, false},
+		{"nothing due", nil, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sub, _, _ := events.Subscribe(events.Subscriber{SchoolId: schoolId, Role: "guardian", UserId: "9"}, 0)
+			defer sub.Close()
+			db, _ := newFakeDB(t, test.script...)
+
+			published, err := publishDueAnnouncements(db)
+			if err != nil {
+				t.Fatalf("publishDueAnnouncements() error = %v", err)
+			}
+			if published != test.wantPublished {
+				t.Errorf("publishDueAnnouncements() = %d, want %d", published, test.wantPublished)
+			}
+			select {
+			case event := <-sub.C:
+				if !test.wantEvent {
+					t.Errorf("guardian received %s event, want none", event.Type)
+				} else if event.Type != events.TypeAnnouncementPublished {
+					t.Errorf("guardian received %s event, want %s", event.Type, events.TypeAnnouncementPublished)
+				}
+			default:
+				if test.wantEvent {
+					t.Errorf("guardian received no event, want %s", events.TypeAnnouncementPublished)
+				}
+			}
+		})
+	}
+}
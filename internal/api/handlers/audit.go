@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/models"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// auditListColumns whitelists the audit log fields GET /audit may filter and sort on
+var auditListColumns = map[string]listColumn{
+	"id":             {column: "id", numeric: true},
+	"actor_id":       {column: "actor_id"},
+	"actor_username": {column: "actor_username"},
+	"action":         {column: "action"},
+	"resource":       {column: "resource"},
+	"resource_id":    {column: "resource_id"},
+	"request_id":     {column: "request_id"},
+	"school_id":      {column: "school_id", numeric: true},
+}
+
+// auditAccess guards reading and verifying the audit log
+var auditAccess = roleAccess{roles: []string{"admin"}, denied: "Only admins may read the audit log"}
+
+type AuditHandler struct {
+	db *sql.DB
+}
+
+func NewAuditHandler(db *sql.DB) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+// GetAuditLogHandler lists audit entries, newest first unless ?sort= says otherwise.
+// Besides the column filters it accepts ?from= and ?to= as RFC 3339 timestamps
+func (h *AuditHandler) GetAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	if !auditAccess.allow(w, r) {
+		return
+	}
+
+	values := r.URL.Query()
+	from, to := values.Get("from"), values.Get("to")
+	values.Del("from")
+	values.Del("to")
+
+	params, err := parseListQuery(values, auditListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	applyTenantScope(r, &params)
+	if len(params.sort) == 0 {
+		params.sort = []listSort{{field: "id", column: "id", desc: true}}
+	}
+
+	for _, bound := range []struct {
+		value     string
+		condition string
+	}{
+		{from, "created_at >= ?"},
+		{to, "created_at < ?"},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			http.Error(w, "from and to must be RFC 3339 timestamps", http.StatusBadRequest)
+			return
+		}
+		params.addScope(bound.condition, t.UTC().Format("2006-01-02 15:04:05.000000"))
+	}
+
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "audit_log", audit.Columns, params, pageParams, func(row rowScanner) (models.AuditEntry, error) {
+		return audit.Scan(row)
+	})
+	if err != nil {
+		log.Println("Audit query error:", err)
+		http.Error(w, "Error retrieving the audit log", http.StatusInternalServerError)
+		return
+	}
+
+	writePage(w, r, result, params.fields)
+}
+
+// VerifyAuditLogHandler walks the hash chain and reports whether it is intact
+func (h *AuditHandler) VerifyAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	if !auditAccess.allow(w, r) {
+		return
+	}
+
+	result, err := audit.Verify(h.db)
+	if err != nil {
+		log.Println("Audit verify error:", err)
+		http.Error(w, "Error verifying the audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !result.Valid {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"ClassConnect/internal/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// errBulkRolledBack is returned when an atomic bulk create fails and every insert is rolled back
+var errBulkRolledBack = errors.New("bulk create rolled back")
+
+// bulkRow holds the insert arguments for one item, or the reason it was rejected before reaching the database
+type bulkRow struct {
+	args []any
+	err  error
+}
+
+// getAtomicParam reads the atomic query parameter, defaulting to all-or-nothing inserts
+func getAtomicParam(r *http.Request) (bool, error) {
+	atomicStr := r.URL.Query().Get("atomic")
+	if atomicStr == "" {
+		return true, nil
+	}
+	return strconv.ParseBool(atomicStr)
+}
+
+// bulkInsert runs the insert query once per row.
+// In atomic mode all rows share one transaction and the first failure rolls back everything,
+// otherwise each row is inserted on its own and failures are only reported in the results
+func bulkInsert(db *sql.DB, atomic bool, query string, rows []bulkRow) ([]models.BulkItemResult, error) {
+	results := make([]models.BulkItemResult, len(rows))
+	for i := range rows {
+		results[i].Index = i
+	}
+
+	if !atomic {
+		stmt, err := db.Prepare(query)
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.Close()
+
+		for i, row := range rows {
+			id, err := insertRow(stmt, row)
+			if err != nil {
+				results[i].Error = bulkErrorMessage(err)
+				continue
+			}
+			results[i].Id = id
+		}
+		return results, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	for i, row := range rows {
+		id, err := insertRow(stmt, row)
+		if err != nil {
+			log.Printf("Bulk insert failed at index %d: %v\n", i, err)
+			results[i].Error = bulkErrorMessage(err)
+			// Ids handed out earlier in the transaction no longer exist
+			for j := 0; j < i; j++ {
+				results[j].Id = 0
+				results[j].Error = "rolled back"
+			}
+			return results[:i+1], errBulkRolledBack
+		}
+		results[i].Id = id
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func insertRow(stmt *sql.Stmt, row bulkRow) (int, error) {
+	if row.err != nil {
+		return 0, row.err
+	}
+	res, err := stmt.Exec(row.args...)
+	if err != nil {
+		return 0, err
+	}
+	lastId, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(lastId), nil
+}
+
+// bulkErrorMessage turns an insert error into a message that is safe to return to the client
+func bulkErrorMessage(err error) string {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1062:
+			return "duplicate entry"
+		case 1048, 1364:
+			return "missing required field"
+		case 1406:
+			return "value too long"
+		}
+		return "error inserting data into the database"
+	}
+	var validationErr validationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Error()
+	}
+	return "error inserting data into the database"
+}
+
+// isDuplicateEntry reports whether err was caused by a unique key violation
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// validationError marks an item that was rejected before being sent to the database
+type validationError string
+
+func (e validationError) Error() string {
+	return string(e)
+}
+
+// writeBulkResponse sends the created records along with the per-item results.
+// A rolled back atomic request and a best-effort request where nothing was created are reported as failures
+func writeBulkResponse[T any](w http.ResponseWriter, results []models.BulkItemResult, err error, created []T) {
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+
+	status := "success"
+	code := http.StatusOK
+	switch {
+	case errors.Is(err, errBulkRolledBack):
+		status = "rolled_back"
+		code = http.StatusBadRequest
+	case failed > 0 && failed == len(results):
+		status = "failed"
+		code = http.StatusBadRequest
+	case failed > 0:
+		status = "partial"
+		code = http.StatusMultiStatus
+	}
+
+	response := struct {
+		Status  string                  `json:"status"`
+		Count   int                     `json:"count"`
+		Failed  int                     `json:"failed"`
+		Data    []T                     `json:"data"`
+		Results []models.BulkItemResult `json:"results"`
+	}{
+		Status:  status,
+		Count:   len(created),
+		Failed:  failed,
+		Data:    created,
+		Results: results,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"ClassConnect/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const bulkTestInsert = "INSERT INTO students(first_name) VALUES(?)"
+
+func TestBulkInsert(t *testing.T) {
+	inserted := func(id int64) fakeStatement {
+		return fakeStatement{sql: "INSERT INTO students", lastId: id, affected: 1}
+	}
+	failed := func(number uint16) fakeStatement {
+		return fakeStatement{sql: "INSERT INTO students", err: &mysql.MySQLError{Number: number, Message: "rejected"}}
+	}
+	row := bulkRow{args: []any{"Anna"}}
+	invalid := bulkRow{err: validationError("first_name is required")}
+
+	tests := []struct {
+		name          string
+		atomic        bool
+		rows          []bulkRow
+		script        []fakeStatement
+		wantResults   []models.BulkItemResult
+		wantStatus    int
+		wantResponse  string
+		wantCommits   int
+		wantRollbacks int
+	}{
+		{
+			name:        "atomic success",
+			atomic:      true,
+			rows:        []bulkRow{row, row},
+			script:      []fakeStatement{inserted(1), inserted(2)},
+			wantResults: []models.BulkItemResult{{Index: 0, Id: 1}, {Index: 1, Id: 2}},
+			wantStatus:  http.StatusOK, wantResponse: "success", wantCommits: 1,
+		},
+		{
+			name:        "atomic duplicate rolls everything back",
+			atomic:      true,
+			rows:        []bulkRow{row, row, row},
+			script:      []fakeStatement{inserted(1), failed(1062), inserted(3)},
+			wantResults: []models.BulkItemResult{{Index: 0, Error: "rolled back"}, {Index: 1, Error: "duplicate entry"}},
+			wantStatus:  http.StatusBadRequest, wantResponse: "rolled_back", wantRollbacks: 1,
+		},
+		{
+			name:        "atomic invalid row never reaches the database",
+			atomic:      true,
+			rows:        []bulkRow{invalid, row},
+			script:      []fakeStatement{inserted(1)},
+			wantResults: []models.BulkItemResult{{Index: 0, Error: "first_name is required"}},
+			wantStatus:  http.StatusBadRequest, wantResponse: "rolled_back", wantRollbacks: 1,
+		},
+		{
+			name:        "best effort partial",
+			rows:        []bulkRow{row, row, invalid, row},
+			script:      []fakeStatement{inserted(1), failed(1062), inserted(4)},
+			wantResults: []models.BulkItemResult{{Index: 0, Id: 1}, {Index: 1, Error: "duplicate entry"}, {Index: 2, Error: "first_name is required"}, {Index: 3, Id: 4}},
+			wantStatus:  http.StatusMultiStatus, wantResponse: "partial",
+		},
+		{
+			name:        "best effort where every row fails",
+			rows:        []bulkRow{row, row, row},
+			script:      []fakeStatement{failed(1048), failed(1406), failed(1146)},
+			wantResults: []models.BulkItemResult{{Index: 0, Error: "missing required field"}, {Index: 1, Error: "value too long"}, {Index: 2, Error: "error inserting data into the database"}},
+			wantStatus:  http.StatusBadRequest, wantResponse: "failed",
+		},
+		{
+			name:        "best effort success",
+			rows:        []bulkRow{row},
+			script:      []fakeStatement{inserted(7)},
+			wantResults: []models.BulkItemResult{{Index: 0, Id: 7}},
+			wantStatus:  http.StatusOK, wantResponse: "success",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, test.script...)
+			results, err := bulkInsert(db, test.atomic, bulkTestInsert, test.rows)
+			if err != nil && !errors.Is(err, errBulkRolledBack) {
+				t.Fatalf("bulkInsert() error = %v", err)
+			}
+			if !reflect.DeepEqual(results, test.wantResults) {
+				t.Errorf("bulkInsert() results = %+v, want %+v", results, test.wantResults)
+			}
+			if fake.commits != test.wantCommits || fake.rollbacks != test.wantRollbacks {
+				t.Errorf("commits %d, rollbacks %d, want %d and %d", fake.commits, fake.rollbacks, test.wantCommits, test.wantRollbacks)
+			}
+
+			created := make([]int, 0)
+			for _, result := range results {
+				if result.Id != 0 {
+					created = append(created, result.Id)
+				}
+			}
+			w := httptest.NewRecorder()
+			writeBulkResponse(w, results, err, created)
+			var response struct {
+				Status string `json:"status"`
+				Count  int    `json:"count"`
+				Failed int    `json:"failed"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != test.wantStatus || response.Status != test.wantResponse {
+				t.Errorf("writeBulkResponse() = %d %q, want %d %q", w.Code, response.Status, test.wantStatus, test.wantResponse)
+			}
+			if response.Count != len(created) || response.Failed != len(results)-len(created) {
+				t.Errorf("writeBulkResponse() count %d failed %d, want %d and %d", response.Count, response.Failed, len(created), len(results)-len(created))
+			}
+		})
+	}
+}
+
+func TestIsDuplicateEntry(t *testing.T) {
+	duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'anna@school.org' for key 'email'"}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{duplicate, true},
+		{fmt.Errorf("inserting student: %w", duplicate), true},
+		{&mysql.MySQLError{Number: 1048}, false},
+		{errors.New("Duplicate entry"), false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := isDuplicateEntry(test.err); got != test.want {
+			t.Errorf("isDuplicateEntry(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestGetAtomicParam(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    bool
+		wantErr bool
+	}{
+		{"", true, false},
+		{"atomic=false", false, false},
+		{"atomic=1", true, false},
+		{"atomic=maybe", false, true},
+	}
+	for _, test := range tests {
+		got, err := getAtomicParam(httptest.NewRequest("POST", "/students/?"+test.query, nil))
+		if (err != nil) != test.wantErr || (err == nil && got != test.want) {
+			t.Errorf("getAtomicParam(%q) = %v, %v, want %v, wantErr %v", test.query, got, err, test.want, test.wantErr)
+		}
+	}
+}
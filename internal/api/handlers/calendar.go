@@ -0,0 +1,556 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/calendar"
+	"ClassConnect/internal/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calendarCategories are the kinds of calendar events, holidays of the whole school close it for the day
+var calendarCategories = map[string]bool{"event": true, "holiday": true, "exam": true, "meeting": true}
+
+// calendarScopes are who an event is for: the whole school, a class or a course
+var calendarScopes = map[string]bool{"school": true, "class": true, "course": true}
+
+const (
+	// defaultCalendarDays is how far ahead the calendar lists events when no range is given
+	defaultCalendarDays = 30
+	// maxCalendarDays is the longest range the calendar lists at once
+	maxCalendarDays = 366
+	// feedHistory is how long past events stay in the iCalendar feeds
+	feedHistory = 365 * 24 * time.Hour
+)
+
+// calendarListColumns whitelists the event fields the calendar may filter, sort and select on. Filters apply to the
+// events and sorting to their occurrences
+var calendarListColumns = map[string]listColumn{
+	"id":          {column: "id", numeric: true},
+	"title":       {column: "title"},
+	"category":    {column: "category"},
+	"scope":       {column: "scope"},
+	"scope_value": {column: "scope_value"},
+	"starts_at":   {column: "starts_at"},
+	"all_day":     {column: "all_day", boolean: true},
+	"created_by":  {column: "created_by"},
+}
+
+// calendarAccess guards changing calendar events, and its roles see every event of the school
+var calendarAccess = roleAccess{roles: []string{"admin", "manager"}, denied: "Only admins and managers may manage the calendar"}
+
+type CalendarHandler struct {
+	db *sql.DB
+}
+
+func NewCalendarHandler(db *sql.DB) *CalendarHandler {
+	return &CalendarHandler{db: db}
+}
+
+// GetEventsHandler lists the occurrences of the events visible to the caller between ?from= and ?to= (YYYY-MM-DD,
+// both included, the next 30 days by default), filtered on the fields of calendarListColumns. Recurring events are
+// listed once per occurrence, and the occurrences are paginated in order of their start
+func (h *CalendarHandler) GetEventsHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := calendarRange(w, r)
+	if !ok {
+		return
+	}
+	end := to.AddDate(0, 0, 1)
+
+	if r.URL.Query().Has("starts_at") {
+		http.Error(w, "Select the occurrences by date with from and to", http.StatusBadRequest)
+		return
+	}
+	params, err := parseListQuery(listValues(r.URL.Query(), "from", "to"), calendarListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("starts_at", calendarListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tenant, args := tenantCondition(r)
+	query := "SELECT " + calendar.Columns + " FROM calendar_events WHERE 1 = 1" + tenant + calendar.Window
+	args = append(args, end.Format(calendar.DBTimeLayout), from.Format(calendar.DBTimeLayout))
+	conditions, filterArgs := params.conditions()
+	for _, condition := range conditions {
+		query += " AND " + condition
+	}
+	args = append(args, filterArgs...)
+	visible, visibleArgs, err := h.callerVisibility(r)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the calendar", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := h.queryEvents(query+visible, append(args, visibleArgs...)...)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the calendar", http.StatusInternalServerError)
+		return
+	}
+	occurrences, err := calendar.Expand(events, from, end)
+	if err != nil {
+		log.Println("Calendar expansion error:", err)
+		http.Error(w, "Error retrieving the calendar", http.StatusInternalServerError)
+		return
+	}
+	result, err := pageSlice(occurrences, params, pageParams)
+	if err != nil {
+		log.Println("Pagination error:", err)
+		http.Error(w, "Error retrieving the calendar", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// GetEventByIdHandler returns an event as it was defined, with its recurrence rule rather than its occurrences
+func (h *CalendarHandler) GetEventByIdHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := h.loadVisibleEvent(w, r)
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, "", event)
+}
+
+func (h *CalendarHandler) CreateEventHandler(w http.ResponseWriter, r *http.Request) {
+	if !calendarAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var event models.CalendarEvent
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	values, err := validateCalendarEvent(&event)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	event.CreatedBy = contextUsername(r)
+
+	res, err := h.db.Exec("INSERT INTO calendar_events(school_id, title, description, location, category, scope, scope_value, starts_at, ends_at, all_day, rrule, last_ends_at, created_by) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)",
+		append(append([]any{schoolId}, values...), event.CreatedBy)...,
+	)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the event", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error creating the event", http.StatusInternalServerError)
+		return
+	}
+	event.Id = int(id)
+
+	audit.Record(h.db, r, audit.ActionCreate, "calendar_events", event.Id, nil, event)
+	writeCreated(w, event)
+}
+
+// UpdateEventHandler replaces an event, changing every one of its occurrences
+func (h *CalendarHandler) UpdateEventHandler(w http.ResponseWriter, r *http.Request) {
+	if !calendarAccess.allow(w, r) {
+		return
+	}
+	before, ok := h.loadVisibleEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var event models.CalendarEvent
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	values, err := validateCalendarEvent(&event)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	event.Id = before.Id
+	event.CreatedBy = before.CreatedBy
+	event.CreatedAt = before.CreatedAt
+
+	_, err = h.db.Exec("UPDATE calendar_events SET title = ?, description = ?, location = ?, category = ?, scope = ?, scope_value = ?, starts_at = ?, ends_at = ?, all_day = ?, rrule = ?, last_ends_at = ? WHERE id = ?",
+		append(values, event.Id)...,
+	)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error updating the event", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "calendar_events", event.Id, before, event)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
+
+// DeleteEventHandler removes an event with all of its occurrences
+func (h *CalendarHandler) DeleteEventHandler(w http.ResponseWriter, r *http.Request) {
+	if !calendarAccess.allow(w, r) {
+		return
+	}
+	before, ok := h.loadVisibleEvent(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := h.db.Exec("DELETE FROM calendar_events WHERE id = ?", before.Id)
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, "Error deleting the event", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionDelete, "calendar_events", before.Id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetNonSchoolDaysHandler lists the weekend days and holidays between ?from= and ?to=
+func (h *CalendarHandler) GetNonSchoolDaysHandler(w http.ResponseWriter, r *http.Request) {
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+	from, to, ok := calendarRange(w, r)
+	if !ok {
+		return
+	}
+
+	days, err := calendar.NonSchoolDays(h.db, schoolId, from.Format(calendar.DateLayout), to.Format(calendar.DateLayout))
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the non-school days", http.StatusInternalServerError)
+		return
+	}
+	writeList(w, r, days)
+}
+
+// CreateFeedTokenHandler gives the caller a new iCalendar subscription URL. The token is only shown in this response,
+// and creating one revokes the previous URL
+func (h *CalendarHandler) CreateFeedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	schoolId, execId, ok := messagingCaller(w, r)
+	if !ok {
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		log.Println("Token generation error:", err)
+		http.Error(w, "Error creating the calendar feed", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	_, err = h.db.Exec("REPLACE INTO calendar_feed_tokens(exec_id, school_id, token_hash) VALUES(?,?,?)", execId, schoolId, hashFeedToken(token))
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionCreate, "calendar_feed_tokens", execId, nil, map[string]any{"exec_id": execId})
+	writeCreated(w, models.CalendarFeed{
+		Token:     token,
+		URL:       publicURL("/calendar/feed/" + token + ".ics"),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// DeleteFeedTokenHandler revokes the caller's iCalendar subscription URL
+func (h *CalendarHandler) DeleteFeedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	_, execId, ok := messagingCaller(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.db.Exec("DELETE FROM calendar_feed_tokens WHERE exec_id = ?", execId)
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, "Error revoking the calendar feed", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "There is no calendar feed to revoke", http.StatusNotFound)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionDelete, "calendar_feed_tokens", execId, map[string]any{"exec_id": execId}, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FeedHandler serves the iCalendar feed of a subscription URL. Calendar applications cannot log in, so the token in
+// the path is the only credential: it stops working once revoked, or when its account is deactivated or deleted
+func (h *CalendarHandler) FeedHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(r.PathValue("token"), ".ics")
+
+	var execId, schoolId int
+	var role, schoolName string
+	err := h.db.QueryRow("SELECT t.exec_id, t.school_id, e.role, s.name FROM calendar_feed_tokens t JOIN execs e ON e.id = t.exec_id AND e.school_id = t.school_id JOIN schools s ON s.id = t.school_id WHERE t.token_hash = ? AND e.inactive_status = FALSE AND e.deleted_at IS NULL",
+		hashFeedToken(token),
+	).Scan(&execId, &schoolId, &role, &schoolName)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Unknown calendar feed", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the calendar", http.StatusInternalServerError)
+		return
+	}
+
+	visible, visibleArgs, err := calendarVisibility(h.db, schoolId, execId, role)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the calendar", http.StatusInternalServerError)
+		return
+	}
+	since := time.Now().Add(-feedHistory).Format(calendar.DBTimeLayout)
+	events, err := h.queryEvents("SELECT "+calendar.Columns+" FROM calendar_events WHERE school_id = ? AND (last_ends_at IS NULL OR last_ends_at > ?)"+visible+" ORDER BY starts_at, id",
+		append([]any{schoolId, since}, visibleArgs...)...,
+	)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the calendar", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.db.Exec("UPDATE calendar_feed_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE exec_id = ?", execId)
+	if err != nil {
+		log.Println("Update error:", err)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+	err = calendar.WriteICS(w, schoolName, events, time.Now())
+	if err != nil {
+		log.Println("Calendar feed error:", err)
+	}
+}
+
+// loadVisibleEvent reads the event of the path's {id} if the caller may see it, writing the error response itself when it fails
+func (h *CalendarHandler) loadVisibleEvent(w http.ResponseWriter, r *http.Request) (models.CalendarEvent, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return models.CalendarEvent{}, false
+	}
+
+	visible, visibleArgs, err := h.callerVisibility(r)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return models.CalendarEvent{}, false
+	}
+	tenant, tenantArgs := tenantCondition(r)
+	events, err := h.queryEvents("SELECT "+calendar.Columns+" FROM calendar_events WHERE id = ?"+tenant+visible,
+		append(append([]any{id}, tenantArgs...), visibleArgs...)...,
+	)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return models.CalendarEvent{}, false
+	}
+	if len(events) == 0 {
+		http.Error(w, "Event with that ID does not exist", http.StatusNotFound)
+		return models.CalendarEvent{}, false
+	}
+	return events[0], true
+}
+
+func (h *CalendarHandler) queryEvents(query string, args ...any) ([]models.CalendarEvent, error) {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]models.CalendarEvent, 0)
+	for rows.Next() {
+		event, err := calendar.Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// callerVisibility is calendarVisibility for the logged in account
+func (h *CalendarHandler) callerVisibility(r *http.Request) (string, []any, error) {
+	execId, _ := strconv.Atoi(contextUserId(r))
+	return calendarVisibility(h.db, contextSchool(r), execId, contextRole(r))
+}
+
+// calendarVisibility builds the condition, appended to a WHERE clause, keeping the events an account sees: every event
+// for admins and managers, otherwise the school-wide events and those of the classes and subjects the account teaches
+// or, for guardians, of the classes their students are in
+func calendarVisibility(db *sql.DB, schoolId, execId int, role string) (string, []any, error) {
+	if calendarAccess.grants(role) {
+		return "", nil, nil
+	}
+
+	conditions := []string{"scope = 'school'"}
+	args := make([]any, 0)
+	addScope := func(scope, value string) {
+		conditions = append(conditions, "(scope = ? AND scope_value = ?)")
+		args = append(args, scope, value)
+	}
+
+	rows, err := db.Query("SELECT t.class, t.subject FROM teachers t JOIN execs e ON e.email = t.email AND e.school_id = t.school_id WHERE e.id = ? AND t.school_id = ? AND t.deleted_at IS NULL", execId, schoolId)
+	if err != nil {
+		return "", nil, err
+	}
+	for rows.Next() {
+		var class, subject string
+		err = rows.Scan(&class, &subject)
+		if err != nil {
+			rows.Close()
+			return "", nil, err
+		}
+		addScope("class", class)
+		addScope("course", subject)
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT s.class FROM student_guardians g JOIN students s ON s.id = g.student_id AND s.deleted_at IS NULL WHERE g.exec_id = ? AND g.school_id = ?", execId, schoolId)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var class string
+		err = rows.Scan(&class)
+		if err != nil {
+			return "", nil, err
+		}
+		addScope("class", class)
+	}
+	if err = rows.Err(); err != nil {
+		return "", nil, err
+	}
+	return " AND (" + strings.Join(conditions, " OR ") + ")", args, nil
+}
+
+// calendarRange reads the ?from= and ?to= dates of a calendar listing, writing a 400 itself when they are invalid
+func calendarRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	today, _ := time.Parse(calendar.DateLayout, time.Now().Format(calendar.DateLayout))
+	from, to := today, today.AddDate(0, 0, defaultCalendarDays)
+
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse(calendar.DateLayout, value)
+		if err != nil {
+			http.Error(w, "from and to must be YYYY-MM-DD dates", http.StatusBadRequest)
+			return from, to, false
+		}
+		to = from.AddDate(0, 0, defaultCalendarDays)
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse(calendar.DateLayout, value)
+		if err != nil {
+			http.Error(w, "from and to must be YYYY-MM-DD dates", http.StatusBadRequest)
+			return from, to, false
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return from, to, false
+	}
+	if to.Sub(from) >= maxCalendarDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("The range may not span more than %d days", maxCalendarDays), http.StatusBadRequest)
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// validateCalendarEvent checks and normalizes an event and returns the values of its columns, from title to last_ends_at
+func validateCalendarEvent(event *models.CalendarEvent) ([]any, error) {
+	event.Title = strings.TrimSpace(event.Title)
+	if event.Title == "" {
+		return nil, errors.New("title is required")
+	}
+	if event.Category == "" {
+		event.Category = "event"
+	}
+	if !calendarCategories[event.Category] {
+		return nil, errors.New("category must be event, holiday, exam or meeting")
+	}
+	if event.Scope == "" {
+		event.Scope = "school"
+	}
+	event.ScopeValue = strings.TrimSpace(event.ScopeValue)
+	switch {
+	case !calendarScopes[event.Scope]:
+		return nil, errors.New("scope must be school, class or course")
+	case event.Scope == "school":
+		event.ScopeValue = ""
+	case event.ScopeValue == "":
+		return nil, fmt.Errorf("scope_value is required for %s events", event.Scope)
+	}
+	if event.Category == "holiday" && (event.Scope != "school" || !event.AllDay) {
+		return nil, errors.New("holidays must be all-day events of the whole school")
+	}
+
+	start, end, err := calendar.Span(*event)
+	if err != nil {
+		return nil, err
+	}
+	var rrule any
+	if event.RRule != "" {
+		rule, err := calendar.ParseRule(event.RRule)
+		if err != nil {
+			return nil, fmt.Errorf("rrule: %w", err)
+		}
+		event.RRule = rule.String(event.AllDay)
+		rrule = event.RRule
+	}
+	last, err := calendar.LastEnd(*event)
+	if err != nil {
+		return nil, err
+	}
+	var lastEndsAt any
+	if !last.IsZero() {
+		lastEndsAt = last.Format(calendar.DBTimeLayout)
+	}
+
+	// The ends_at column of all-day events holds their last day, as the API does
+	if event.AllDay {
+		end = end.AddDate(0, 0, -1)
+	}
+	return []any{event.Title, event.Description, event.Location, event.Category, event.Scope, event.ScopeValue,
+		start.Format(calendar.DBTimeLayout), end.Format(calendar.DBTimeLayout), event.AllDay, rrule, lastEndsAt,
+	}, nil
+}
+
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
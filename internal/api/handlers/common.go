@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// roleAccess restricts endpoints to some roles, denied telling everyone else who may use them
+type roleAccess struct {
+	roles  []string
+	denied string
+}
+
+// allow writes a 403 with the denied message unless the caller holds one of the roles
+func (a roleAccess) allow(w http.ResponseWriter, r *http.Request) bool {
+	if !a.grants(contextRole(r)) {
+		http.Error(w, a.denied, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// grants reports whether the role is one of the roles, for endpoints that show more to them rather than refuse others
+func (a roleAccess) grants(role string) bool {
+	_, err := utils.AuthorizeUser(role, a.roles...)
+	return err == nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// contextRole returns the role stored in the request context by the JWT middleware
+func contextRole(r *http.Request) string {
+	role, _ := r.Context().Value(utils.ContextKey("role")).(string)
+	return role
+}
+
+// contextUserId returns the ID of the logged in exec stored in the request context by the JWT middleware
+func contextUserId(r *http.Request) string {
+	userId, _ := r.Context().Value(utils.ContextKey("userId")).(string)
+	return userId
+}
+
+// contextUsername returns the username stored in the request context by the JWT middleware
+func contextUsername(r *http.Request) string {
+	username, _ := r.Context().Value(utils.ContextKey("username")).(string)
+	return username
+}
+
+// writeList responds with an unpaginated list in the same envelope the paginated endpoints use
+func writeList[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	response := struct {
+		Status string `json:"status"`
+		Count  int    `json:"count"`
+		Data   []T    `json:"data"`
+	}{
+		Status: "success",
+		Count:  len(items),
+		Data:   items,
+	}
+	writeJSONWithETag(w, r, "", response)
+}
+
+// writeCreated responds with 201 and the record that was created
+func writeCreated(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(body)
+}
+
+// callerTeaching returns the classes and subjects the logged in account teaches, taken from the live teacher records
+// of its school that share the account's email
+func callerTeaching(db *sql.DB, r *http.Request) ([]string, []string, error) {
+	tenant, tenantArgs := tenantCondition(r)
+	rows, err := db.Query("SELECT class, subject FROM teachers WHERE email = (SELECT email FROM execs WHERE id = ?) AND "+notDeleted+tenant,
+		append([]any{contextUserId(r)}, tenantArgs...)...,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	classes := make([]string, 0)
+	subjects := make([]string, 0)
+	for rows.Next() {
+		var class, subject string
+		err = rows.Scan(&class, &subject)
+		if err != nil {
+			return nil, nil, err
+		}
+		classes = append(classes, class)
+		subjects = append(subjects, subject)
+	}
+	return classes, subjects, rows.Err()
+}
+
+// loadStudentSchool resolves the {id} of the path to a live student of the current school and returns the student's school,
+// writing the error response itself when it cannot
+func loadStudentSchool(db *sql.DB, w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Student ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	var schoolId int
+	tenant, tenantArgs := tenantCondition(r)
+	err = db.QueryRow("SELECT school_id FROM students WHERE id = ? AND "+notDeleted+tenant, append([]any{id}, tenantArgs...)...).Scan(&schoolId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Student with that ID does not exist", http.StatusNotFound)
+		return 0, 0, false
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	return id, schoolId, true
+}
+
+// validateAttachments checks that every attachment has a name and an http or https link, returning an empty list for nil
+func validateAttachments(attachments []models.Attachment) ([]models.Attachment, error) {
+	if attachments == nil {
+		return make([]models.Attachment, 0), nil
+	}
+	for i, attachment := range attachments {
+		link, err := url.Parse(attachment.URL)
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") || attachment.Name == "" {
+			return nil, fmt.Errorf("attachment %d: a name and an http or https url are required", i)
+		}
+	}
+	return attachments, nil
+}
+
+// publicURL is the address clients reach a path of the API at, from PUBLIC_BASE_URL. Request headers are not trusted
+// for links handed out to other applications
+func publicURL(path string) string {
+	base := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return base + path
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	errPreconditionRequired = errors.New("If-Match header is required")
+	errPreconditionFailed   = errors.New("the resource has been modified since it was last retrieved")
+)
+
+// versionETag builds the entity tag for a single row from its version column
+func versionETag(version int) string {
+	return `"v` + strconv.Itoa(version) + `"`
+}
+
+// contentETag builds an entity tag from the serialized response body, used for collections
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether any entity tag in an If-Match or If-None-Match header value equals etag.
+// Weak tags are compared by their opaque value and "*" matches everything
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersions parses the If-Match header into the row versions it accepts.
+// A wildcard is reported separately since it accepts any existing version
+func ifMatchVersions(r *http.Request) ([]int, bool, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil, false, errPreconditionRequired
+	}
+
+	versions := make([]int, 0)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return nil, true, nil
+		}
+		candidate = strings.TrimPrefix(candidate, "W/")
+		candidate = strings.Trim(candidate, `"`)
+		version, err := strconv.Atoi(strings.TrimPrefix(candidate, "v"))
+		if err != nil || !strings.HasPrefix(candidate, "v") {
+			// Unknown tags can never match, but other tags in the list still might
+			continue
+		}
+		versions = append(versions, version)
+	}
+
+	if len(versions) == 0 {
+		return nil, false, errPreconditionFailed
+	}
+	return versions, false, nil
+}
+
+// versionCondition returns the WHERE fragment restricting a write to the versions accepted by If-Match
+func versionCondition(versions []int, wildcard bool) (string, []any) {
+	if wildcard {
+		return "", nil
+	}
+	placeholders := make([]string, len(versions))
+	args := make([]any, len(versions))
+	for i, version := range versions {
+		placeholders[i] = "?"
+		args[i] = version
+	}
+	return " AND version IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// versionAccepted reports whether a row version satisfies the parsed If-Match header
+func versionAccepted(version int, versions []int, wildcard bool) bool {
+	if wildcard {
+		return true
+	}
+	for _, accepted := range versions {
+		if accepted == version {
+			return true
+		}
+	}
+	return false
+}
+
+// writePreconditionError maps If-Match errors onto 428 and 412
+func writePreconditionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errPreconditionRequired) {
+		http.Error(w, err.Error(), http.StatusPreconditionRequired)
+		return
+	}
+	http.Error(w, errPreconditionFailed.Error(), http.StatusPreconditionFailed)
+}
+
+// writeJSONWithETag encodes body as JSON with the given ETag, or answers 304 when the client already has it.
+// An empty etag is derived from the encoded body
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, etag string, body any) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, "Error encoding the response", http.StatusInternalServerError)
+		return
+	}
+	if etag == "" {
+		etag = contentETag(encoded)
+	}
+
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(encoded, '\n'))
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		etag   string
+		want   bool
+	}{
+		{`"v3"`, `"v3"`, true},
+		{`"v2"`, `"v3"`, false},
+		{`"v1", "v3"`, `"v3"`, true},
+		{`W/"v3"`, `"v3"`, true},
+		{`*`, `"v3"`, true},
+		{`v3`, `"v3"`, false},
+		{``, `"v3"`, false},
+	}
+	for _, test := range tests {
+		if got := etagMatches(test.header, test.etag); got != test.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", test.header, test.etag, got, test.want)
+		}
+	}
+}
+
+func TestIfMatchVersions(t *testing.T) {
+	tests := []struct {
+		header       string
+		wantVersions []int
+		wantWildcard bool
+		wantErr      error
+	}{
+		{`"v3"`, []int{3}, false, nil},
+		{`"v3", W/"v4"`, []int{3, 4}, false, nil},
+		{`"abc", "v5"`, []int{5}, false, nil},
+		{`"v1", *`, nil, true, nil},
+		{``, nil, false, errPreconditionRequired},
+		{`"abc"`, nil, false, errPreconditionFailed},
+		{`"3"`, nil, false, errPreconditionFailed},
+		{`"vx"`, nil, false, errPreconditionFailed},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("PATCH", "/students/1", nil)
+		if test.header != "" {
+			r.Header.Set("If-Match", test.header)
+		}
+		versions, wildcard, err := ifMatchVersions(r)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("ifMatchVersions(%q) error = %v, want %v", test.header, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(versions, test.wantVersions) || wildcard != test.wantWildcard {
+			t.Errorf("ifMatchVersions(%q) = %v, %v, want %v, %v", test.header, versions, wildcard, test.wantVersions, test.wantWildcard)
+		}
+	}
+}
+
+func TestVersionCondition(t *testing.T) {
+	condition, args := versionCondition([]int{3, 4}, false)
+	if condition != " AND version IN (?, ?)" || !reflect.DeepEqual(args, []any{3, 4}) {
+		t.Errorf("versionCondition([3 4]) = %q, %v", condition, args)
+	}
+	condition, args = versionCondition(nil, true)
+	if condition != "" || args != nil {
+		t.Errorf("versionCondition(*) = %q, %v, want no condition", condition, args)
+	}
+
+	tests := []struct {
+		version  int
+		versions []int
+		wildcard bool
+		want     bool
+	}{
+		{3, []int{3, 4}, false, true},
+		{5, []int{3, 4}, false, false},
+		{5, nil, true, true},
+	}
+	for _, test := range tests {
+		if got := versionAccepted(test.version, test.versions, test.wildcard); got != test.want {
+			t.Errorf("versionAccepted(%d, %v, %v) = %v, want %v", test.version, test.versions, test.wildcard, got, test.want)
+		}
+	}
+}
+
+func TestWritePreconditionError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errPreconditionRequired, http.StatusPreconditionRequired},
+		{errPreconditionFailed, http.StatusPreconditionFailed},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		writePreconditionError(w, test.err)
+		if w.Code != test.want {
+			t.Errorf("writePreconditionError(%v) status = %d, want %d", test.err, w.Code, test.want)
+		}
+	}
+}
+
+func TestWriteJSONWithETag(t *testing.T) {
+	body := map[string]string{"status": "success"}
+	contentTag := contentETag([]byte(`{"status":"success"}`))
+	tests := []struct {
+		name        string
+		etag        string
+		ifNoneMatch string
+		wantStatus  int
+		wantETag    string
+	}{
+		{"derived from the body", "", "", http.StatusOK, contentTag},
+		{"version tag", versionETag(7), "", http.StatusOK, `"v7"`},
+		{"client is current", versionETag(7), `"v6", "v7"`, http.StatusNotModified, `"v7"`},
+		{"client is stale", versionETag(7), `"v6"`, http.StatusOK, `"v7"`},
+		{"client has the same content", "", contentTag, http.StatusNotModified, contentTag},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/students/1", nil)
+		if test.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		writeJSONWithETag(w, r, test.etag, body)
+		if w.Code != test.wantStatus || w.Header().Get("ETag") != test.wantETag {
+			t.Errorf("%s: status %d ETag %s, want %d %s", test.name, w.Code, w.Header().Get("ETag"), test.wantStatus, test.wantETag)
+		}
+		if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("%s: 304 response has a body", test.name)
+		}
+		if w.Code == http.StatusOK && strings.TrimSpace(w.Body.String()) != `{"status":"success"}` {
+			t.Errorf("%s: body = %q", test.name, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"ClassConnect/internal/events"
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resetEvent tells a client that events were missed and cannot be replayed, so it should reload what it shows
+const resetEvent = "reset"
+
+type EventsHandler struct {
+	db *sql.DB
+}
+
+func NewEventsHandler(db *sql.DB) *EventsHandler {
+	return &EventsHandler{db: db}
+}
+
+// StreamEventsHandler streams the events addressed to the caller as Server-Sent Events.
+// ?types= limits the stream to a comma separated list of event types. A reconnecting client sends the Last-Event-ID
+// header (or ?last_event_id=) and first receives the events it missed
+func (h *EventsHandler) StreamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	subscriber, lastEventId, err := h.subscriber(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "retry: 5000\n\n")
+	if err := controller.Flush(); err != nil {
+		log.Println("Event stream error:", err)
+		return
+	}
+
+	sub, missed, complete := events.Subscribe(subscriber, lastEventId)
+	defer sub.Close()
+
+	if !complete {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", resetEvent)
+	}
+	for _, event := range missed {
+		writeServerSentEvent(w, event)
+	}
+	controller.Flush()
+
+	heartbeat := time.NewTicker(events.HeartbeatInterval())
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			io.WriteString(w, ": heartbeat\n\n")
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind, the client reconnects with its Last-Event-ID and catches up
+				return
+			}
+			writeServerSentEvent(w, event)
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// EventsWebSocketHandler delivers the same events as the stream endpoint over a WebSocket, one JSON message per event.
+// The login cookie authenticates the upgrade request like any other. Missed events are replayed from ?last_event_id=
+func (h *EventsHandler) EventsWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	subscriber, lastEventId, err := h.subscriber(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := utils.UpgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub, missed, complete := events.Subscribe(subscriber, lastEventId)
+	defer sub.Close()
+
+	// Clients have nothing to say, reading only answers pings and notices when they leave
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		// A frame the reader chokes on ends this connection, never the process
+		defer func() {
+			if err := recover(); err != nil {
+				log.Println("WebSocket read panic:", err)
+				conn.Close()
+			}
+		}()
+		for {
+			if _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if !complete {
+		conn.WriteText([]byte(`{"type":"` + resetEvent + `"}`))
+	}
+	for _, event := range missed {
+		if writeWebSocketEvent(conn, event) != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(events.HeartbeatInterval())
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			err = conn.Ping()
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			err = writeWebSocketEvent(conn, event)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// subscriber describes the caller to the event bus and reads the event ID to replay from
+func (h *EventsHandler) subscriber(r *http.Request) (events.Subscriber, int64, error) {
+	subscriber := events.Subscriber{
+		SchoolId: contextSchool(r),
+		Role:     contextRole(r),
+		UserId:   contextUserId(r),
+		SeeAll:   contextRole(r) == utils.SuperAdminRole,
+	}
+	if types := r.URL.Query().Get("types"); types != "" {
+		for _, eventType := range strings.Split(types, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				subscriber.Types = append(subscriber.Types, eventType)
+			}
+		}
+	}
+
+	var err error
+	subscriber.Classes, subscriber.Courses, err = callerTeaching(h.db, r)
+	if err != nil {
+		log.Println("Query error:", err)
+		return subscriber, 0, errors.New("unable to resolve the caller's classes")
+	}
+
+	var lastEventId int64
+	lastEventStr := r.Header.Get("Last-Event-ID")
+	if lastEventStr == "" {
+		lastEventStr = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventStr != "" {
+		lastEventId, err = strconv.ParseInt(lastEventStr, 10, 64)
+		if err != nil {
+			return subscriber, 0, errors.New("Last-Event-ID must be an event ID")
+		}
+	}
+	return subscriber, lastEventId, nil
+}
+
+func writeServerSentEvent(w io.Writer, event events.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Event encoding error:", err)
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+}
+
+func writeWebSocketEvent(conn *utils.WebSocketConn, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Event encoding error:", err)
+		return nil
+	}
+	return conn.WriteText(data)
+}
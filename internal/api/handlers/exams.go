@@ -0,0 +1,1305 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/calendar"
+	"ClassConnect/internal/exams"
+	"ClassConnect/internal/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxExamMinutes is the longest an exam session may last
+	maxExamMinutes = 720
+	// maxRoomCapacity is the most seats a room may have
+	maxRoomCapacity = 1000
+)
+
+// examSessionColumns are the columns querySessions scans, candidates counts the live students of the session's classes
+const examSessionColumns = "s.id, s.course, COALESCE(s.title, ''), s.starts_at, s.ends_at, s.duration_minutes, COALESCE(s.created_by, ''), s.created_at, " +
+	"(SELECT COUNT(*) FROM students st WHERE st.school_id = s.school_id AND st.deleted_at IS NULL AND st.class IN (SELECT c.class FROM exam_session_classes c WHERE c.session_id = s.id)), " +
+	"(SELECT COUNT(*) FROM exam_seats es WHERE es.session_id = s.id)"
+
+// examRoomListColumns whitelists the room fields the list may filter, sort and select on
+var examRoomListColumns = map[string]listColumn{
+	"id":            {column: "id", numeric: true},
+	"name":          {column: "name"},
+	"capacity":      {column: "capacity", numeric: true},
+	"seats_per_row": {column: "seats_per_row", numeric: true},
+	"created_at":    {column: "created_at"},
+}
+
+// examSessionListColumns whitelists the session fields the list may filter, sort and select on, starts_at is
+// formatted the way calendarTimeFromDB writes it so cursors compare against the same value
+var examSessionListColumns = map[string]listColumn{
+	"id":               {column: "s.id", numeric: true},
+	"course":           {column: "s.course"},
+	"title":            {column: "s.title"},
+	"starts_at":        {column: "DATE_FORMAT(s.starts_at, '%Y-%m-%dT%H:%i')"},
+	"duration_minutes": {column: "s.duration_minutes", numeric: true},
+	"created_by":       {column: "s.created_by"},
+}
+
+// examSeatColumns are the columns sessionSeats reads, joined from exam_seats, exam_rooms and students
+const examSeatColumns = "es.room_id, r.name, es.seat, es.seat_row, es.seat_column, es.student_id, st.first_name, st.last_name, st.class"
+
+// examsAccess guards rooms, sessions, seating and invigilation
+var examsAccess = roleAccess{roles: []string{"admin", "manager"}, denied: "Only admins and managers may manage exams"}
+
+type ExamsHandler struct {
+	db *sql.DB
+}
+
+func NewExamsHandler(db *sql.DB) *ExamsHandler {
+	return &ExamsHandler{db: db}
+}
+
+// GetRoomsHandler lists the exam rooms of the school by name
+func (h *ExamsHandler) GetRoomsHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListQuery(r.URL.Query(), examRoomListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("name", examRoomListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	applyTenantScope(r, &params)
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "exam_rooms", "id, name, capacity, seats_per_row, created_at", params, pageParams, func(row rowScanner) (models.ExamRoom, error) {
+		var room models.ExamRoom
+		err := row.Scan(&room.Id, &room.Name, &room.Capacity, &room.SeatsPerRow, &room.CreatedAt)
+		return room, err
+	})
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the rooms", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+func (h *ExamsHandler) CreateRoomHandler(w http.ResponseWriter, r *http.Request) {
+	if !examsAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var room models.ExamRoom
+	err := json.NewDecoder(r.Body).Decode(&room)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	err = validateExamRoom(&room)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.db.Exec("INSERT INTO exam_rooms(school_id, name, capacity, seats_per_row) VALUES(?,?,?,?)", schoolId, room.Name, room.Capacity, room.SeatsPerRow)
+	if isDuplicateEntry(err) {
+		http.Error(w, "A room with that name already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the room", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error creating the room", http.StatusInternalServerError)
+		return
+	}
+	room.Id = int(id)
+
+	audit.Record(h.db, r, audit.ActionCreate, "exam_rooms", room.Id, nil, room)
+	writeCreated(w, room)
+}
+
+// UpdateRoomHandler replaces a room. Seating plans already made keep their seats until they are planned again
+func (h *ExamsHandler) UpdateRoomHandler(w http.ResponseWriter, r *http.Request) {
+	if !examsAccess.allow(w, r) {
+		return
+	}
+	before, ok := h.loadRoom(w, r)
+	if !ok {
+		return
+	}
+
+	var room models.ExamRoom
+	err := json.NewDecoder(r.Body).Decode(&room)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	err = validateExamRoom(&room)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	room.Id = before.Id
+	room.CreatedAt = before.CreatedAt
+
+	_, err = h.db.Exec("UPDATE exam_rooms SET name = ?, capacity = ?, seats_per_row = ? WHERE id = ?", room.Name, room.Capacity, room.SeatsPerRow, room.Id)
+	if isDuplicateEntry(err) {
+		http.Error(w, "A room with that name already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error updating the room", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "exam_rooms", room.Id, before, room)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(room)
+}
+
+// DeleteRoomHandler removes a room that no exam session uses
+func (h *ExamsHandler) DeleteRoomHandler(w http.ResponseWriter, r *http.Request) {
+	if !examsAccess.allow(w, r) {
+		return
+	}
+	before, ok := h.loadRoom(w, r)
+	if !ok {
+		return
+	}
+
+	var sessions int
+	err := h.db.QueryRow("SELECT COUNT(*) FROM exam_session_rooms WHERE room_id = ?", before.Id).Scan(&sessions)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error deleting the room", http.StatusInternalServerError)
+		return
+	}
+	if sessions > 0 {
+		http.Error(w, fmt.Sprintf("The room is booked for %d exam sessions", sessions), http.StatusConflict)
+		return
+	}
+
+	_, err = h.db.Exec("DELETE FROM exam_rooms WHERE id = ?", before.Id)
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, "Error deleting the room", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionDelete, "exam_rooms", before.Id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSessionsHandler lists the exam sessions starting between ?from= and ?to= (YYYY-MM-DD, both included), sat by
+// ?class= and filtered on the fields of examSessionListColumns, in the order they are sat
+func (h *ExamsHandler) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListQuery(listValues(r.URL.Query(), "from", "to", "class"), examSessionListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("starts_at", examSessionListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	applyTenantScopeOn(r, &params, "s.school_id")
+	for _, bound := range []struct {
+		param     string
+		condition string
+		days      int
+	}{
+		{"from", "s.starts_at >= ?", 0},
+		{"to", "s.starts_at < ?", 1},
+	} {
+		value := r.URL.Query().Get(bound.param)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse(calendar.DateLayout, value)
+		if err != nil {
+			http.Error(w, "from and to must be YYYY-MM-DD dates", http.StatusBadRequest)
+			return
+		}
+		params.addScope(bound.condition, date.AddDate(0, 0, bound.days).Format(calendar.DBTimeLayout))
+	}
+	if class := r.URL.Query().Get("class"); class != "" {
+		params.addScope("EXISTS (SELECT 1 FROM exam_session_classes c WHERE c.session_id = s.id AND c.class = ?)", class)
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "exam_sessions s", examSessionColumns, params, pageParams, scanExamSession)
+	if err == nil {
+		err = h.loadSessionDetails(result.records)
+	}
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the exam sessions", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// GetSessionHandler returns a session with its classes, rooms and invigilators
+func (h *ExamsHandler) GetSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, _, ok := h.loadSession(w, r)
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, "", session)
+}
+
+// CreateSessionHandler schedules an exam session, refusing it with a 409 listing the conflicts when one of its
+// classes or rooms is already taken at that time
+func (h *ExamsHandler) CreateSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if !examsAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var session models.ExamSession
+	err := json.NewDecoder(r.Body).Decode(&session)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	start, end, ok := h.validateSession(w, schoolId, &session)
+	if !ok {
+		return
+	}
+	conflicts, err := h.sessionConflicts(schoolId, 0, session, nil, start, end)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error creating the exam session", http.StatusInternalServerError)
+		return
+	}
+	if len(conflicts) > 0 {
+		writeExamConflicts(w, conflicts)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error creating the exam session", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO exam_sessions(school_id, course, title, starts_at, ends_at, duration_minutes, created_by) VALUES(?,?,?,?,?,?,?)",
+		schoolId, session.Course, session.Title, start.Format(calendar.DBTimeLayout), end.Format(calendar.DBTimeLayout), session.DurationMinutes, contextUsername(r),
+	)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the exam session", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error creating the exam session", http.StatusInternalServerError)
+		return
+	}
+	err = replaceSessionClassesAndRooms(tx, int(id), session)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the exam session", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error creating the exam session", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := h.sessionById(int(id))
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error creating the exam session", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionCreate, "exam_sessions", created.Id, nil, created)
+	writeCreated(w, created)
+}
+
+// UpdateSessionHandler replaces a session after checking it for conflicts again. The invigilators of the rooms it keeps
+// stay assigned, while the seating plan is cleared and has to be made again
+func (h *ExamsHandler) UpdateSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if !examsAccess.allow(w, r) {
+		return
+	}
+	before, schoolId, ok := h.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	var session models.ExamSession
+	err := json.NewDecoder(r.Body).Decode(&session)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	start, end, ok := h.validateSession(w, schoolId, &session)
+	if !ok {
+		return
+	}
+	kept := make([]int, 0)
+	for _, room := range before.Rooms {
+		if slices.Contains(session.RoomIds, room.Id) {
+			for _, invigilator := range room.Invigilators {
+				kept = append(kept, invigilator.TeacherId)
+			}
+		}
+	}
+	conflicts, err := h.sessionConflicts(schoolId, before.Id, session, kept, start, end)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error updating the exam session", http.StatusInternalServerError)
+		return
+	}
+	if len(conflicts) > 0 {
+		writeExamConflicts(w, conflicts)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error updating the exam session", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE exam_sessions SET course = ?, title = ?, starts_at = ?, ends_at = ?, duration_minutes = ? WHERE id = ?",
+		session.Course, session.Title, start.Format(calendar.DBTimeLayout), end.Format(calendar.DBTimeLayout), session.DurationMinutes, before.Id,
+	)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM exam_seats WHERE session_id = ?", before.Id)
+	}
+	if err == nil {
+		err = replaceSessionClassesAndRooms(tx, before.Id, session)
+	}
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error updating the exam session", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error updating the exam session", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := h.sessionById(before.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error updating the exam session", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionUpdate, "exam_sessions", updated.Id, before, updated)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteSessionHandler removes a session with its invigilators and seating plan
+func (h *ExamsHandler) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if !examsAccess.allow(w, r) {
+		return
+	}
+	before, _, ok := h.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := h.db.Exec("DELETE FROM exam_sessions WHERE id = ?", before.Id)
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, "Error deleting the exam session", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionDelete, "exam_sessions", before.Id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSessionConflictsHandler checks a scheduled session again, since students changing class or seating plans of
+// other sessions can create conflicts after it was scheduled
+func (h *ExamsHandler) GetSessionConflictsHandler(w http.ResponseWriter, r *http.Request) {
+	session, schoolId, ok := h.loadSession(w, r)
+	if !ok {
+		return
+	}
+	conflicts, err := h.conflictsOf(schoolId, session)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error checking the exam session", http.StatusInternalServerError)
+		return
+	}
+	writeList(w, r, conflicts)
+}
+
+// SetInvigilatorsHandler replaces the invigilators of a session with [{room_id, teacher_id}]. A teacher watches over
+// one room at a time and cannot invigilate two sessions that overlap
+func (h *ExamsHandler) SetInvigilatorsHandler(w http.ResponseWriter, r *http.Request) {
+	if !examsAccess.allow(w, r) {
+		return
+	}
+	session, schoolId, ok := h.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	var invigilators []models.ExamInvigilator
+	err := json.NewDecoder(r.Body).Decode(&invigilators)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	teacherIds := make([]int, 0, len(invigilators))
+	for i, invigilator := range invigilators {
+		if !slices.ContainsFunc(session.Rooms, func(room models.ExamSessionRoom) bool { return room.Id == invigilator.RoomId }) {
+			http.Error(w, fmt.Sprintf("invigilator %d: room %d is not booked for the session", i, invigilator.RoomId), http.StatusBadRequest)
+			return
+		}
+		if slices.Contains(teacherIds, invigilator.TeacherId) {
+			http.Error(w, fmt.Sprintf("invigilator %d: teacher %d is listed twice", i, invigilator.TeacherId), http.StatusBadRequest)
+			return
+		}
+		teacherIds = append(teacherIds, invigilator.TeacherId)
+	}
+	if len(teacherIds) > 0 {
+		placeholders, args := inList(teacherIds)
+		var found int
+		err = h.db.QueryRow("SELECT COUNT(*) FROM teachers WHERE school_id = ? AND "+notDeleted+" AND id IN "+placeholders, append([]any{schoolId}, args...)...).Scan(&found)
+		if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Error saving the invigilators", http.StatusInternalServerError)
+			return
+		}
+		if found != len(teacherIds) {
+			http.Error(w, "Every invigilator must be a teacher of the school", http.StatusBadRequest)
+			return
+		}
+	}
+
+	start, end, err := sessionSpan(session)
+	if err != nil {
+		log.Println("Exam session error:", err)
+		http.Error(w, "Error saving the invigilators", http.StatusInternalServerError)
+		return
+	}
+	conflicts, err := h.sessionConflicts(schoolId, session.Id, models.ExamSession{}, teacherIds, start, end)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error saving the invigilators", http.StatusInternalServerError)
+		return
+	}
+	if len(conflicts) > 0 {
+		writeExamConflicts(w, conflicts)
+		return
+	}
+
+	h.saveInvigilators(w, r, session, invigilators)
+}
+
+// AutoAssignInvigilatorsHandler gives every room of a session without an invigilator a teacher who is free at that
+// time, preferring teachers of other subjects than the exam's and those who have invigilated the least
+func (h *ExamsHandler) AutoAssignInvigilatorsHandler(w http.ResponseWriter, r *http.Request) {
+	if !examsAccess.allow(w, r) {
+		return
+	}
+	session, schoolId, ok := h.loadSession(w, r)
+	if !ok {
+		return
+	}
+	start, end, err := sessionSpan(session)
+	if err != nil {
+		log.Println("Exam session error:", err)
+		http.Error(w, "Error assigning the invigilators", http.StatusInternalServerError)
+		return
+	}
+
+	// Teachers invigilating an overlapping session are busy, the least used come first
+	rows, err := h.db.Query("SELECT t.id, t.subject FROM teachers t WHERE t.school_id = ? AND t.deleted_at IS NULL AND t.id NOT IN "+
+		"(SELECT i.teacher_id FROM exam_invigilators i JOIN exam_sessions s ON s.id = i.session_id WHERE s.id <> ? AND s.school_id = ? AND s.starts_at < ? AND s.ends_at > ?) "+
+		"ORDER BY (SELECT COUNT(*) FROM exam_invigilators i WHERE i.teacher_id = t.id), t.id",
+		schoolId, session.Id, schoolId, end.Format(calendar.DBTimeLayout), start.Format(calendar.DBTimeLayout),
+	)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error assigning the invigilators", http.StatusInternalServerError)
+		return
+	}
+	free := make([]int, 0)
+	sameSubject := make([]int, 0)
+	for rows.Next() {
+		var id int
+		var subject string
+		err = rows.Scan(&id, &subject)
+		if err != nil {
+			rows.Close()
+			log.Println("Scan error:", err)
+			http.Error(w, "Error assigning the invigilators", http.StatusInternalServerError)
+			return
+		}
+		if strings.EqualFold(subject, session.Course) {
+			sameSubject = append(sameSubject, id)
+		} else {
+			free = append(free, id)
+		}
+	}
+	rows.Close()
+	free = append(free, sameSubject...)
+
+	invigilators := make([]models.ExamInvigilator, 0)
+	for _, room := range session.Rooms {
+		invigilators = append(invigilators, room.Invigilators...)
+	}
+	free = slices.DeleteFunc(free, func(id int) bool {
+		return slices.ContainsFunc(invigilators, func(invigilator models.ExamInvigilator) bool { return invigilator.TeacherId == id })
+	})
+	unassigned := make([]string, 0)
+	for _, room := range session.Rooms {
+		if len(room.Invigilators) > 0 {
+			continue
+		}
+		if len(free) == 0 {
+			unassigned = append(unassigned, room.Name)
+			continue
+		}
+		invigilators = append(invigilators, models.ExamInvigilator{RoomId: room.Id, TeacherId: free[0]})
+		free = free[1:]
+	}
+	if len(unassigned) > 0 {
+		http.Error(w, "Not enough teachers are free to invigilate "+strings.Join(unassigned, ", "), http.StatusConflict)
+		return
+	}
+
+	h.saveInvigilators(w, r, session, invigilators)
+}
+
+// saveInvigilators replaces the invigilators of a session and responds with the updated session
+func (h *ExamsHandler) saveInvigilators(w http.ResponseWriter, r *http.Request, session models.ExamSession, invigilators []models.ExamInvigilator) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error saving the invigilators", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM exam_invigilators WHERE session_id = ?", session.Id)
+	for _, invigilator := range invigilators {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT INTO exam_invigilators(session_id, teacher_id, room_id) VALUES(?,?,?)", session.Id, invigilator.TeacherId, invigilator.RoomId)
+	}
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error saving the invigilators", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error saving the invigilators", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := h.sessionById(session.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error saving the invigilators", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionUpdate, "exam_sessions", session.Id, map[string]any{"rooms": session.Rooms}, map[string]any{"rooms": updated.Rooms})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// CreateSeatingHandler makes the seating plan of a session, replacing the previous one. Students already seated in
+// an overlapping session are a conflict, and so are rooms too small for every student
+func (h *ExamsHandler) CreateSeatingHandler(w http.ResponseWriter, r *http.Request) {
+	if !examsAccess.allow(w, r) {
+		return
+	}
+	session, schoolId, ok := h.loadSession(w, r)
+	if !ok {
+		return
+	}
+
+	conflicts, err := h.conflictsOf(schoolId, session)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error making the seating plan", http.StatusInternalServerError)
+		return
+	}
+	conflicts = slices.DeleteFunc(conflicts, func(conflict models.ExamConflict) bool {
+		return conflict.Type != "class" && conflict.Type != "student"
+	})
+	if len(conflicts) > 0 {
+		writeExamConflicts(w, conflicts)
+		return
+	}
+
+	candidates, err := h.sessionCandidates(schoolId, session.Classes)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error making the seating plan", http.StatusInternalServerError)
+		return
+	}
+	rooms, err := h.roomsById(schoolId, sessionRoomIds(session))
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error making the seating plan", http.StatusInternalServerError)
+		return
+	}
+	seats, err := exams.Seat(candidates, rooms)
+	if errors.Is(err, exams.ErrNotEnoughSeats) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Seating error:", err)
+		http.Error(w, "Error making the seating plan", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error making the seating plan", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM exam_seats WHERE session_id = ?", session.Id)
+	for _, seat := range seats {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT INTO exam_seats(session_id, student_id, room_id, seat, seat_row, seat_column) VALUES(?,?,?,?,?,?)",
+			session.Id, seat.StudentId, seat.RoomId, seat.Seat, seat.Row, seat.Column,
+		)
+	}
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error making the seating plan", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error making the seating plan", http.StatusInternalServerError)
+		return
+	}
+
+	plan := models.ExamSeatingPlan{SessionId: session.Id, Seated: len(seats), Adjacent: exams.Adjacent(seats), Seats: seats}
+	audit.Record(h.db, r, audit.ActionCreate, "exam_seats", session.Id, nil, map[string]any{"seated": plan.Seated, "adjacent": plan.Adjacent})
+	writeCreated(w, plan)
+}
+
+// GetSeatingHandler returns the seating plan of a session, or of one room with ?room=
+func (h *ExamsHandler) GetSeatingHandler(w http.ResponseWriter, r *http.Request) {
+	session, _, ok := h.loadSession(w, r)
+	if !ok {
+		return
+	}
+	roomId := 0
+	if value := r.URL.Query().Get("room"); value != "" {
+		var err error
+		roomId, err = strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "room must be a room ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	seats, err := h.sessionSeats(session.Id, roomId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the seating plan", http.StatusInternalServerError)
+		return
+	}
+	writeJSONWithETag(w, r, "", models.ExamSeatingPlan{SessionId: session.Id, Seated: len(seats), Adjacent: exams.Adjacent(seats), Seats: seats})
+}
+
+// GetSeatingListHandler renders the seating list of one room of a session as a PDF to print and hang on the door
+func (h *ExamsHandler) GetSeatingListHandler(w http.ResponseWriter, r *http.Request) {
+	session, schoolId, ok := h.loadSession(w, r)
+	if !ok {
+		return
+	}
+	roomId, err := strconv.Atoi(r.PathValue("roomId"))
+	if err != nil {
+		http.Error(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	i := slices.IndexFunc(session.Rooms, func(room models.ExamSessionRoom) bool { return room.Id == roomId })
+	if i == -1 {
+		http.Error(w, "The room is not booked for the session", http.StatusNotFound)
+		return
+	}
+	room := session.Rooms[i]
+
+	seats, err := h.sessionSeats(session.Id, room.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the seating plan", http.StatusInternalServerError)
+		return
+	}
+	var school string
+	err = h.db.QueryRow("SELECT name FROM schools WHERE id = ?", schoolId).Scan(&school)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the seating plan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exams.SeatingListFilename(session, room)))
+	err = exams.RenderSeatingList(w, school, session, room, seats)
+	if err != nil {
+		log.Println("Seating list render error:", err)
+	}
+}
+
+// validateSession checks and normalizes a session, makes sure its rooms belong to the school and that it falls on a
+// school day, and returns its start and end. It writes the error response itself when the session is invalid
+func (h *ExamsHandler) validateSession(w http.ResponseWriter, schoolId int, session *models.ExamSession) (time.Time, time.Time, bool) {
+	session.Course = strings.TrimSpace(session.Course)
+	session.Title = strings.TrimSpace(session.Title)
+	if session.Course == "" {
+		http.Error(w, "course is required", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	if session.DurationMinutes < 1 || session.DurationMinutes > maxExamMinutes {
+		http.Error(w, fmt.Sprintf("duration_minutes must be between 1 and %d", maxExamMinutes), http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	start, end, err := sessionSpan(*session)
+	if err != nil {
+		http.Error(w, "starts_at must be a YYYY-MM-DDTHH:MM time", http.StatusBadRequest)
+		return start, end, false
+	}
+	session.EndsAt = end.Format(calendar.TimeLayout)
+
+	classes := make([]string, 0, len(session.Classes))
+	for _, class := range session.Classes {
+		class = strings.TrimSpace(class)
+		if class != "" && !slices.Contains(classes, class) {
+			classes = append(classes, class)
+		}
+	}
+	if len(classes) == 0 {
+		http.Error(w, "At least one class is required", http.StatusBadRequest)
+		return start, end, false
+	}
+	session.Classes = classes
+
+	slices.Sort(session.RoomIds)
+	session.RoomIds = slices.Compact(session.RoomIds)
+	if len(session.RoomIds) == 0 {
+		http.Error(w, "At least one room is required", http.StatusBadRequest)
+		return start, end, false
+	}
+	rooms, err := h.roomsById(schoolId, session.RoomIds)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return start, end, false
+	}
+	if len(rooms) != len(session.RoomIds) {
+		http.Error(w, "Every room must be an exam room of the school", http.StatusBadRequest)
+		return start, end, false
+	}
+
+	date := start.Format(calendar.DateLayout)
+	closed, err := calendar.NonSchoolDays(h.db, schoolId, date, date)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return start, end, false
+	}
+	if len(closed) > 0 {
+		http.Error(w, fmt.Sprintf("%s is not a school day (%s)", date, closed[0].Reason), http.StatusBadRequest)
+		return start, end, false
+	}
+	return start, end, true
+}
+
+// conflictsOf checks a scheduled session against the other sessions
+func (h *ExamsHandler) conflictsOf(schoolId int, session models.ExamSession) ([]models.ExamConflict, error) {
+	start, end, err := sessionSpan(session)
+	if err != nil {
+		return nil, err
+	}
+	session.RoomIds = sessionRoomIds(session)
+	teacherIds := make([]int, 0)
+	for _, room := range session.Rooms {
+		for _, invigilator := range room.Invigilators {
+			teacherIds = append(teacherIds, invigilator.TeacherId)
+		}
+	}
+	return h.sessionConflicts(schoolId, session.Id, session, teacherIds, start, end)
+}
+
+// sessionConflicts lists what clashes with a session planned from start to end with the classes and rooms of session
+// and the invigilators teacherIds, among the other sessions of the school overlapping that time:
+//   - class, the other session has one of the classes
+//   - student, a student of one of the classes is seated in the other session, after changing class
+//   - room, the other session uses one of the rooms
+//   - invigilator, one of the teachers invigilates the other session
+func (h *ExamsHandler) sessionConflicts(schoolId, sessionId int, session models.ExamSession, teacherIds []int, start, end time.Time) ([]models.ExamConflict, error) {
+	rows, err := h.db.Query("SELECT id, course, starts_at FROM exam_sessions WHERE school_id = ? AND id <> ? AND starts_at < ? AND ends_at > ?",
+		schoolId, sessionId, end.Format(calendar.DBTimeLayout), start.Format(calendar.DBTimeLayout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	overlapping := make(map[int]models.ExamConflict)
+	ids := make([]int, 0)
+	for rows.Next() {
+		var other models.ExamConflict
+		var startsAt string
+		err = rows.Scan(&other.SessionId, &other.Course, &startsAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		other.StartsAt = calendarTimeFromDB(startsAt)
+		overlapping[other.SessionId] = other
+		ids = append(ids, other.SessionId)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	conflicts := make([]models.ExamConflict, 0)
+	if len(ids) == 0 {
+		return conflicts, nil
+	}
+	sessions, sessionArgs := inList(ids)
+
+	type check struct {
+		kind   string
+		query  string
+		values []any
+	}
+	checks := make([]check, 0, 4)
+	if len(session.Classes) > 0 {
+		classes, classArgs := inList(session.Classes)
+		checks = append(checks,
+			check{"class", "SELECT session_id, class FROM exam_session_classes WHERE session_id IN " + sessions + " AND class IN " + classes,
+				append(slices.Clone(sessionArgs), classArgs...)},
+			check{"student", "SELECT es.session_id, CONCAT(st.first_name, ' ', st.last_name, ' (', st.class, ')') FROM exam_seats es JOIN students st ON st.id = es.student_id AND st.deleted_at IS NULL " +
+				"WHERE es.session_id IN " + sessions + " AND st.class IN " + classes + " AND st.class NOT IN (SELECT c.class FROM exam_session_classes c WHERE c.session_id = es.session_id)",
+				append(slices.Clone(sessionArgs), classArgs...)},
+		)
+	}
+	if len(session.RoomIds) > 0 {
+		rooms, roomArgs := inList(session.RoomIds)
+		checks = append(checks, check{"room", "SELECT sr.session_id, r.name FROM exam_session_rooms sr JOIN exam_rooms r ON r.id = sr.room_id WHERE sr.session_id IN " + sessions + " AND sr.room_id IN " + rooms,
+			append(slices.Clone(sessionArgs), roomArgs...)})
+	}
+	if len(teacherIds) > 0 {
+		teachers, teacherArgs := inList(teacherIds)
+		checks = append(checks, check{"invigilator", "SELECT i.session_id, CONCAT(t.first_name, ' ', t.last_name) FROM exam_invigilators i JOIN teachers t ON t.id = i.teacher_id WHERE i.session_id IN " + sessions + " AND i.teacher_id IN " + teachers,
+			append(slices.Clone(sessionArgs), teacherArgs...)})
+	}
+
+	for _, check := range checks {
+		rows, err := h.db.Query(check.query+" ORDER BY 1, 2", check.values...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			var detail string
+			err = rows.Scan(&id, &detail)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			conflict := overlapping[id]
+			conflict.Type = check.kind
+			conflict.Detail = detail
+			conflicts = append(conflicts, conflict)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return conflicts, nil
+}
+
+// loadSession reads the session of the path's {id} within the current school and returns it with its school,
+// writing the error response itself when it cannot
+func (h *ExamsHandler) loadSession(w http.ResponseWriter, r *http.Request) (models.ExamSession, int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid exam session ID", http.StatusBadRequest)
+		return models.ExamSession{}, 0, false
+	}
+
+	var schoolId int
+	tenant, tenantArgs := tenantCondition(r)
+	err = h.db.QueryRow("SELECT school_id FROM exam_sessions WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...).Scan(&schoolId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Exam session with that ID does not exist", http.StatusNotFound)
+		return models.ExamSession{}, 0, false
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return models.ExamSession{}, 0, false
+	}
+
+	session, err := h.sessionById(id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return session, 0, false
+	}
+	return session, schoolId, true
+}
+
+func (h *ExamsHandler) sessionById(id int) (models.ExamSession, error) {
+	sessions, err := h.querySessions("SELECT "+examSessionColumns+" FROM exam_sessions s WHERE s.id = ?", id)
+	if err != nil {
+		return models.ExamSession{}, err
+	}
+	if len(sessions) == 0 {
+		return models.ExamSession{}, sql.ErrNoRows
+	}
+	return sessions[0], nil
+}
+
+// querySessions runs a query selecting examSessionColumns and loads the classes, rooms and invigilators of the sessions
+func (h *ExamsHandler) querySessions(query string, args ...any) ([]models.ExamSession, error) {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]models.ExamSession, 0)
+	for rows.Next() {
+		session, err := scanExamSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return sessions, h.loadSessionDetails(sessions)
+}
+
+// scanExamSession reads a row of examSessionColumns
+func scanExamSession(row rowScanner) (models.ExamSession, error) {
+	var session models.ExamSession
+	var startsAt, endsAt string
+	err := row.Scan(&session.Id, &session.Course, &session.Title, &startsAt, &endsAt, &session.DurationMinutes,
+		&session.CreatedBy, &session.CreatedAt, &session.Candidates, &session.Seated,
+	)
+	session.StartsAt = calendarTimeFromDB(startsAt)
+	session.EndsAt = calendarTimeFromDB(endsAt)
+	session.Classes = make([]string, 0)
+	session.Rooms = make([]models.ExamSessionRoom, 0)
+	return session, err
+}
+
+// loadSessionDetails fills in the classes, rooms and invigilators of the sessions
+func (h *ExamsHandler) loadSessionDetails(sessions []models.ExamSession) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	byId := make(map[int]int, len(sessions))
+	ids := make([]int, 0, len(sessions))
+	for i, session := range sessions {
+		byId[session.Id] = i
+		ids = append(ids, session.Id)
+	}
+	placeholders, idArgs := inList(ids)
+
+	classRows, err := h.db.Query("SELECT session_id, class FROM exam_session_classes WHERE session_id IN "+placeholders+" ORDER BY class", idArgs...)
+	if err != nil {
+		return err
+	}
+	defer classRows.Close()
+	for classRows.Next() {
+		var id int
+		var class string
+		err = classRows.Scan(&id, &class)
+		if err != nil {
+			return err
+		}
+		session := &sessions[byId[id]]
+		session.Classes = append(session.Classes, class)
+	}
+	if err = classRows.Err(); err != nil {
+		return err
+	}
+
+	roomRows, err := h.db.Query("SELECT sr.session_id, r.id, r.name, r.capacity FROM exam_session_rooms sr JOIN exam_rooms r ON r.id = sr.room_id WHERE sr.session_id IN "+placeholders+" ORDER BY r.name", idArgs...)
+	if err != nil {
+		return err
+	}
+	defer roomRows.Close()
+	for roomRows.Next() {
+		var id int
+		room := models.ExamSessionRoom{Invigilators: make([]models.ExamInvigilator, 0)}
+		err = roomRows.Scan(&id, &room.Id, &room.Name, &room.Capacity)
+		if err != nil {
+			return err
+		}
+		session := &sessions[byId[id]]
+		session.Rooms = append(session.Rooms, room)
+	}
+	if err = roomRows.Err(); err != nil {
+		return err
+	}
+
+	invigilatorRows, err := h.db.Query("SELECT i.session_id, i.room_id, i.teacher_id, CONCAT(t.first_name, ' ', t.last_name) FROM exam_invigilators i JOIN teachers t ON t.id = i.teacher_id WHERE i.session_id IN "+placeholders+" ORDER BY t.last_name, t.first_name", idArgs...)
+	if err != nil {
+		return err
+	}
+	defer invigilatorRows.Close()
+	for invigilatorRows.Next() {
+		var id int
+		var invigilator models.ExamInvigilator
+		err = invigilatorRows.Scan(&id, &invigilator.RoomId, &invigilator.TeacherId, &invigilator.Name)
+		if err != nil {
+			return err
+		}
+		session := &sessions[byId[id]]
+		for i := range session.Rooms {
+			if session.Rooms[i].Id == invigilator.RoomId {
+				session.Rooms[i].Invigilators = append(session.Rooms[i].Invigilators, invigilator)
+			}
+		}
+	}
+	return invigilatorRows.Err()
+}
+
+// sessionCandidates lists the live students of the classes as seats still to be placed
+func (h *ExamsHandler) sessionCandidates(schoolId int, classes []string) ([]models.ExamSeat, error) {
+	placeholders, args := inList(classes)
+	rows, err := h.db.Query("SELECT id, first_name, last_name, class FROM students WHERE school_id = ? AND "+notDeleted+" AND class IN "+placeholders,
+		append([]any{schoolId}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := make([]models.ExamSeat, 0)
+	for rows.Next() {
+		var candidate models.ExamSeat
+		err = rows.Scan(&candidate.StudentId, &candidate.FirstName, &candidate.LastName, &candidate.Class)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, rows.Err()
+}
+
+// sessionSeats reads the seating plan of a session, of every room or only roomId's, leaving out deleted students
+func (h *ExamsHandler) sessionSeats(sessionId, roomId int) ([]models.ExamSeat, error) {
+	query := "SELECT " + examSeatColumns + " FROM exam_seats es JOIN exam_rooms r ON r.id = es.room_id JOIN students st ON st.id = es.student_id AND st.deleted_at IS NULL WHERE es.session_id = ?"
+	args := []any{sessionId}
+	if roomId != 0 {
+		query += " AND es.room_id = ?"
+		args = append(args, roomId)
+	}
+	rows, err := h.db.Query(query+" ORDER BY r.name, es.seat", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seats := make([]models.ExamSeat, 0)
+	for rows.Next() {
+		var seat models.ExamSeat
+		err = rows.Scan(&seat.RoomId, &seat.RoomName, &seat.Seat, &seat.Row, &seat.Column, &seat.StudentId, &seat.FirstName, &seat.LastName, &seat.Class)
+		if err != nil {
+			return nil, err
+		}
+		seats = append(seats, seat)
+	}
+	return seats, rows.Err()
+}
+
+// roomsById reads the rooms of a school in the order of ids, leaving out the ones that do not exist
+func (h *ExamsHandler) roomsById(schoolId int, ids []int) ([]models.ExamRoom, error) {
+	if len(ids) == 0 {
+		return []models.ExamRoom{}, nil
+	}
+	placeholders, args := inList(ids)
+	rows, err := h.db.Query("SELECT id, name, capacity, seats_per_row, created_at FROM exam_rooms WHERE school_id = ? AND id IN "+placeholders,
+		append([]any{schoolId}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byId := make(map[int]models.ExamRoom)
+	for rows.Next() {
+		var room models.ExamRoom
+		err = rows.Scan(&room.Id, &room.Name, &room.Capacity, &room.SeatsPerRow, &room.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		byId[room.Id] = room
+	}
+	rooms := make([]models.ExamRoom, 0, len(byId))
+	for _, id := range ids {
+		if room, ok := byId[id]; ok {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms, rows.Err()
+}
+
+// loadRoom reads the room of the path's {id} within the current school, writing the error response itself when it cannot
+func (h *ExamsHandler) loadRoom(w http.ResponseWriter, r *http.Request) (models.ExamRoom, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid room ID", http.StatusBadRequest)
+		return models.ExamRoom{}, false
+	}
+
+	var room models.ExamRoom
+	tenant, tenantArgs := tenantCondition(r)
+	err = h.db.QueryRow("SELECT id, name, capacity, seats_per_row, created_at FROM exam_rooms WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...).Scan(
+		&room.Id, &room.Name, &room.Capacity, &room.SeatsPerRow, &room.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Room with that ID does not exist", http.StatusNotFound)
+		return room, false
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return room, false
+	}
+	return room, true
+}
+
+// replaceSessionClassesAndRooms sets the classes and rooms of a session. Rooms that are dropped take their
+// invigilators and seats with them
+func replaceSessionClassesAndRooms(tx *sql.Tx, sessionId int, session models.ExamSession) error {
+	_, err := tx.Exec("DELETE FROM exam_session_classes WHERE session_id = ?", sessionId)
+	if err != nil {
+		return err
+	}
+	for _, class := range session.Classes {
+		_, err = tx.Exec("INSERT INTO exam_session_classes(session_id, class) VALUES(?,?)", sessionId, class)
+		if err != nil {
+			return err
+		}
+	}
+
+	placeholders, args := inList(session.RoomIds)
+	_, err = tx.Exec("DELETE FROM exam_session_rooms WHERE session_id = ? AND room_id NOT IN "+placeholders, append([]any{sessionId}, args...)...)
+	if err != nil {
+		return err
+	}
+	for _, roomId := range session.RoomIds {
+		_, err = tx.Exec("INSERT IGNORE INTO exam_session_rooms(session_id, room_id) VALUES(?,?)", sessionId, roomId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateExamRoom checks a room, laying its seats out in a single row unless seats_per_row is given
+func validateExamRoom(room *models.ExamRoom) error {
+	room.Name = strings.TrimSpace(room.Name)
+	if room.Name == "" {
+		return errors.New("name is required")
+	}
+	if room.Capacity < 1 || room.Capacity > maxRoomCapacity {
+		return fmt.Errorf("capacity must be between 1 and %d", maxRoomCapacity)
+	}
+	if room.SeatsPerRow == 0 {
+		room.SeatsPerRow = room.Capacity
+	}
+	if room.SeatsPerRow < 1 || room.SeatsPerRow > room.Capacity {
+		return errors.New("seats_per_row must be between 1 and the capacity")
+	}
+	return nil
+}
+
+// sessionSpan returns when a session starts and ends
+func sessionSpan(session models.ExamSession) (time.Time, time.Time, error) {
+	start, err := time.Parse(calendar.TimeLayout, session.StartsAt)
+	if err != nil {
+		return start, start, err
+	}
+	return start, start.Add(time.Duration(session.DurationMinutes) * time.Minute), nil
+}
+
+func sessionRoomIds(session models.ExamSession) []int {
+	ids := make([]int, 0, len(session.Rooms))
+	for _, room := range session.Rooms {
+		ids = append(ids, room.Id)
+	}
+	return ids
+}
+
+// writeExamConflicts responds with a 409 listing the conflicts
+func writeExamConflicts(w http.ResponseWriter, conflicts []models.ExamConflict) {
+	response := struct {
+		Status    string                `json:"status"`
+		Conflicts []models.ExamConflict `json:"conflicts"`
+	}{
+		Status:    "conflict",
+		Conflicts: conflicts,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(response)
+}
+
+// calendarTimeFromDB converts a DATETIME value into the calendar's YYYY-MM-DDTHH:MM layout
+func calendarTimeFromDB(value string) string {
+	t, err := time.Parse(calendar.DBTimeLayout, value)
+	if err != nil {
+		return value
+	}
+	return t.Format(calendar.TimeLayout)
+}
+
+// inList returns the "(?,?)" placeholders and arguments of an IN condition over values, which must not be empty
+func inList[T any](values []T) (string, []any) {
+	args := make([]any, 0, len(values))
+	for _, value := range values {
+		args = append(args, value)
+	}
+	return "(?" + strings.Repeat(",?", len(values)-1) + ")", args
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"ClassConnect/internal/models"
+	"testing"
+)
+
+func TestValidateExamRoom(t *testing.T) {
+	tests := []struct {
+		name            string
+		room            models.ExamRoom
+		wantSeatsPerRow int
+		wantErr         bool
+	}{
+		{"seats per row kept", models.ExamRoom{Name: "Hall", Capacity: 30, SeatsPerRow: 6}, 6, false},
+		{"one row by default", models.ExamRoom{Name: "Lab", Capacity: 12}, 12, false},
+		{"largest room", models.ExamRoom{Name: "Gym", Capacity: maxRoomCapacity, SeatsPerRow: 20}, 20, false},
+		{"blank name", models.ExamRoom{Name: "  ", Capacity: 10}, 0, true},
+		{"no capacity", models.ExamRoom{Name: "Hall"}, 0, true},
+		{"too large", models.ExamRoom{Name: "Hall", Capacity: maxRoomCapacity + 1}, 0, true},
+		{"rows wider than the room", models.ExamRoom{Name: "Hall", Capacity: 10, SeatsPerRow: 11}, 0, true},
+		{"negative seats per row", models.ExamRoom{Name: "Hall", Capacity: 10, SeatsPerRow: -1}, 0, true},
+	}
+	for _, test := range tests {
+		room := test.room
+		err := validateExamRoom(&room)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: validateExamRoom() error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && room.SeatsPerRow != test.wantSeatsPerRow {
+			t.Errorf("%s: SeatsPerRow = %d, want %d", test.name, room.SeatsPerRow, test.wantSeatsPerRow)
+		}
+	}
+}
+
+func TestSessionSpan(t *testing.T) {
+	tests := []struct {
+		startsAt string
+		minutes  int
+		wantEnd  string
+		wantErr  bool
+	}{
+		{"2026-06-15T09:00", 90, "2026-06-15T10:30", false},
+		{"2026-06-15T23:00", 120, "2026-06-16T01:00", false},
+		{"2026-06-15 09:00", 90, "", true},
+		{"2026-06-15", 90, "", true},
+	}
+	for _, test := range tests {
+		start, end, err := sessionSpan(models.ExamSession{StartsAt: test.startsAt, DurationMinutes: test.minutes})
+		if (err != nil) != test.wantErr {
+			t.Errorf("sessionSpan(%q) error = %v, wantErr %v", test.startsAt, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := start.Format("2006-01-02T15:04"); got != test.startsAt {
+			t.Errorf("sessionSpan(%q) start = %s", test.startsAt, got)
+		}
+		if got := end.Format("2006-01-02T15:04"); got != test.wantEnd {
+			t.Errorf("sessionSpan(%q) end = %s, want %s", test.startsAt, got, test.wantEnd)
+		}
+	}
+}
+
+func TestInList(t *testing.T) {
+	tests := []struct {
+		values   []int
+		want     string
+		wantArgs int
+	}{
+		{[]int{7}, "(?)", 1},
+		{[]int{1, 2, 3}, "(?,?,?)", 3},
+	}
+	for _, test := range tests {
+		got, args := inList(test.values)
+		if got != test.want || len(args) != test.wantArgs {
+			t.Errorf("inList(%v) = %q with %d args, want %q with %d", test.values, got, len(args), test.want, test.wantArgs)
+		}
+	}
+}
@@ -1,23 +1,22 @@
 package handlers
 
 import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/jobs"
 	"ClassConnect/internal/models"
 	"ClassConnect/pkg/utils"
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
-
-	"github.com/go-mail/mail/v2"
-	"golang.org/x/crypto/argon2"
 )
 
 type ExecsHandler struct {
@@ -28,36 +27,46 @@ func NewExecsHandler(db *sql.DB) *ExecsHandler {
 	return &ExecsHandler{db: db}
 }
 
-func (h *ExecsHandler) GetExecsHandler(w http.ResponseWriter, _ *http.Request) {
-	rows, err := h.db.Query("SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, inactive_status, role FROM execs;")
+// execListColumns whitelists the exec fields list endpoints may filter, sort and select on
+var execListColumns = map[string]listColumn{
+	"id":              {column: "id", numeric: true},
+	"first_name":      {column: "first_name"},
+	"last_name":       {column: "last_name"},
+	"email":           {column: "email"},
+	"username":        {column: "username"},
+	"role":            {column: "role"},
+	"inactive_status": {column: "inactive_status", boolean: true},
+	"school_id":       {column: "school_id", numeric: true},
+}
+
+func (h *ExecsHandler) GetExecsHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListQuery(r.URL.Query(), execListColumns)
 	if err != nil {
-		log.Println("Query error:", err)
-		http.Error(w, "Error retrieving all the execs", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
-	execsList := make([]models.Exec, 0)
-	for rows.Next() {
-		var exec models.Exec
-		err = rows.Scan(&exec.Id, &exec.FirstName, &exec.LastName, &exec.Email, &exec.Username, &exec.Password, &exec.PasswordChangedAt, &exec.UserCreatedAt, &exec.PasswordResetCode, &exec.InactiveStatus, &exec.Role)
-		if err != nil {
-			log.Println("Scan error:", err)
-			http.Error(w, "Error scanning database results", http.StatusInternalServerError)
-			return
-		}
-		execsList = append(execsList, exec)
+
+	status, err := applyDeletedScope(r, &params)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
 	}
-	response := struct {
-		Status string        `json:"status"`
-		Count  int           `json:"count"`
-		Data   []models.Exec `json:"data"`
-	}{
-		Status: "success",
-		Count:  len(execsList),
-		Data:   execsList,
+	applyTenantScope(r, &params)
+
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+
+	result, err := queryPage(h.db, "execs", execColumns, params, pageParams, scanExec)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving all the execs", http.StatusInternalServerError)
+		return
+	}
+
+	writePage(w, r, result, params.fields)
 }
 
 func (h *ExecsHandler) GetExecByIdHandler(w http.ResponseWriter, r *http.Request) {
@@ -68,105 +77,101 @@ func (h *ExecsHandler) GetExecByIdHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var exec models.Exec
-	err = h.db.QueryRow("SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, inactive_status, role FROM execs WHERE id = ?", id).Scan(
-		&exec.Id,
-		&exec.FirstName,
-		&exec.LastName,
-		&exec.Email,
-		&exec.Username,
-		&exec.Password,
-		&exec.PasswordChangedAt,
-		&exec.UserCreatedAt,
-		&exec.PasswordResetCode,
-		&exec.InactiveStatus,
-		&exec.Role,
-	)
+	if r.URL.Query().Has("as_of") {
+		if _, err := h.getExecIncludingDeleted(r, id); err != nil {
+			http.Error(w, "Exec with that ID does not exist in the database!", http.StatusNotFound)
+			return
+		}
+		writeAsOf(w, r, h.db, "execs", execColumns, id, scanExec)
+		return
+	}
+
+	exec, err := h.getExec(r, id)
 	if err != nil {
 		log.Println("Query error:", err)
 		http.Error(w, "Exec with that ID does not exist in the database!", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(exec)
+	writeJSONWithETag(w, r, versionETag(exec.Version), exec)
 }
 
 func (h *ExecsHandler) CreateExecsHandler(w http.ResponseWriter, r *http.Request) {
+	atomic, err := getAtomicParam(r)
+	if err != nil {
+		http.Error(w, "Invalid atomic parameter", http.StatusBadRequest)
+		return
+	}
+
 	var newExecs []models.Exec
-	err := json.NewDecoder(r.Body).Decode(&newExecs)
+	err = json.NewDecoder(r.Body).Decode(&newExecs)
 	if err != nil {
 		http.Error(w, "Invalid Request body", http.StatusBadRequest)
 		return
 	}
 
-	stmt, err := h.db.Prepare("INSERT INTO execs(first_name, last_name, email, username, password, password_changed_at, password_reset_token, inactive_status, role) VALUES(?,?,?,?,?,?,?,?,?)")
-	if err != nil {
-		log.Println("Prepare error:", err)
-		http.Error(w, "Error in preparing SQL query", http.StatusInternalServerError)
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
 		return
 	}
-	defer stmt.Close()
 
-	addedExecs := make([]models.Exec, len(newExecs))
+	rows := make([]bulkRow, len(newExecs))
 	for i, newExec := range newExecs {
 		if newExec.Password == "" {
-			http.Error(w, "Password field cannot be empty", http.StatusBadRequest)
-			return
+			rows[i].err = validationError("password field cannot be empty")
+			continue
+		}
+		if !canAssignRole(r, newExec.Role) {
+			rows[i].err = validationError("only super admins may create super admins")
+			continue
 		}
 
-		salt := make([]byte, 16)
-		_, err := rand.Read(salt)
+		hashedPassword, err := utils.HashPassword(newExec.Password)
 		if err != nil {
 			http.Error(w, "Error generating the password hash", http.StatusInternalServerError)
 			return
 		}
 
-		hash := argon2.IDKey([]byte(newExec.Password), salt, 1, 64*1024, 4, 32)
-		saltBase64 := base64.StdEncoding.EncodeToString(salt)
-		hashBase64 := base64.StdEncoding.EncodeToString(hash)
-
-		encodedHash := fmt.Sprintf("%s.%s", saltBase64, hashBase64)
-		newExec.Password = encodedHash
-
-		res, err := stmt.Exec(
+		rows[i].args = []any{
 			newExec.FirstName,
 			newExec.LastName,
 			newExec.Email,
 			newExec.Username,
-			newExec.Password,
+			hashedPassword,
 			newExec.PasswordChangedAt,
 			newExec.PasswordResetCode,
 			newExec.InactiveStatus,
 			newExec.Role,
-		)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Error inserting data into the database", http.StatusInternalServerError)
-			return
+			contextUsername(r),
+			schoolId,
 		}
-		lastId, err := res.LastInsertId()
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Error getting last insert id", http.StatusInternalServerError)
-			return
+	}
+
+	results, err := bulkInsert(h.db, atomic, "INSERT INTO execs(first_name, last_name, email, username, password, password_changed_at, password_reset_token, inactive_status, role, updated_by, school_id) VALUES(?,?,?,?,?,?,?,?,?,?,?)", rows)
+	if err != nil && !errors.Is(err, errBulkRolledBack) {
+		log.Println(err)
+		http.Error(w, "Error inserting data into the database", http.StatusInternalServerError)
+		return
+	}
+
+	addedExecs := make([]models.Exec, 0, len(newExecs))
+	if err == nil {
+		for i, result := range results {
+			if result.Error != "" {
+				continue
+			}
+			newExecs[i].Id = result.Id
+			// Never echo the password back to the client
+			newExecs[i].Password = ""
+			addedExecs = append(addedExecs, newExecs[i])
 		}
-		newExec.Id = int(lastId)
-		addedExecs[i] = newExec
 	}
 
-	response := struct {
-		Status string        `json:"status"`
-		Count  int           `json:"count"`
-		Data   []models.Exec `json:"data"`
-	}{
-		Status: "success",
-		Count:  len(addedExecs),
-		Data:   addedExecs,
+	for _, added := range addedExecs {
+		recordChange(h.db, r, audit.ActionCreate, "execs", added.Id, nil, added)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
 
+	writeBulkResponse(w, results, err, addedExecs)
 }
 
 func (h *ExecsHandler) DeleteExecsHandler(w http.ResponseWriter, r *http.Request) {
@@ -177,14 +182,16 @@ func (h *ExecsHandler) DeleteExecsHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	res, err := h.db.Exec("DELETE FROM execs WHERE id = ?", id)
+	versions, wildcard, err := ifMatchVersions(r)
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "Error deleting the exec", http.StatusInternalServerError)
+		writePreconditionError(w, err)
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	// The previous state is kept for the audit log
+	before, _ := h.getExec(r, id)
+
+	rowsAffected, err := softDeleteRow(h.db, r, "execs", id, versions, wildcard)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Error deleting the exec", http.StatusInternalServerError)
@@ -192,11 +199,13 @@ func (h *ExecsHandler) DeleteExecsHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	if rowsAffected == 0 {
-		log.Println(err)
-		http.Error(w, "The exec does not exist", http.StatusInternalServerError)
+		h.writeExecWriteMiss(w, r, id)
 		return
 	}
 
+	after, _ := h.getExecIncludingDeleted(r, id)
+	recordChange(h.db, r, audit.ActionDelete, "execs", id, before, after)
+
 	response := struct {
 		Status string `json:"status"`
 		Id     int    `json:"id"`
@@ -224,22 +233,19 @@ func (h *ExecsHandler) UpdateExecsHandler(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Invalid request payload", http.StatusBadGateway)
 		return
 	}
+	if !canAssignRole(r, updatedExec.Role) {
+		http.Error(w, "Only super admins may grant the super admin role", http.StatusForbidden)
+		return
+	}
 
-	var existingExec models.Exec
-	err = h.db.QueryRow("SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, inactive_status, role FROM execs WHERE id = ?", id).Scan(
-		&existingExec.Id,
-		&existingExec.FirstName,
-		&existingExec.LastName,
-		&existingExec.Email,
-		&existingExec.Username,
-		&existingExec.Password,
-		&existingExec.PasswordChangedAt,
-		&existingExec.UserCreatedAt,
-		&existingExec.PasswordResetCode,
-		&existingExec.InactiveStatus,
-		&existingExec.Role,
-	)
-	// In case there are no rows, an error is still thrown
+	versions, wildcard, err := ifMatchVersions(r)
+	if err != nil {
+		writePreconditionError(w, err)
+		return
+	}
+
+	// The previous state is kept for the audit log and tells whether the role or status changes
+	before, err := h.getExec(r, id)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Exec with the given ID not found!", http.StatusNotFound)
 		return
@@ -247,28 +253,54 @@ func (h *ExecsHandler) UpdateExecsHandler(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
 		return
 	}
+	// Changing the role or status needs the same roles as changing them through PATCH
+	if updatedExec.Role != before.Role && !execPatchFields["role"].allows(contextRole(r)) {
+		writePatchError(w, fmt.Errorf("%w: %q", errPatchForbidden, "role"))
+		return
+	}
+	if updatedExec.InactiveStatus != before.InactiveStatus && !execPatchFields["inactive_status"].allows(contextRole(r)) {
+		writePatchError(w, fmt.Errorf("%w: %q", errPatchForbidden, "inactive_status"))
+		return
+	}
 
-	updatedExec.Id = existingExec.Id
-	_, err = h.db.Exec("UPDATE execs SET first_name = ?, last_name = ?, email = ?, username = ?, password = ?, password_changed_at = ?, password_reset_token = ?, inactive_status = ?, role = ? WHERE id = ?",
+	// Passwords and reset tokens are managed by the password endpoints and are never replaced here
+	tenant, tenantArgs := tenantCondition(r)
+	condition, conditionArgs := versionCondition(versions, wildcard)
+	args := []any{
 		updatedExec.FirstName,
 		updatedExec.LastName,
 		updatedExec.Email,
 		updatedExec.Username,
-		updatedExec.Password,
-		updatedExec.PasswordChangedAt,
-		updatedExec.PasswordResetCode,
 		updatedExec.InactiveStatus,
 		updatedExec.Role,
+		contextUsername(r),
 		id,
+	}
+	res, err := h.db.Exec("UPDATE execs SET first_name = ?, last_name = ?, email = ?, username = ?, inactive_status = ?, role = ?, version = version + 1, updated_by = ? WHERE id = ? AND "+notDeleted+tenant+condition,
+		append(append(args, tenantArgs...), conditionArgs...)...,
 	)
+	if isDuplicateEntry(err) {
+		http.Error(w, "An exec with that email or username already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Error updating the execs details", http.StatusInternalServerError)
+		return
+	}
 
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		http.Error(w, "Error updating the execs details", http.StatusInternalServerError)
 		return
 	}
+	if rowsAffected == 0 {
+		h.writeExecWriteMiss(w, r, id)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedExec)
+	after, ok := h.writeExec(w, r, id)
+	if ok {
+		recordChange(h.db, r, audit.ActionUpdate, "execs", id, before, after)
+	}
 }
 
 func (h *ExecsHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -288,18 +320,23 @@ func (h *ExecsHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Search for user if they exist in the database
 	var user models.Exec
+	var schoolId int
 	err = h.db.QueryRow(
-		"SELECT id, first_name, last_name, email, username, password, inactive_status, role FROM execs WHERE username = ?",
+		"SELECT id, first_name, last_name, email, username, password, inactive_status, role, school_id FROM execs WHERE username = ? AND "+notDeleted,
 		req.Username,
-	).Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Username, &user.Password, &user.InactiveStatus, &user.Role)
+	).Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Username, &user.Password, &user.InactiveStatus, &user.Role, &schoolId)
 
+	// Failed attempts are audited under the username that was tried
+	failedActor := audit.Actor{Username: req.Username}
 	if err != nil {
+		audit.RecordAs(h.db, r, failedActor, audit.ActionLoginFailed, "execs", nil, nil, map[string]string{"reason": "unknown username"})
 		http.Error(w, "Error locating the user in the database", http.StatusNotFound)
 		return
 	}
 
 	// Check if user is active
 	if user.InactiveStatus {
+		audit.RecordAs(h.db, r, failedActor, audit.ActionLoginFailed, "execs", user.Id, nil, map[string]string{"reason": "account inactive"})
 		http.Error(w, "Account is inactive", http.StatusForbidden)
 		return
 	}
@@ -307,17 +344,21 @@ func (h *ExecsHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Verify password
 	err = utils.VerifyPassword(req.Password, user.Password)
 	if err != nil {
+		audit.RecordAs(h.db, r, failedActor, audit.ActionLoginFailed, "execs", user.Id, nil, map[string]string{"reason": "incorrect password"})
 		http.Error(w, "Incorrect password", http.StatusForbidden)
 		return
 	}
 
 	// Generate JWT token
-	tokenString, err := utils.SignToken(strconv.Itoa(user.Id), user.Username, user.Role)
+	tokenString, err := utils.SignToken(strconv.Itoa(user.Id), user.Username, user.Role, strconv.Itoa(schoolId))
 	if err != nil {
 		http.Error(w, "Error generating JWT token", http.StatusInternalServerError)
 		return
 	}
 
+	actor := audit.Actor{Id: strconv.Itoa(user.Id), Username: user.Username, Role: user.Role}
+	audit.RecordAs(h.db, r, actor, audit.ActionLogin, "execs", user.Id, nil, nil)
+
 	// Send token as a response or as a cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:     "Bearer",
@@ -352,6 +393,9 @@ func (h *ExecsHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteStrictMode,
 	})
 
+	actor := audit.ActorFromRequest(r)
+	audit.Record(h.db, r, audit.ActionLogout, "execs", actor.Id, nil, nil)
+
 	w.Header().Set("Content-Type", "application/json")
 	response := struct {
 		Message string `json:"message"`
@@ -386,7 +430,9 @@ func (h *ExecsHandler) UpdatePasswordHandler(w http.ResponseWriter, r *http.Requ
 	var username string
 	var userPassword string
 	var role string
-	err = h.db.QueryRow("SELECT username, password, role FROM execs WHERE id = ?", userId).Scan(&username, &userPassword, &role)
+	var schoolId int
+	tenant, tenantArgs := tenantCondition(r)
+	err = h.db.QueryRow("SELECT username, password, role, school_id FROM execs WHERE id = ? AND "+notDeleted+tenant, append([]any{userId}, tenantArgs...)...).Scan(&username, &userPassword, &role, &schoolId)
 	if err != nil {
 		http.Error(w, "User with the ID does not exist", http.StatusNotFound)
 		return
@@ -407,14 +453,16 @@ func (h *ExecsHandler) UpdatePasswordHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Update the password in the database
-	_, err = h.db.Exec("UPDATE execs SET password = ?, password_changed_at = CURRENT_TIMESTAMP WHERE id = ?", hashedPassword, userId)
+	_, err = h.db.Exec("UPDATE execs SET password = ?, password_changed_at = CURRENT_TIMESTAMP, version = version + 1, updated_by = ? WHERE id = ?", hashedPassword, contextUsername(r), userId)
 	if err != nil {
 		log.Println("Update error:", err)
 		http.Error(w, "Error updating password", http.StatusInternalServerError)
 		return
 	}
 
-	tokenString, err := utils.SignToken(strconv.Itoa(userId), username, role)
+	audit.Record(h.db, r, audit.ActionPasswordChange, "execs", userId, nil, nil)
+
+	tokenString, err := utils.SignToken(strconv.Itoa(userId), username, role, strconv.Itoa(schoolId))
 	if err != nil {
 		http.Error(w, "Error generating JWT token", http.StatusInternalServerError)
 		return
@@ -467,7 +515,7 @@ func (h *ExecsHandler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Requ
 	log.Printf("Looking up user with email: %s\n", req.Email)
 
 	var exec models.Exec
-	err = h.db.QueryRow("SELECT id FROM execs WHERE email = ?", req.Email).Scan(&exec.Id)
+	err = h.db.QueryRow("SELECT id FROM execs WHERE email = ? AND "+notDeleted, req.Email).Scan(&exec.Id)
 	if err != nil {
 		log.Println("User lookup error:", err)
 		http.Error(w, "User with that email does not exist", http.StatusNotFound)
@@ -520,23 +568,17 @@ func (h *ExecsHandler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Requ
 	resetURL := fmt.Sprintf("http://localhost:3000/execs/resetPassword/%s", token)
 	message := fmt.Sprintf("Forgot your password? Reset your password using the following link: \n%s\n\nIf you didn't request a password reset, please ignore this email. This link is only valid for %d minutes", resetURL, duration)
 
-	log.Printf("Sending email to: %s\n", req.Email)
-
-	m := mail.NewMessage()
-	m.SetHeader("From", "schooladmin@school.com")
-	m.SetHeader("To", req.Email)
-	m.SetHeader("Subject", "Your password reset link")
-	m.SetBody("text/plain", message)
-
-	d := mail.NewDialer("localhost", 1025, "", "")
-	err = d.DialAndSend(m)
+	// The email goes out from the job queue so a slow or unavailable mail server does not hold up the request
+	_, err = jobs.Enqueue(h.db, 0, jobSendEmail, emailPayload{To: req.Email, Subject: "Your password reset link", Body: message}, "")
 	if err != nil {
-		log.Println("Email send error:", err)
+		log.Println("Email job error:", err)
 		http.Error(w, "Failed to send the email", http.StatusInternalServerError)
 		return
 	}
 
-	log.Println("Email sent successfully")
+	log.Printf("Queued the reset email to: %s\n", req.Email)
+
+	audit.RecordAs(h.db, r, audit.Actor{}, audit.ActionPasswordForgot, "execs", exec.Id, nil, nil)
 
 	// Respond with success message
 	response := struct {
@@ -597,7 +639,7 @@ func (h *ExecsHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Reque
 	log.Printf("Looking up hashed token in database...\n")
 
 	// Query without expiry check since schema doesn't have password_token_expires
-	query := "SELECT id, email FROM execs WHERE password_reset_token = ?"
+	query := "SELECT id, email FROM execs WHERE password_reset_token = ? AND " + notDeleted
 	err = h.db.QueryRow(query, hashedTokenString).Scan(&user.Id, &user.Email)
 	if err != nil {
 		log.Println("Database query error:", err)
@@ -620,7 +662,7 @@ func (h *ExecsHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	log.Println("Updating password in database...")
-	updateQuery := "UPDATE execs SET password = ?, password_reset_token = NULL, password_changed_at = CURRENT_TIMESTAMP WHERE id = ?"
+	updateQuery := "UPDATE execs SET password = ?, password_reset_token = NULL, password_changed_at = CURRENT_TIMESTAMP, version = version + 1, updated_by = username WHERE id = ?"
 	_, err = h.db.Exec(updateQuery, hashedPassword, user.Id)
 	if err != nil {
 		log.Println("Database update error:", err)
@@ -630,6 +672,8 @@ func (h *ExecsHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Reque
 
 	log.Println("Password reset successful")
 
+	audit.RecordAs(h.db, r, audit.Actor{Id: strconv.Itoa(user.Id)}, audit.ActionPasswordReset, "execs", user.Id, nil, nil)
+
 	response := struct {
 		Status  string `json:"status"`
 		Message string `json:"message"`
@@ -641,3 +685,218 @@ func (h *ExecsHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Reque
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// execPatchFields lists the exec fields that may be changed through PATCH /execs/{id}.
+// Passwords are only changed through the dedicated password endpoints
+var execPatchFields = map[string]patchField{
+	"first_name":      {column: "first_name"},
+	"last_name":       {column: "last_name"},
+	"email":           {column: "email"},
+	"username":        {column: "username"},
+	"inactive_status": {column: "inactive_status", kind: patchBool, roles: []string{"admin"}},
+	"role":            {column: "role", roles: []string{"admin"}},
+}
+
+func (h *ExecsHandler) PatchExecsHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid Exec ID", http.StatusBadRequest)
+		return
+	}
+
+	patch, err := decodeMergePatch(r)
+	if err != nil {
+		writePatchError(w, err)
+		return
+	}
+	var role string
+	if json.Unmarshal(patch["role"], &role) == nil && !canAssignRole(r, role) {
+		http.Error(w, "Only super admins may grant the super admin role", http.StatusForbidden)
+		return
+	}
+
+	versions, wildcard, err := ifMatchVersions(r)
+	if err != nil {
+		writePreconditionError(w, err)
+		return
+	}
+
+	// The previous state is kept for the audit log
+	before, _ := h.getExec(r, id)
+
+	query, args, err := buildPatchUpdate("execs", id, patch, execPatchFields, contextRole(r), contextUsername(r))
+	if err != nil {
+		writePatchError(w, err)
+		return
+	}
+
+	if query == "" {
+		// Nothing to change, but the precondition still has to hold
+		exec, err := h.getExec(r, id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Exec with the given ID not found!", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+			return
+		}
+		if !versionAccepted(exec.Version, versions, wildcard) {
+			writePreconditionError(w, errPreconditionFailed)
+			return
+		}
+		h.writeExec(w, r, id)
+		return
+	}
+
+	tenant, tenantArgs := tenantCondition(r)
+	condition, conditionArgs := versionCondition(versions, wildcard)
+	res, err := h.db.Exec(query+" AND "+notDeleted+tenant+condition, append(append(args, tenantArgs...), conditionArgs...)...)
+	if isDuplicateEntry(err) {
+		http.Error(w, "An exec with that email or username already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Patch error:", err)
+		http.Error(w, "Error updating the execs details", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		http.Error(w, "Error updating the execs details", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		h.writeExecWriteMiss(w, r, id)
+		return
+	}
+
+	after, ok := h.writeExec(w, r, id)
+	if ok {
+		recordChange(h.db, r, audit.ActionUpdate, "execs", id, before, after)
+	}
+}
+
+// GetExecHistoryHandler lists every stored version of a exec, including versions from before a soft delete
+func (h *ExecsHandler) GetExecHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Exec ID", http.StatusBadRequest)
+		return
+	}
+
+	// History rows carry no school, the live row decides whether the caller may see them
+	if _, err := h.getExecIncludingDeleted(r, id); err != nil {
+		http.Error(w, "No history found for that ID", http.StatusNotFound)
+		return
+	}
+
+	writeHistory(w, r, h.db, "execs", execColumns, id, scanExec)
+}
+
+// RestoreExecHandler brings back a soft-deleted exec, admin only
+func (h *ExecsHandler) RestoreExecHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := utils.AuthorizeUser(contextRole(r), "admin")
+	if err != nil {
+		http.Error(w, "Only admins may restore deleted records", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Exec ID", http.StatusBadRequest)
+		return
+	}
+
+	before, _ := h.getExecIncludingDeleted(r, id)
+	err = restoreRow(h.db, r, "execs", id)
+	if err != nil {
+		if !errors.Is(err, errRestoreNotFound) && !errors.Is(err, errRestoreNotDeleted) {
+			log.Println("Restore error:", err)
+		}
+		writeRestoreError(w, err)
+		return
+	}
+
+	after, ok := h.writeExec(w, r, id)
+	if ok {
+		recordChange(h.db, r, audit.ActionRestore, "execs", id, before, after)
+	}
+}
+
+// execExportSpec exports the same columns the list endpoint can filter on
+var execExportSpec = exportSpec{
+	resource:      "execs",
+	table:         "execs",
+	columns:       execListColumns,
+	defaultFields: []string{"id", "first_name", "last_name", "email", "username", "role", "inactive_status"},
+}
+
+func (h *ExecsHandler) ExportExecsHandler(w http.ResponseWriter, r *http.Request) {
+	handleExport(w, r, h.db, execExportSpec)
+}
+
+// execColumns lists the columns scanned by scanExec, in order.
+// Password hashes and reset tokens are deliberately left out so they are never sent to clients
+const execColumns = "id, first_name, last_name, email, username, password_changed_at, user_created_at, inactive_status, role, version, COALESCE(deleted_at, ''), COALESCE(deleted_by, '')"
+
+func scanExec(row rowScanner) (models.Exec, error) {
+	var exec models.Exec
+	err := row.Scan(
+		&exec.Id,
+		&exec.FirstName,
+		&exec.LastName,
+		&exec.Email,
+		&exec.Username,
+		&exec.PasswordChangedAt,
+		&exec.UserCreatedAt,
+		&exec.InactiveStatus,
+		&exec.Role,
+		&exec.Version,
+		&exec.DeletedAt,
+		&exec.DeletedBy,
+	)
+	return exec, err
+}
+
+func (h *ExecsHandler) getExec(r *http.Request, id int) (models.Exec, error) {
+	tenant, tenantArgs := tenantCondition(r)
+	return scanExec(h.db.QueryRow("SELECT "+execColumns+" FROM execs WHERE id = ? AND "+notDeleted+tenant, append([]any{id}, tenantArgs...)...))
+}
+
+// getExecIncludingDeleted also finds soft-deleted execs that have not been purged yet
+func (h *ExecsHandler) getExecIncludingDeleted(r *http.Request, id int) (models.Exec, error) {
+	tenant, tenantArgs := tenantCondition(r)
+	return scanExec(h.db.QueryRow("SELECT "+execColumns+" FROM execs WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...))
+}
+
+// writeExec responds with the current state of an exec after a successful write
+func (h *ExecsHandler) writeExec(w http.ResponseWriter, r *http.Request, id int) (models.Exec, bool) {
+	exec, err := h.getExec(r, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Exec with the given ID not found!", http.StatusNotFound)
+		return exec, false
+	} else if err != nil {
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return exec, false
+	}
+
+	w.Header().Set("ETag", versionETag(exec.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exec)
+	return exec, true
+}
+
+// writeExecWriteMiss explains why a conditional write touched no rows:
+// either the exec is gone or its version no longer matches If-Match
+func (h *ExecsHandler) writeExecWriteMiss(w http.ResponseWriter, r *http.Request, id int) {
+	_, err := h.getExec(r, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "The exec does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	writePreconditionError(w, errPreconditionFailed)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"ClassConnect/pkg/utils"
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// execRow answers one getExec lookup with an exec of the given role and status
+func execRow(role string, inactive bool) fakeStatement {
+	return fakeStatement{
+		sql:     "FROM execs WHERE id = ?",
+		columns: []string{"id", "first_name", "last_name", "email", "username", "password_changed_at", "user_created_at", "inactive_status", "role", "version", "deleted_at", "deleted_by"},
+		rows:    [][]driver.Value{{int64(5), "Ada", "Lovelace", "ada@school.org", "ada", nil, "2026-01-05 08:00:00", inactive, role, int64(3), "", ""}},
+	}
+}
+
+func TestUpdateExecsHandlerRoleChanges(t *testing.T) {
+	const unchanged = `"first_name":"Ada","last_name":"Lovelace","email":"ada@school.org","username":"ada"`
+	tests := []struct {
+		name       string
+		callerRole string
+		current    fakeStatement // the exec before the update, without rows when it does not exist
+		body       string
+		wantStatus int
+		wantUpdate bool
+	}{
+		{"manager promotes an account to admin", "manager", execRow("manager", false), `{` + unchanged + `,"role":"admin"}`, http.StatusForbidden, false},
+		{"teacher promotes an account to admin", "teacher", execRow("teacher", false), `{` + unchanged + `,"role":"admin"}`, http.StatusForbidden, false},
+		{"manager reactivates an account", "manager", execRow("manager", true), `{` + unchanged + `,"role":"manager","inactive_status":false}`, http.StatusForbidden, false},
+		{"manager renames an account", "manager", execRow("manager", false), `{"first_name":"Ada","last_name":"King","email":"ada@school.org","username":"ada","role":"manager"}`, http.StatusOK, true},
+		{"admin changes the role", "admin", execRow("manager", false), `{` + unchanged + `,"role":"admin"}`, http.StatusOK, true},
+		{"admin deactivates an account", "admin", execRow("manager", false), `{` + unchanged + `,"role":"manager","inactive_status":true}`, http.StatusOK, true},
+		{"unknown exec", "admin", fakeStatement{}, `{` + unchanged + `,"role":"admin"}`, http.StatusNotFound, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var script []fakeStatement
+			if test.current.rows != nil {
+				script = append(script, test.current, fakeStatement{sql: "UPDATE execs SET", affected: 1}, execRow("admin", false))
+			}
+			db, fake := newFakeDB(t, script...)
+			r := httptest.NewRequest("PUT", "/execs/5", strings.NewReader(test.body))
+			r.SetPathValue("id", "5")
+			r.Header.Set("If-Match", `"v3"`)
+			r = r.WithContext(context.WithValue(r.Context(), utils.ContextKey("role"), test.callerRole))
+			w := httptest.NewRecorder()
+
+			NewExecsHandler(db).UpdateExecsHandler(w, r)
+			if w.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, test.wantStatus, w.Body.String())
+			}
+			if got := fake.ran("UPDATE execs SET"); got != test.wantUpdate {
+				t.Errorf("UPDATE ran = %v, want %v", got, test.wantUpdate)
+			}
+		})
+	}
+}
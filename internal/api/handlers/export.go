@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"ClassConnect/internal/jobs"
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportSpec describes a collection that can be exported
+type exportSpec struct {
+	resource string
+	table    string
+	columns  map[string]listColumn
+	// defaultFields are exported, in order, when the request has no fields parameter
+	defaultFields []string
+}
+
+type exportFormat struct {
+	name        string
+	contentType string
+}
+
+var exportFormats = []exportFormat{
+	{name: "csv", contentType: "text/csv"},
+	{name: "xlsx", contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{name: "ndjson", contentType: "application/x-ndjson"},
+}
+
+// archiveFormat is the format of export jobs that bundle several files, such as a class's report cards.
+// It cannot be requested from the export endpoints
+var archiveFormat = exportFormat{name: "zip", contentType: "application/zip"}
+
+type ExportsHandler struct {
+	db *sql.DB
+}
+
+func NewExportsHandler(db *sql.DB) *ExportsHandler {
+	return &ExportsHandler{db: db}
+}
+
+// negotiateExportFormat picks the format from ?format= or, failing that, the Accept header. CSV is the default
+func negotiateExportFormat(r *http.Request) (exportFormat, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		if format, ok := findExportFormat(name); ok {
+			return format, nil
+		}
+		return exportFormat{}, fmt.Errorf("unsupported format %q, expected csv, xlsx or ndjson", name)
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		for _, format := range exportFormats {
+			if format.contentType == mediaType {
+				return format, nil
+			}
+		}
+	}
+	return exportFormats[0], nil
+}
+
+// handleExport implements GET /{resource}/export, honouring the same filter, sort and fields parameters as the list endpoint.
+// Rows are streamed straight from the database cursor to the client. With async=true the file is written in the
+// background and the response points at the export job instead
+func handleExport(w http.ResponseWriter, r *http.Request, db *sql.DB, spec exportSpec) {
+	_, err := utils.AuthorizeUser(contextRole(r), "admin", "manager")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	format, err := negotiateExportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	params, err := parseListQuery(r.URL.Query(), spec.columns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, err := applyDeletedScope(r, &params)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	applyTenantScope(r, &params)
+
+	async := false
+	if asyncStr := r.URL.Query().Get("async"); asyncStr != "" {
+		async, err = strconv.ParseBool(asyncStr)
+		if err != nil {
+			http.Error(w, "async must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if async {
+		job, err := startExportJob(db, r, spec, format)
+		if err != nil {
+			log.Println("Export job error:", err)
+			http.Error(w, "Error starting the export", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/exports/%d", job.Id))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", spec.resource, time.Now().Format("20060102-150405"), format.name)
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	_, err = writeExport(db, spec, params, format, w)
+	if err != nil {
+		// The status line is gone by now, all we can do is stop the stream and log
+		log.Println("Export error:", err)
+	}
+}
+
+// writeExport runs the export query and encodes each row as soon as it is scanned, returning the row count
+func writeExport(db *sql.DB, spec exportSpec, params listQuery, format exportFormat, out io.Writer) (int, error) {
+	fields := params.fields
+	if len(fields) == 0 {
+		fields = spec.defaultFields
+	}
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = spec.columns[field].column
+	}
+
+	conditions, args := params.conditions()
+	query := fmt.Sprintf("SELECT %s FROM %s%s%s", strings.Join(columns, ", "), spec.table, joinConditions(conditions), params.orderByClause(false))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	buffered := bufio.NewWriter(out)
+	encoder, err := newExportEncoder(format, buffered, fields)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	raw := make([]sql.NullString, len(fields))
+	dest := make([]any, len(fields))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(dest...)
+		if err != nil {
+			return count, err
+		}
+
+		values := make([]any, len(fields))
+		for i, field := range fields {
+			values[i] = exportValue(spec.columns[field], raw[i])
+		}
+		err = encoder.write(values)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	err = rows.Err()
+	if err != nil {
+		return count, err
+	}
+
+	err = encoder.close()
+	if err != nil {
+		return count, err
+	}
+	return count, buffered.Flush()
+}
+
+// exportValue converts a scanned column into the type its JSON field has
+func exportValue(column listColumn, raw sql.NullString) any {
+	if !raw.Valid {
+		return nil
+	}
+	switch {
+	case column.boolean:
+		return raw.String == "1" || strings.EqualFold(raw.String, "true")
+	case column.numeric:
+		if number, err := strconv.Atoi(raw.String); err == nil {
+			return number
+		}
+	}
+	return raw.String
+}
+
+// exportEncoder writes rows in one of the export formats
+type exportEncoder struct {
+	write func(values []any) error
+	close func() error
+}
+
+func newExportEncoder(format exportFormat, out io.Writer, fields []string) (exportEncoder, error) {
+	switch format.name {
+	case "xlsx":
+		xlsx, err := utils.NewXLSXWriter(out)
+		if err != nil {
+			return exportEncoder{}, err
+		}
+		header := make([]any, len(fields))
+		for i, field := range fields {
+			header[i] = field
+		}
+		err = xlsx.WriteRow(header)
+		return exportEncoder{write: xlsx.WriteRow, close: xlsx.Close}, err
+
+	case "ndjson":
+		encoder := json.NewEncoder(out)
+		return exportEncoder{
+			write: func(values []any) error {
+				record := make(map[string]any, len(fields))
+				for i, field := range fields {
+					record[field] = values[i]
+				}
+				return encoder.Encode(record)
+			},
+			close: func() error { return nil },
+		}, nil
+	}
+
+	writer := csv.NewWriter(out)
+	err := writer.Write(fields)
+	return exportEncoder{
+		write: func(values []any) error {
+			record := make([]string, len(values))
+			for i, value := range values {
+				if value != nil {
+					record[i] = fmt.Sprint(value)
+				}
+			}
+			return writer.Write(record)
+		},
+		close: func() error {
+			writer.Flush()
+			return writer.Error()
+		},
+	}, err
+}
+
+// exportDir is where asynchronous exports are written, configurable through EXPORT_DIR
+func exportDir() string {
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "classconnect-exports")
+	}
+	return dir
+}
+
+// exportPayload is the job that writes an asynchronous export. The query string is parsed again by the job,
+// it was validated and the include_deleted permission checked when the export was requested
+type exportPayload struct {
+	ExportJobId    int    `json:"export_job_id"`
+	Resource       string `json:"resource"`
+	Query          string `json:"query"`
+	Format         string `json:"format"`
+	IncludeDeleted bool   `json:"include_deleted"`
+}
+
+// exportSpecs finds the spec of an export job's resource
+var exportSpecs = map[string]exportSpec{
+	studentExportSpec.resource: studentExportSpec,
+	teacherExportSpec.resource: teacherExportSpec,
+	execExportSpec.resource:    execExportSpec,
+}
+
+// startExportJob records a pending export and queues the job that writes the file
+func startExportJob(db *sql.DB, r *http.Request, spec exportSpec, format exportFormat) (models.ExportJob, error) {
+	job := models.ExportJob{Resource: spec.resource, SchoolId: contextSchool(r), Format: format.name, Status: "pending", CreatedBy: contextUsername(r)}
+
+	res, err := db.Exec("INSERT INTO export_jobs(resource, school_id, format, status, created_by) VALUES(?,?,?,?,?)", job.Resource, job.SchoolId, job.Format, job.Status, job.CreatedBy)
+	if err != nil {
+		return job, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return job, err
+	}
+	job.Id = int(id)
+
+	includeDeleted, _ := strconv.ParseBool(r.URL.Query().Get("include_deleted"))
+	payload := exportPayload{ExportJobId: job.Id, Resource: spec.resource, Query: r.URL.RawQuery, Format: format.name, IncludeDeleted: includeDeleted}
+	_, err = jobs.Enqueue(db, job.SchoolId, jobWriteExport, payload, job.CreatedBy)
+	if err != nil {
+		finishExportJob(db, job.Id, "", 0, err)
+		return job, err
+	}
+	return job, nil
+}
+
+// runExportJob writes the file of an asynchronous export. The export job is only marked failed once the last attempt fails
+func runExportJob(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		var payload exportPayload
+		err := json.Unmarshal(job.Payload, &payload)
+		if err != nil {
+			return jobs.Permanent(err)
+		}
+		spec, ok := exportSpecs[payload.Resource]
+		format, formatOk := findExportFormat(payload.Format)
+		if !ok || !formatOk {
+			err = jobs.Permanent(fmt.Errorf("cannot export %s as %s", payload.Resource, payload.Format))
+			finishExportJob(db, payload.ExportJobId, "", 0, err)
+			return err
+		}
+
+		query, err := url.ParseQuery(payload.Query)
+		var params listQuery
+		if err == nil {
+			params, err = parseListQuery(query, spec.columns)
+		}
+		if err != nil {
+			err = jobs.Permanent(err)
+			finishExportJob(db, payload.ExportJobId, "", 0, err)
+			return err
+		}
+		if !payload.IncludeDeleted {
+			params.addScope(notDeleted)
+		}
+		if job.SchoolId != 0 {
+			params.addScope("school_id = ?", job.SchoolId)
+		}
+
+		path, count, err := writeExportFile(db, spec, params, format, payload.ExportJobId)
+		if err == nil || job.Final() {
+			finishExportJob(db, payload.ExportJobId, path, count, err)
+		}
+		return err
+	}
+}
+
+func findExportFormat(name string) (exportFormat, bool) {
+	for _, format := range exportFormats {
+		if format.name == name {
+			return format, true
+		}
+	}
+	return exportFormat{}, false
+}
+
+// finishExportJob marks a job completed with its file, or failed when writing the file returned an error
+func finishExportJob(db *sql.DB, jobId int, path string, count int, jobErr error) {
+	var err error
+	if jobErr != nil {
+		log.Printf("Export job %d failed: %v\n", jobId, jobErr)
+		_, err = db.Exec("UPDATE export_jobs SET status = 'failed', error = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?", "export failed", jobId)
+	} else {
+		_, err = db.Exec("UPDATE export_jobs SET status = 'completed', path = ?, row_count = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?", path, count, jobId)
+	}
+	if err != nil {
+		log.Printf("Error updating export job %d: %v\n", jobId, err)
+	}
+}
+
+func writeExportFile(db *sql.DB, spec exportSpec, params listQuery, format exportFormat, jobId int) (string, int, error) {
+	dir := exportDir()
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return "", 0, err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s-%d.%s", spec.resource, jobId, format.name))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	count, err := writeExport(db, spec, params, format, file)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+	return path, count, nil
+}
+
+// getExportJob loads a job along with the path of its file
+func (h *ExportsHandler) getExportJob(r *http.Request) (models.ExportJob, string, int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return models.ExportJob{}, "", http.StatusBadRequest, errors.New("invalid export ID")
+	}
+
+	var job models.ExportJob
+	var path, jobErr, createdBy, finishedAt sql.NullString
+	tenant, tenantArgs := tenantCondition(r)
+	err = h.db.QueryRow("SELECT id, resource, school_id, format, status, row_count, path, error, created_by, created_at, finished_at FROM export_jobs WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...).Scan(
+		&job.Id, &job.Resource, &job.SchoolId, &job.Format, &job.Status, &job.RowCount, &path, &jobErr, &createdBy, &job.CreatedAt, &finishedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return job, "", http.StatusNotFound, errors.New("export with that ID does not exist")
+	} else if err != nil {
+		log.Println("Query error:", err)
+		return job, "", http.StatusInternalServerError, errors.New("unable to retrieve data")
+	}
+	job.Error = jobErr.String
+	job.CreatedBy = createdBy.String
+	job.FinishedAt = finishedAt.String
+
+	// Exports are only visible to whoever started them and to admins
+	username, _ := r.Context().Value(utils.ContextKey("username")).(string)
+	if _, err := utils.AuthorizeUser(contextRole(r), "admin"); job.CreatedBy != username && err != nil {
+		return job, "", http.StatusNotFound, errors.New("export with that ID does not exist")
+	}
+
+	if job.Status == "completed" {
+		job.DownloadURL = fmt.Sprintf("/exports/%d/download", job.Id)
+	}
+	return job, path.String, http.StatusOK, nil
+}
+
+func (h *ExportsHandler) GetExportByIdHandler(w http.ResponseWriter, r *http.Request) {
+	job, _, status, err := h.getExportJob(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *ExportsHandler) DownloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	job, path, status, err := h.getExportJob(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if job.Status != "completed" {
+		http.Error(w, "The export has not completed yet", http.StatusConflict)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("Export file error:", err)
+		http.Error(w, "The export file is no longer available", http.StatusGone)
+		return
+	}
+	defer file.Close()
+
+	for _, format := range append(exportFormats, archiveFormat) {
+		if format.name == job.Format {
+			w.Header().Set("Content-Type", format.contentType)
+		}
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	io.Copy(w, file)
+}
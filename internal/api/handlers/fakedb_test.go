@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeStatement scripts the answer to one statement, matched on a fragment of its SQL.
+// Queries return columns and rows, other statements their last insert id and affected rows, unless err is set
+type fakeStatement struct {
+	sql      string
+	columns  []string
+	rows     [][]driver.Value
+	lastId   int64
+	affected int64
+	err      error
+}
+
+// fakeDB is a database/sql driver for handler tests. Every statement takes the first scripted answer whose fragment it
+// contains, each answer being used once. Queries without an answer return no rows and other statements change nothing
+type fakeDB struct {
+	mu        sync.Mutex
+	script    []fakeStatement
+	executed  []string
+	commits   int
+	rollbacks int
+}
+
+// newFakeDB opens a database answering from the script
+func newFakeDB(t *testing.T, script ...fakeStatement) (*sql.DB, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{script: script}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+// ran reports whether a statement containing the fragment was executed
+func (f *fakeDB) ran(fragment string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, query := range f.executed {
+		if strings.Contains(query, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeDB) answer(query string) fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.executed = append(f.executed, query)
+	for i, statement := range f.script {
+		if strings.Contains(query, statement.sql) {
+			f.script = append(f.script[:i:i], f.script[i+1:]...)
+			return statement
+		}
+	}
+	return fakeStatement{}
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{c.db}, nil }
+
+type fakeTx struct{ db *fakeDB }
+
+func (t fakeTx) Commit() error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+	t.db.commits++
+	return nil
+}
+
+func (t fakeTx) Rollback() error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+	t.db.rollbacks++
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	statement := s.db.answer(s.query)
+	if statement.err != nil {
+		return nil, statement.err
+	}
+	return fakeResult(statement), nil
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	statement := s.db.answer(s.query)
+	if statement.err != nil {
+		return nil, statement.err
+	}
+	return &fakeRows{columns: statement.columns, rows: statement.rows}, nil
+}
+
+type fakeResult fakeStatement
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastId, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
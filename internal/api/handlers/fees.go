@@ -0,0 +1,1286 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/fees"
+	"ClassConnect/internal/jobs"
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// paymentMethods are the ways a payment may have been made
+var paymentMethods = []string{"cash", "bank_transfer", "card", "cheque", "mobile_money", "other"}
+
+// discountKinds are the kinds of amounts taken off invoices
+var discountKinds = []string{"discount", "scholarship"}
+
+// maxFeeAmount is the largest amount a fee, discount or payment may be, as the DECIMAL(10,2) columns hold
+const maxFeeAmount = 99999999.99
+
+// feeStructureColumns are the columns scanFeeStructure reads, invoices counting those generated from the structure
+const feeStructureColumns = "id, name, academic_year_id, class, (SELECT COUNT(*) FROM invoices i WHERE i.fee_structure_id = fee_structures.id), COALESCE(created_by, ''), created_at"
+
+// feeDiscountColumns are the columns scanFeeDiscount reads
+const feeDiscountColumns = "id, student_id, academic_year_id, kind, description, percent, amount, COALESCE(created_by, ''), created_at"
+
+// feeStructureListColumns whitelists the fee structure fields the list may filter, sort and select on
+var feeStructureListColumns = map[string]listColumn{
+	"id":               {column: "id", numeric: true},
+	"name":             {column: "name"},
+	"academic_year_id": {column: "academic_year_id", numeric: true},
+	"class":            {column: "class"},
+	"created_by":       {column: "created_by"},
+	"created_at":       {column: "created_at"},
+}
+
+// feeDiscountListColumns whitelists the discount fields the list may filter, sort and select on
+var feeDiscountListColumns = map[string]listColumn{
+	"id":               {column: "id", numeric: true},
+	"student_id":       {column: "student_id", numeric: true},
+	"academic_year_id": {column: "academic_year_id", numeric: true},
+	"kind":             {column: "kind"},
+	"created_by":       {column: "created_by"},
+	"created_at":       {column: "created_at"},
+}
+
+// invoiceListColumns whitelists the invoice fields the list may filter, sort and select on
+var invoiceListColumns = map[string]listColumn{
+	"id":               {column: "i.id", numeric: true},
+	"student_id":       {column: "i.student_id", numeric: true},
+	"class":            {column: "s.class"},
+	"fee_structure_id": {column: "i.fee_structure_id", numeric: true},
+	"issue_date":       {column: "i.issue_date"},
+	"due_date":         {column: "i.due_date"},
+	"total":            {column: "i.total", numeric: true},
+	"created_by":       {column: "i.created_by"},
+}
+
+// feesAccess lets finance staff work on fees alongside admins and managers
+var feesAccess = roleAccess{roles: []string{"admin", "manager", "finance"}, denied: "Only admins, managers and finance staff may manage fees"}
+
+type FeesHandler struct {
+	db *sql.DB
+}
+
+func NewFeesHandler(db *sql.DB) *FeesHandler {
+	return &FeesHandler{db: db}
+}
+
+// GetStructuresHandler lists the fee structures of the school, latest year first, filtered by ?year= and the fields
+// of feeStructureListColumns
+func (h *FeesHandler) GetStructuresHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	params, err := parseListQuery(listValues(r.URL.Query(), "year"), feeStructureListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("-academic_year_id,class,name", feeStructureListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	applyTenantScope(r, &params)
+	if year := r.URL.Query().Get("year"); year != "" {
+		params.addScope("academic_year_id = ?", year)
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "fee_structures", feeStructureColumns, params, pageParams, scanFeeStructure)
+	if err == nil {
+		err = h.loadStructureItems(result.records)
+	}
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the fee structures", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+func (h *FeesHandler) GetStructureHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	structure, _, ok := h.loadStructure(w, r)
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, "", structure)
+}
+
+func (h *FeesHandler) CreateStructureHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var structure models.FeeStructure
+	err := json.NewDecoder(r.Body).Decode(&structure)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !h.validateStructure(w, schoolId, &structure) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error creating the fee structure", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO fee_structures(school_id, academic_year_id, class, name, created_by) VALUES(?,?,?,?,?)",
+		schoolId, structure.AcademicYearId, structure.Class, structure.Name, contextUsername(r),
+	)
+	if isDuplicateEntry(err) {
+		http.Error(w, "The class already has a fee structure with that name for the year", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the fee structure", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err == nil {
+		err = insertFeeItems(tx, int(id), structure.Items)
+	}
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the fee structure", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error creating the fee structure", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := h.structureById(int(id))
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error creating the fee structure", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionCreate, "fee_structures", created.Id, nil, created)
+	writeCreated(w, created)
+}
+
+// UpdateStructureHandler replaces a fee structure. Invoices already generated from it keep their lines
+func (h *FeesHandler) UpdateStructureHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	before, schoolId, ok := h.loadStructure(w, r)
+	if !ok {
+		return
+	}
+
+	var structure models.FeeStructure
+	err := json.NewDecoder(r.Body).Decode(&structure)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !h.validateStructure(w, schoolId, &structure) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error updating the fee structure", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE fee_structures SET academic_year_id = ?, class = ?, name = ? WHERE id = ?", structure.AcademicYearId, structure.Class, structure.Name, before.Id)
+	if isDuplicateEntry(err) {
+		http.Error(w, "The class already has a fee structure with that name for the year", http.StatusConflict)
+		return
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM fee_structure_items WHERE fee_structure_id = ?", before.Id)
+	}
+	if err == nil {
+		err = insertFeeItems(tx, before.Id, structure.Items)
+	}
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error updating the fee structure", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error updating the fee structure", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := h.structureById(before.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error updating the fee structure", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionUpdate, "fee_structures", updated.Id, before, updated)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteStructureHandler removes a fee structure no invoice was generated from
+func (h *FeesHandler) DeleteStructureHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	before, _, ok := h.loadStructure(w, r)
+	if !ok {
+		return
+	}
+	if before.Invoices > 0 {
+		http.Error(w, fmt.Sprintf("%d invoices were generated from the fee structure", before.Invoices), http.StatusConflict)
+		return
+	}
+
+	_, err := h.db.Exec("DELETE FROM fee_structures WHERE id = ?", before.Id)
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, "Error deleting the fee structure", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionDelete, "fee_structures", before.Id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GenerateInvoicesHandler invoices the students of a fee structure's class, as enrolled in its academic year, taking
+// off their standing discounts and scholarships for that year. Students already invoiced for the structure are skipped
+func (h *FeesHandler) GenerateInvoicesHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	structure, schoolId, ok := h.loadStructure(w, r)
+	if !ok {
+		return
+	}
+
+	var batch models.InvoiceBatch
+	err := json.NewDecoder(r.Body).Decode(&batch)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	issueDate, dueDate, err := invoiceDates(batch.IssueDate, batch.DueDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := `SELECT s.id FROM students s LEFT JOIN enrollments e ON e.student_id = s.id AND e.academic_year_id = ?
+		WHERE s.school_id = ? AND s.deleted_at IS NULL AND COALESCE(e.class, s.class) = ?
+		AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.fee_structure_id = ? AND i.student_id = s.id)`
+	args := []any{structure.AcademicYearId, schoolId, structure.Class, structure.Id}
+	if len(batch.StudentIds) > 0 {
+		placeholders, idArgs := inList(batch.StudentIds)
+		query += " AND s.id IN " + placeholders
+		args = append(args, idArgs...)
+	}
+	studentIds, err := h.queryIds(query+" ORDER BY s.last_name, s.first_name", args...)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error generating the invoices", http.StatusInternalServerError)
+		return
+	}
+	var invoiced int
+	err = h.db.QueryRow("SELECT COUNT(*) FROM invoices WHERE fee_structure_id = ?", structure.Id).Scan(&invoiced)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error generating the invoices", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error generating the invoices", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	createdIds := make([]int, 0, len(studentIds))
+	for _, studentId := range studentIds {
+		discounts, err := h.studentDiscounts(studentId, structure.AcademicYearId)
+		if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Error generating the invoices", http.StatusInternalServerError)
+			return
+		}
+		lines := make([]models.InvoiceLine, 0, len(structure.Items)+len(discounts))
+		for _, item := range structure.Items {
+			lines = append(lines, models.InvoiceLine{Kind: "fee", Description: item.Description, Amount: item.Amount})
+		}
+		for _, discount := range discounts {
+			lines = append(lines, fees.Discount(discount, structure.Total))
+		}
+
+		id, err := insertInvoice(tx, schoolId, studentId, structure.Id, issueDate, dueDate, "", lines, contextUsername(r))
+		if isDuplicateEntry(err) {
+			http.Error(w, "The invoices of the fee structure are being generated by another request", http.StatusConflict)
+			return
+		} else if err != nil {
+			log.Println("Insert error:", err)
+			http.Error(w, "Error generating the invoices", http.StatusInternalServerError)
+			return
+		}
+		createdIds = append(createdIds, id)
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error generating the invoices", http.StatusInternalServerError)
+		return
+	}
+
+	result := models.InvoiceBatchResult{Created: len(createdIds), Skipped: invoiced, Invoices: make([]models.Invoice, 0)}
+	if len(batch.StudentIds) > 0 {
+		result.Skipped = len(batch.StudentIds) - len(createdIds)
+	}
+	if len(createdIds) > 0 {
+		placeholders, idArgs := inList(createdIds)
+		result.Invoices, err = fees.Load(h.db, "i.id IN "+placeholders, idArgs...)
+		if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Error generating the invoices", http.StatusInternalServerError)
+			return
+		}
+	}
+	audit.Record(h.db, r, audit.ActionCreate, "invoices", structure.Id, nil, map[string]any{"fee_structure_id": structure.Id, "invoice_ids": createdIds})
+	writeCreated(w, result)
+}
+
+// GetDiscountsHandler lists the standing discounts and scholarships of the school, filtered by ?student=, ?year= and
+// the fields of feeDiscountListColumns
+func (h *FeesHandler) GetDiscountsHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	params, err := parseListQuery(listValues(r.URL.Query(), "student", "year"), feeDiscountListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("student_id", feeDiscountListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	applyTenantScope(r, &params)
+	for _, filter := range []struct{ param, condition string }{
+		{"student", "student_id = ?"},
+		{"year", "academic_year_id = ?"},
+	} {
+		if value := r.URL.Query().Get(filter.param); value != "" {
+			params.addScope(filter.condition, value)
+		}
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "fee_discounts", feeDiscountColumns, params, pageParams, scanFeeDiscount)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the discounts", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// CreateDiscountHandler gives a student a discount or scholarship on the invoices generated for an academic year
+func (h *FeesHandler) CreateDiscountHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var discount models.FeeDiscount
+	err := json.NewDecoder(r.Body).Decode(&discount)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	discount.Description = strings.TrimSpace(discount.Description)
+	if discount.Kind == "" {
+		discount.Kind = "discount"
+	}
+	err = validateDiscount(discount.Kind, discount.Description, discount.Percent, discount.Amount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var found int
+	err = h.db.QueryRow("SELECT (SELECT COUNT(*) FROM students WHERE id = ? AND school_id = ? AND "+notDeleted+") + (SELECT COUNT(*) FROM academic_years WHERE id = ? AND school_id = ?)",
+		discount.StudentId, schoolId, discount.AcademicYearId, schoolId,
+	).Scan(&found)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error creating the discount", http.StatusInternalServerError)
+		return
+	}
+	if found != 2 {
+		http.Error(w, "student_id and academic_year_id must be a student and an academic year of the school", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.db.Exec("INSERT INTO fee_discounts(school_id, student_id, academic_year_id, kind, description, percent, amount, created_by) VALUES(?,?,?,?,?,?,?,?)",
+		schoolId, discount.StudentId, discount.AcademicYearId, discount.Kind, discount.Description, discount.Percent, discount.Amount, contextUsername(r),
+	)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the discount", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error creating the discount", http.StatusInternalServerError)
+		return
+	}
+	discount.Id = int(id)
+	discount.CreatedBy = contextUsername(r)
+
+	audit.Record(h.db, r, audit.ActionCreate, "fee_discounts", discount.Id, nil, discount)
+	writeCreated(w, discount)
+}
+
+// DeleteDiscountHandler removes a standing discount. Invoices already generated keep it
+func (h *FeesHandler) DeleteDiscountHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid discount ID", http.StatusBadRequest)
+		return
+	}
+	tenant, tenantArgs := tenantCondition(r)
+	discounts, err := h.queryDiscounts("SELECT "+feeDiscountColumns+" FROM fee_discounts WHERE id = ?"+tenant,
+		append([]any{id}, tenantArgs...)...,
+	)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error deleting the discount", http.StatusInternalServerError)
+		return
+	}
+	if len(discounts) == 0 {
+		http.Error(w, "Discount with that ID does not exist", http.StatusNotFound)
+		return
+	}
+
+	_, err = h.db.Exec("DELETE FROM fee_discounts WHERE id = ?", id)
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, "Error deleting the discount", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionDelete, "fee_discounts", id, discounts[0], nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetInvoicesHandler lists the invoices of the school by due date, filtered by ?student=, ?structure=, ?status= (open,
+// partially_paid, paid, overdue or void; unpaid matches the first two and overdue) and the fields of invoiceListColumns
+func (h *FeesHandler) GetInvoicesHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	params, err := parseListQuery(listValues(r.URL.Query(), "student", "structure", "status"), invoiceListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("due_date", invoiceListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	applyTenantScopeOn(r, &params, "i.school_id")
+	for _, filter := range []struct{ param, condition string }{
+		{"student", "i.student_id = ?"},
+		{"structure", "i.fee_structure_id = ?"},
+	} {
+		if value := r.URL.Query().Get(filter.param); value != "" {
+			params.addScope(filter.condition, value)
+		}
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		condition, args := fees.StatusCondition(status, time.Now().Format(fees.DateLayout))
+		if condition == "" {
+			http.Error(w, "status must be open, partially_paid, paid, overdue, void or unpaid", http.StatusBadRequest)
+			return
+		}
+		params.addScope(condition, args...)
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, fees.Tables, fees.Columns, params, pageParams, func(row rowScanner) (models.Invoice, error) {
+		return fees.Scan(row)
+	})
+	if err == nil {
+		err = fees.LoadLines(h.db, result.records)
+	}
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the invoices", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// GetInvoiceHandler returns an invoice with its lines and payments
+func (h *FeesHandler) GetInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	invoice, _, ok := h.loadInvoice(w, r)
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, "", invoice)
+}
+
+// CreateInvoiceHandler bills a student for fees outside of any fee structure, {student_id, issue_date, due_date,
+// lines: [{description, amount}], notes}
+func (h *FeesHandler) CreateInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var invoice models.Invoice
+	err := json.NewDecoder(r.Body).Decode(&invoice)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	issueDate, dueDate, err := invoiceDates(invoice.IssueDate, invoice.DueDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(invoice.Lines) == 0 {
+		http.Error(w, "At least one line is required", http.StatusBadRequest)
+		return
+	}
+	for i := range invoice.Lines {
+		line := &invoice.Lines[i]
+		line.Kind = "fee"
+		line.Description = strings.TrimSpace(line.Description)
+		line.Amount = fees.Round(line.Amount)
+		if line.Description == "" || line.Amount <= 0 || line.Amount > maxFeeAmount {
+			http.Error(w, fmt.Sprintf("line %d: description and a positive amount are required", i), http.StatusBadRequest)
+			return
+		}
+	}
+	invoice.Notes = strings.TrimSpace(invoice.Notes)
+	if len(invoice.Notes) > 500 {
+		http.Error(w, "notes must be at most 500 characters", http.StatusBadRequest)
+		return
+	}
+	var exists int
+	err = h.db.QueryRow("SELECT COUNT(*) FROM students WHERE id = ? AND school_id = ? AND "+notDeleted, invoice.StudentId, schoolId).Scan(&exists)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error creating the invoice", http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		http.Error(w, "student_id must be a student of the school", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error creating the invoice", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	id, err := insertInvoice(tx, schoolId, invoice.StudentId, 0, issueDate, dueDate, invoice.Notes, invoice.Lines, contextUsername(r))
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the invoice", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error creating the invoice", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := h.invoiceById(id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error creating the invoice", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionCreate, "invoices", created.Id, nil, created)
+	writeCreated(w, created)
+}
+
+// AddInvoiceDiscountHandler takes a discount or scholarship off an invoice, {kind, description, percent | amount}.
+// Percentages are of the invoice's fees, and the discount may not exceed the balance
+func (h *FeesHandler) AddInvoiceDiscountHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	before, _, ok := h.loadInvoice(w, r)
+	if !ok {
+		return
+	}
+	if before.Status == fees.StatusVoid {
+		http.Error(w, "The invoice is void", http.StatusConflict)
+		return
+	}
+
+	var discount models.FeeDiscount
+	err := json.NewDecoder(r.Body).Decode(&discount)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	discount.Description = strings.TrimSpace(discount.Description)
+	if discount.Kind == "" {
+		discount.Kind = "discount"
+	}
+	err = validateDiscount(discount.Kind, discount.Description, discount.Percent, discount.Amount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	line := fees.Discount(discount, before.Subtotal)
+	if line.Amount > before.Balance {
+		http.Error(w, fmt.Sprintf("The discount of %.2f exceeds the balance of %.2f", line.Amount, before.Balance), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error adding the discount", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO invoice_lines(invoice_id, kind, description, amount) VALUES(?,?,?,?)", before.Id, line.Kind, line.Description, line.Amount)
+	if err == nil {
+		_, err = tx.Exec("UPDATE invoices SET total = ? WHERE id = ?", fees.Total(append(slices.Clone(before.Lines), line)), before.Id)
+	}
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error adding the discount", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error adding the discount", http.StatusInternalServerError)
+		return
+	}
+
+	h.respondInvoice(w, r, before, "Error adding the discount")
+}
+
+// VoidInvoiceHandler cancels an invoice without payments. Void invoices stay listed but are owed by nobody
+func (h *FeesHandler) VoidInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	before, _, ok := h.loadInvoice(w, r)
+	if !ok {
+		return
+	}
+	if before.Status == fees.StatusVoid {
+		http.Error(w, "The invoice is already void", http.StatusConflict)
+		return
+	}
+	if len(before.Payments) > 0 {
+		http.Error(w, "The invoice has payments, delete them before voiding it", http.StatusConflict)
+		return
+	}
+
+	_, err := h.db.Exec("UPDATE invoices SET voided_at = NOW(), voided_by = ? WHERE id = ? AND voided_at IS NULL", contextUsername(r), before.Id)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error voiding the invoice", http.StatusInternalServerError)
+		return
+	}
+	h.respondInvoice(w, r, before, "Error voiding the invoice")
+}
+
+// RemindInvoiceHandler emails the guardians of the student about an unpaid invoice right away
+func (h *FeesHandler) RemindInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	invoice, _, ok := h.loadInvoice(w, r)
+	if !ok {
+		return
+	}
+	if invoice.Status == fees.StatusVoid || invoice.Status == fees.StatusPaid {
+		http.Error(w, "Only unpaid invoices can be reminded about", http.StatusConflict)
+		return
+	}
+
+	reminder, err := fees.ReminderFor(h.db, invoice)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error sending the reminder", http.StatusInternalServerError)
+		return
+	}
+	if len(reminder.Recipients) == 0 {
+		http.Error(w, "The student has no active guardian account to remind", http.StatusConflict)
+		return
+	}
+	err = sendFeeReminder(h.db, reminder, contextUsername(r))
+	if err != nil {
+		log.Println("Enqueue error:", err)
+		http.Error(w, "Error sending the reminder", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "invoices", invoice.Id, map[string]any{"reminders": invoice.Reminders}, map[string]any{"reminders": invoice.Reminders + 1})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{"status": "queued", "recipients": reminder.Recipients})
+}
+
+// CreatePaymentHandler records a full or partial payment of an invoice, {amount, method, reference, paid_on}.
+// Payments above the balance are refused
+func (h *FeesHandler) CreatePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	before, schoolId, ok := h.loadInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	var payment models.Payment
+	err := json.NewDecoder(r.Body).Decode(&payment)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	payment.Amount = fees.Round(payment.Amount)
+	payment.Reference = strings.TrimSpace(payment.Reference)
+	if payment.Amount <= 0 {
+		http.Error(w, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+	if len(payment.Reference) > 255 {
+		http.Error(w, "reference must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(paymentMethods, payment.Method) {
+		http.Error(w, "method must be one of "+strings.Join(paymentMethods, ", "), http.StatusBadRequest)
+		return
+	}
+	today := time.Now().Format(fees.DateLayout)
+	if payment.PaidOn == "" {
+		payment.PaidOn = today
+	}
+	if _, err := time.Parse(fees.DateLayout, payment.PaidOn); err != nil || payment.PaidOn > today {
+		http.Error(w, "paid_on must be a YYYY-MM-DD date that is not in the future", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error recording the payment", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Locking the invoice keeps two payments recorded at once from paying more than the balance
+	var balance float64
+	var voided bool
+	err = tx.QueryRow("SELECT total - COALESCE((SELECT SUM(amount) FROM fee_payments WHERE invoice_id = invoices.id), 0), voided_at IS NOT NULL FROM invoices WHERE id = ? FOR UPDATE", before.Id).Scan(&balance, &voided)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error recording the payment", http.StatusInternalServerError)
+		return
+	}
+	if voided {
+		http.Error(w, "The invoice is void", http.StatusConflict)
+		return
+	}
+	if payment.Amount > fees.Round(balance) {
+		http.Error(w, fmt.Sprintf("The payment of %.2f exceeds the balance of %.2f", payment.Amount, balance), http.StatusBadRequest)
+		return
+	}
+
+	res, err := tx.Exec("INSERT INTO fee_payments(school_id, invoice_id, amount, method, reference, paid_on, recorded_by) VALUES(?,?,?,?,?,?,?)",
+		schoolId, before.Id, payment.Amount, payment.Method, payment.Reference, payment.PaidOn, contextUsername(r),
+	)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error recording the payment", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error recording the payment", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error recording the payment", http.StatusInternalServerError)
+		return
+	}
+	payment.Id = int(id)
+	payment.InvoiceId = before.Id
+	payment.RecordedBy = contextUsername(r)
+
+	audit.Record(h.db, r, audit.ActionCreate, "fee_payments", payment.Id, nil, payment)
+	updated, err := h.invoiceById(before.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error recording the payment", http.StatusInternalServerError)
+		return
+	}
+	writeCreated(w, updated)
+}
+
+// DeletePaymentHandler removes a payment recorded by mistake, the invoice is owed again
+func (h *FeesHandler) DeletePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	var payment models.Payment
+	tenant, tenantArgs := tenantCondition(r)
+	err = h.db.QueryRow("SELECT id, invoice_id, amount, method, COALESCE(reference, ''), paid_on, COALESCE(recorded_by, ''), created_at FROM fee_payments WHERE id = ?"+tenant,
+		append([]any{id}, tenantArgs...)...,
+	).Scan(&payment.Id, &payment.InvoiceId, &payment.Amount, &payment.Method, &payment.Reference, &payment.PaidOn, &payment.RecordedBy, &payment.CreatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Payment with that ID does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.db.Exec("DELETE FROM fee_payments WHERE id = ?", payment.Id)
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, "Error deleting the payment", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionDelete, "fee_payments", payment.Id, payment, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetStatementHandler returns the statement of a guardian account: the invoices of each of their children with the
+// balance owed across all of them
+func (h *FeesHandler) GetStatementHandler(w http.ResponseWriter, r *http.Request) {
+	if !feesAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+	guardianId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid guardian ID", http.StatusBadRequest)
+		return
+	}
+	h.writeStatement(w, r, schoolId, guardianId)
+}
+
+// GetOwnStatementHandler returns the statement of the guardian who is logged in
+func (h *FeesHandler) GetOwnStatementHandler(w http.ResponseWriter, r *http.Request) {
+	if contextRole(r) != utils.GuardianRole {
+		http.Error(w, "Only guardian accounts have a fee statement", http.StatusForbidden)
+		return
+	}
+	schoolId, guardianId, ok := messagingCaller(w, r)
+	if !ok {
+		return
+	}
+	h.writeStatement(w, r, schoolId, guardianId)
+}
+
+func (h *FeesHandler) writeStatement(w http.ResponseWriter, r *http.Request, schoolId, guardianId int) {
+	statement, err := fees.Statement(h.db, schoolId, guardianId)
+	if errors.Is(err, fees.ErrGuardianNotFound) {
+		http.Error(w, "Guardian with that ID does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error compiling the statement", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statement)
+}
+
+// respondInvoice audits a change of an invoice and responds with its new state
+func (h *FeesHandler) respondInvoice(w http.ResponseWriter, r *http.Request, before models.Invoice, failure string) {
+	updated, err := h.invoiceById(before.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, failure, http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionUpdate, "invoices", updated.Id, before, updated)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// loadInvoice reads the invoice of the path's {id} within the current school with its payments and returns it with
+// its school, writing the error response itself when it cannot
+func (h *FeesHandler) loadInvoice(w http.ResponseWriter, r *http.Request) (models.Invoice, int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return models.Invoice{}, 0, false
+	}
+
+	var schoolId int
+	tenant, tenantArgs := tenantCondition(r)
+	err = h.db.QueryRow("SELECT school_id FROM invoices WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...).Scan(&schoolId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invoice with that ID does not exist", http.StatusNotFound)
+		return models.Invoice{}, 0, false
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return models.Invoice{}, 0, false
+	}
+
+	invoice, err := h.invoiceById(id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return invoice, 0, false
+	}
+	return invoice, schoolId, true
+}
+
+func (h *FeesHandler) invoiceById(id int) (models.Invoice, error) {
+	invoices, err := fees.Load(h.db, "i.id = ?", id)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	if len(invoices) == 0 {
+		return models.Invoice{}, sql.ErrNoRows
+	}
+	invoice := invoices[0]
+	invoice.Payments, err = fees.LoadPayments(h.db, id)
+	return invoice, err
+}
+
+// loadStructure reads the fee structure of the path's {id} within the current school and returns it with its
+// school, writing the error response itself when it cannot
+func (h *FeesHandler) loadStructure(w http.ResponseWriter, r *http.Request) (models.FeeStructure, int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid fee structure ID", http.StatusBadRequest)
+		return models.FeeStructure{}, 0, false
+	}
+
+	var schoolId int
+	tenant, tenantArgs := tenantCondition(r)
+	err = h.db.QueryRow("SELECT school_id FROM fee_structures WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...).Scan(&schoolId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Fee structure with that ID does not exist", http.StatusNotFound)
+		return models.FeeStructure{}, 0, false
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return models.FeeStructure{}, 0, false
+	}
+
+	structure, err := h.structureById(id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return structure, 0, false
+	}
+	return structure, schoolId, true
+}
+
+func (h *FeesHandler) structureById(id int) (models.FeeStructure, error) {
+	structures, err := h.queryStructures("id = ?", id)
+	if err != nil {
+		return models.FeeStructure{}, err
+	}
+	if len(structures) == 0 {
+		return models.FeeStructure{}, sql.ErrNoRows
+	}
+	return structures[0], nil
+}
+
+// queryStructures reads the fee structures matching a condition with their items
+func (h *FeesHandler) queryStructures(condition string, args ...any) ([]models.FeeStructure, error) {
+	rows, err := h.db.Query("SELECT "+feeStructureColumns+" FROM fee_structures WHERE "+condition+" ORDER BY academic_year_id DESC, class, name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	structures := make([]models.FeeStructure, 0)
+	for rows.Next() {
+		structure, err := scanFeeStructure(rows)
+		if err != nil {
+			return nil, err
+		}
+		structures = append(structures, structure)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return structures, h.loadStructureItems(structures)
+}
+
+// scanFeeStructure reads a row of feeStructureColumns
+func scanFeeStructure(row rowScanner) (models.FeeStructure, error) {
+	var structure models.FeeStructure
+	err := row.Scan(&structure.Id, &structure.Name, &structure.AcademicYearId, &structure.Class, &structure.Invoices, &structure.CreatedBy, &structure.CreatedAt)
+	structure.Items = make([]models.FeeItem, 0)
+	return structure, err
+}
+
+// loadStructureItems reads the items of scanned fee structures and adds up their totals
+func (h *FeesHandler) loadStructureItems(structures []models.FeeStructure) error {
+	if len(structures) == 0 {
+		return nil
+	}
+	byId := make(map[int]int, len(structures))
+	ids := make([]int, 0, len(structures))
+	for i, structure := range structures {
+		byId[structure.Id] = i
+		ids = append(ids, structure.Id)
+	}
+	placeholders, idArgs := inList(ids)
+	itemRows, err := h.db.Query("SELECT fee_structure_id, description, amount FROM fee_structure_items WHERE fee_structure_id IN "+placeholders+" ORDER BY id", idArgs...)
+	if err != nil {
+		return err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var id int
+		var item models.FeeItem
+		err = itemRows.Scan(&id, &item.Description, &item.Amount)
+		if err != nil {
+			return err
+		}
+		structure := &structures[byId[id]]
+		structure.Items = append(structure.Items, item)
+		structure.Total = fees.Round(structure.Total + item.Amount)
+	}
+	return itemRows.Err()
+}
+
+func (h *FeesHandler) queryDiscounts(query string, args ...any) ([]models.FeeDiscount, error) {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discounts := make([]models.FeeDiscount, 0)
+	for rows.Next() {
+		discount, err := scanFeeDiscount(rows)
+		if err != nil {
+			return nil, err
+		}
+		discounts = append(discounts, discount)
+	}
+	return discounts, rows.Err()
+}
+
+// scanFeeDiscount reads a row of feeDiscountColumns
+func scanFeeDiscount(row rowScanner) (models.FeeDiscount, error) {
+	var discount models.FeeDiscount
+	err := row.Scan(&discount.Id, &discount.StudentId, &discount.AcademicYearId, &discount.Kind, &discount.Description, &discount.Percent, &discount.Amount, &discount.CreatedBy, &discount.CreatedAt)
+	return discount, err
+}
+
+func (h *FeesHandler) studentDiscounts(studentId, yearId int) ([]models.FeeDiscount, error) {
+	return h.queryDiscounts("SELECT "+feeDiscountColumns+" FROM fee_discounts WHERE student_id = ? AND academic_year_id = ? ORDER BY id",
+		studentId, yearId,
+	)
+}
+
+func (h *FeesHandler) queryIds(query string, args ...any) ([]int, error) {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// validateStructure checks and normalizes a fee structure and makes sure its academic year belongs to the school,
+// writing the error response itself when it is invalid
+func (h *FeesHandler) validateStructure(w http.ResponseWriter, schoolId int, structure *models.FeeStructure) bool {
+	structure.Name = strings.TrimSpace(structure.Name)
+	structure.Class = strings.TrimSpace(structure.Class)
+	if structure.Name == "" || structure.Class == "" {
+		http.Error(w, "name and class are required", http.StatusBadRequest)
+		return false
+	}
+	if len(structure.Items) == 0 {
+		http.Error(w, "At least one item is required", http.StatusBadRequest)
+		return false
+	}
+	for i := range structure.Items {
+		item := &structure.Items[i]
+		item.Description = strings.TrimSpace(item.Description)
+		item.Amount = fees.Round(item.Amount)
+		if item.Description == "" || item.Amount <= 0 || item.Amount > maxFeeAmount {
+			http.Error(w, fmt.Sprintf("item %d: description and a positive amount are required", i), http.StatusBadRequest)
+			return false
+		}
+	}
+
+	var exists int
+	err := h.db.QueryRow("SELECT COUNT(*) FROM academic_years WHERE id = ? AND school_id = ?", structure.AcademicYearId, schoolId).Scan(&exists)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return false
+	}
+	if exists == 0 {
+		http.Error(w, "academic_year_id must be an academic year of the school", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func insertFeeItems(tx *sql.Tx, structureId int, items []models.FeeItem) error {
+	for _, item := range items {
+		_, err := tx.Exec("INSERT INTO fee_structure_items(fee_structure_id, description, amount) VALUES(?,?,?)", structureId, item.Description, item.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertInvoice writes an invoice with its lines, structureId 0 being an invoice outside of any fee structure
+func insertInvoice(tx *sql.Tx, schoolId, studentId, structureId int, issueDate, dueDate, notes string, lines []models.InvoiceLine, createdBy string) (int, error) {
+	structure := sql.NullInt64{Int64: int64(structureId), Valid: structureId != 0}
+	res, err := tx.Exec("INSERT INTO invoices(school_id, student_id, fee_structure_id, issue_date, due_date, total, notes, created_by) VALUES(?,?,?,?,?,?,?,?)",
+		schoolId, studentId, structure, issueDate, dueDate, fees.Total(lines), notes, createdBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range lines {
+		_, err = tx.Exec("INSERT INTO invoice_lines(invoice_id, kind, description, amount) VALUES(?,?,?,?)", id, line.Kind, line.Description, line.Amount)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(id), nil
+}
+
+// sendFeeReminder queues one reminder email per guardian and records that the invoice was reminded about
+func sendFeeReminder(db *sql.DB, reminder fees.Reminder, createdBy string) error {
+	subject, body := fees.ReminderEmail(reminder.Invoice)
+	for _, recipient := range reminder.Recipients {
+		_, err := jobs.Enqueue(db, reminder.SchoolId, jobSendEmail, emailPayload{To: recipient, Subject: subject, Body: body}, createdBy)
+		if err != nil {
+			return err
+		}
+	}
+	return fees.MarkReminded(db, reminder.Invoice.Id)
+}
+
+// invoiceDates checks the dates of new invoices, the issue date defaulting to today
+func invoiceDates(issueDate, dueDate string) (string, string, error) {
+	if issueDate == "" {
+		issueDate = time.Now().Format(fees.DateLayout)
+	}
+	if _, err := time.Parse(fees.DateLayout, issueDate); err != nil {
+		return "", "", errors.New("issue_date must be a YYYY-MM-DD date")
+	}
+	if _, err := time.Parse(fees.DateLayout, dueDate); err != nil {
+		return "", "", errors.New("due_date must be a YYYY-MM-DD date")
+	}
+	if dueDate < issueDate {
+		return "", "", errors.New("due_date must not be before issue_date")
+	}
+	return issueDate, dueDate, nil
+}
+
+// validateDiscount checks a discount takes either a percentage or a fixed amount off
+func validateDiscount(kind, description string, percent, amount float64) error {
+	if !slices.Contains(discountKinds, kind) {
+		return errors.New("kind must be discount or scholarship")
+	}
+	if description == "" {
+		return errors.New("description is required")
+	}
+	if (percent > 0) == (amount > 0) || percent < 0 || amount < 0 {
+		return errors.New("either percent or amount is required")
+	}
+	if percent > 100 {
+		return errors.New("percent must be at most 100")
+	}
+	if amount > maxFeeAmount {
+		return fmt.Errorf("amount must be at most %.2f", maxFeeAmount)
+	}
+	return nil
+}
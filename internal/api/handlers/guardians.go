@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// guardiansAccess guards reading and linking the guardians of a student
+var guardiansAccess = roleAccess{roles: []string{"admin", "manager"}, denied: "Only admins and managers may manage a student's guardians"}
+
+// GetGuardiansHandler lists the guardian accounts of a student
+func (h *StudentHandler) GetGuardiansHandler(w http.ResponseWriter, r *http.Request) {
+	if !guardiansAccess.allow(w, r) {
+		return
+	}
+	studentId, _, ok := loadStudentSchool(h.db, w, r)
+	if !ok {
+		return
+	}
+
+	guardians, err := studentGuardians(h.db, studentId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the guardians", http.StatusInternalServerError)
+		return
+	}
+	writeList(w, r, guardians)
+}
+
+// SetGuardiansHandler replaces the guardians of a student. Each one must be an account of the school with the guardian role
+func (h *StudentHandler) SetGuardiansHandler(w http.ResponseWriter, r *http.Request) {
+	if !guardiansAccess.allow(w, r) {
+		return
+	}
+	studentId, schoolId, ok := loadStudentSchool(h.db, w, r)
+	if !ok {
+		return
+	}
+
+	var guardians []models.Guardian
+	err := json.NewDecoder(r.Body).Decode(&guardians)
+	if err != nil {
+		http.Error(w, "Invalid request body, expected a list of guardians", http.StatusBadRequest)
+		return
+	}
+	seen := make(map[int]bool)
+	for i, guardian := range guardians {
+		if seen[guardian.ExecId] {
+			http.Error(w, fmt.Sprintf("guardian %d: exec %d is listed twice", i, guardian.ExecId), http.StatusBadRequest)
+			return
+		}
+		seen[guardian.ExecId] = true
+
+		var role string
+		err = h.db.QueryRow("SELECT role FROM execs WHERE id = ? AND school_id = ? AND "+notDeleted, guardian.ExecId, schoolId).Scan(&role)
+		if err == sql.ErrNoRows || (err == nil && role != utils.GuardianRole) {
+			http.Error(w, fmt.Sprintf("guardian %d: exec %d is not a guardian account of the school", i, guardian.ExecId), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	before, err := studentGuardians(h.db, studentId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error saving the guardians", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM student_guardians WHERE student_id = ?", studentId)
+	for _, guardian := range guardians {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT INTO student_guardians(student_id, exec_id, school_id, relationship) VALUES(?,?,?,?)", studentId, guardian.ExecId, schoolId, guardian.Relationship)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error saving the guardians", http.StatusInternalServerError)
+		return
+	}
+
+	after, err := studentGuardians(h.db, studentId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the guardians", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionUpdate, "student_guardians", studentId, before, after)
+	writeList(w, r, after)
+}
+
+// studentGuardians lists the guardian accounts linked to a student
+func studentGuardians(db *sql.DB, studentId int) ([]models.Guardian, error) {
+	rows, err := db.Query(`SELECT e.id, TRIM(CONCAT(e.first_name, ' ', e.last_name)), e.email, COALESCE(g.relationship, '') FROM student_guardians g
+		JOIN execs e ON e.id = g.exec_id WHERE g.student_id = ? ORDER BY e.last_name, e.first_name`, studentId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	guardians := make([]models.Guardian, 0)
+	for rows.Next() {
+		var guardian models.Guardian
+		err = rows.Scan(&guardian.ExecId, &guardian.Name, &guardian.Email, &guardian.Relationship)
+		if err != nil {
+			return nil, err
+		}
+		guardians = append(guardians, guardian)
+	}
+	return guardians, rows.Err()
+}
+
+// guardianUserIds returns the exec ids of a student's guardians, the user ids events about the student are addressed to
+func guardianUserIds(db *sql.DB, studentId int) ([]string, error) {
+	guardians, err := studentGuardians(db, studentId)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(guardians))
+	for _, guardian := range guardians {
+		ids = append(ids, strconv.Itoa(guardian.ExecId))
+	}
+	return ids, nil
+}
+
+// guardianClasses returns the classes of a guardian's children
+func guardianClasses(db *sql.DB, execId string, schoolId int) ([]string, error) {
+	rows, err := db.Query("SELECT DISTINCT s.class FROM student_guardians g JOIN students s ON s.id = g.student_id AND s.deleted_at IS NULL WHERE g.exec_id = ? AND g.school_id = ?", execId, schoolId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	classes := make([]string, 0)
+	for rows.Next() {
+		var class string
+		err = rows.Scan(&class)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, class)
+	}
+	return classes, rows.Err()
+}
+
+// classGuardianIds returns the exec ids of the guardians of the students in the classes, as event user ids
+func classGuardianIds(db *sql.DB, schoolId int, classes []string) ([]string, error) {
+	args := []any{schoolId}
+	for _, class := range classes {
+		args = append(args, class)
+	}
+	rows, err := db.Query("SELECT DISTINCT g.exec_id FROM student_guardians g JOIN students s ON s.id = g.student_id AND s.deleted_at IS NULL WHERE g.school_id = ? AND s.class IN (?"+strings.Repeat(",?", len(classes)-1)+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, strconv.Itoa(id))
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"ClassConnect/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// historyTimeLayout matches how MariaDB renders the DATETIME(6) changed_at column
+const historyTimeLayout = "2006-01-02 15:04:05.000000"
+
+var errNotAtThatTime = errors.New("record did not exist at that time")
+
+// extraScanner passes a row through a resource's own scan function and reads the trailing columns into extra
+type extraScanner struct {
+	row   rowScanner
+	extra []any
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// scanHistory reads a history row selected with the resource columns followed by version, changed_by, changed_at and
+// whether the record was deleted. The history tables mirror the live columns, so the resource's scan function applies unchanged
+func scanHistory[T any](row rowScanner, scan func(rowScanner) (T, error)) (models.RecordVersion[T], bool, error) {
+	var version models.RecordVersion[T]
+	var changedBy sql.NullString
+	var deleted bool
+
+	var err error
+	version.Record, err = scan(extraScanner{row: row, extra: []any{&version.Version, &changedBy, &version.ChangedAt, &deleted}})
+	version.ChangedBy = changedBy.String
+	return version, deleted, err
+}
+
+// historyColumns appends the columns read by scanHistory to a resource's column list
+func historyColumns(columns string) string {
+	return columns + ", version, changed_by, changed_at, deleted_at IS NOT NULL"
+}
+
+// listHistory returns every stored version of a record, oldest first
+func listHistory[T any](db *sql.DB, table, columns string, id int, scan func(rowScanner) (T, error)) ([]models.RecordVersion[T], error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s_history WHERE id = ? ORDER BY version ASC", historyColumns(columns), table), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]models.RecordVersion[T], 0)
+	for rows.Next() {
+		version, _, err := scanHistory(rows, scan)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// recordAsOf returns the version of a record that was current at the given time.
+// A record that was soft-deleted at that time is reported like one that did not exist yet
+func recordAsOf[T any](db *sql.DB, table, columns string, id int, asOf time.Time, scan func(rowScanner) (T, error)) (models.RecordVersion[T], error) {
+	query := fmt.Sprintf("SELECT %s FROM %s_history WHERE id = ? AND changed_at <= ? ORDER BY version DESC LIMIT 1", historyColumns(columns), table)
+	version, deleted, err := scanHistory(db.QueryRow(query, id, asOf.UTC().Format(historyTimeLayout)), scan)
+	if err == sql.ErrNoRows || (err == nil && deleted) {
+		return version, errNotAtThatTime
+	}
+	return version, err
+}
+
+// writeHistory implements GET /{resource}/{id}/history
+func writeHistory[T any](w http.ResponseWriter, r *http.Request, db *sql.DB, table, columns string, id int, scan func(rowScanner) (T, error)) {
+	versions, err := listHistory(db, table, columns, id, scan)
+	if err != nil {
+		log.Println("History error:", err)
+		http.Error(w, "Error retrieving the history", http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "No history found for that ID", http.StatusNotFound)
+		return
+	}
+
+	response := struct {
+		Status string                    `json:"status"`
+		Count  int                       `json:"count"`
+		Data   []models.RecordVersion[T] `json:"data"`
+	}{
+		Status: "success",
+		Count:  len(versions),
+		Data:   versions,
+	}
+	writeJSONWithETag(w, r, "", response)
+}
+
+// writeAsOf implements GET /{resource}/{id}?as_of=<RFC 3339 timestamp>
+func writeAsOf[T any](w http.ResponseWriter, r *http.Request, db *sql.DB, table, columns string, id int, scan func(rowScanner) (T, error)) {
+	asOf, err := time.Parse(time.RFC3339, r.URL.Query().Get("as_of"))
+	if err != nil {
+		http.Error(w, "as_of must be an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+
+	version, err := recordAsOf(db, table, columns, id, asOf, scan)
+	if errors.Is(err, errNotAtThatTime) {
+		http.Error(w, "The record did not exist at that time", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("History error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONWithETag(w, r, versionETag(version.Version), version.Record)
+}
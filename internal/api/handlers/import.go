@@ -0,0 +1,518 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/models"
+	"ClassConnect/internal/webhooks"
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxImportSize = 10 << 20
+	maxImportRows = 50000
+	// importLookupChunk bounds the number of placeholders in the existing-email lookups
+	importLookupChunk = 500
+)
+
+// importField is a column of the target table that can be filled from a spreadsheet
+type importField struct {
+	name     string
+	required bool
+}
+
+// importSpec describes how spreadsheet rows map onto a table. Rows are matched on email for upserts
+type importSpec struct {
+	resource string
+	table    string
+	fields   []importField
+}
+
+// importRow is a validated spreadsheet row, keyed by field name
+type importRow struct {
+	number int
+	values map[string]string
+}
+
+type ImportsHandler struct {
+	db *sql.DB
+}
+
+func NewImportsHandler(db *sql.DB) *ImportsHandler {
+	return &ImportsHandler{db: db}
+}
+
+// handleImport implements POST /{resource}/import for a spreadsheet upload in the "file" form field.
+// An optional "mapping" field holds a JSON object from field name to spreadsheet header,
+// otherwise headers are matched to fields by name. With dry_run=true the file is only validated
+func handleImport(w http.ResponseWriter, r *http.Request, db *sql.DB, spec importSpec) {
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		http.Error(w, "Invalid upload, expected a multipart form of at most 10MB", http.StatusBadRequest)
+		return
+	}
+
+	dryRun := false
+	if dryRunStr := r.FormValue("dry_run"); dryRunStr != "" {
+		dryRun, err = strconv.ParseBool(dryRunStr)
+		if err != nil {
+			http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "The file field is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Error reading the uploaded file", http.StatusBadRequest)
+		return
+	}
+
+	rows, readErrors, err := utils.ReadSpreadsheet(header.Filename, data)
+	if err != nil {
+		log.Println("Spreadsheet error:", err)
+		http.Error(w, "Error reading the spreadsheet: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err, ok := readErrors[0]; ok {
+		http.Error(w, "Error reading the header row: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(rows) < 2 {
+		http.Error(w, "The spreadsheet needs a header row and at least one data row", http.StatusBadRequest)
+		return
+	}
+	if len(rows)-1 > maxImportRows {
+		http.Error(w, fmt.Sprintf("The spreadsheet has more than %d rows", maxImportRows), http.StatusBadRequest)
+		return
+	}
+
+	var requested map[string]string
+	if mappingStr := r.FormValue("mapping"); mappingStr != "" {
+		err = json.Unmarshal([]byte(mappingStr), &requested)
+		if err != nil {
+			http.Error(w, "mapping must be a JSON object of field name to column header", http.StatusBadRequest)
+			return
+		}
+	}
+
+	columns, mapping, missing, err := resolveImportMapping(spec, rows[0], requested)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(missing) > 0 {
+		// The client has to pick the columns for these fields before anything can be imported
+		response := struct {
+			Status  string            `json:"status"`
+			Headers []string          `json:"headers"`
+			Mapping map[string]string `json:"mapping"`
+			Missing []string          `json:"missing"`
+		}{
+			Status:  "mapping_required",
+			Headers: rows[0],
+			Mapping: mapping,
+			Missing: missing,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	job := models.ImportJob{
+		Resource:  spec.resource,
+		SchoolId:  schoolId,
+		Filename:  header.Filename,
+		DryRun:    dryRun,
+		TotalRows: len(rows) - 1,
+		Mapping:   mapping,
+		Errors:    make([]models.ImportRowError, 0),
+	}
+	job.CreatedBy, _ = r.Context().Value(utils.ContextKey("username")).(string)
+
+	valid := validateImportRows(spec, rows[1:], readErrors, columns, &job)
+
+	err = runImport(db, spec, valid, &job)
+	if err != nil {
+		log.Println("Import error:", err)
+		job.Status = "failed"
+		job.Created, job.Updated = 0, 0
+	}
+
+	job.Id, err = saveImportJob(db, job)
+	if err != nil {
+		log.Println("Import job error:", err)
+		http.Error(w, "Error recording the import job", http.StatusInternalServerError)
+		return
+	}
+
+	if job.Status == "failed" {
+		http.Error(w, "Error importing the spreadsheet, no rows were changed", http.StatusInternalServerError)
+		return
+	}
+
+	if !job.DryRun {
+		audit.Record(db, r, audit.ActionImport, spec.resource, job.Id, nil, job)
+		webhooks.Notify(db, job.SchoolId, strings.TrimSuffix(spec.resource, "s")+".imported", job)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// resolveImportMapping finds the spreadsheet column of every field.
+// It returns the column index per field, the header per field and the required fields left unmapped
+func resolveImportMapping(spec importSpec, headers []string, requested map[string]string) (map[string]int, map[string]string, []string, error) {
+	byHeader := make(map[string]int, len(headers))
+	for i, header := range headers {
+		byHeader[normalizeHeader(header)] = i
+	}
+
+	known := make(map[string]bool, len(spec.fields))
+	for _, field := range spec.fields {
+		known[field.name] = true
+	}
+	for field := range requested {
+		if !known[field] {
+			return nil, nil, nil, fmt.Errorf("unknown field %q in mapping", field)
+		}
+	}
+
+	columns := make(map[string]int)
+	mapping := make(map[string]string)
+	missing := make([]string, 0)
+	for _, field := range spec.fields {
+		header, explicit := requested[field.name]
+		if !explicit {
+			header = field.name
+		}
+
+		index, ok := byHeader[normalizeHeader(header)]
+		if !ok {
+			if explicit {
+				return nil, nil, nil, fmt.Errorf("column %q mapped to %q does not exist", header, field.name)
+			}
+			if field.required {
+				missing = append(missing, field.name)
+			}
+			continue
+		}
+		columns[field.name] = index
+		mapping[field.name] = headers[index]
+	}
+	return columns, mapping, missing, nil
+}
+
+// normalizeHeader lets "First Name", "first-name" and "FirstName" all match first_name
+func normalizeHeader(header string) string {
+	replacer := strings.NewReplacer(" ", "", "_", "", "-", "", ".", "")
+	return replacer.Replace(strings.ToLower(strings.TrimSpace(header)))
+}
+
+// validateImportRows checks every data row, recording errors on the job and returning the rows that can be imported.
+// readErrors holds the rows the spreadsheet could not be read in full, by their index in the file
+func validateImportRows(spec importSpec, rows [][]string, readErrors map[int]error, columns map[string]int, job *models.ImportJob) []importRow {
+	valid := make([]importRow, 0, len(rows))
+	seen := make(map[string]int)
+
+	for i, cells := range rows {
+		// The header is row 1 in the spreadsheet
+		number := i + 2
+		if err, ok := readErrors[i+1]; ok {
+			job.Errors = append(job.Errors, models.ImportRowError{Row: number, Error: err.Error()})
+			job.Skipped++
+			continue
+		}
+		row := importRow{number: number, values: make(map[string]string, len(spec.fields))}
+
+		empty := true
+		for field, index := range columns {
+			value := ""
+			if index < len(cells) {
+				value = strings.TrimSpace(cells[index])
+			}
+			empty = empty && value == ""
+			row.values[field] = value
+		}
+		if empty {
+			job.Skipped++
+			continue
+		}
+
+		rowErrors := make([]models.ImportRowError, 0)
+		for _, field := range spec.fields {
+			value := row.values[field.name]
+			switch {
+			case field.required && value == "":
+				rowErrors = append(rowErrors, models.ImportRowError{Row: number, Field: field.name, Error: "value is required"})
+			case len(value) > 255:
+				rowErrors = append(rowErrors, models.ImportRowError{Row: number, Field: field.name, Error: "value is longer than 255 characters"})
+			}
+		}
+
+		email := row.values["email"]
+		if email != "" {
+			address, err := mail.ParseAddress(email)
+			if err != nil || address.Address != email {
+				rowErrors = append(rowErrors, models.ImportRowError{Row: number, Field: "email", Error: "invalid email address"})
+			} else if previous, ok := seen[strings.ToLower(email)]; ok {
+				rowErrors = append(rowErrors, models.ImportRowError{Row: number, Field: "email", Error: fmt.Sprintf("duplicate of row %d", previous)})
+			} else {
+				seen[strings.ToLower(email)] = number
+			}
+		}
+
+		if len(rowErrors) > 0 {
+			job.Errors = append(job.Errors, rowErrors...)
+			job.Skipped++
+			continue
+		}
+		valid = append(valid, row)
+	}
+	return valid
+}
+
+// runImport upserts the valid rows by email inside a single transaction.
+// Rows identical to the stored record are counted as skipped. In dry-run mode nothing is written
+func runImport(db *sql.DB, spec importSpec, rows []importRow, job *models.ImportJob) error {
+	existing, deleted, err := loadExistingByEmail(db, spec, job.SchoolId, rows)
+	if err != nil {
+		return err
+	}
+
+	inserts := make([]importRow, 0)
+	updates := make([]importRow, 0)
+	for _, row := range rows {
+		email := strings.ToLower(row.values["email"])
+		current, ok := existing[email]
+		switch {
+		case deleted[email]:
+			// Updating a soft-deleted record would silently revive it with stale state
+			job.Errors = append(job.Errors, models.ImportRowError{Row: row.number, Field: "email", Error: "belongs to a deleted record, restore it before importing"})
+			job.Skipped++
+		case !ok:
+			inserts = append(inserts, row)
+		case importRowChanged(spec, row, current):
+			updates = append(updates, row)
+		default:
+			job.Skipped++
+		}
+	}
+
+	if job.DryRun {
+		job.Status = "validated"
+		job.Created = len(inserts)
+		job.Updated = len(updates)
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	fieldNames := make([]string, len(spec.fields))
+	setClauses := make([]string, len(spec.fields))
+	for i, field := range spec.fields {
+		fieldNames[i] = field.name
+		setClauses[i] = field.name + " = ?"
+	}
+
+	if len(inserts) > 0 {
+		insertStmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s(%s, updated_by, school_id) VALUES(?%s)", spec.table, strings.Join(fieldNames, ", "), strings.Repeat(",?", len(fieldNames)+1)))
+		if err != nil {
+			return err
+		}
+		defer insertStmt.Close()
+
+		for _, row := range inserts {
+			_, err = insertStmt.Exec(append(importArgs(spec, row), job.CreatedBy, job.SchoolId)...)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", row.number, err)
+			}
+		}
+	}
+
+	if len(updates) > 0 {
+		updateStmt, err := tx.Prepare(fmt.Sprintf("UPDATE %s SET %s, version = version + 1, updated_by = ? WHERE school_id = ? AND email = ?", spec.table, strings.Join(setClauses, ", ")))
+		if err != nil {
+			return err
+		}
+		defer updateStmt.Close()
+
+		for _, row := range updates {
+			_, err = updateStmt.Exec(append(importArgs(spec, row), job.CreatedBy, job.SchoolId, row.values["email"])...)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", row.number, err)
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	job.Status = "completed"
+	job.Created = len(inserts)
+	job.Updated = len(updates)
+	return nil
+}
+
+func importArgs(spec importSpec, row importRow) []any {
+	args := make([]any, len(spec.fields))
+	for i, field := range spec.fields {
+		args[i] = row.values[field.name]
+	}
+	return args
+}
+
+func importRowChanged(spec importSpec, row importRow, current map[string]string) bool {
+	for _, field := range spec.fields {
+		if row.values[field.name] != current[field.name] {
+			return true
+		}
+	}
+	return false
+}
+
+// loadExistingByEmail fetches the stored values of every row whose email appears in the import, keyed by lowercase email.
+// It also reports which of those emails belong to soft-deleted records
+func loadExistingByEmail(db *sql.DB, spec importSpec, schoolId int, rows []importRow) (map[string]map[string]string, map[string]bool, error) {
+	existing := make(map[string]map[string]string)
+	deleted := make(map[string]bool)
+	fieldNames := make([]string, len(spec.fields))
+	for i, field := range spec.fields {
+		fieldNames[i] = field.name
+	}
+
+	for start := 0; start < len(rows); start += importLookupChunk {
+		chunk := rows[start:min(start+importLookupChunk, len(rows))]
+		args := make([]any, 0, len(chunk)+1)
+		args = append(args, schoolId)
+		for _, row := range chunk {
+			args = append(args, row.values["email"])
+		}
+
+		query := fmt.Sprintf("SELECT %s, deleted_at IS NOT NULL FROM %s WHERE school_id = ? AND email IN (?%s)", strings.Join(fieldNames, ", "), spec.table, strings.Repeat(",?", len(chunk)-1))
+		dbRows, err := db.Query(query, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for dbRows.Next() {
+			values := make([]string, len(fieldNames))
+			var isDeleted bool
+			dest := make([]any, len(fieldNames), len(fieldNames)+1)
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			dest = append(dest, &isDeleted)
+			err = dbRows.Scan(dest...)
+			if err != nil {
+				dbRows.Close()
+				return nil, nil, err
+			}
+
+			current := make(map[string]string, len(fieldNames))
+			for i, name := range fieldNames {
+				current[name] = values[i]
+			}
+			email := strings.ToLower(current["email"])
+			existing[email] = current
+			if isDeleted {
+				deleted[email] = true
+			}
+		}
+		err = dbRows.Err()
+		dbRows.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return existing, deleted, nil
+}
+
+func saveImportJob(db *sql.DB, job models.ImportJob) (int, error) {
+	mapping, err := json.Marshal(job.Mapping)
+	if err != nil {
+		return 0, err
+	}
+	rowErrors, err := json.Marshal(job.Errors)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := db.Exec(`INSERT INTO import_jobs(resource, school_id, filename, status, dry_run, total_rows, created, updated, skipped, mapping, errors, created_by, finished_at)
+		VALUES(?,?,?,?,?,?,?,?,?,?,?,?,CURRENT_TIMESTAMP)`,
+		job.Resource, job.SchoolId, job.Filename, job.Status, job.DryRun, job.TotalRows, job.Created, job.Updated, job.Skipped, mapping, rowErrors, job.CreatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (h *ImportsHandler) GetImportByIdHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid import ID", http.StatusBadRequest)
+		return
+	}
+
+	var job models.ImportJob
+	var mapping, rowErrors []byte
+	var createdBy, finishedAt sql.NullString
+	tenant, tenantArgs := tenantCondition(r)
+	err = h.db.QueryRow(`SELECT id, resource, school_id, filename, status, dry_run, total_rows, created, updated, skipped, mapping, errors, created_by, created_at, finished_at
+		FROM import_jobs WHERE id = ?`+tenant, append([]any{id}, tenantArgs...)...).Scan(
+		&job.Id, &job.Resource, &job.SchoolId, &job.Filename, &job.Status, &job.DryRun, &job.TotalRows, &job.Created, &job.Updated, &job.Skipped,
+		&mapping, &rowErrors, &createdBy, &job.CreatedAt, &finishedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Import with that ID does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	job.CreatedBy = createdBy.String
+	job.FinishedAt = finishedAt.String
+
+	err = json.Unmarshal(mapping, &job.Mapping)
+	if err == nil {
+		err = json.Unmarshal(rowErrors, &job.Errors)
+	}
+	if err != nil {
+		http.Error(w, "Unable to decode the import job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"ClassConnect/internal/fees"
+	"ClassConnect/internal/jobs"
+	"ClassConnect/internal/models"
+	"ClassConnect/internal/retention"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// Job types run by the background workers
+const (
+	jobSendEmail        = "email.send"
+	jobWriteExport      = "exports.write"
+	jobWriteReportCards = "report_cards.write"
+	jobPurge            = "retention.purge"
+	jobPurgeMessages    = "messages.purge"
+	jobRemindFees       = "fees.remind"
+	jobCleanup          = "jobs.cleanup"
+	jobAnnounce         = "announcements.publish"
+)
+
+// jobListColumns whitelists the job fields the list may filter, sort and select on
+var jobListColumns = map[string]listColumn{
+	"id":         {column: "id", numeric: true},
+	"type":       {column: "type"},
+	"status":     {column: "status"},
+	"attempts":   {column: "attempts", numeric: true},
+	"run_at":     {column: "run_at"},
+	"created_by": {column: "created_by"},
+	"created_at": {column: "created_at"},
+}
+
+// jobColumns are the columns scanJob reads
+const jobColumns = "id, COALESCE(school_id, 0), type, status, attempts, max_attempts, run_at, COALESCE(last_error, ''), COALESCE(created_by, ''), created_at, COALESCE(started_at, ''), COALESCE(finished_at, '')"
+
+// emailPayload is a plain text email sent by the email.send job
+type emailPayload struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// RegisterJobs registers the handlers of every job type and the recurring jobs, before the workers and scheduler start
+func RegisterJobs(db *sql.DB) error {
+	jobs.Register(jobSendEmail, 0, sendEmailJob)
+	jobs.Register(jobWriteExport, 3, runExportJob(db))
+	jobs.Register(jobWriteReportCards, 3, runReportCardsJob(db))
+	jobs.Register(jobPurge, 3, func(ctx context.Context, job jobs.Job) error {
+		period := retention.RetentionPeriod()
+		purged, err := retention.Purge(db, period)
+		if purged > 0 {
+			log.Printf("Purged %d soft-deleted records older than %s\n", purged, period)
+		}
+		return err
+	})
+	jobs.Register(jobPurgeMessages, 3, func(ctx context.Context, job jobs.Job) error {
+		purged, err := retention.PurgeMessages(db, retention.MessageRetention())
+		if purged > 0 {
+			log.Printf("Purged %d messages past their retention period\n", purged)
+		}
+		return err
+	})
+	jobs.Register(jobRemindFees, 3, func(ctx context.Context, job jobs.Job) error {
+		reminders, err := fees.DueReminders(db, fees.ReminderInterval())
+		if err != nil {
+			return err
+		}
+		for _, reminder := range reminders {
+			err = sendFeeReminder(db, reminder, "")
+			if err != nil {
+				return err
+			}
+		}
+		if len(reminders) > 0 {
+			log.Printf("Reminded guardians about %d overdue invoices\n", len(reminders))
+		}
+		return nil
+	})
+	jobs.Register(jobCleanup, 3, func(ctx context.Context, job jobs.Job) error {
+		_, err := jobs.Cleanup(db, jobs.Retention())
+		return err
+	})
+	jobs.Register(jobAnnounce, 3, func(ctx context.Context, job jobs.Job) error {
+		published, err := publishDueAnnouncements(db)
+		if published > 0 {
+			log.Printf("Announced %d scheduled announcements\n", published)
+		}
+		return err
+	})
+
+	err := jobs.AddSchedule("purge-soft-deleted", retention.PurgeSchedule(), jobPurge)
+	if err != nil {
+		return err
+	}
+	err = jobs.AddSchedule("purge-messages", "0 4 * * *", jobPurgeMessages)
+	if err != nil {
+		return err
+	}
+	err = jobs.AddSchedule("remind-fees", "0 7 * * *", jobRemindFees)
+	if err != nil {
+		return err
+	}
+	err = jobs.AddSchedule("cleanup-jobs", "30 3 * * *", jobCleanup)
+	if err != nil {
+		return err
+	}
+	return jobs.AddSchedule("announce-scheduled", "* * * * *", jobAnnounce)
+}
+
+func sendEmailJob(ctx context.Context, job jobs.Job) error {
+	var payload emailPayload
+	err := json.Unmarshal(job.Payload, &payload)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	m := mail.NewMessage()
+	m.SetHeader("From", "schooladmin@school.com")
+	m.SetHeader("To", payload.To)
+	m.SetHeader("Subject", payload.Subject)
+	m.SetBody("text/plain", payload.Body)
+
+	d := mail.NewDialer("localhost", 1025, "", "")
+	return d.DialAndSend(m)
+}
+
+// jobsAccess keeps the job queue and schedules to admins
+var jobsAccess = roleAccess{roles: []string{"admin"}, denied: "Only admins may manage jobs"}
+
+type JobsHandler struct {
+	db *sql.DB
+}
+
+func NewJobsHandler(db *sql.DB) *JobsHandler {
+	return &JobsHandler{db: db}
+}
+
+// GetJobsHandler lists the jobs of the school, newest first, filtered on the fields of jobListColumns.
+// Jobs of no school, such as the scheduled ones, are only listed for super admins
+func (h *JobsHandler) GetJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if !jobsAccess.allow(w, r) {
+		return
+	}
+
+	params, err := parseListQuery(r.URL.Query(), jobListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("-id", jobListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	applyTenantScope(r, &params)
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "jobs", jobColumns, params, pageParams, scanJob)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the jobs", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+func (h *JobsHandler) GetJobByIdHandler(w http.ResponseWriter, r *http.Request) {
+	if !jobsAccess.allow(w, r) {
+		return
+	}
+	job, ok := h.loadJob(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// RetryJobHandler queues a dead or cancelled job again with a fresh set of attempts
+func (h *JobsHandler) RetryJobHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeJob(w, r, jobs.Retry, "Only dead or cancelled jobs can be retried")
+}
+
+// CancelJobHandler stops a job that has not started yet
+func (h *JobsHandler) CancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeJob(w, r, jobs.Cancel, "Only queued jobs can be cancelled")
+}
+
+func (h *JobsHandler) changeJob(w http.ResponseWriter, r *http.Request, change func(*sql.DB, int64) (bool, error), conflict string) {
+	if !jobsAccess.allow(w, r) {
+		return
+	}
+	job, ok := h.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	changed, err := change(h.db, job.Id)
+	if err != nil {
+		log.Println("Job update error:", err)
+		http.Error(w, "Error updating the job", http.StatusInternalServerError)
+		return
+	}
+	if !changed {
+		http.Error(w, conflict, http.StatusConflict)
+		return
+	}
+
+	job, ok = h.loadJob(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetSchedulesHandler lists the recurring jobs with their next run
+func (h *JobsHandler) GetSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	if !jobsAccess.allow(w, r) {
+		return
+	}
+
+	now := time.Now()
+	list := make([]models.JobSchedule, 0)
+	for _, schedule := range jobs.Schedules() {
+		entry := models.JobSchedule{Name: schedule.Name, Spec: schedule.Spec, Type: schedule.Type}
+		if next := schedule.Next(now); !next.IsZero() {
+			entry.NextRunAt = next.Format(time.RFC3339)
+		}
+		list = append(list, entry)
+	}
+	writeList(w, r, list)
+}
+
+// loadJob reads the job of the path's {id} within the current school, writing the error response itself when it cannot
+func (h *JobsHandler) loadJob(w http.ResponseWriter, r *http.Request) (models.Job, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return models.Job{}, false
+	}
+
+	tenant, tenantArgs := tenantCondition(r)
+	job, err := scanJob(h.db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Job with that ID does not exist", http.StatusNotFound)
+		return job, false
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return job, false
+	}
+	return job, true
+}
+
+func scanJob(row rowScanner) (models.Job, error) {
+	var job models.Job
+	err := row.Scan(&job.Id, &job.SchoolId, &job.Type, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt,
+		&job.LastError, &job.CreatedBy, &job.CreatedAt, &job.StartedAt, &job.FinishedAt,
+	)
+	return job, err
+}
@@ -0,0 +1,933 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/calendar"
+	"ClassConnect/internal/events"
+	"ClassConnect/internal/jobs"
+	"ClassConnect/internal/leave"
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// leaveListColumns whitelists the leave request fields the list may filter, sort and select on
+var leaveListColumns = map[string]listColumn{
+	"id":              {column: "l.id", numeric: true},
+	"kind":            {column: "l.kind"},
+	"teacher_id":      {column: "l.teacher_id", numeric: true},
+	"student_id":      {column: "l.student_id", numeric: true},
+	"start_date":      {column: "l.start_date"},
+	"end_date":        {column: "l.end_date"},
+	"days":            {column: "l.days", numeric: true},
+	"status":          {column: "l.status"},
+	"requested_by_id": {column: "l.requested_by_id", numeric: true},
+	"created_at":      {column: "l.created_at"},
+}
+
+// coverListColumns whitelists the cover fields the list may filter, sort and select on
+var coverListColumns = map[string]listColumn{
+	"id":              {column: "c.id", numeric: true},
+	"leave_id":        {column: "c.leave_id", numeric: true},
+	"teacher_id":      {column: "c.teacher_id", numeric: true},
+	"date":            {column: "c.date"},
+	"class":           {column: "c.class"},
+	"subject":         {column: "c.subject"},
+	"exam_session_id": {column: "c.exam_session_id", numeric: true},
+	"substitute_id":   {column: "c.substitute_id", numeric: true},
+}
+
+// leaveManageAccess guards the approval chains and cover, its roles see and act on every request of the school
+var leaveManageAccess = roleAccess{roles: []string{"admin", "manager"}, denied: "Only admins and managers may manage leave cover and approval chains"}
+
+// leaveAdminAccess guards changing the approval chains, admins also deciding any step of a request
+var leaveAdminAccess = roleAccess{roles: []string{"admin"}, denied: "Only admins may change the leave approval chains"}
+
+// leaveCaller is what the leave rules need to know about the account making a request
+type leaveCaller struct {
+	id   int
+	role string
+	// teachers holds the teacher records sharing the account's email, and classes their classes
+	teachers []int
+	classes  []string
+	// children holds the students the account is a guardian of
+	children []int
+}
+
+// manager tells admins and managers apart, they see and act on every request of the school
+func (c *leaveCaller) manager() bool {
+	return leaveManageAccess.grants(c.role)
+}
+
+// subject reports whether the request is about the caller's own leave
+func (c *leaveCaller) subject(request models.LeaveRequest) bool {
+	return request.Kind == leave.KindTeacher && slices.Contains(c.teachers, request.TeacherId)
+}
+
+// canView lets callers see the requests they made, their own leave, their children's and those they may approve
+func (c *leaveCaller) canView(request models.LeaveRequest) bool {
+	if c.manager() || request.RequestedById == c.id || c.subject(request) {
+		return true
+	}
+	if request.Kind == leave.KindStudent && slices.Contains(c.children, request.StudentId) {
+		return true
+	}
+	for _, approval := range request.Approvals {
+		if c.holds(approval.Role, request) {
+			return true
+		}
+	}
+	return false
+}
+
+// canApprove lets callers decide the pending step of a request when they hold its role. Admins may decide any step,
+// and nobody decides their own leave or a request they made
+func (c *leaveCaller) canApprove(request models.LeaveRequest) bool {
+	if request.Status != leave.StatusPending || request.Step >= len(request.Approvals) || c.subject(request) {
+		return false
+	}
+	if leaveAdminAccess.grants(c.role) {
+		return true
+	}
+	return request.RequestedById != c.id && c.holds(request.Approvals[request.Step].Role, request)
+}
+
+// canCancel lets the requester, the teacher on leave and the student's guardians withdraw a request, until approved
+// leave has started. Admins and managers may cancel any request
+func (c *leaveCaller) canCancel(request models.LeaveRequest) bool {
+	if request.Status != leave.StatusPending && request.Status != leave.StatusApproved {
+		return false
+	}
+	if c.manager() {
+		return true
+	}
+	if request.Status == leave.StatusApproved && request.StartDate <= time.Now().Format(calendar.DateLayout) {
+		return false
+	}
+	return request.RequestedById == c.id || c.subject(request) || (request.Kind == leave.KindStudent && slices.Contains(c.children, request.StudentId))
+}
+
+func (c *leaveCaller) holds(role string, request models.LeaveRequest) bool {
+	if role == leave.RoleTeacher {
+		return request.Kind == leave.KindStudent && slices.Contains(c.classes, request.Class)
+	}
+	return c.role == role
+}
+
+// viewCondition is canView as a condition on leave.Tables, empty for admins and managers
+func (c *leaveCaller) viewCondition() (string, []any) {
+	if c.manager() {
+		return "", nil
+	}
+	conditions := []string{"l.requested_by_id = ?"}
+	args := []any{c.id}
+	if subject, subjectArgs := c.subjectCondition(); subject != "" {
+		conditions = append(conditions, subject)
+		args = append(args, subjectArgs...)
+	}
+	if len(c.children) > 0 {
+		placeholders, childArgs := inList(c.children)
+		conditions = append(conditions, "(l.kind = ? AND l.student_id IN "+placeholders+")")
+		args = append(append(args, leave.KindStudent), childArgs...)
+	}
+	holds, holdsArgs := c.holdsCondition()
+	conditions = append(conditions, "EXISTS (SELECT 1 FROM leave_approvals ap WHERE ap.leave_id = l.id AND "+holds+")")
+	args = append(args, holdsArgs...)
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// approveCondition is canApprove as a condition on leave.Tables
+func (c *leaveCaller) approveCondition() (string, []any) {
+	condition := "l.status = ?"
+	args := []any{leave.StatusPending}
+	if subject, subjectArgs := c.subjectCondition(); subject != "" {
+		condition += " AND NOT " + subject
+		args = append(args, subjectArgs...)
+	}
+	step := "EXISTS (SELECT 1 FROM leave_approvals ap WHERE ap.leave_id = l.id AND ap.position = l.step"
+	if leaveAdminAccess.grants(c.role) {
+		return condition + " AND " + step + ")", args
+	}
+	holds, holdsArgs := c.holdsCondition()
+	condition += " AND (l.requested_by_id IS NULL OR l.requested_by_id <> ?) AND " + step + " AND " + holds + ")"
+	args = append(append(args, c.id), holdsArgs...)
+	return condition, args
+}
+
+// subjectCondition is subject as a condition on leave.Tables, empty when the caller is no teacher
+func (c *leaveCaller) subjectCondition() (string, []any) {
+	if len(c.teachers) == 0 {
+		return "", nil
+	}
+	placeholders, args := inList(c.teachers)
+	return "(l.kind = ? AND l.teacher_id IN " + placeholders + ")", append([]any{leave.KindTeacher}, args...)
+}
+
+// holdsCondition is holds as a condition on the role of leave_approvals ap
+func (c *leaveCaller) holdsCondition() (string, []any) {
+	var conditions []string
+	var args []any
+	if c.role != leave.RoleTeacher {
+		conditions = append(conditions, "ap.role = ?")
+		args = append(args, c.role)
+	}
+	if len(c.classes) > 0 {
+		placeholders, classArgs := inList(c.classes)
+		conditions = append(conditions, "(ap.role = ? AND l.kind = ? AND s.class IN "+placeholders+")")
+		args = append(append(args, leave.RoleTeacher, leave.KindStudent), classArgs...)
+	}
+	if len(conditions) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+func loadLeaveCaller(db *sql.DB, schoolId, execId int, role string) (*leaveCaller, error) {
+	caller := &leaveCaller{id: execId, role: role}
+	rows, err := db.Query("SELECT t.id, t.class FROM teachers t JOIN execs e ON e.email = t.email AND e.school_id = t.school_id WHERE e.id = ? AND t.school_id = ? AND t.deleted_at IS NULL",
+		execId, schoolId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var class string
+		err = rows.Scan(&id, &class)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		caller.teachers = append(caller.teachers, id)
+		caller.classes = append(caller.classes, class)
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT student_id FROM student_guardians WHERE exec_id = ? AND school_id = ?", execId, schoolId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		caller.children = append(caller.children, id)
+	}
+	return caller, rows.Err()
+}
+
+type LeaveHandler struct {
+	db *sql.DB
+}
+
+func NewLeaveHandler(db *sql.DB) *LeaveHandler {
+	return &LeaveHandler{db: db}
+}
+
+// GetChainsHandler returns the approval chain of teacher and student leave
+func (h *LeaveHandler) GetChainsHandler(w http.ResponseWriter, r *http.Request) {
+	if !leaveManageAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	chains, err := leave.Chains(h.db, schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the approval chains", http.StatusInternalServerError)
+		return
+	}
+	writeList(w, r, chains)
+}
+
+// SetChainsHandler replaces the approval chains of the kinds of leave given, [{kind, steps}]. Each step is a role,
+// teacher standing for the teachers of the student's class. Requests already made keep the chain they started with
+func (h *LeaveHandler) SetChainsHandler(w http.ResponseWriter, r *http.Request) {
+	if !leaveAdminAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var chains []models.LeaveChain
+	err := json.NewDecoder(r.Body).Decode(&chains)
+	if err != nil {
+		http.Error(w, "Invalid request body, expected a list of chains", http.StatusBadRequest)
+		return
+	}
+	seen := make(map[string]bool)
+	for i, chain := range chains {
+		if chain.Kind != leave.KindStudent && chain.Kind != leave.KindTeacher {
+			http.Error(w, fmt.Sprintf("chain %d: kind must be student or teacher", i), http.StatusBadRequest)
+			return
+		}
+		if seen[chain.Kind] {
+			http.Error(w, fmt.Sprintf("chain %d: the %s chain is listed twice", i, chain.Kind), http.StatusBadRequest)
+			return
+		}
+		seen[chain.Kind] = true
+		if len(chain.Steps) > leave.MaxSteps {
+			http.Error(w, fmt.Sprintf("chain %d: at most %d steps are allowed", i, leave.MaxSteps), http.StatusBadRequest)
+			return
+		}
+		for j, role := range chain.Steps {
+			switch {
+			case role == "" || len(role) > 50 || strings.Contains(role, ","):
+				http.Error(w, fmt.Sprintf("chain %d: step %d must be a role", i, j), http.StatusBadRequest)
+				return
+			case role == utils.GuardianRole:
+				http.Error(w, fmt.Sprintf("chain %d: guardians cannot approve leave", i), http.StatusBadRequest)
+				return
+			case role == leave.RoleTeacher && chain.Kind == leave.KindTeacher:
+				http.Error(w, fmt.Sprintf("chain %d: teachers cannot approve teacher leave", i), http.StatusBadRequest)
+				return
+			case slices.Contains(chain.Steps[:j], role):
+				http.Error(w, fmt.Sprintf("chain %d: %s appears twice", i, role), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	before, err := leave.Chains(h.db, schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error saving the approval chains", http.StatusInternalServerError)
+		return
+	}
+	for _, chain := range chains {
+		_, err = h.db.Exec("REPLACE INTO leave_chains(school_id, kind, steps, updated_by) VALUES(?,?,?,?)", schoolId, chain.Kind, leave.JoinSteps(chain.Steps), contextUsername(r))
+		if err != nil {
+			log.Println("Update error:", err)
+			http.Error(w, "Error saving the approval chains", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	after, err := leave.Chains(h.db, schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the approval chains", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionUpdate, "leave_chains", schoolId, before, after)
+	writeList(w, r, after)
+}
+
+// GetRequestsHandler lists the requests the caller may see, latest start first, filtered by ?teacher=, ?student=,
+// ?from=, ?to= and the fields of leaveListColumns. ?awaiting=me keeps the requests waiting for the caller's approval
+func (h *LeaveHandler) GetRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	caller, schoolId, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+	params, err := parseListQuery(listValues(r.URL.Query(), "teacher", "student", "from", "to", "awaiting"), leaveListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("-start_date", leaveListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	params.addScope("l.school_id = ?", schoolId)
+	for _, filter := range []struct{ param, condition string }{
+		{"teacher", "l.teacher_id = ?"},
+		{"student", "l.student_id = ?"},
+		{"from", "l.end_date >= ?"},
+		{"to", "l.start_date <= ?"},
+	} {
+		if value := r.URL.Query().Get(filter.param); value != "" {
+			params.addScope(filter.condition, value)
+		}
+	}
+	awaiting := r.URL.Query().Get("awaiting")
+	if awaiting != "" && awaiting != "me" {
+		http.Error(w, "awaiting must be me", http.StatusBadRequest)
+		return
+	}
+	if awaiting == "me" {
+		condition, args := caller.approveCondition()
+		params.addScope(condition, args...)
+	} else if condition, args := caller.viewCondition(); condition != "" {
+		params.addScope(condition, args...)
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, leave.Tables, leave.Columns, params, pageParams, func(row rowScanner) (models.LeaveRequest, error) {
+		return leave.Scan(row)
+	})
+	if err == nil {
+		err = leave.LoadDetails(h.db, result.records)
+	}
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the leave requests", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// GetRequestHandler returns a request with its approvals and, for approved teacher leave, its cover
+func (h *LeaveHandler) GetRequestHandler(w http.ResponseWriter, r *http.Request) {
+	request, _, _, ok := h.loadRequest(w, r)
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, "", request)
+}
+
+// CreateRequestHandler asks for leave, {kind, teacher_id | student_id, start_date, end_date, reason}. Guardians ask
+// for their children and teachers for themselves; admins and managers, and the teachers of a student's class, may
+// record a request on someone's behalf. The request follows the school's approval chain for its kind
+func (h *LeaveHandler) CreateRequestHandler(w http.ResponseWriter, r *http.Request) {
+	caller, schoolId, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.LeaveRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if request.Kind == "" && request.StudentId == 0 && len(caller.teachers) > 0 {
+		request.Kind = leave.KindTeacher
+	} else if request.Kind == "" {
+		request.Kind = leave.KindStudent
+	}
+	if request.Kind == leave.KindTeacher && request.TeacherId == 0 && len(caller.teachers) > 0 {
+		request.TeacherId = caller.teachers[0]
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+	if request.Reason == "" || len(request.Reason) > 1000 {
+		http.Error(w, "reason is required and must be at most 1000 characters", http.StatusBadRequest)
+		return
+	}
+	start, errStart := time.Parse(calendar.DateLayout, request.StartDate)
+	end, errEnd := time.Parse(calendar.DateLayout, request.EndDate)
+	if errStart != nil || errEnd != nil {
+		http.Error(w, "start_date and end_date must be YYYY-MM-DD dates", http.StatusBadRequest)
+		return
+	}
+	if end.Before(start) || end.Sub(start) >= leave.MaxDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("end_date must be on or after start_date and the leave at most %d days long", leave.MaxDays), http.StatusBadRequest)
+		return
+	}
+
+	switch request.Kind {
+	case leave.KindStudent:
+		request.TeacherId = 0
+		var class string
+		err = h.db.QueryRow("SELECT class FROM students WHERE id = ? AND school_id = ? AND "+notDeleted, request.StudentId, schoolId).Scan(&class)
+		if err == sql.ErrNoRows {
+			http.Error(w, "student_id must be a student of the school", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+			return
+		}
+		if !caller.manager() && !slices.Contains(caller.children, request.StudentId) && !slices.Contains(caller.classes, class) {
+			http.Error(w, "You may only ask for leave for your own children or the students you teach", http.StatusForbidden)
+			return
+		}
+	case leave.KindTeacher:
+		request.StudentId = 0
+		var exists int
+		err = h.db.QueryRow("SELECT COUNT(*) FROM teachers WHERE id = ? AND school_id = ? AND "+notDeleted, request.TeacherId, schoolId).Scan(&exists)
+		if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+			return
+		}
+		if exists == 0 {
+			http.Error(w, "teacher_id must be a teacher of the school", http.StatusBadRequest)
+			return
+		}
+		if !caller.manager() && !slices.Contains(caller.teachers, request.TeacherId) {
+			http.Error(w, "You may only ask for leave for yourself", http.StatusForbidden)
+			return
+		}
+	default:
+		http.Error(w, "kind must be student or teacher", http.StatusBadRequest)
+		return
+	}
+
+	var overlapping int
+	err = h.db.QueryRow("SELECT COUNT(*) FROM leave_requests WHERE kind = ? AND COALESCE(teacher_id, student_id) = ? AND status IN (?, ?) AND start_date <= ? AND end_date >= ?",
+		request.Kind, max(request.TeacherId, request.StudentId), leave.StatusPending, leave.StatusApproved, request.EndDate, request.StartDate,
+	).Scan(&overlapping)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	if overlapping > 0 {
+		http.Error(w, "A pending or approved leave request already covers some of these days", http.StatusConflict)
+		return
+	}
+
+	days, err := leave.SchoolDays(h.db, schoolId, request.StartDate, request.EndDate)
+	if err == nil && len(days) == 0 {
+		http.Error(w, "The school is closed on every day of the leave", http.StatusBadRequest)
+		return
+	}
+	var chain []string
+	if err == nil {
+		chain, err = leave.Chain(h.db, schoolId, request.Kind)
+	}
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error creating the leave request", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error creating the leave request", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// A school without approvers for a kind of leave approves it right away
+	status := leave.StatusPending
+	if len(chain) == 0 {
+		status = leave.StatusApproved
+	}
+	res, err := tx.Exec(`INSERT INTO leave_requests(school_id, kind, teacher_id, student_id, start_date, end_date, days, reason, status, requested_by, requested_by_id, decided_at)
+		VALUES(?,?,?,?,?,?,?,?,?,?,?,IF(? = 'approved', NOW(), NULL))`,
+		schoolId, request.Kind, sql.NullInt64{Int64: int64(request.TeacherId), Valid: request.TeacherId != 0}, sql.NullInt64{Int64: int64(request.StudentId), Valid: request.StudentId != 0},
+		request.StartDate, request.EndDate, len(days), request.Reason, status, contextUsername(r), caller.id, status,
+	)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the leave request", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	for position, role := range chain {
+		if err != nil {
+			break
+		}
+		stepStatus := leave.StatusWaiting
+		if position == 0 {
+			stepStatus = leave.StatusPending
+		}
+		_, err = tx.Exec("INSERT INTO leave_approvals(leave_id, position, role, status) VALUES(?,?,?,?)", id, position, role, stepStatus)
+	}
+	if err == nil && status == leave.StatusApproved {
+		request.Id = int(id)
+		err = leave.Apply(tx, schoolId, request, days, contextUsername(r))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the leave request", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := leave.LoadOne(h.db, int(id))
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error creating the leave request", http.StatusInternalServerError)
+		return
+	}
+	h.notify(schoolId, created)
+	audit.Record(h.db, r, audit.ActionCreate, "leave_requests", created.Id, nil, created)
+	writeCreated(w, created)
+}
+
+// ApproveRequestHandler approves the pending step of a request, {comment}. Approving the last step approves the leave:
+// the student is excused on its school days, or the teacher's lessons and invigilations are listed as needing cover
+func (h *LeaveHandler) ApproveRequestHandler(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, leave.StatusApproved)
+}
+
+// RejectRequestHandler rejects the pending step of a request, {comment}, which rejects the leave
+func (h *LeaveHandler) RejectRequestHandler(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, leave.StatusRejected)
+}
+
+func (h *LeaveHandler) decide(w http.ResponseWriter, r *http.Request, decision string) {
+	before, caller, schoolId, ok := h.loadRequest(w, r)
+	if !ok {
+		return
+	}
+	if before.Status != leave.StatusPending {
+		http.Error(w, "The leave request is already "+before.Status, http.StatusConflict)
+		return
+	}
+	if !caller.canApprove(before) {
+		http.Error(w, "The leave request is not waiting for your approval", http.StatusForbidden)
+		return
+	}
+
+	var body models.LeaveDecision
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	body.Comment = strings.TrimSpace(body.Comment)
+	if len(body.Comment) > 500 {
+		http.Error(w, "comment must be at most 500 characters", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error deciding on the leave request", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Matching the pending step keeps two approvers from deciding it at once
+	res, err := tx.Exec("UPDATE leave_approvals SET status = ?, decided_by = ?, comment = ?, decided_at = NOW() WHERE leave_id = ? AND position = ? AND status = ?",
+		decision, contextUsername(r), body.Comment, before.Id, before.Step, leave.StatusPending,
+	)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error deciding on the leave request", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		http.Error(w, "The leave request was decided by someone else, reload it and try again", http.StatusConflict)
+		return
+	}
+
+	last := before.Step == len(before.Approvals)-1
+	switch {
+	case decision == leave.StatusRejected || last:
+		_, err = tx.Exec("UPDATE leave_requests SET status = ?, decided_at = NOW() WHERE id = ?", decision, before.Id)
+		if err == nil && decision == leave.StatusApproved {
+			var days []string
+			days, err = leave.SchoolDays(h.db, schoolId, before.StartDate, before.EndDate)
+			if err == nil {
+				err = leave.Apply(tx, schoolId, before, days, contextUsername(r))
+			}
+		}
+	default:
+		_, err = tx.Exec("UPDATE leave_requests SET step = step + 1 WHERE id = ?", before.Id)
+		if err == nil {
+			_, err = tx.Exec("UPDATE leave_approvals SET status = ? WHERE leave_id = ? AND position = ?", leave.StatusPending, before.Id, before.Step+1)
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error deciding on the leave request", http.StatusInternalServerError)
+		return
+	}
+
+	h.respond(w, r, schoolId, before)
+}
+
+// CancelRequestHandler withdraws a pending or approved request, undoing what approved leave changed
+func (h *LeaveHandler) CancelRequestHandler(w http.ResponseWriter, r *http.Request) {
+	before, caller, schoolId, ok := h.loadRequest(w, r)
+	if !ok {
+		return
+	}
+	if !caller.canCancel(before) {
+		if before.Status != leave.StatusPending && before.Status != leave.StatusApproved {
+			http.Error(w, "The leave request is already "+before.Status, http.StatusConflict)
+		} else {
+			http.Error(w, "Only admins and managers may cancel this leave request", http.StatusForbidden)
+		}
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error cancelling the leave request", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE leave_requests SET status = ?, decided_at = NOW() WHERE id = ? AND status = ?", leave.StatusCancelled, before.Id, before.Status)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error cancelling the leave request", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		http.Error(w, "The leave request was changed by someone else, reload it and try again", http.StatusConflict)
+		return
+	}
+	if before.Status == leave.StatusApproved {
+		err = leave.Revert(tx, before)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error cancelling the leave request", http.StatusInternalServerError)
+		return
+	}
+
+	h.respond(w, r, schoolId, before)
+}
+
+// GetCoverHandler lists the lessons and invigilations of teachers on approved leave between ?from= and ?to= (the next
+// 30 days by default), ?open=true keeping those still without a substitute
+func (h *LeaveHandler) GetCoverHandler(w http.ResponseWriter, r *http.Request) {
+	if !leaveManageAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+	from, to, ok := calendarRange(w, r)
+	if !ok {
+		return
+	}
+	params, err := parseListQuery(listValues(r.URL.Query(), "from", "to", "open"), coverListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("date", coverListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	params.addScope("c.school_id = ? AND c.date >= ? AND c.date <= ?", schoolId, from.Format(calendar.DateLayout), to.Format(calendar.DateLayout))
+	if open := r.URL.Query().Get("open"); open != "" {
+		openOnly, err := strconv.ParseBool(open)
+		if err != nil {
+			http.Error(w, "open must be true or false", http.StatusBadRequest)
+			return
+		}
+		if openOnly {
+			params.addScope("c.substitute_id IS NULL")
+		}
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, leave.CoverTables, leave.CoverColumns, params, pageParams, func(row rowScanner) (models.LeaveCover, error) {
+		return leave.ScanCover(row)
+	})
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the cover", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// SetCoverHandler assigns the substitute of a lesson or invigilation, {substitute_id}, or clears it with 0. The
+// substitute must be a teacher of the school who is not on leave that day, and is emailed
+func (h *LeaveHandler) SetCoverHandler(w http.ResponseWriter, r *http.Request) {
+	if !leaveManageAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid cover ID", http.StatusBadRequest)
+		return
+	}
+	cover, err := leave.LoadCover(h.db, "c.id = ? AND c.school_id = ?", id, schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	if len(cover) == 0 {
+		http.Error(w, "Cover with that ID does not exist", http.StatusNotFound)
+		return
+	}
+	before := cover[0]
+
+	var request struct {
+		SubstituteId int `json:"substitute_id"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var substituteEmail string
+	if request.SubstituteId != 0 {
+		if request.SubstituteId == before.TeacherId {
+			http.Error(w, "The teacher on leave cannot cover their own lesson", http.StatusBadRequest)
+			return
+		}
+		var onLeave int
+		err = h.db.QueryRow("SELECT email, (SELECT COUNT(*) FROM leave_requests l WHERE l.teacher_id = teachers.id AND l.status = ? AND l.start_date <= ? AND l.end_date >= ?) FROM teachers WHERE id = ? AND school_id = ? AND "+notDeleted,
+			leave.StatusApproved, before.Date, before.Date, request.SubstituteId, schoolId,
+		).Scan(&substituteEmail, &onLeave)
+		if err == sql.ErrNoRows {
+			http.Error(w, "substitute_id must be a teacher of the school", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+			return
+		}
+		if onLeave > 0 {
+			http.Error(w, "The substitute is on leave on "+before.Date, http.StatusConflict)
+			return
+		}
+	}
+
+	substitute := sql.NullInt64{Int64: int64(request.SubstituteId), Valid: request.SubstituteId != 0}
+	_, err = h.db.Exec("UPDATE leave_cover SET substitute_id = ?, updated_by = ? WHERE id = ?", substitute, contextUsername(r), id)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error assigning the substitute", http.StatusInternalServerError)
+		return
+	}
+	cover, err = leave.LoadCover(h.db, "c.id = ?", id)
+	if err != nil || len(cover) == 0 {
+		log.Println("Query error:", err)
+		http.Error(w, "Error assigning the substitute", http.StatusInternalServerError)
+		return
+	}
+	after := cover[0]
+
+	if substituteEmail != "" && request.SubstituteId != before.SubstituteId {
+		what := fmt.Sprintf("the %s lesson of %s", after.Subject, after.Class)
+		if after.ExamSessionId != 0 {
+			what = fmt.Sprintf("the invigilation of the %s exam", after.Subject)
+		}
+		body := fmt.Sprintf("You were asked to cover %s on %s for %s, who is on leave.\n", what, after.Date, after.TeacherName)
+		_, err = jobs.Enqueue(h.db, schoolId, jobSendEmail, emailPayload{To: substituteEmail, Subject: "Cover on " + after.Date, Body: body}, contextUsername(r))
+		if err != nil {
+			log.Println("Email job error:", err)
+		}
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "leave_cover", id, before, after)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(after)
+}
+
+// respond reloads a request after a change, notifies who needs to know, audits it and writes it
+func (h *LeaveHandler) respond(w http.ResponseWriter, r *http.Request, schoolId int, before models.LeaveRequest) {
+	updated, err := leave.LoadOne(h.db, before.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the leave request", http.StatusInternalServerError)
+		return
+	}
+	h.notify(schoolId, updated)
+	audit.Record(h.db, r, audit.ActionUpdate, "leave_requests", updated.Id, before, updated)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// notify tells the requester where their request stands and asks the approvers of its pending step to decide, by
+// email and with a leave.updated event
+func (h *LeaveHandler) notify(schoolId int, request models.LeaveRequest) {
+	audience := events.Audience{UserIds: []string{strconv.Itoa(request.RequestedById)}}
+	if request.Status == leave.StatusPending {
+		if role := request.Approvals[request.Step].Role; role == leave.RoleTeacher {
+			audience.Classes = []string{request.Class}
+		} else {
+			audience.Roles = []string{role}
+		}
+	}
+	events.Publish(events.TypeLeaveUpdated, schoolId, audience, request)
+
+	emails := make([]emailPayload, 0)
+	if requester, err := leave.Requester(h.db, request); err != nil {
+		log.Println("Query error:", err)
+	} else if requester != "" {
+		subject, body := leave.StatusEmail(request)
+		emails = append(emails, emailPayload{To: requester, Subject: subject, Body: body})
+	}
+	approvers, err := leave.Approvers(h.db, schoolId, request)
+	if err != nil {
+		log.Println("Query error:", err)
+	}
+	subject, body := leave.ApprovalEmail(request)
+	for _, approver := range approvers {
+		emails = append(emails, emailPayload{To: approver, Subject: subject, Body: body})
+	}
+	for _, email := range emails {
+		_, err = jobs.Enqueue(h.db, schoolId, jobSendEmail, email, request.RequestedBy)
+		if err != nil {
+			log.Println("Email job error:", err)
+		}
+	}
+}
+
+// caller reads who is making the request, writing the error response itself when it cannot
+func (h *LeaveHandler) caller(w http.ResponseWriter, r *http.Request) (*leaveCaller, int, bool) {
+	schoolId, execId, ok := messagingCaller(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+	caller, err := loadLeaveCaller(h.db, schoolId, execId, contextRole(r))
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	return caller, schoolId, true
+}
+
+// loadRequest reads the request of the path's {id} within the current school when the caller may see it, writing the
+// error response itself when it cannot
+func (h *LeaveHandler) loadRequest(w http.ResponseWriter, r *http.Request) (models.LeaveRequest, *leaveCaller, int, bool) {
+	caller, schoolId, ok := h.caller(w, r)
+	if !ok {
+		return models.LeaveRequest{}, nil, 0, false
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid leave request ID", http.StatusBadRequest)
+		return models.LeaveRequest{}, nil, 0, false
+	}
+
+	requests, err := leave.Load(h.db, "l.id = ? AND l.school_id = ?", id, schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return models.LeaveRequest{}, nil, 0, false
+	}
+	if len(requests) == 0 || !caller.canView(requests[0]) {
+		http.Error(w, "Leave request with that ID does not exist", http.StatusNotFound)
+		return models.LeaveRequest{}, nil, 0, false
+	}
+	return requests[0], caller, schoolId, true
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// listColumn describes a column that list endpoints may filter, sort and select on
+type listColumn struct {
+	column  string
+	boolean bool
+	numeric bool
+}
+
+// listFilter is an equality filter on one column, several values are OR'ed together
+type listFilter struct {
+	column string
+	values []any
+}
+
+// listSort is a sort key, with the type of its column so that cursor values can be checked against it
+type listSort struct {
+	field   string
+	column  string
+	desc    bool
+	numeric bool
+	boolean bool
+}
+
+// newListSort sorts on a whitelisted column
+func newListSort(field string, column listColumn, desc bool) listSort {
+	return listSort{field: field, column: column.column, desc: desc, numeric: column.numeric, boolean: column.boolean}
+}
+
+// listQuery is the parsed form of the filter, sort and fields query parameters shared by every list endpoint
+type listQuery struct {
+	filters []listFilter
+	sort    []listSort
+	fields  []string
+
+	// scopes are fixed conditions added by the handler rather than the client
+	scopes    []string
+	scopeArgs []any
+
+	// id is the tie-breaker ending every sort, the id column unless set by keyedBy. Its column is qualified when the
+	// list joins several tables
+	id listSort
+	// tableArgs bind the placeholders of the table expression, such as a join on the caller, ahead of the conditions
+	tableArgs []any
+}
+
+// reservedListParams are query parameters that are never treated as filters
+var reservedListParams = map[string]bool{
+	"sort":          true,
+	"fields":        true,
+	"limit":         true,
+	"cursor":        true,
+	"include_total": true,
+	"format":        true,
+	"async":         true,
+	// include_deleted is handled by applyDeletedScope
+	"include_deleted": true,
+}
+
+// parseListQuery validates the query string against the whitelisted columns of a resource.
+// Filters use the JSON field names, e.g. ?class=9A&last_name=Smith,
+// sorting is a comma separated list where a leading "-" means descending, e.g. ?sort=-last_name,first_name,
+// and fields restricts the returned JSON fields, e.g. ?fields=id,first_name,email
+func parseListQuery(values url.Values, columns map[string]listColumn) (listQuery, error) {
+	var query listQuery
+	query.id = listSort{field: "id", column: "id", numeric: true}
+	if id, ok := columns["id"]; ok {
+		query.id = newListSort("id", id, false)
+	}
+
+	// Sort the keys so the generated SQL is deterministic
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if reservedListParams[key] {
+			continue
+		}
+		column, ok := columns[key]
+		if !ok {
+			return listQuery{}, fmt.Errorf("unknown filter %q", key)
+		}
+
+		filter := listFilter{column: column.column}
+		for _, value := range values[key] {
+			if column.boolean {
+				parsed, err := strconv.ParseBool(value)
+				if err != nil {
+					return listQuery{}, fmt.Errorf("filter %q must be true or false", key)
+				}
+				filter.values = append(filter.values, parsed)
+				continue
+			}
+			if column.numeric {
+				parsed, err := strconv.Atoi(value)
+				if err != nil {
+					return listQuery{}, fmt.Errorf("filter %q must be a number", key)
+				}
+				filter.values = append(filter.values, parsed)
+				continue
+			}
+			filter.values = append(filter.values, value)
+		}
+		query.filters = append(query.filters, filter)
+	}
+
+	if sortParam := values.Get("sort"); sortParam != "" {
+		sorts, err := parseSort(sortParam, columns)
+		if err != nil {
+			return listQuery{}, err
+		}
+		query.sort = sorts
+	}
+
+	if fieldsParam := values.Get("fields"); fieldsParam != "" {
+		for _, field := range strings.Split(fieldsParam, ",") {
+			field = strings.TrimSpace(field)
+			if _, ok := columns[field]; !ok {
+				return listQuery{}, fmt.Errorf("unknown field %q", field)
+			}
+			query.fields = append(query.fields, field)
+		}
+	}
+
+	return query, nil
+}
+
+// listValues returns the query string without the parameters a handler reads itself, such as date ranges the
+// equality filters cannot express, so parseListQuery does not take them for unknown filters
+func listValues(values url.Values, own ...string) url.Values {
+	values = maps.Clone(values)
+	for _, key := range own {
+		values.Del(key)
+	}
+	return values
+}
+
+// parseSort reads a comma separated list of fields where a leading "-" means descending
+func parseSort(sortParam string, columns map[string]listColumn) ([]listSort, error) {
+	var sorts []listSort
+	for _, field := range strings.Split(sortParam, ",") {
+		field = strings.TrimSpace(field)
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+		column, ok := columns[field]
+		if !ok {
+			return nil, fmt.Errorf("cannot sort by %q", field)
+		}
+		sorts = append(sorts, newListSort(field, column, desc))
+	}
+	return sorts, nil
+}
+
+// defaultSort sorts the list as given, in the ?sort= syntax, when the client did not ask for an order. It must be
+// called before getPageParams so cursors are checked against the order actually used. An error means the handler's
+// default names a column the list does not have
+func (q *listQuery) defaultSort(sortParam string, columns map[string]listColumn) error {
+	if len(q.sort) > 0 {
+		return nil
+	}
+	sorts, err := parseSort(sortParam, columns)
+	if err != nil {
+		return fmt.Errorf("invalid default sort: %w", err)
+	}
+	q.sort = sorts
+	return nil
+}
+
+// keyedBy makes a unique field other than id the tie-breaker of the sort, for collections without an id
+func (q *listQuery) keyedBy(field string, columns map[string]listColumn) {
+	q.id = newListSort(field, columns[field], false)
+}
+
+// bindTable supplies the arguments of the placeholders in the table expression passed to queryPage
+func (q *listQuery) bindTable(args ...any) {
+	q.tableArgs = append(q.tableArgs, args...)
+}
+
+// addScope restricts the query with a fixed, parameterized SQL condition
+func (q *listQuery) addScope(condition string, args ...any) {
+	q.scopes = append(q.scopes, condition)
+	q.scopeArgs = append(q.scopeArgs, args...)
+}
+
+// conditions renders the scopes and filters as parameterized SQL conditions to be AND'ed together
+func (q listQuery) conditions() ([]string, []any) {
+	conditions := append([]string(nil), q.scopes...)
+	args := append([]any(nil), q.scopeArgs...)
+	for _, filter := range q.filters {
+		if len(filter.values) == 1 {
+			conditions = append(conditions, filter.column+" = ?")
+		} else {
+			conditions = append(conditions, filter.column+" IN (?"+strings.Repeat(", ?", len(filter.values)-1)+")")
+		}
+		args = append(args, filter.values...)
+	}
+	return conditions, args
+}
+
+// sortKeys returns the sort fields followed by the id, which keeps the order total and stable
+func (q listQuery) sortKeys() []listSort {
+	id := q.id
+	if id.column == "" {
+		id = listSort{field: "id", column: "id", numeric: true}
+	}
+	keys := make([]listSort, 0, len(q.sort)+1)
+	for _, s := range q.sort {
+		keys = append(keys, s)
+		if s.column == id.column {
+			return keys
+		}
+	}
+	return append(keys, id)
+}
+
+// orderByClause renders the sort keys, reversed when walking backwards through a collection
+func (q listQuery) orderByClause(reverse bool) string {
+	keys := q.sortKeys()
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		if key.desc != reverse {
+			parts[i] = key.column + " DESC"
+		} else {
+			parts[i] = key.column + " ASC"
+		}
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+func joinConditions(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// selectFields trims each record down to the requested JSON fields.
+// Without a fields parameter the records are returned untouched
+func selectFields[T any](records []T, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return records, nil
+	}
+
+	selected := make([]map[string]any, len(records))
+	for i, record := range records {
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		var full map[string]any
+		err = json.Unmarshal(encoded, &full)
+		if err != nil {
+			return nil, err
+		}
+
+		selected[i] = make(map[string]any, len(fields))
+		for _, field := range fields {
+			selected[i][field] = full[field]
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,991 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/events"
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxThreadParticipants = 20
+	// hiddenMessageBody replaces the body of a hidden message for everyone but admins
+	hiddenMessageBody = "[removed by a moderator]"
+)
+
+const threadColumns = "t.id, t.subject, t.created_by, t.created_at, COALESCE(t.last_message_at, t.created_at), t.locked_at IS NOT NULL"
+
+const messageColumns = "id, thread_id, sender_id, body, COALESCE(attachments, ''), created_at, hidden_at IS NOT NULL, COALESCE(hidden_reason, '')"
+
+// threadListColumns whitelists the thread fields the list may filter, sort and select on
+var threadListColumns = map[string]listColumn{
+	"id":              {column: "t.id", numeric: true},
+	"subject":         {column: "t.subject"},
+	"created_by":      {column: "t.created_by", numeric: true},
+	"created_at":      {column: "t.created_at"},
+	"last_message_at": {column: "COALESCE(t.last_message_at, t.created_at)"},
+	"locked":          {column: "t.locked_at IS NOT NULL", boolean: true},
+}
+
+// messageListColumns whitelists the message fields the list of a thread may filter, sort and select on
+var messageListColumns = map[string]listColumn{
+	"id":         {column: "id", numeric: true},
+	"sender_id":  {column: "sender_id", numeric: true},
+	"created_at": {column: "created_at"},
+	"hidden":     {column: "hidden_at IS NOT NULL", boolean: true},
+}
+
+// blockListColumns whitelists the block fields the list may filter, sort and select on, blocks being keyed by account
+var blockListColumns = map[string]listColumn{
+	"exec_id":    {column: "exec_id", numeric: true},
+	"reason":     {column: "reason"},
+	"blocked_by": {column: "blocked_by"},
+	"created_at": {column: "created_at"},
+}
+
+// contactListColumns whitelists the contact fields, matched in memory since contacts are worked out from the rules
+var contactListColumns = map[string]listColumn{
+	"id":   {column: "id", numeric: true},
+	"name": {column: "name"},
+	"role": {column: "role"},
+}
+
+// moderationAccess guards hiding messages, locking threads and blocking accounts
+var moderationAccess = roleAccess{roles: []string{"admin"}, denied: "Only admins may moderate messages"}
+
+type MessagesHandler struct {
+	db *sql.DB
+}
+
+func NewMessagesHandler(db *sql.DB) *MessagesHandler {
+	return &MessagesHandler{db: db}
+}
+
+// messagingAccount is what the messaging rules need to know about an account
+type messagingAccount struct {
+	id   int
+	name string
+	role string
+	// teaches holds the classes of the teacher records sharing the account's email
+	teaches []string
+	// children holds the current classes of the students the account is a guardian of
+	children []string
+}
+
+// guardian tells guardian accounts apart, every other role counts as staff when messaging
+func (a *messagingAccount) guardian() bool {
+	return a.role == utils.GuardianRole
+}
+
+func (a *messagingAccount) participant() models.MessageParticipant {
+	return models.MessageParticipant{Id: a.id, Name: a.name, Role: a.role}
+}
+
+// canMessage applies the messaging rules: staff may message staff, and guardians may message the teachers of their
+// students' classes. Guardians never message each other
+func canMessage(a, b *messagingAccount) bool {
+	switch {
+	case !a.guardian() && !b.guardian():
+		return true
+	case a.guardian() && b.guardian():
+		return false
+	case a.guardian():
+		return sharesClass(b.teaches, a.children)
+	default:
+		return sharesClass(a.teaches, b.children)
+	}
+}
+
+func sharesClass(teaches, children []string) bool {
+	for _, class := range teaches {
+		if slices.Contains(children, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadMessagingAccounts reads the active accounts of a school by ID, or all of them when ids is empty
+func loadMessagingAccounts(db *sql.DB, schoolId int, ids []int) (map[int]*messagingAccount, error) {
+	query := "SELECT id, first_name, last_name, role FROM execs WHERE school_id = ? AND inactive_status = FALSE AND " + notDeleted
+	args := []any{schoolId}
+	if len(ids) > 0 {
+		query += " AND id IN (?" + strings.Repeat(",?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	accounts := make(map[int]*messagingAccount)
+	for rows.Next() {
+		var account messagingAccount
+		var firstName, lastName string
+		err = rows.Scan(&account.id, &firstName, &lastName, &account.role)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		account.name = strings.TrimSpace(firstName + " " + lastName)
+		accounts[account.id] = &account
+	}
+	rows.Close()
+
+	classSources := []struct {
+		query string
+		field func(*messagingAccount) *[]string
+	}{
+		{
+			"SELECT e.id, t.class FROM execs e JOIN teachers t ON t.email = e.email AND t.school_id = e.school_id AND t.deleted_at IS NULL WHERE e.school_id = ?",
+			func(a *messagingAccount) *[]string { return &a.teaches },
+		},
+		{
+			"SELECT g.exec_id, s.class FROM student_guardians g JOIN students s ON s.id = g.student_id AND s.deleted_at IS NULL WHERE g.school_id = ?",
+			func(a *messagingAccount) *[]string { return &a.children },
+		},
+	}
+	for _, source := range classSources {
+		rows, err := db.Query(source.query, schoolId)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			var class string
+			err = rows.Scan(&id, &class)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if account, ok := accounts[id]; ok {
+				field := source.field(account)
+				*field = append(*field, class)
+			}
+		}
+		rows.Close()
+	}
+	return accounts, nil
+}
+
+// GetThreadsHandler lists the caller's threads, most recently active first, with their unread counts.
+// Admins may pass ?all=true to see every thread of the school
+func (h *MessagesHandler) GetThreadsHandler(w http.ResponseWriter, r *http.Request) {
+	schoolId, callerId, ok := messagingCaller(w, r)
+	if !ok {
+		return
+	}
+	all := false
+	if allStr := r.URL.Query().Get("all"); allStr != "" {
+		var err error
+		all, err = strconv.ParseBool(allStr)
+		if err != nil {
+			http.Error(w, "all must be true or false", http.StatusBadRequest)
+			return
+		}
+		if all && !moderationAccess.grants(contextRole(r)) {
+			http.Error(w, "Only admins may list every thread", http.StatusForbidden)
+			return
+		}
+	}
+
+	params, err := parseListQuery(listValues(r.URL.Query(), "all"), threadListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("-last_message_at,-id", threadListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	params.bindTable(callerId)
+	params.addScope("t.school_id = ?", schoolId)
+	if !all {
+		params.addScope("p.exec_id IS NOT NULL")
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "message_threads t LEFT JOIN message_participants p ON p.thread_id = t.id AND p.exec_id = ?",
+		threadColumns+`, CASE WHEN p.exec_id IS NULL THEN 0 ELSE
+		(SELECT COUNT(*) FROM messages m WHERE m.thread_id = t.id AND m.id > p.last_read_id AND m.sender_id <> p.exec_id AND m.hidden_at IS NULL) END`,
+		params, pageParams, scanThread,
+	)
+	if err == nil {
+		err = h.attachParticipants(result.records)
+	}
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the threads", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// GetThreadHandler returns a thread with its participants, to its participants and to admins
+func (h *MessagesHandler) GetThreadHandler(w http.ResponseWriter, r *http.Request) {
+	thread, _, ok := h.loadThread(w, r, false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
+// GetThreadMessagesHandler lists the messages of a thread, newest first, to its participants and to admins
+func (h *MessagesHandler) GetThreadMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListQuery(r.URL.Query(), messageListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("-id", messageListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	thread, _, ok := h.loadThread(w, r, false)
+	if !ok {
+		return
+	}
+	params.addScope("thread_id = ?", thread.Id)
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "messages", messageColumns, params, pageParams, scanMessage)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the messages", http.StatusInternalServerError)
+		return
+	}
+	if !moderationAccess.grants(contextRole(r)) {
+		for i := range result.records {
+			if result.records[i].Hidden {
+				result.records[i].Body = hiddenMessageBody
+				result.records[i].Attachments = make([]models.Attachment, 0)
+			}
+		}
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// CreateThreadHandler starts a thread with its first message. Every pair of participants, the caller included,
+// has to be allowed to message each other
+func (h *MessagesHandler) CreateThreadHandler(w http.ResponseWriter, r *http.Request) {
+	schoolId, callerId, ok := messagingCaller(w, r)
+	if !ok || !h.requireNotBlocked(w, callerId) {
+		return
+	}
+
+	var req models.NewMessageThread
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Subject = strings.TrimSpace(req.Subject)
+	if req.Subject == "" || strings.TrimSpace(req.Body) == "" {
+		http.Error(w, "subject and body are required", http.StatusBadRequest)
+		return
+	}
+	req.Attachments, err = validateAttachments(req.Attachments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	memberIds := []int{callerId}
+	for _, id := range req.ParticipantIds {
+		if !slices.Contains(memberIds, id) {
+			memberIds = append(memberIds, id)
+		}
+	}
+	if len(memberIds) < 2 || len(memberIds) > maxThreadParticipants+1 {
+		http.Error(w, fmt.Sprintf("a thread takes between 1 and %d other participants", maxThreadParticipants), http.StatusBadRequest)
+		return
+	}
+
+	accounts, err := loadMessagingAccounts(h.db, schoolId, memberIds)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	if accounts[callerId] == nil {
+		http.Error(w, "Your account cannot send messages in this school", http.StatusForbidden)
+		return
+	}
+	members := make([]*messagingAccount, 0, len(memberIds))
+	for _, id := range memberIds {
+		account := accounts[id]
+		if account == nil {
+			http.Error(w, fmt.Sprintf("account %d cannot be messaged", id), http.StatusBadRequest)
+			return
+		}
+		members = append(members, account)
+	}
+	for i, a := range members {
+		for _, b := range members[i+1:] {
+			if !canMessage(a, b) {
+				http.Error(w, fmt.Sprintf("%s and %s may not message each other", a.name, b.name), http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	attachments, err := json.Marshal(req.Attachments)
+	if err != nil {
+		http.Error(w, "Invalid attachments", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error creating the thread", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO message_threads(school_id, subject, created_by, last_message_at) VALUES(?,?,?,CURRENT_TIMESTAMP)", schoolId, req.Subject, callerId)
+	var threadId, messageId int64
+	if err == nil {
+		threadId, err = res.LastInsertId()
+	}
+	if err == nil {
+		res, err = tx.Exec("INSERT INTO messages(thread_id, sender_id, body, attachments) VALUES(?,?,?,?)", threadId, callerId, req.Body, string(attachments))
+	}
+	if err == nil {
+		messageId, err = res.LastInsertId()
+	}
+	for _, member := range members {
+		if err != nil {
+			break
+		}
+		lastRead := int64(0)
+		if member.id == callerId {
+			lastRead = messageId
+		}
+		_, err = tx.Exec("INSERT INTO message_participants(thread_id, exec_id, last_read_id) VALUES(?,?,?)", threadId, member.id, lastRead)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the thread", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionCreate, "message_threads", threadId, nil, map[string]any{"subject": req.Subject, "participant_ids": memberIds})
+
+	thread, err := h.threadById(int(threadId), callerId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the thread", http.StatusInternalServerError)
+		return
+	}
+	message, err := scanMessage(h.db.QueryRow("SELECT "+messageColumns+" FROM messages WHERE id = ?", messageId))
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the thread", http.StatusInternalServerError)
+		return
+	}
+	thread.Messages = []models.Message{message}
+	publishMessage(schoolId, thread, message)
+	writeCreated(w, thread)
+}
+
+// SendMessageHandler adds a message to a thread. Only participants post, and the messaging rules are checked again
+// since a guardian's student may have changed class since the thread started
+func (h *MessagesHandler) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	thread, callerId, ok := h.loadThread(w, r, true)
+	if !ok || !h.requireNotBlocked(w, callerId) {
+		return
+	}
+	if thread.Locked {
+		http.Error(w, "The thread has been locked by a moderator", http.StatusConflict)
+		return
+	}
+
+	var message models.Message
+	err := json.NewDecoder(r.Body).Decode(&message)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(message.Body) == "" {
+		http.Error(w, "body is required", http.StatusBadRequest)
+		return
+	}
+	message.Attachments, err = validateAttachments(message.Attachments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	schoolId := contextSchool(r)
+	memberIds := make([]int, 0, len(thread.Participants))
+	for _, participant := range thread.Participants {
+		memberIds = append(memberIds, participant.Id)
+	}
+	accounts, err := loadMessagingAccounts(h.db, schoolId, memberIds)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	sender := accounts[callerId]
+	if sender == nil {
+		http.Error(w, "Your account cannot send messages in this school", http.StatusForbidden)
+		return
+	}
+	// Participants whose accounts were deleted or deactivated no longer count
+	for _, account := range accounts {
+		if account.id != callerId && !canMessage(sender, account) {
+			http.Error(w, fmt.Sprintf("You may no longer message %s", account.name), http.StatusForbidden)
+			return
+		}
+	}
+
+	attachments, err := json.Marshal(message.Attachments)
+	if err != nil {
+		http.Error(w, "Invalid attachments", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error sending the message", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO messages(thread_id, sender_id, body, attachments) VALUES(?,?,?,?)", thread.Id, callerId, message.Body, string(attachments))
+	var messageId int64
+	if err == nil {
+		messageId, err = res.LastInsertId()
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE message_threads SET last_message_at = CURRENT_TIMESTAMP WHERE id = ?", thread.Id)
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE message_participants SET last_read_id = ? WHERE thread_id = ? AND exec_id = ?", messageId, thread.Id, callerId)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error sending the message", http.StatusInternalServerError)
+		return
+	}
+
+	message, err = scanMessage(h.db.QueryRow("SELECT "+messageColumns+" FROM messages WHERE id = ?", messageId))
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the message", http.StatusInternalServerError)
+		return
+	}
+	publishMessage(schoolId, thread, message)
+	writeCreated(w, message)
+}
+
+// MarkThreadReadHandler marks every message of a thread as read by the caller
+func (h *MessagesHandler) MarkThreadReadHandler(w http.ResponseWriter, r *http.Request) {
+	thread, callerId, ok := h.loadThread(w, r, true)
+	if !ok {
+		return
+	}
+
+	_, err := h.db.Exec("UPDATE message_participants SET last_read_id = (SELECT COALESCE(MAX(id), 0) FROM messages WHERE thread_id = ?) WHERE thread_id = ? AND exec_id = ?",
+		thread.Id, thread.Id, callerId,
+	)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error marking the thread as read", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetUnreadHandler returns the caller's unread message count in total and per thread, leaving out threads with none
+func (h *MessagesHandler) GetUnreadHandler(w http.ResponseWriter, r *http.Request) {
+	schoolId, callerId, ok := messagingCaller(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT p.thread_id, COUNT(m.id) FROM message_participants p
+		JOIN message_threads t ON t.id = p.thread_id AND t.school_id = ?
+		JOIN messages m ON m.thread_id = p.thread_id AND m.id > p.last_read_id AND m.sender_id <> p.exec_id AND m.hidden_at IS NULL
+		WHERE p.exec_id = ? GROUP BY p.thread_id ORDER BY p.thread_id`, schoolId, callerId,
+	)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the unread counts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := struct {
+		Status  string               `json:"status"`
+		Total   int                  `json:"total"`
+		Threads []models.UnreadCount `json:"threads"`
+	}{Status: "success", Threads: make([]models.UnreadCount, 0)}
+	for rows.Next() {
+		var count models.UnreadCount
+		err = rows.Scan(&count.ThreadId, &count.UnreadCount)
+		if err != nil {
+			log.Println("Scan error:", err)
+			http.Error(w, "Error retrieving the unread counts", http.StatusInternalServerError)
+			return
+		}
+		response.Total += count.UnreadCount
+		response.Threads = append(response.Threads, count)
+	}
+	writeJSONWithETag(w, r, "", response)
+}
+
+// GetContactsHandler lists the accounts the caller may start a thread with, by name
+func (h *MessagesHandler) GetContactsHandler(w http.ResponseWriter, r *http.Request) {
+	schoolId, callerId, ok := messagingCaller(w, r)
+	if !ok {
+		return
+	}
+	params, err := parseListQuery(r.URL.Query(), contactListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := params.defaultSort("name", contactListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accounts, err := loadMessagingAccounts(h.db, schoolId, nil)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	caller := accounts[callerId]
+	if caller == nil {
+		http.Error(w, "Your account cannot send messages in this school", http.StatusForbidden)
+		return
+	}
+
+	contacts := make([]models.MessageParticipant, 0)
+	for _, account := range accounts {
+		if account.id != callerId && canMessage(caller, account) && contactMatches(account.participant(), params.filters) {
+			contacts = append(contacts, account.participant())
+		}
+	}
+	result, err := pageSlice(contacts, params, pageParams)
+	if err != nil {
+		log.Println("Paging error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// contactMatches applies the list filters to a contact, whose filter columns are its JSON fields
+func contactMatches(contact models.MessageParticipant, filters []listFilter) bool {
+	fields := map[string]any{"id": contact.Id, "name": contact.Name, "role": contact.Role}
+	for _, filter := range filters {
+		if !slices.Contains(filter.values, fields[filter.column]) {
+			return false
+		}
+	}
+	return true
+}
+
+// HideMessageHandler lets an admin remove a message from its thread with a reason. The message is kept for admins
+func (h *MessagesHandler) HideMessageHandler(w http.ResponseWriter, r *http.Request) {
+	h.setMessageHidden(w, r, true)
+}
+
+// UnhideMessageHandler restores a hidden message
+func (h *MessagesHandler) UnhideMessageHandler(w http.ResponseWriter, r *http.Request) {
+	h.setMessageHidden(w, r, false)
+}
+
+func (h *MessagesHandler) setMessageHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	if !moderationAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if hidden {
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	before, err := scanMessage(h.db.QueryRow("SELECT "+messageColumns+" FROM messages WHERE id = ? AND thread_id IN (SELECT id FROM message_threads WHERE school_id = ?)", id, schoolId))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Message with that ID does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+
+	if hidden {
+		_, err = h.db.Exec("UPDATE messages SET hidden_at = CURRENT_TIMESTAMP, hidden_by = ?, hidden_reason = ? WHERE id = ?", contextUsername(r), req.Reason, id)
+	} else {
+		_, err = h.db.Exec("UPDATE messages SET hidden_at = NULL, hidden_by = NULL, hidden_reason = NULL WHERE id = ?", id)
+	}
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error updating the message", http.StatusInternalServerError)
+		return
+	}
+
+	after := before
+	after.Hidden, after.HiddenReason = hidden, req.Reason
+	audit.Record(h.db, r, audit.ActionUpdate, "messages", id,
+		map[string]any{"hidden": before.Hidden, "hidden_reason": before.HiddenReason},
+		map[string]any{"hidden": after.Hidden, "hidden_reason": after.HiddenReason},
+	)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(after)
+}
+
+// LockThreadHandler stops anyone from posting to a thread, which stays readable
+func (h *MessagesHandler) LockThreadHandler(w http.ResponseWriter, r *http.Request) {
+	h.setThreadLocked(w, r, true)
+}
+
+// UnlockThreadHandler reopens a locked thread
+func (h *MessagesHandler) UnlockThreadHandler(w http.ResponseWriter, r *http.Request) {
+	h.setThreadLocked(w, r, false)
+}
+
+func (h *MessagesHandler) setThreadLocked(w http.ResponseWriter, r *http.Request, locked bool) {
+	if !moderationAccess.allow(w, r) {
+		return
+	}
+	thread, _, ok := h.loadThread(w, r, false)
+	if !ok {
+		return
+	}
+
+	var err error
+	if locked {
+		_, err = h.db.Exec("UPDATE message_threads SET locked_at = COALESCE(locked_at, CURRENT_TIMESTAMP), locked_by = ? WHERE id = ?", contextUsername(r), thread.Id)
+	} else {
+		_, err = h.db.Exec("UPDATE message_threads SET locked_at = NULL, locked_by = NULL WHERE id = ?", thread.Id)
+	}
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error updating the thread", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "message_threads", thread.Id, map[string]any{"locked": thread.Locked}, map[string]any{"locked": locked})
+	thread.Locked = locked
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
+// GetBlocksHandler lists the accounts of the school blocked from messaging, most recent first
+func (h *MessagesHandler) GetBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	if !moderationAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+	params, err := parseListQuery(r.URL.Query(), blockListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params.keyedBy("exec_id", blockListColumns)
+	if err := params.defaultSort("-created_at", blockListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	params.addScope("school_id = ?", schoolId)
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "message_blocks", "exec_id, COALESCE(reason, ''), COALESCE(blocked_by, ''), created_at", params, pageParams,
+		func(row rowScanner) (models.MessageBlock, error) {
+			var block models.MessageBlock
+			err := row.Scan(&block.ExecId, &block.Reason, &block.BlockedBy, &block.CreatedAt)
+			return block, err
+		},
+	)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the blocks", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// CreateBlockHandler stops an account from starting threads or sending messages. It can still read its threads
+func (h *MessagesHandler) CreateBlockHandler(w http.ResponseWriter, r *http.Request) {
+	if !moderationAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var block models.MessageBlock
+	err := json.NewDecoder(r.Body).Decode(&block)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var exists int
+	err = h.db.QueryRow("SELECT 1 FROM execs WHERE id = ? AND school_id = ? AND "+notDeleted, block.ExecId, schoolId).Scan(&exists)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Exec with that ID does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+
+	block.BlockedBy = contextUsername(r)
+	_, err = h.db.Exec("INSERT INTO message_blocks(exec_id, school_id, reason, blocked_by) VALUES(?,?,?,?)", block.ExecId, schoolId, block.Reason, block.BlockedBy)
+	if isDuplicateEntry(err) {
+		http.Error(w, "The account is already blocked", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error blocking the account", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionCreate, "message_blocks", block.ExecId, nil, block)
+	writeCreated(w, block)
+}
+
+// DeleteBlockHandler lets a blocked account send messages again
+func (h *MessagesHandler) DeleteBlockHandler(w http.ResponseWriter, r *http.Request) {
+	if !moderationAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+	execId, err := strconv.Atoi(r.PathValue("execId"))
+	if err != nil {
+		http.Error(w, "Invalid exec ID", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.db.Exec("DELETE FROM message_blocks WHERE exec_id = ? AND school_id = ?", execId, schoolId)
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, "Error removing the block", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "The account is not blocked", http.StatusNotFound)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionDelete, "message_blocks", execId, models.MessageBlock{ExecId: execId}, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadThread reads the thread of the path's {id} with its participants. Participants and admins of the school may
+// see it, or only participants when participantOnly is set. The error response is written when it returns false
+func (h *MessagesHandler) loadThread(w http.ResponseWriter, r *http.Request, participantOnly bool) (models.MessageThread, int, bool) {
+	schoolId, callerId, ok := messagingCaller(w, r)
+	if !ok {
+		return models.MessageThread{}, 0, false
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid thread ID", http.StatusBadRequest)
+		return models.MessageThread{}, 0, false
+	}
+
+	var threadSchool int
+	err = h.db.QueryRow("SELECT school_id FROM message_threads WHERE id = ?", id).Scan(&threadSchool)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return models.MessageThread{}, 0, false
+	}
+	var thread models.MessageThread
+	if err == nil && threadSchool == schoolId {
+		thread, err = h.threadById(id, callerId)
+		if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+			return models.MessageThread{}, 0, false
+		}
+	}
+
+	participant := slices.ContainsFunc(thread.Participants, func(p models.MessageParticipant) bool { return p.Id == callerId })
+	if thread.Id == 0 || (!participant && (participantOnly || !moderationAccess.grants(contextRole(r)))) {
+		// Threads the caller may not see are reported as missing rather than forbidden
+		http.Error(w, "Thread with that ID does not exist", http.StatusNotFound)
+		return models.MessageThread{}, 0, false
+	}
+	return thread, callerId, true
+}
+
+// threadById reads a thread with its participants and the unread count of the given account
+func (h *MessagesHandler) threadById(id, callerId int) (models.MessageThread, error) {
+	var thread models.MessageThread
+	err := h.db.QueryRow("SELECT "+threadColumns+`, COALESCE((SELECT COUNT(*) FROM messages m JOIN message_participants p ON p.thread_id = m.thread_id AND p.exec_id = ?
+		WHERE m.thread_id = t.id AND m.id > p.last_read_id AND m.sender_id <> p.exec_id AND m.hidden_at IS NULL), 0) FROM message_threads t WHERE t.id = ?`, callerId, id,
+	).Scan(&thread.Id, &thread.Subject, &thread.CreatedBy, &thread.CreatedAt, &thread.LastMessageAt, &thread.Locked, &thread.UnreadCount)
+	if err != nil {
+		return thread, err
+	}
+	threads := []models.MessageThread{thread}
+	err = h.attachParticipants(threads)
+	return threads[0], err
+}
+
+// attachParticipants fills in the participants of the threads
+func (h *MessagesHandler) attachParticipants(threads []models.MessageThread) error {
+	if len(threads) == 0 {
+		return nil
+	}
+	byId := make(map[int]*models.MessageThread, len(threads))
+	args := make([]any, 0, len(threads))
+	for i := range threads {
+		threads[i].Participants = make([]models.MessageParticipant, 0)
+		byId[threads[i].Id] = &threads[i]
+		args = append(args, threads[i].Id)
+	}
+
+	rows, err := h.db.Query(`SELECT p.thread_id, e.id, TRIM(CONCAT(e.first_name, ' ', e.last_name)), e.role FROM message_participants p
+		JOIN execs e ON e.id = p.exec_id WHERE p.thread_id IN (?`+strings.Repeat(",?", len(args)-1)+") ORDER BY p.thread_id, e.id", args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var threadId int
+		var participant models.MessageParticipant
+		err = rows.Scan(&threadId, &participant.Id, &participant.Name, &participant.Role)
+		if err != nil {
+			return err
+		}
+		byId[threadId].Participants = append(byId[threadId].Participants, participant)
+	}
+	return rows.Err()
+}
+
+// requireNotBlocked writes a 403 and returns false when an admin has blocked the account from messaging
+func (h *MessagesHandler) requireNotBlocked(w http.ResponseWriter, execId int) bool {
+	var blocked int
+	err := h.db.QueryRow("SELECT COUNT(*) FROM message_blocks WHERE exec_id = ?", execId).Scan(&blocked)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return false
+	}
+	if blocked > 0 {
+		http.Error(w, "Your account has been blocked from sending messages", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// messagingCaller returns the school and account ID of the caller, writing the error response itself when there is none
+func messagingCaller(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+	callerId, err := strconv.Atoi(contextUserId(r))
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	return schoolId, callerId, true
+}
+
+// publishMessage notifies the other participants of a thread of a new message
+func publishMessage(schoolId int, thread models.MessageThread, message models.Message) {
+	recipients := make([]string, 0, len(thread.Participants))
+	for _, participant := range thread.Participants {
+		if participant.Id != message.SenderId {
+			recipients = append(recipients, strconv.Itoa(participant.Id))
+		}
+	}
+	events.Publish(events.TypeMessageReceived, schoolId, events.Audience{UserIds: recipients}, map[string]any{
+		"thread_id": thread.Id,
+		"subject":   thread.Subject,
+		"message":   message,
+	})
+}
+
+// scanThread reads a row of threadColumns followed by the unread count
+func scanThread(row rowScanner) (models.MessageThread, error) {
+	var thread models.MessageThread
+	err := row.Scan(&thread.Id, &thread.Subject, &thread.CreatedBy, &thread.CreatedAt, &thread.LastMessageAt, &thread.Locked, &thread.UnreadCount)
+	return thread, err
+}
+
+func scanMessage(row rowScanner) (models.Message, error) {
+	var message models.Message
+	var attachments string
+	err := row.Scan(&message.Id, &message.ThreadId, &message.SenderId, &message.Body, &attachments, &message.CreatedAt, &message.Hidden, &message.HiddenReason)
+	if err != nil {
+		return message, err
+	}
+	message.Attachments = make([]models.Attachment, 0)
+	if attachments != "" {
+		err = json.Unmarshal([]byte(attachments), &message.Attachments)
+	}
+	return message, err
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetBlocksHandlerPages(t *testing.T) {
+	// One row more than the page size tells queryPage there is a next page
+	rows := make([][]driver.Value, 0, defaultPageSize+1)
+	for i := 0; i <= defaultPageSize; i++ {
+		rows = append(rows, []driver.Value{int64(100 - i), "", "admin", "2026-10-19 08:00:00"})
+	}
+	db, fake := newFakeDB(t, fakeStatement{sql: "FROM message_blocks", columns: []string{"exec_id", "reason", "blocked_by", "created_at"}, rows: rows})
+
+	r := httptest.NewRequest("GET", "/messages/blocks", nil)
+	ctx := context.WithValue(r.Context(), utils.ContextKey("role"), "admin")
+	r = r.WithContext(context.WithValue(ctx, utils.ContextKey("schoolId"), 1))
+	w := httptest.NewRecorder()
+
+	NewMessagesHandler(db).GetBlocksHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if !fake.ran("ORDER BY created_at DESC, exec_id ASC LIMIT ?") {
+		t.Errorf("blocks were not read newest first with the account as tie-breaker")
+	}
+
+	var response struct {
+		Count      int                   `json:"count"`
+		NextCursor string                `json:"next_cursor"`
+		Data       []models.MessageBlock `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Count != defaultPageSize || len(response.Data) != defaultPageSize {
+		t.Errorf("count = %d with %d blocks, want %d", response.Count, len(response.Data), defaultPageSize)
+	}
+	cursor, err := decodeCursor(response.NextCursor)
+	if err != nil {
+		t.Fatalf("next_cursor %q: %v", response.NextCursor, err)
+	}
+	if cursor.Sort != "-created_at,exec_id" || len(cursor.Values) != 2 || cursor.Values[1] != float64(91) {
+		t.Errorf("next cursor = %+v, want the sort -created_at,exec_id ending at account 91", cursor)
+	}
+}
+
+func TestContactMatches(t *testing.T) {
+	contact := models.MessageParticipant{Id: 7, Name: "Grace Hopper", Role: "teacher"}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"role=teacher", true},
+		{"role=guardian&role=teacher", true},
+		{"role=guardian", false},
+		{"id=7&role=teacher", true},
+		{"id=8", false},
+		{"name=Grace+Hopper", true},
+	}
+	for _, test := range tests {
+		values, _ := url.ParseQuery(test.query)
+		params, err := parseListQuery(values, contactListColumns)
+		if err != nil {
+			t.Fatalf("parseListQuery(%q) error = %v", test.query, err)
+		}
+		if got := contactMatches(contact, params.filters); got != test.want {
+			t.Errorf("contactMatches(%q) = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestThreadListSorts(t *testing.T) {
+	params, err := parseListQuery(url.Values{}, threadListColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := params.defaultSort("-last_message_at,-id", threadListColumns); err != nil {
+		t.Fatal(err)
+	}
+	if got := params.orderByClause(false); !strings.Contains(got, "COALESCE(t.last_message_at, t.created_at) DESC, t.id DESC") {
+		t.Errorf("orderByClause() = %q, want the most recently active threads first", got)
+	}
+}
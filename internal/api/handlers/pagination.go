@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor marks a position in a sorted collection.
+// It is handed to clients as opaque base64 and is only valid for the sort it was created with
+type pageCursor struct {
+	Sort     string `json:"s"`
+	Values   []any  `json:"v"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// pageParams holds the parsed limit, cursor and include_total query parameters
+type pageParams struct {
+	limit        int
+	cursor       *pageCursor
+	includeTotal bool
+}
+
+// page is one keyset paginated slice of a collection
+type page[T any] struct {
+	records    []T
+	nextCursor string
+	prevCursor string
+	total      *int
+}
+
+// getPageParams parses the pagination parameters, capping the page size at maxPageSize
+func getPageParams(r *http.Request, params listQuery) (pageParams, error) {
+	query := r.URL.Query()
+	page := pageParams{limit: defaultPageSize}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return pageParams{}, errors.New("limit must be a positive number")
+		}
+		page.limit = min(limit, maxPageSize)
+	}
+
+	if includeTotalStr := query.Get("include_total"); includeTotalStr != "" {
+		includeTotal, err := strconv.ParseBool(includeTotalStr)
+		if err != nil {
+			return pageParams{}, errors.New("include_total must be true or false")
+		}
+		page.includeTotal = includeTotal
+	}
+
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		cursor, err := decodeCursor(cursorStr)
+		keys := params.sortKeys()
+		if err != nil || cursor.Sort != sortSignature(params) || len(cursor.Values) != len(keys) {
+			return pageParams{}, errInvalidCursor
+		}
+		for i, key := range keys {
+			if !key.accepts(cursor.Values[i]) {
+				return pageParams{}, errInvalidCursor
+			}
+		}
+		page.cursor = &cursor
+	}
+
+	return page, nil
+}
+
+// accepts reports whether a cursor value decoded from JSON fits the column: a whole number for numeric columns,
+// a boolean for boolean ones and a string otherwise. Any column may hold NULL
+func (key listSort) accepts(value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case float64:
+		return key.numeric && value == math.Trunc(value)
+	case bool:
+		return key.boolean
+	case string:
+		return !key.numeric && !key.boolean
+	}
+	return false
+}
+
+// sortSignature identifies the sort a cursor was created with
+func sortSignature(params listQuery) string {
+	keys := params.sortKeys()
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		if key.desc {
+			parts[i] = "-" + key.field
+		} else {
+			parts[i] = key.field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func encodeCursor(cursor pageCursor) string {
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCursor(value string) (pageCursor, error) {
+	var cursor pageCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(decoded, &cursor)
+	return cursor, err
+}
+
+// keysetCondition selects the rows strictly after (or before, when walking backwards) the cursor position.
+// For sort keys a, b, id it expands to (a > ?) OR (a = ? AND b > ?) OR (a = ? AND b = ? AND id > ?),
+// with the comparison flipped for descending keys. NULLs sort first in ascending order, as MariaDB sorts them, so a
+// NULL cursor value is compared with IS NULL and IS NOT NULL instead
+func keysetCondition(keys []listSort, cursor pageCursor) (string, []any) {
+	alternatives := make([]string, len(keys))
+	args := make([]any, 0, len(keys)*(len(keys)+1)/2)
+	for i, key := range keys {
+		parts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			if cursor.Values[j] == nil {
+				parts = append(parts, keys[j].column+" IS NULL")
+				continue
+			}
+			parts = append(parts, keys[j].column+" = ?")
+			args = append(args, cursor.Values[j])
+		}
+
+		ascending := key.desc == cursor.Backward
+		// The last key is the id tie-breaker, which is never NULL
+		last := i == len(keys)-1
+		switch {
+		case cursor.Values[i] == nil && ascending:
+			parts = append(parts, key.column+" IS NOT NULL")
+		case cursor.Values[i] == nil:
+			// Nothing sorts before NULL
+			parts = append(parts, "FALSE")
+		case ascending:
+			parts = append(parts, key.column+" > ?")
+			args = append(args, cursor.Values[i])
+		case last:
+			parts = append(parts, key.column+" < ?")
+			args = append(args, cursor.Values[i])
+		default:
+			parts = append(parts, "("+key.column+" < ? OR "+key.column+" IS NULL)")
+			args = append(args, cursor.Values[i])
+		}
+
+		alternatives[i] = "(" + strings.Join(parts, " AND ") + ")"
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// cursorValues extracts the sort key values of a record, as JSON values, from the struct fields named by the sort
+// keys' JSON fields. Fields omitempty leaves out of the record's JSON still give their zero value, and nil pointers NULL
+func cursorValues[T any](record T, keys []listSort) ([]any, error) {
+	fields := jsonFields(reflect.Indirect(reflect.ValueOf(record)))
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		field, ok := fields[key.field]
+		if !ok {
+			return nil, fmt.Errorf("%T has no field %q to sort on", record, key.field)
+		}
+		encoded, err := json.Marshal(field.Interface())
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(encoded, &values[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// jsonFields maps the JSON names of a struct's exported fields to their values
+func jsonFields(record reflect.Value) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	if record.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < record.NumField(); i++ {
+		field := record.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = record.Field(i)
+	}
+	return fields
+}
+
+// queryPage runs a keyset paginated SELECT of the given columns against table, applying the list filters.
+// table may join other tables, its placeholders being bound with bindTable; columns may not hold placeholders.
+// It fetches one row more than requested to find out whether another page exists in the walking direction
+func queryPage[T any](db *sql.DB, table, columns string, params listQuery, pageParams pageParams, scan func(rowScanner) (T, error)) (page[T], error) {
+	var result page[T]
+	keys := params.sortKeys()
+	signature := sortSignature(params)
+
+	conditions, args := params.conditions()
+	args = append(append([]any(nil), params.tableArgs...), args...)
+	filterWhere := joinConditions(conditions)
+	filterArgs := append([]any(nil), args...)
+
+	backward := false
+	if pageParams.cursor != nil {
+		backward = pageParams.cursor.Backward
+		condition, cursorArgs := keysetCondition(keys, *pageParams.cursor)
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s%s%s LIMIT ?", columns, table, joinConditions(conditions), params.orderByClause(backward))
+	rows, err := db.Query(query, append(args, pageParams.limit+1)...)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	records := make([]T, 0, pageParams.limit+1)
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return result, err
+		}
+		records = append(records, record)
+	}
+	err = rows.Err()
+	if err != nil {
+		return result, err
+	}
+
+	result, err = finishPage(records, keys, signature, pageParams)
+	if err != nil {
+		return result, err
+	}
+
+	if pageParams.includeTotal {
+		var total int
+		err = db.QueryRow("SELECT COUNT(*) FROM "+table+filterWhere, filterArgs...).Scan(&total)
+		if err != nil {
+			return result, err
+		}
+		result.total = &total
+	}
+
+	return result, nil
+}
+
+// finishPage trims the records read in the walking direction, one more than the page size when another page exists,
+// to the page and sets the cursors of its neighbours
+func finishPage[T any](records []T, keys []listSort, signature string, pageParams pageParams) (page[T], error) {
+	var result page[T]
+	backward := pageParams.cursor != nil && pageParams.cursor.Backward
+
+	hasMore := len(records) > pageParams.limit
+	if hasMore {
+		records = records[:pageParams.limit]
+	}
+	if backward {
+		// Rows were read in reverse order, flip them back to the requested order
+		for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+			records[i], records[j] = records[j], records[i]
+		}
+	}
+
+	// Walking forward there is a previous page whenever we started from a cursor, and vice versa
+	hasNext := hasMore
+	hasPrev := pageParams.cursor != nil
+	if backward {
+		hasNext, hasPrev = true, hasMore
+	}
+
+	if len(records) > 0 {
+		if hasNext {
+			values, err := cursorValues(records[len(records)-1], keys)
+			if err != nil {
+				return result, err
+			}
+			result.nextCursor = encodeCursor(pageCursor{Sort: signature, Values: values})
+		}
+		if hasPrev {
+			values, err := cursorValues(records[0], keys)
+			if err != nil {
+				return result, err
+			}
+			result.prevCursor = encodeCursor(pageCursor{Sort: signature, Values: values, Backward: true})
+		}
+	}
+	result.records = records
+	return result, nil
+}
+
+// pageSlice is queryPage for collections computed in memory, such as the occurrences of recurring events. The records
+// are sorted and compared on the JSON values of the sort fields, the same values the cursors carry
+func pageSlice[T any](records []T, params listQuery, pageParams pageParams) (page[T], error) {
+	keys := params.sortKeys()
+	values := make([][]any, len(records))
+	for i, record := range records {
+		var err error
+		values[i], err = cursorValues(record, keys)
+		if err != nil {
+			return page[T]{}, err
+		}
+	}
+
+	backward := pageParams.cursor != nil && pageParams.cursor.Backward
+	order := make([]int, len(records))
+	for i := range order {
+		order[i] = i
+	}
+	// Walking backwards reads the records in reverse order, as queryPage does
+	sort.SliceStable(order, func(i, j int) bool {
+		comparison := compareKeys(keys, values[order[i]], values[order[j]])
+		if backward {
+			return comparison > 0
+		}
+		return comparison < 0
+	})
+
+	walked := make([]T, 0, pageParams.limit+1)
+	for _, i := range order {
+		if len(walked) > pageParams.limit {
+			break
+		}
+		if pageParams.cursor != nil {
+			// Keep the records strictly past the cursor in the walking direction
+			comparison := compareKeys(keys, values[i], pageParams.cursor.Values)
+			if (!backward && comparison <= 0) || (backward && comparison >= 0) {
+				continue
+			}
+		}
+		walked = append(walked, records[i])
+	}
+
+	result, err := finishPage(walked, keys, sortSignature(params), pageParams)
+	if err == nil && pageParams.includeTotal {
+		total := len(records)
+		result.total = &total
+	}
+	return result, err
+}
+
+// compareKeys orders two sets of sort key values, descending keys comparing the other way round
+func compareKeys(keys []listSort, a, b []any) int {
+	for i, key := range keys {
+		comparison := compareValues(a[i], b[i])
+		if key.desc {
+			comparison = -comparison
+		}
+		if comparison != 0 {
+			return comparison
+		}
+	}
+	return 0
+}
+
+// compareValues orders two JSON values of the same field: numbers, strings or booleans, with null first
+func compareValues(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == b:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			return cmp.Compare(a, b)
+		}
+	case bool:
+		if b, ok := b.(bool); ok && a != b {
+			if a {
+				return 1
+			}
+			return -1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// writePage sends a page of records with RFC 8288 Link headers pointing at the neighbouring pages
+func writePage[T any](w http.ResponseWriter, r *http.Request, result page[T], fields []string) {
+	data, err := selectFields(result.records, fields)
+	if err != nil {
+		http.Error(w, "Error encoding the response", http.StatusInternalServerError)
+		return
+	}
+
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, pageURL(r, ""))}
+	if result.nextCursor != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(r, result.nextCursor)))
+	}
+	if result.prevCursor != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(r, result.prevCursor)))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+
+	response := struct {
+		Status     string `json:"status"`
+		Count      int    `json:"count"`
+		Total      *int   `json:"total,omitempty"`
+		NextCursor string `json:"next_cursor,omitempty"`
+		PrevCursor string `json:"prev_cursor,omitempty"`
+		Data       any    `json:"data"`
+	}{
+		Status:     "success",
+		Count:      len(result.records),
+		Total:      result.total,
+		NextCursor: result.nextCursor,
+		PrevCursor: result.prevCursor,
+		Data:       data,
+	}
+	writeJSONWithETag(w, r, "", response)
+}
+
+// pageURL rebuilds the request URL with a different cursor, keeping every other parameter
+func pageURL(r *http.Request, cursor string) string {
+	query := r.URL.Query()
+	query.Del("cursor")
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return u.String()
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+var testListColumns = map[string]listColumn{
+	"id":     {column: "id", numeric: true},
+	"name":   {column: "name"},
+	"active": {column: "active", boolean: true},
+}
+
+func testListQuery(t *testing.T, sort string) listQuery {
+	t.Helper()
+	params, err := parseListQuery(url.Values{"sort": {sort}}, testListColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+func TestDefaultSort(t *testing.T) {
+	tests := []struct {
+		sort     string // the client's ?sort=
+		defaults string
+		want     string
+		wantErr  bool
+	}{
+		{"", "-name", "-name,id", false},
+		{"id", "-name", "id", false},
+		{"", "-active,name", "-active,name,id", false},
+		{"", "missing", "", true},
+		{"name", "missing", "name,id", false},
+	}
+	for _, test := range tests {
+		params := testListQuery(t, test.sort)
+		err := params.defaultSort(test.defaults, testListColumns)
+		if (err != nil) != test.wantErr {
+			t.Errorf("defaultSort(%q) with ?sort=%s error = %v, wantErr %v", test.defaults, test.sort, err, test.wantErr)
+			continue
+		}
+		if got := sortSignature(params); err == nil && got != test.want {
+			t.Errorf("defaultSort(%q) with ?sort=%s sorts by %q, want %q", test.defaults, test.sort, got, test.want)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []pageCursor{
+		{Sort: "name,id", Values: []any{"Anna", float64(4)}},
+		{Sort: "-created_at,id", Values: []any{"2026-09-07 08:00:00", float64(12)}, Backward: true},
+		{Sort: "active,id", Values: []any{true, float64(1)}},
+	}
+	for _, test := range tests {
+		got, err := decodeCursor(encodeCursor(test))
+		if err != nil {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) error = %v", test, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test) {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) = %+v", test, got)
+		}
+	}
+
+	for _, value := range []string{"!!!", "bm90IGpzb24", ""} {
+		if _, err := decodeCursor(value); err == nil {
+			t.Errorf("decodeCursor(%q) error = nil, want an error", value)
+		}
+	}
+}
+
+func TestGetPageParams(t *testing.T) {
+	params := testListQuery(t, "name")
+	valid := encodeCursor(pageCursor{Sort: "name,id", Values: []any{"Anna", float64(4)}})
+	tests := []struct {
+		query     string
+		wantLimit int
+		wantTotal bool
+		wantErr   bool
+	}{
+		{"", defaultPageSize, false, false},
+		{"limit=25&include_total=true", 25, true, false},
+		{"limit=1000", maxPageSize, false, false},
+		{"cursor=" + valid, defaultPageSize, false, false},
+		{"limit=0", 0, false, true},
+		{"limit=ten", 0, false, true},
+		{"include_total=maybe", 0, false, true},
+		{"cursor=" + encodeCursor(pageCursor{Sort: "-name,id", Values: []any{"Anna", float64(4)}}), 0, false, true},
+		{"cursor=" + encodeCursor(pageCursor{Sort: "name,id", Values: []any{"Anna"}}), 0, false, true},
+		{"cursor=garbage", 0, false, true},
+		{"cursor=" + encodeCursor(pageCursor{Sort: "name,id", Values: []any{"Anna", "4"}}), 0, false, true},
+		{"cursor=" + encodeCursor(pageCursor{Sort: "name,id", Values: []any{"Anna", 4.5}}), 0, false, true},
+		{"cursor=" + encodeCursor(pageCursor{Sort: "name,id", Values: []any{float64(1), float64(4)}}), 0, false, true},
+		{"cursor=" + encodeCursor(pageCursor{Sort: "name,id", Values: []any{map[string]any{"x": 1}, float64(4)}}), 0, false, true},
+		{"cursor=" + encodeCursor(pageCursor{Sort: "name,id", Values: []any{nil, float64(4)}}), defaultPageSize, false, false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/items?"+test.query, nil)
+		got, err := getPageParams(r, params)
+		if (err != nil) != test.wantErr {
+			t.Errorf("getPageParams(%q) error = %v, wantErr %v", test.query, err, test.wantErr)
+			continue
+		}
+		if err == nil && (got.limit != test.wantLimit || got.includeTotal != test.wantTotal) {
+			t.Errorf("getPageParams(%q) = limit %d total %v, want limit %d total %v", test.query, got.limit, got.includeTotal, test.wantLimit, test.wantTotal)
+		}
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		sort     string
+		backward bool
+		null     bool // whether the cursor's first value is NULL
+		want     string
+		wantArgs int
+	}{
+		{"id", false, false, "((id > ?))", 1},
+		{"name", false, false, "((name > ?) OR (name = ? AND id > ?))", 3},
+		{"-name", false, false, "(((name < ? OR name IS NULL)) OR (name = ? AND id > ?))", 3},
+		{"-name", true, false, "((name > ?) OR (name = ? AND id < ?))", 3},
+		{"name", false, true, "((name IS NOT NULL) OR (name IS NULL AND id > ?))", 1},
+		{"name", true, true, "((FALSE) OR (name IS NULL AND id < ?))", 1},
+		{"-name", false, true, "((FALSE) OR (name IS NULL AND id > ?))", 1},
+		{"-name", true, true, "((name IS NOT NULL) OR (name IS NULL AND id < ?))", 1},
+	}
+	for _, test := range tests {
+		keys := testListQuery(t, test.sort).sortKeys()
+		values := make([]any, len(keys))
+		for i := range values {
+			values[i] = i
+		}
+		if test.null {
+			values[0] = nil
+		}
+		got, args := keysetCondition(keys, pageCursor{Values: values, Backward: test.backward})
+		if got != test.want {
+			t.Errorf("keysetCondition(%q, backward %v, null %v) = %q, want %q", test.sort, test.backward, test.null, got, test.want)
+		}
+		if len(args) != test.wantArgs {
+			t.Errorf("keysetCondition(%q, backward %v, null %v) has %d args, want %d", test.sort, test.backward, test.null, len(args), test.wantArgs)
+		}
+	}
+}
+
+func TestCursorValues(t *testing.T) {
+	type item struct {
+		Id       int     `json:"id"`
+		Name     string  `json:"name,omitempty"`
+		Active   bool    `json:"active,omitempty"`
+		Deadline *string `json:"deadline"`
+	}
+	deadline := "2026-10-19"
+	keys := func(fields ...string) []listSort {
+		sorts := make([]listSort, len(fields))
+		for i, field := range fields {
+			sorts[i] = listSort{field: field}
+		}
+		return sorts
+	}
+	tests := []struct {
+		record item
+		keys   []listSort
+		want   []any
+	}{
+		{item{Id: 3, Name: "Anna", Active: true}, keys("name", "active", "id"), []any{"Anna", true, float64(3)}},
+		{item{Id: 4}, keys("name", "active", "id"), []any{"", false, float64(4)}},
+		{item{Id: 5}, keys("deadline", "id"), []any{nil, float64(5)}},
+		{item{Id: 6, Deadline: &deadline}, keys("deadline", "id"), []any{"2026-10-19", float64(6)}},
+	}
+	for _, test := range tests {
+		got, err := cursorValues(test.record, test.keys)
+		if err != nil {
+			t.Errorf("cursorValues(%+v) error = %v", test.record, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("cursorValues(%+v) = %v, want %v", test.record, got, test.want)
+		}
+	}
+
+	if _, err := cursorValues(item{}, keys("missing")); err == nil {
+		t.Errorf("cursorValues() of an unknown field error = nil, want an error")
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		a, b any
+		want int
+	}{
+		{float64(2), float64(10), -1},
+		{float64(10), float64(2), 1},
+		{float64(3), float64(3), 0},
+		{"10", "2", -1},
+		{"b", "a", 1},
+		{"", "a", -1},
+		{false, true, -1},
+		{true, false, 1},
+		{true, true, 0},
+		{float64(1), "a", -1},
+		{nil, "a", -1},
+		{float64(1), nil, 1},
+		{nil, nil, 0},
+	}
+	for _, test := range tests {
+		if got := compareValues(test.a, test.b); got != test.want {
+			t.Errorf("compareValues(%v, %v) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestPageSlice(t *testing.T) {
+	type item struct {
+		Id   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	items := []item{{1, "c"}, {2, "a"}, {3, "b"}, {4, "a"}, {5, "d"}}
+
+	tests := []struct {
+		sort  string
+		limit int
+		want  []string
+	}{
+		{"name", 2, []string{"[2 4]", "[3 1]", "[5]"}},
+		{"-name", 2, []string{"[5 1]", "[3 2]", "[4]"}},
+		{"-id", 3, []string{"[5 4 3]", "[2 1]"}},
+		{"id", 5, []string{"[1 2 3 4 5]"}},
+	}
+	for _, test := range tests {
+		t.Run(test.sort, func(t *testing.T) {
+			params := testListQuery(t, test.sort)
+			fetch := func(cursor string) page[item] {
+				t.Helper()
+				pageParams := pageParams{limit: test.limit, includeTotal: true}
+				if cursor != "" {
+					decoded, err := decodeCursor(cursor)
+					if err != nil {
+						t.Fatal(err)
+					}
+					pageParams.cursor = &decoded
+				}
+				result, err := pageSlice(items, params, pageParams)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.total == nil || *result.total != len(items) {
+					t.Errorf("total = %v, want %d", result.total, len(items))
+				}
+				return result
+			}
+			ids := func(result page[item]) string {
+				got := make([]int, len(result.records))
+				for i, record := range result.records {
+					got[i] = record.Id
+				}
+				return fmt.Sprint(got)
+			}
+
+			// Walk forward to the last page, then back to the first
+			result := fetch("")
+			if result.prevCursor != "" {
+				t.Errorf("first page has a previous cursor")
+			}
+			for i, want := range test.want {
+				if got := ids(result); got != want {
+					t.Fatalf("page %d forward = %s, want %s", i+1, got, want)
+				}
+				if i < len(test.want)-1 {
+					result = fetch(result.nextCursor)
+				}
+			}
+			if result.nextCursor != "" {
+				t.Errorf("last page has a next cursor")
+			}
+			for i := len(test.want) - 2; i >= 0; i-- {
+				result = fetch(result.prevCursor)
+				if got := ids(result); got != test.want[i] {
+					t.Fatalf("page %d backward = %s, want %s", i+1, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPageSliceCursorPastTheEnd(t *testing.T) {
+	params := testListQuery(t, "id")
+	cursor := pageCursor{Sort: sortSignature(params), Values: []any{float64(99)}}
+	result, err := pageSlice([]struct {
+		Id int `json:"id"`
+	}{{1}, {2}}, params, pageParams{limit: 10, cursor: &cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.records) != 0 || result.nextCursor != "" || result.prevCursor != "" {
+		t.Errorf("pageSlice() past the end = %+v, want an empty page without cursors", result)
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"ClassConnect/pkg/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// patchKind is the JSON type a patched field must hold
+type patchKind int
+
+const (
+	patchString patchKind = iota
+	patchBool
+	patchInt
+	// patchDate is a string holding a YYYY-MM-DD date
+	patchDate
+)
+
+// patchField describes a JSON field that may be changed through a merge patch, a string unless kind says otherwise
+type patchField struct {
+	column   string
+	kind     patchKind
+	nullable bool
+	// roles restricts who may change the field, an empty list allows every authenticated user
+	roles []string
+}
+
+// decode reads a JSON value of the kind into the argument bound to its column
+func (k patchKind) decode(raw json.RawMessage) (any, error) {
+	switch k {
+	case patchBool:
+		var value bool
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case patchInt:
+		var value int64
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case patchDate:
+		var value string
+		err := json.Unmarshal(raw, &value)
+		if err == nil {
+			_, err = time.Parse(time.DateOnly, value)
+		}
+		return value, err
+	}
+	var value string
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
+
+// String describes the values of the kind for error messages
+func (k patchKind) String() string {
+	switch k {
+	case patchBool:
+		return "true or false"
+	case patchInt:
+		return "a whole number"
+	case patchDate:
+		return "a YYYY-MM-DD date"
+	}
+	return "a string"
+}
+
+// allows reports whether a caller with the role may change the field
+func (f patchField) allows(role string) bool {
+	if len(f.roles) == 0 {
+		return true
+	}
+	_, err := utils.AuthorizeUser(role, f.roles...)
+	return err == nil
+}
+
+var (
+	errPatchForbidden = errors.New("field cannot be updated by the current user")
+	errPatchInvalid   = errors.New("invalid merge patch")
+)
+
+// decodeMergePatch reads an RFC 7396 merge patch document from the request body.
+// Only flat JSON objects are accepted since none of the resources have nested fields
+func decodeMergePatch(r *http.Request) (map[string]json.RawMessage, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+			return nil, fmt.Errorf("%w: unsupported content type %q", errPatchInvalid, contentType)
+		}
+	}
+
+	var patch map[string]json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil || patch == nil {
+		return nil, fmt.Errorf("%w: body must be a JSON object", errPatchInvalid)
+	}
+	return patch, nil
+}
+
+// buildPatchUpdate translates a merge patch into an UPDATE statement touching only the whitelisted columns.
+// It returns an empty query when the patch does not change anything
+func buildPatchUpdate(table string, id int, patch map[string]json.RawMessage, fields map[string]patchField, role, updatedBy string) (string, []any, error) {
+	// Sort the keys so the generated statement is deterministic
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	setClauses := make([]string, 0, len(keys))
+	args := make([]any, 0, len(keys)+1)
+	for _, key := range keys {
+		field, ok := fields[key]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: unknown or read-only field %q", errPatchInvalid, key)
+		}
+		if !field.allows(role) {
+			return "", nil, fmt.Errorf("%w: %q", errPatchForbidden, key)
+		}
+
+		raw := bytes.TrimSpace(patch[key])
+		if bytes.Equal(raw, []byte("null")) {
+			// A null member removes the value, which is only possible for nullable columns
+			if !field.nullable {
+				return "", nil, fmt.Errorf("%w: field %q cannot be removed", errPatchInvalid, key)
+			}
+			setClauses = append(setClauses, field.column+" = NULL")
+			continue
+		}
+
+		value, err := field.kind.decode(raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: field %q must be %s", errPatchInvalid, key, field.kind)
+		}
+
+		setClauses = append(setClauses, field.column+" = ?")
+		args = append(args, value)
+	}
+
+	if len(setClauses) == 0 {
+		return "", nil, nil
+	}
+
+	// Every change produces a new version for the ETag / If-Match checks
+	setClauses = append(setClauses, "version = version + 1", "updated_by = ?")
+	args = append(args, updatedBy, id)
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", table, strings.Join(setClauses, ", "))
+	return query, args, nil
+}
+
+// writePatchError maps merge patch errors onto the matching HTTP status
+func writePatchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errPatchForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
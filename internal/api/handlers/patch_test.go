@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDecodeMergePatch(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		wantFields  int
+		wantErr     bool
+	}{
+		{"application/merge-patch+json", `{"first_name":"Anna","class":null}`, 2, false},
+		{"application/json; charset=utf-8", `{"first_name":"Anna"}`, 1, false},
+		{"", `{}`, 0, false},
+		{"text/plain", `{"first_name":"Anna"}`, 0, true},
+		{"application/merge-patch+json", `null`, 0, true},
+		{"application/merge-patch+json", `["first_name"]`, 0, true},
+		{"application/merge-patch+json", `{"first_name":`, 0, true},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("PATCH", "/students/1", strings.NewReader(test.body))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		patch, err := decodeMergePatch(r)
+		if (err != nil) != test.wantErr {
+			t.Errorf("decodeMergePatch(%q, %s) error = %v, wantErr %v", test.contentType, test.body, err, test.wantErr)
+			continue
+		}
+		if err != nil && !errors.Is(err, errPatchInvalid) {
+			t.Errorf("decodeMergePatch(%q, %s) error = %v, want errPatchInvalid", test.contentType, test.body, err)
+		}
+		if err == nil && len(patch) != test.wantFields {
+			t.Errorf("decodeMergePatch(%s) has %d fields, want %d", test.body, len(patch), test.wantFields)
+		}
+	}
+}
+
+func TestBuildPatchUpdate(t *testing.T) {
+	fields := map[string]patchField{
+		"first_name": {column: "first_name"},
+		"class":      {column: "class", nullable: true},
+		"credits":    {column: "credits", kind: patchInt, roles: []string{"admin"}},
+		"active":     {column: "active", kind: patchBool},
+		"born_on":    {column: "born_on", kind: patchDate, nullable: true},
+	}
+	tests := []struct {
+		name      string
+		body      string
+		role      string
+		wantQuery string
+		wantArgs  []any
+		wantErr   error
+	}{
+		{
+			name:      "sets in key order",
+			body:      `{"first_name":"Anna","class":"10A"}`,
+			role:      "teacher",
+			wantQuery: "UPDATE students SET class = ?, first_name = ?, version = version + 1, updated_by = ? WHERE id = ?",
+			wantArgs:  []any{"10A", "Anna", "jdoe", 7},
+		},
+		{
+			name:      "null removes a nullable field",
+			body:      `{"class":null}`,
+			role:      "teacher",
+			wantQuery: "UPDATE students SET class = NULL, version = version + 1, updated_by = ? WHERE id = ?",
+			wantArgs:  []any{"jdoe", 7},
+		},
+		{
+			name:      "role restricted field",
+			body:      `{"credits":1200}`,
+			role:      "admin",
+			wantQuery: "UPDATE students SET credits = ?, version = version + 1, updated_by = ? WHERE id = ?",
+			wantArgs:  []any{int64(1200), "jdoe", 7},
+		},
+		{
+			name:      "super admin passes role checks",
+			body:      `{"credits":1000}`,
+			role:      "super_admin",
+			wantQuery: "UPDATE students SET credits = ?, version = version + 1, updated_by = ? WHERE id = ?",
+			wantArgs:  []any{int64(1000), "jdoe", 7},
+		},
+		{
+			name:      "typed fields",
+			body:      `{"active":false,"born_on":"2012-03-09"}`,
+			role:      "teacher",
+			wantQuery: "UPDATE students SET active = ?, born_on = ?, version = version + 1, updated_by = ? WHERE id = ?",
+			wantArgs:  []any{false, "2012-03-09", "jdoe", 7},
+		},
+		{name: "empty patch", body: `{}`, role: "teacher"},
+		{name: "role not allowed", body: `{"credits":1000}`, role: "teacher", wantErr: errPatchForbidden},
+		{name: "unknown field", body: `{"id":3}`, role: "admin", wantErr: errPatchInvalid},
+		{name: "null on a required field", body: `{"first_name":null}`, role: "admin", wantErr: errPatchInvalid},
+		{name: "nested value", body: `{"first_name":{"given":"Anna"}}`, role: "admin", wantErr: errPatchInvalid},
+		{name: "array value", body: `{"class":["10A"]}`, role: "admin", wantErr: errPatchInvalid},
+		{name: "number for a string", body: `{"first_name":42}`, role: "admin", wantErr: errPatchInvalid},
+		{name: "string for a boolean", body: `{"active":"false"}`, role: "admin", wantErr: errPatchInvalid},
+		{name: "fraction for a whole number", body: `{"credits":1200.5}`, role: "admin", wantErr: errPatchInvalid},
+		{name: "string for a whole number", body: `{"credits":"1200"}`, role: "admin", wantErr: errPatchInvalid},
+		{name: "malformed date", body: `{"born_on":"09/03/2012"}`, role: "admin", wantErr: errPatchInvalid},
+		{name: "boolean for a date", body: `{"born_on":true}`, role: "admin", wantErr: errPatchInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("PATCH", "/students/7", strings.NewReader(test.body))
+			patch, err := decodeMergePatch(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, args, err := buildPatchUpdate("students", 7, patch, fields, test.role, "jdoe")
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("buildPatchUpdate() error = %v, want %v", err, test.wantErr)
+			}
+			if err != nil && len(patch) == 1 {
+				for key := range patch {
+					if !strings.Contains(err.Error(), strconv.Quote(key)) {
+						t.Errorf("buildPatchUpdate() error = %q, want it to name the field %q", err, key)
+					}
+				}
+			}
+			if query != test.wantQuery {
+				t.Errorf("buildPatchUpdate() query = %q, want %q", query, test.wantQuery)
+			}
+			if len(args) != 0 || len(test.wantArgs) != 0 {
+				if !reflect.DeepEqual(args, test.wantArgs) {
+					t.Errorf("buildPatchUpdate() args = %v, want %v", args, test.wantArgs)
+				}
+			}
+		})
+	}
+}
+
+func TestWritePatchError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errPatchForbidden, http.StatusForbidden},
+		{errPatchInvalid, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		writePatchError(w, test.err)
+		if w.Code != test.want {
+			t.Errorf("writePatchError(%v) status = %d, want %d", test.err, w.Code, test.want)
+		}
+	}
+}
@@ -0,0 +1,546 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/calendar"
+	"ClassConnect/internal/events"
+	"ClassConnect/internal/jobs"
+	"ClassConnect/internal/leave"
+	"ClassConnect/internal/models"
+	"ClassConnect/internal/reportcard"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// attendanceStatuses are the values an attendance record may hold
+var attendanceStatuses = map[string]bool{"present": true, "absent": true, "late": true, "excused": true}
+
+// reportCardBatchAccess guards writing the report cards of a whole class
+var reportCardBatchAccess = roleAccess{roles: []string{"admin", "manager"}, denied: "Only admins and managers may write the report cards of a class"}
+
+type ReportCardsHandler struct {
+	db *sql.DB
+}
+
+func NewReportCardsHandler(db *sql.DB) *ReportCardsHandler {
+	return &ReportCardsHandler{db: db}
+}
+
+// GetReportCardHandler renders a student's report card for ?term= as a PDF
+func (h *ReportCardsHandler) GetReportCardHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, _, ok := loadStudentSchool(h.db, w, r)
+	if !ok {
+		return
+	}
+	termId, err := strconv.Atoi(r.URL.Query().Get("term"))
+	if err != nil {
+		http.Error(w, "term must be a term ID", http.StatusBadRequest)
+		return
+	}
+
+	card, err := reportcard.Load(h.db, studentId, termId)
+	if errors.Is(err, reportcard.ErrStudentNotFound) {
+		http.Error(w, "Student with that ID does not exist", http.StatusNotFound)
+		return
+	} else if errors.Is(err, reportcard.ErrTermNotFound) {
+		http.Error(w, "Term with that ID does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Report card error:", err)
+		http.Error(w, "Error generating the report card", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", reportcard.Filename(card)))
+	err = reportcard.Render(card, w)
+	if err != nil {
+		log.Println("Report card render error:", err)
+	}
+}
+
+// CreateReportCardBatchHandler starts a background job that writes the report cards of a class into a ZIP.
+// The job is an export job, so it is polled and downloaded through /exports/{id}
+func (h *ReportCardsHandler) CreateReportCardBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if !reportCardBatchAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var batch models.ReportCardBatch
+	err := json.NewDecoder(r.Body).Decode(&batch)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	batch.Class = strings.TrimSpace(batch.Class)
+	if batch.Class == "" || batch.TermId == 0 {
+		http.Error(w, "class and term_id are required", http.StatusBadRequest)
+		return
+	}
+
+	var yearId int
+	err = h.db.QueryRow("SELECT academic_year_id FROM terms WHERE id = ? AND school_id = ?", batch.TermId, schoolId).Scan(&yearId)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Term with that ID does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+
+	// Students are picked by the class they were enrolled in that year, falling back to their current class
+	rows, err := h.db.Query(`SELECT s.id FROM students s LEFT JOIN enrollments e ON e.student_id = s.id AND e.academic_year_id = ?
+		WHERE s.school_id = ? AND s.deleted_at IS NULL AND COALESCE(e.class, s.class) = ? ORDER BY s.last_name, s.first_name`,
+		yearId, schoolId, batch.Class,
+	)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	studentIds := make([]int, 0)
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			log.Println("Scan error:", err)
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+			return
+		}
+		studentIds = append(studentIds, id)
+	}
+	rows.Close()
+	if len(studentIds) == 0 {
+		http.Error(w, "The class has no students", http.StatusNotFound)
+		return
+	}
+
+	job := models.ExportJob{Resource: "report_cards", SchoolId: schoolId, Format: archiveFormat.name, Status: "pending", CreatedBy: contextUsername(r)}
+	res, err := h.db.Exec("INSERT INTO export_jobs(resource, school_id, format, status, created_by) VALUES(?,?,?,?,?)", job.Resource, job.SchoolId, job.Format, job.Status, job.CreatedBy)
+	if err == nil {
+		var id int64
+		id, err = res.LastInsertId()
+		job.Id = int(id)
+	}
+	if err != nil {
+		log.Println("Export job error:", err)
+		http.Error(w, "Error starting the report card job", http.StatusInternalServerError)
+		return
+	}
+
+	payload := reportCardsPayload{ExportJobId: job.Id, TermId: batch.TermId, StudentIds: studentIds}
+	_, err = jobs.Enqueue(h.db, schoolId, jobWriteReportCards, payload, job.CreatedBy)
+	if err != nil {
+		log.Println("Report card job error:", err)
+		finishExportJob(h.db, job.Id, "", 0, err)
+		http.Error(w, "Error starting the report card job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/exports/%d", job.Id))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// reportCardsPayload is the job that writes a class's report cards. The students are resolved when the batch is
+// requested, so retries produce the same archive
+type reportCardsPayload struct {
+	ExportJobId int   `json:"export_job_id"`
+	TermId      int   `json:"term_id"`
+	StudentIds  []int `json:"student_ids"`
+}
+
+// runReportCardsJob writes a report card archive, marking its export job failed once the last attempt fails
+func runReportCardsJob(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		var payload reportCardsPayload
+		err := json.Unmarshal(job.Payload, &payload)
+		if err != nil {
+			return jobs.Permanent(err)
+		}
+		path, count, err := writeReportCardArchive(db, payload.TermId, payload.StudentIds, payload.ExportJobId)
+		if err == nil || job.Final() {
+			finishExportJob(db, payload.ExportJobId, path, count, err)
+		}
+		return err
+	}
+}
+
+func writeReportCardArchive(db *sql.DB, termId int, studentIds []int, jobId int) (string, int, error) {
+	dir := exportDir()
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return "", 0, err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("report-cards-%d.%s", jobId, archiveFormat.name))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	count, err := reportcard.WriteArchive(db, file, studentIds, termId)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+	return path, count, nil
+}
+
+// GetGradesHandler lists a student's grades for ?term=
+func (h *ReportCardsHandler) GetGradesHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, _, ok := loadStudentSchool(h.db, w, r)
+	if !ok {
+		return
+	}
+	termId, err := strconv.Atoi(r.URL.Query().Get("term"))
+	if err != nil {
+		http.Error(w, "term must be a term ID", http.StatusBadRequest)
+		return
+	}
+
+	grades, err := reportcard.LoadGrades(h.db, studentId, termId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the grades", http.StatusInternalServerError)
+		return
+	}
+	writeList(w, r, grades)
+}
+
+// SetGradesHandler records a student's grades, replacing the grade of a subject already graded in the term
+func (h *ReportCardsHandler) SetGradesHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, schoolId, ok := loadStudentSchool(h.db, w, r)
+	if !ok {
+		return
+	}
+
+	var grades []models.Grade
+	err := json.NewDecoder(r.Body).Decode(&grades)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for i := range grades {
+		grade := &grades[i]
+		grade.StudentId = studentId
+		grade.Subject = strings.TrimSpace(grade.Subject)
+		if grade.MaxScore == 0 {
+			grade.MaxScore = 100
+		}
+		if grade.Subject == "" || grade.TermId == 0 {
+			http.Error(w, fmt.Sprintf("grade %d: subject and term_id are required", i), http.StatusBadRequest)
+			return
+		}
+		if grade.MaxScore < 0 || grade.Score < 0 || grade.Score > grade.MaxScore {
+			http.Error(w, fmt.Sprintf("grade %d: score must be between 0 and max_score", i), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error saving the grades", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	username := contextUsername(r)
+	for i, grade := range grades {
+		var exists int
+		err = tx.QueryRow("SELECT 1 FROM terms WHERE id = ? AND school_id = ?", grade.TermId, schoolId).Scan(&exists)
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("grade %d: term with that ID does not exist", i), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Error saving the grades", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(`INSERT INTO grades(school_id, student_id, term_id, subject, score, max_score, remark, updated_by) VALUES(?,?,?,?,?,?,?,?)
+			ON DUPLICATE KEY UPDATE score = VALUES(score), max_score = VALUES(max_score), remark = VALUES(remark), updated_by = VALUES(updated_by)`,
+			schoolId, studentId, grade.TermId, grade.Subject, grade.Score, grade.MaxScore, grade.Remark, username,
+		)
+		if err != nil {
+			log.Println("Insert error:", err)
+			http.Error(w, "Error saving the grades", http.StatusInternalServerError)
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error saving the grades", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "grades", studentId, nil, grades)
+	if student, err := h.getStudentSummary(studentId); err == nil {
+		guardians := h.guardianAudience(studentId)
+		for _, grade := range grades {
+			events.Publish(events.TypeGradePosted, schoolId, events.Audience{
+				Roles:   []string{"admin", "manager"},
+				UserIds: guardians,
+				Classes: []string{student.Class},
+				Courses: []string{grade.Subject},
+			}, map[string]any{"student": student, "grade": grade})
+		}
+	}
+	writeList(w, r, grades)
+}
+
+// GetAttendanceHandler lists a student's attendance, optionally limited to the ?from= and ?to= dates
+func (h *ReportCardsHandler) GetAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, _, ok := loadStudentSchool(h.db, w, r)
+	if !ok {
+		return
+	}
+
+	query := "SELECT id, student_id, date, status FROM attendance WHERE student_id = ?"
+	args := []any{studentId}
+	for _, bound := range []struct {
+		param     string
+		condition string
+	}{
+		{"from", " AND date >= ?"},
+		{"to", " AND date <= ?"},
+	} {
+		value := r.URL.Query().Get(bound.param)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			http.Error(w, "from and to must be YYYY-MM-DD dates", http.StatusBadRequest)
+			return
+		}
+		query += bound.condition
+		args = append(args, value)
+	}
+
+	rows, err := h.db.Query(query+" ORDER BY date", args...)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the attendance", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	records := make([]models.AttendanceRecord, 0)
+	for rows.Next() {
+		var record models.AttendanceRecord
+		err = rows.Scan(&record.Id, &record.StudentId, &record.Date, &record.Status)
+		if err != nil {
+			log.Println("Scan error:", err)
+			http.Error(w, "Error retrieving the attendance", http.StatusInternalServerError)
+			return
+		}
+		records = append(records, record)
+	}
+
+	writeList(w, r, records)
+}
+
+// SetAttendanceHandler records a student's attendance, one status per day
+func (h *ReportCardsHandler) SetAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, schoolId, ok := loadStudentSchool(h.db, w, r)
+	if !ok {
+		return
+	}
+
+	var records []models.AttendanceRecord
+	err := json.NewDecoder(r.Body).Decode(&records)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for i := range records {
+		record := &records[i]
+		record.StudentId = studentId
+		if _, err := time.Parse(dateLayout, record.Date); err != nil {
+			http.Error(w, fmt.Sprintf("record %d: date must be a YYYY-MM-DD date", i), http.StatusBadRequest)
+			return
+		}
+		if !attendanceStatuses[record.Status] {
+			http.Error(w, fmt.Sprintf("record %d: status must be present, absent, late or excused", i), http.StatusBadRequest)
+			return
+		}
+	}
+	if !h.requireSchoolDays(w, schoolId, records) {
+		return
+	}
+
+	// Absences on days of approved leave are excused, and keep pointing at the leave so cancelling it undoes them
+	leaveIds := make([]sql.NullInt64, len(records))
+	if len(records) > 0 {
+		from, to := records[0].Date, records[0].Date
+		for _, record := range records {
+			from = min(from, record.Date)
+			to = max(to, record.Date)
+		}
+		covered, err := leave.Covering(h.db, studentId, from, to)
+		if err != nil {
+			log.Println("Query error:", err)
+			http.Error(w, "Error saving the attendance", http.StatusInternalServerError)
+			return
+		}
+		for i := range records {
+			if leaveId, ok := covered[records[i].Date]; ok && (records[i].Status == "absent" || records[i].Status == "excused") {
+				records[i].Status = "excused"
+				leaveIds[i] = sql.NullInt64{Int64: int64(leaveId), Valid: true}
+			}
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error saving the attendance", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	username := contextUsername(r)
+	for i, record := range records {
+		_, err = tx.Exec(`INSERT INTO attendance(school_id, student_id, date, status, updated_by, leave_id) VALUES(?,?,?,?,?,?)
+			ON DUPLICATE KEY UPDATE status = VALUES(status), updated_by = VALUES(updated_by), leave_id = VALUES(leave_id)`,
+			schoolId, studentId, record.Date, record.Status, username, leaveIds[i],
+		)
+		if err != nil {
+			log.Println("Insert error:", err)
+			http.Error(w, "Error saving the attendance", http.StatusInternalServerError)
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error saving the attendance", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "attendance", studentId, nil, records)
+	if student, err := h.getStudentSummary(studentId); err == nil {
+		guardians := h.guardianAudience(studentId)
+		for _, record := range records {
+			if record.Status != "absent" {
+				continue
+			}
+			events.Publish(events.TypeAttendanceAbsent, schoolId, events.Audience{
+				Roles:   []string{"admin", "manager"},
+				UserIds: guardians,
+				Classes: []string{student.Class},
+			}, map[string]any{"student": student, "date": record.Date})
+		}
+	}
+	writeList(w, r, records)
+}
+
+// requireSchoolDays refuses attendance on weekends and holidays, writing a 400 naming the first record that falls on one
+func (h *ReportCardsHandler) requireSchoolDays(w http.ResponseWriter, schoolId int, records []models.AttendanceRecord) bool {
+	if len(records) == 0 {
+		return true
+	}
+	from, to := records[0].Date, records[0].Date
+	for _, record := range records {
+		from = min(from, record.Date)
+		to = max(to, record.Date)
+	}
+	days, err := calendar.NonSchoolDays(h.db, schoolId, from, to)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error saving the attendance", http.StatusInternalServerError)
+		return false
+	}
+	closed := make(map[string]string, len(days))
+	for _, day := range days {
+		closed[day.Date] = day.Reason
+	}
+	for i, record := range records {
+		if reason, ok := closed[record.Date]; ok {
+			http.Error(w, fmt.Sprintf("record %d: %s is not a school day (%s)", i, record.Date, reason), http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// SetTermRemarkHandler sets the overall remark printed on a student's report card for a term
+func (h *ReportCardsHandler) SetTermRemarkHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, schoolId, ok := loadStudentSchool(h.db, w, r)
+	if !ok {
+		return
+	}
+
+	var remark models.TermRemark
+	err := json.NewDecoder(r.Body).Decode(&remark)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	remark.StudentId = studentId
+	remark.Remark = strings.TrimSpace(remark.Remark)
+	remark.UpdatedBy = contextUsername(r)
+
+	var exists int
+	err = h.db.QueryRow("SELECT 1 FROM terms WHERE id = ? AND school_id = ?", remark.TermId, schoolId).Scan(&exists)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Term with that ID does not exist", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error saving the remark", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.db.Exec("INSERT INTO term_remarks(school_id, student_id, term_id, remark, updated_by) VALUES(?,?,?,?,?) ON DUPLICATE KEY UPDATE remark = VALUES(remark), updated_by = VALUES(updated_by)",
+		schoolId, studentId, remark.TermId, remark.Remark, remark.UpdatedBy,
+	)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error saving the remark", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "term_remarks", studentId, nil, remark)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(remark)
+}
+
+// guardianAudience returns the user ids of the student's guardians, who are told about their child's grades and
+// absences. A failed lookup only leaves them out of the event
+func (h *ReportCardsHandler) guardianAudience(studentId int) []string {
+	guardians, err := guardianUserIds(h.db, studentId)
+	if err != nil {
+		log.Println("Query error:", err)
+	}
+	return guardians
+}
+
+// getStudentSummary reads the name and class of a student for event payloads
+func (h *ReportCardsHandler) getStudentSummary(studentId int) (models.Student, error) {
+	student := models.Student{Id: studentId}
+	err := h.db.QueryRow("SELECT first_name, last_name, class FROM students WHERE id = ?", studentId).Scan(&student.FirstName, &student.LastName, &student.Class)
+	if err != nil {
+		log.Println("Query error:", err)
+	}
+	return student, err
+}
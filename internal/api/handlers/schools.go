@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// validSubdomain is a single DNS label, which is what the tenant middleware matches against
+var validSubdomain = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+type SchoolsHandler struct {
+	db *sql.DB
+}
+
+func NewSchoolsHandler(db *sql.DB) *SchoolsHandler {
+	return &SchoolsHandler{db: db}
+}
+
+// GetSchoolsHandler lists every school for super admins, other users only see their own
+func (h *SchoolsHandler) GetSchoolsHandler(w http.ResponseWriter, r *http.Request) {
+	query := "SELECT id, name, subdomain, created_at FROM schools"
+	var args []any
+	if schoolId := contextSchool(r); schoolId != 0 {
+		query += " WHERE id = ?"
+		args = append(args, schoolId)
+	}
+	rows, err := h.db.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the schools", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	schools := make([]models.School, 0)
+	for rows.Next() {
+		var school models.School
+		err = rows.Scan(&school.Id, &school.Name, &school.Subdomain, &school.CreatedAt)
+		if err != nil {
+			log.Println("Scan error:", err)
+			http.Error(w, "Error retrieving the schools", http.StatusInternalServerError)
+			return
+		}
+		schools = append(schools, school)
+	}
+
+	response := struct {
+		Status string          `json:"status"`
+		Count  int             `json:"count"`
+		Data   []models.School `json:"data"`
+	}{
+		Status: "success",
+		Count:  len(schools),
+		Data:   schools,
+	}
+	writeJSONWithETag(w, r, "", response)
+}
+
+func (h *SchoolsHandler) GetSchoolByIdHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid school ID", http.StatusBadRequest)
+		return
+	}
+	if schoolId := contextSchool(r); schoolId != 0 && schoolId != id {
+		http.Error(w, "School with that ID does not exist", http.StatusNotFound)
+		return
+	}
+
+	var school models.School
+	err = h.db.QueryRow("SELECT id, name, subdomain, created_at FROM schools WHERE id = ?", id).Scan(&school.Id, &school.Name, &school.Subdomain, &school.CreatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "School with that ID does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONWithETag(w, r, "", school)
+}
+
+// CreateSchoolHandler adds a school to the district, super admins only
+func (h *SchoolsHandler) CreateSchoolHandler(w http.ResponseWriter, r *http.Request) {
+	if contextRole(r) != utils.SuperAdminRole {
+		http.Error(w, "Only super admins may create schools", http.StatusForbidden)
+		return
+	}
+
+	var school models.School
+	err := json.NewDecoder(r.Body).Decode(&school)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	school.Name = strings.TrimSpace(school.Name)
+	school.Subdomain = strings.ToLower(strings.TrimSpace(school.Subdomain))
+	if school.Name == "" || !validSubdomain.MatchString(school.Subdomain) {
+		http.Error(w, "A name and a subdomain of lowercase letters, digits and hyphens are required", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.db.Exec("INSERT INTO schools(name, subdomain) VALUES(?,?)", school.Name, school.Subdomain)
+	if isDuplicateEntry(err) {
+		http.Error(w, "A school with that subdomain already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the school", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error creating the school", http.StatusInternalServerError)
+		return
+	}
+	school.Id = int(id)
+
+	audit.Record(h.db, r, audit.ActionCreate, "schools", school.Id, nil, school)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(school)
+}
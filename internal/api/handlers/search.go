@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	// searchCandidates caps how many rows each source hands to the in-memory ranking
+	searchCandidates = 200
+	// minSearchScore drops candidates that only matched on a stray trigram
+	minSearchScore = 0.2
+)
+
+// searchSource describes one searchable table
+type searchSource struct {
+	resultType string
+	table      string
+	// columns must select id, first_name, last_name, email and class, in that order
+	columns string
+	// fullText lists the columns covered by the table's FULLTEXT index
+	fullText string
+	// condition narrows the table to the rows of this type, when it holds several
+	condition string
+	// roles restricts who may see results of this type, an empty list allows every authenticated user
+	roles []string
+}
+
+var searchSources = []searchSource{
+	{
+		resultType: "student",
+		table:      "students",
+		columns:    "id, first_name, last_name, email, class",
+		fullText:   "first_name, last_name, email, class",
+	},
+	{
+		resultType: "teacher",
+		table:      "teachers",
+		columns:    "id, first_name, last_name, email, class",
+		fullText:   "first_name, last_name, email, class, subject",
+	},
+	{
+		resultType: "exec",
+		table:      "execs",
+		columns:    "id, first_name, last_name, email, ''",
+		fullText:   "first_name, last_name, email, username",
+		condition:  "role <> '" + utils.GuardianRole + "'",
+		roles:      []string{"admin", "manager"},
+	},
+	{
+		// Guardians are exec accounts too, their class lists the classes of their children
+		resultType: "guardian",
+		table:      "execs",
+		columns: "id, first_name, last_name, email, COALESCE((SELECT GROUP_CONCAT(DISTINCT s.class ORDER BY s.class SEPARATOR ', ') " +
+			"FROM student_guardians g JOIN students s ON s.id = g.student_id AND s.deleted_at IS NULL WHERE g.exec_id = execs.id), '')",
+		fullText:  "first_name, last_name, email, username",
+		condition: "role = '" + utils.GuardianRole + "'",
+		roles:     []string{"admin", "manager"},
+	},
+}
+
+type SearchHandler struct {
+	db *sql.DB
+}
+
+func NewSearchHandler(db *sql.DB) *SearchHandler {
+	return &SearchHandler{db: db}
+}
+
+// SearchHandler finds people by name, email or class.
+// Candidates come from the FULLTEXT indexes, phonetic (Soundex) matches on names and prefix matches,
+// and are then ranked by trigram similarity so misspellings such as "Jon Smyth" still find "John Smith"
+func (h *SearchHandler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "Query parameter q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxSearchLimit)
+	}
+
+	var types map[string]bool
+	if typesStr := r.URL.Query().Get("types"); typesStr != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(typesStr, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	role := contextRole(r)
+	results := make([]models.SearchResult, 0)
+	for _, source := range searchSources {
+		if types != nil && !types[source.resultType] {
+			continue
+		}
+		if len(source.roles) > 0 {
+			if _, err := utils.AuthorizeUser(role, source.roles...); err != nil {
+				continue
+			}
+		}
+
+		sourceResults, err := h.searchSource(r, source, q)
+		if err != nil {
+			log.Println("Search error:", err)
+			http.Error(w, "Error searching the database", http.StatusInternalServerError)
+			return
+		}
+		results = append(results, sourceResults...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	response := struct {
+		Status string                `json:"status"`
+		Query  string                `json:"query"`
+		Count  int                   `json:"count"`
+		Data   []models.SearchResult `json:"data"`
+	}{
+		Status: "success",
+		Query:  q,
+		Count:  len(results),
+		Data:   results,
+	}
+	writeJSONWithETag(w, r, "", response)
+}
+
+// searchSource loads the candidate rows of one table and scores them against the query
+func (h *SearchHandler) searchSource(r *http.Request, source searchSource, q string) ([]models.SearchResult, error) {
+	tokens := strings.Fields(q)
+
+	conditions := []string{fmt.Sprintf("MATCH(%s) AGAINST(? IN NATURAL LANGUAGE MODE)", source.fullText)}
+	args := []any{q}
+	for _, token := range tokens {
+		conditions = append(conditions,
+			"LEFT(SOUNDEX(first_name), 4) = LEFT(SOUNDEX(?), 4)",
+			"LEFT(SOUNDEX(last_name), 4) = LEFT(SOUNDEX(?), 4)",
+			"first_name LIKE ?",
+			"last_name LIKE ?",
+			"email LIKE ?",
+		)
+		prefix := escapeLike(token) + "%"
+		args = append(args, token, token, prefix, prefix, prefix)
+	}
+
+	tenant, tenantArgs := tenantCondition(r)
+	where := notDeleted + tenant
+	if source.condition != "" {
+		where += " AND " + source.condition
+	}
+	query := fmt.Sprintf("SELECT %s, MATCH(%s) AGAINST(? IN NATURAL LANGUAGE MODE) AS relevance FROM %s WHERE %s AND (%s) LIMIT ?",
+		source.columns, source.fullText, source.table, where, strings.Join(conditions, " OR "))
+	args = append(append([]any{q}, tenantArgs...), args...)
+	args = append(args, searchCandidates)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]models.SearchResult, 0)
+	for rows.Next() {
+		result := models.SearchResult{Type: source.resultType}
+		var relevance float64
+		err = rows.Scan(&result.Id, &result.FirstName, &result.LastName, &result.Email, &result.Class, &relevance)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Score = scoreSearchResult(result, tokens, relevance)
+		if result.Score < minSearchScore {
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// scoreSearchResult ranks a candidate between 0 and 1.
+// Each query token is matched against the best fitting field by trigram similarity, with a bonus for
+// sounding like a name, and the full-text relevance nudges exact word matches upwards
+func scoreSearchResult(result models.SearchResult, tokens []string, relevance float64) float64 {
+	fields := []string{result.FirstName, result.LastName, result.Email, result.Class}
+	emailLocal, _, _ := strings.Cut(result.Email, "@")
+	fields = append(fields, emailLocal)
+
+	total := 0.0
+	for _, token := range tokens {
+		best := 0.0
+		for _, field := range fields {
+			best = math.Max(best, utils.TrigramSimilarity(token, field))
+		}
+
+		tokenCode := utils.Soundex(token)
+		if tokenCode != "" && (tokenCode == utils.Soundex(result.FirstName) || tokenCode == utils.Soundex(result.LastName)) {
+			best = math.Max(best, 0.5) + 0.2
+		}
+		total += math.Min(best, 1)
+	}
+
+	score := total / float64(len(tokens))
+	// Full-text relevance is unbounded, squash it into a small bonus
+	score += 0.2 * relevance / (relevance + 1)
+	return math.Round(math.Min(score, 1)*1000) / 1000
+}
+
+// escapeLike escapes the LIKE wildcards in user input
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return replacer.Replace(s)
+}
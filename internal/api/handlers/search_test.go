@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"ClassConnect/internal/models"
+	"testing"
+)
+
+func TestScoreSearchResult(t *testing.T) {
+	student := models.SearchResult{FirstName: "Anna", LastName: "Smith", Email: "anna.smith@school.org", Class: "10A"}
+	tests := []struct {
+		name      string
+		tokens    []string
+		relevance float64
+		want      float64
+	}{
+		{"exact first name", []string{"anna"}, 0, 1},
+		{"sounds like the last name", []string{"smyth"}, 0, 0.7},
+		{"relevance adds a bonus", []string{"smyth"}, 1, 0.8},
+		{"capped at one", []string{"anna"}, 100, 1},
+		{"averaged over the tokens", []string{"anna", "zzz"}, 0, 0.5},
+		{"unrelated", []string{"bob"}, 0, 0},
+	}
+	for _, test := range tests {
+		if got := scoreSearchResult(student, test.tokens, test.relevance); got != test.want {
+			t.Errorf("%s: scoreSearchResult(%q) = %v, want %v", test.name, test.tokens, got, test.want)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"anna", "anna"},
+		{"50%", `50\%`},
+		{"first_name", `first\_name`},
+		{`C:\temp`, `C:\\temp`},
+		{`\%_`, `\\\%\_`},
+	}
+	for _, test := range tests {
+		if got := escapeLike(test.s); got != test.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", test.s, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"ClassConnect/pkg/utils"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// notDeleted is the condition every read and write of a live student, teacher or exec carries.
+// Deleted rows keep their deleted_at and deleted_by until the retention purge removes them
+const notDeleted = "deleted_at IS NULL"
+
+var (
+	errRestoreNotFound   = errors.New("record not found")
+	errRestoreNotDeleted = errors.New("record is not deleted")
+)
+
+// applyDeletedScope hides soft-deleted rows from a list query unless an admin asked for ?include_deleted=true
+func applyDeletedScope(r *http.Request, params *listQuery) (int, error) {
+	if includeStr := r.URL.Query().Get("include_deleted"); includeStr != "" {
+		include, err := strconv.ParseBool(includeStr)
+		if err != nil {
+			return http.StatusBadRequest, errors.New("include_deleted must be true or false")
+		}
+		if include {
+			_, err = utils.AuthorizeUser(contextRole(r), "admin")
+			if err != nil {
+				return http.StatusForbidden, errors.New("only admins may list deleted records")
+			}
+			return 0, nil
+		}
+	}
+
+	params.addScope(notDeleted)
+	return 0, nil
+}
+
+// softDeleteRow marks a live row as deleted by the current user, honouring the If-Match versions
+func softDeleteRow(db *sql.DB, r *http.Request, table string, id int, versions []int, wildcard bool) (int64, error) {
+	username := contextUsername(r)
+	tenant, tenantArgs := tenantCondition(r)
+	condition, conditionArgs := versionCondition(versions, wildcard)
+	args := append(append([]any{username, username, id}, tenantArgs...), conditionArgs...)
+	res, err := db.Exec("UPDATE "+table+" SET deleted_at = CURRENT_TIMESTAMP, deleted_by = ?, version = version + 1, updated_by = ? WHERE id = ? AND "+notDeleted+tenant+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// restoreRow clears the deletion marker of a soft-deleted row
+func restoreRow(db *sql.DB, r *http.Request, table string, id int) error {
+	tenant, tenantArgs := tenantCondition(r)
+	res, err := db.Exec("UPDATE "+table+" SET deleted_at = NULL, deleted_by = NULL, version = version + 1, updated_by = ? WHERE id = ? AND deleted_at IS NOT NULL"+tenant,
+		append([]any{contextUsername(r), id}, tenantArgs...)...,
+	)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	var exists int
+	err = db.QueryRow("SELECT 1 FROM "+table+" WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return errRestoreNotFound
+	} else if err != nil {
+		return err
+	}
+	return errRestoreNotDeleted
+}
+
+func writeRestoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errRestoreNotFound):
+		http.Error(w, "The record does not exist or has already been purged", http.StatusNotFound)
+	case errors.Is(err, errRestoreNotDeleted):
+		http.Error(w, "The record is not deleted", http.StatusConflict)
+	default:
+		http.Error(w, "Error restoring the record", http.StatusInternalServerError)
+	}
+}
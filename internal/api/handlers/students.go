@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"ClassConnect/internal/audit"
 	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,66 +21,44 @@ func NewStudentHandler(db *sql.DB) *StudentHandler {
 	return &StudentHandler{db: db}
 }
 
-func (h *StudentHandler) GetStudentsHandler(w http.ResponseWriter, r *http.Request) {
-	page, limit := getPaginationParams(r)
-	offset := (page - 1) * limit
+// studentListColumns whitelists the student fields list endpoints may filter, sort and select on
+var studentListColumns = map[string]listColumn{
+	"id":         {column: "id", numeric: true},
+	"first_name": {column: "first_name"},
+	"last_name":  {column: "last_name"},
+	"email":      {column: "email"},
+	"class":      {column: "class"},
+	"school_id":  {column: "school_id", numeric: true},
+}
 
-	rows, err := h.db.Query("SELECT * FROM students LIMIT ? OFFSET ?", limit, offset)
+func (h *StudentHandler) GetStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListQuery(r.URL.Query(), studentListColumns)
 	if err != nil {
-		http.Error(w, "Error retrieving all the students", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
-	studentList := make([]models.Student, 0)
-	for rows.Next() {
-		var student models.Student
-		err = rows.Scan(&student.Id, &student.FirstName, &student.LastName, &student.Email, &student.Class)
-		if err != nil {
-			http.Error(w, "Error scanning database results", http.StatusInternalServerError)
-			return
-		}
-		studentList = append(studentList, student)
-	}
 
-	var studentCount int
-	err = h.db.QueryRow("SELECT COUNT(*) FROM students").Scan(&studentCount)
+	status, err := applyDeletedScope(r, &params)
 	if err != nil {
-		http.Error(w, "Error finding student count", http.StatusInternalServerError)
+		http.Error(w, err.Error(), status)
 		return
 	}
+	applyTenantScope(r, &params)
 
-	response := struct {
-		Status   string           `json:"status"`
-		Count    int              `json:"count"`
-		Page     int              `json:"page"`
-		PageSize int              `json:"page_size"`
-		Data     []models.Student `json:"data"`
-	}{
-		Status:   "success",
-		Count:    studentCount,
-		Page:     page,
-		PageSize: limit,
-		Data:     studentList,
-	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-func getPaginationParams(r *http.Request) (int, int) {
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-
-	page, err := strconv.Atoi(pageStr)
+	pageParams, err := getPageParams(r, params)
 	if err != nil {
-		page = 1
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	limit, err := strconv.Atoi(limitStr)
+	result, err := queryPage(h.db, "students", studentColumns, params, pageParams, scanStudent)
 	if err != nil {
-		limit = 10
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving all the students", http.StatusInternalServerError)
+		return
 	}
 
-	return page, limit
+	writePage(w, r, result, params.fields)
 }
 
 func (h *StudentHandler) GetStudentByIdHandler(w http.ResponseWriter, r *http.Request) {
@@ -88,68 +69,71 @@ func (h *StudentHandler) GetStudentByIdHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	var student models.Student
-	err = h.db.QueryRow("SELECT * FROM students WHERE id = ?", id).Scan(
-		&student.Id,
-		&student.FirstName,
-		&student.LastName,
-		&student.Email,
-		&student.Class,
-	)
+	if r.URL.Query().Has("as_of") {
+		if _, err := h.getStudentIncludingDeleted(r, id); err != nil {
+			http.Error(w, "Student with that ID does not exist in the database!", http.StatusNotFound)
+			return
+		}
+		writeAsOf(w, r, h.db, "students", studentColumns, id, scanStudent)
+		return
+	}
+
+	student, err := h.getStudent(r, id)
 	if err != nil {
 		http.Error(w, "Student with that ID does not exist in the database!", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(student)
+	writeJSONWithETag(w, r, versionETag(student.Version), student)
 }
 
 func (h *StudentHandler) CreateStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	atomic, err := getAtomicParam(r)
+	if err != nil {
+		http.Error(w, "Invalid atomic parameter", http.StatusBadRequest)
+		return
+	}
+
 	var newStudents []models.Student
-	err := json.NewDecoder(r.Body).Decode(&newStudents)
+	err = json.NewDecoder(r.Body).Decode(&newStudents)
 	if err != nil {
 		http.Error(w, "Invalid Request body", http.StatusBadRequest)
 		return
 	}
 
-	stmt, err := h.db.Prepare("INSERT INTO students(first_name, last_name, email, class) VALUES(?,?,?,?)")
-	if err != nil {
-		http.Error(w, "Error in preparing SQL query", http.StatusInternalServerError)
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
 		return
 	}
-	defer stmt.Close()
 
-	addedStudents := make([]models.Student, len(newStudents))
+	rows := make([]bulkRow, len(newStudents))
 	for i, newStudent := range newStudents {
-		res, err := stmt.Exec(newStudent.FirstName, newStudent.LastName, newStudent.Email, newStudent.Class)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Error inserting data into the database", http.StatusInternalServerError)
-			return
-		}
-		lastId, err := res.LastInsertId()
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Error getting last insert id", http.StatusInternalServerError)
-			return
+		rows[i].args = []any{newStudent.FirstName, newStudent.LastName, newStudent.Email, newStudent.Class, contextUsername(r), schoolId}
+	}
+
+	results, err := bulkInsert(h.db, atomic, "INSERT INTO students(first_name, last_name, email, class, updated_by, school_id) VALUES(?,?,?,?,?,?)", rows)
+	if err != nil && !errors.Is(err, errBulkRolledBack) {
+		log.Println(err)
+		http.Error(w, "Error inserting data into the database", http.StatusInternalServerError)
+		return
+	}
+
+	addedStudents := make([]models.Student, 0, len(newStudents))
+	if err == nil {
+		for i, result := range results {
+			if result.Error != "" {
+				continue
+			}
+			newStudents[i].Id = result.Id
+			addedStudents = append(addedStudents, newStudents[i])
 		}
-		newStudent.Id = int(lastId)
-		addedStudents[i] = newStudent
 	}
 
-	response := struct {
-		Status string           `json:"status"`
-		Count  int              `json:"count"`
-		Data   []models.Student `json:"data"`
-	}{
-		Status: "success",
-		Count:  len(addedStudents),
-		Data:   addedStudents,
+	for _, added := range addedStudents {
+		recordChange(h.db, r, audit.ActionCreate, "students", added.Id, nil, added)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
 
+	writeBulkResponse(w, results, err, addedStudents)
 }
 
 func (h *StudentHandler) DeleteStudentsHandler(w http.ResponseWriter, r *http.Request) {
@@ -160,14 +144,16 @@ func (h *StudentHandler) DeleteStudentsHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	res, err := h.db.Exec("DELETE FROM students WHERE id = ?", id)
+	versions, wildcard, err := ifMatchVersions(r)
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "Error deleting the student", http.StatusInternalServerError)
+		writePreconditionError(w, err)
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	// The previous state is kept for the audit log
+	before, _ := h.getStudent(r, id)
+
+	rowsAffected, err := softDeleteRow(h.db, r, "students", id, versions, wildcard)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Error deleting the student", http.StatusInternalServerError)
@@ -175,11 +161,13 @@ func (h *StudentHandler) DeleteStudentsHandler(w http.ResponseWriter, r *http.Re
 	}
 
 	if rowsAffected == 0 {
-		log.Println(err)
-		http.Error(w, "The student does not exist", http.StatusInternalServerError)
+		h.writeStudentWriteMiss(w, r, id)
 		return
 	}
 
+	after, _ := h.getStudentIncludingDeleted(r, id)
+	recordChange(h.db, r, audit.ActionDelete, "students", id, before, after)
+
 	response := struct {
 		Status string `json:"status"`
 		Id     int    `json:"id"`
@@ -208,37 +196,304 @@ func (h *StudentHandler) UpdateStudentsHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	var existingStudent models.Student
-	err = h.db.QueryRow("SELECT * FROM students WHERE id = ?", id).Scan(
-		&existingStudent.Id,
-		&existingStudent.FirstName,
-		&existingStudent.LastName,
-		&existingStudent.Email,
-		&existingStudent.Class,
-	)
-	// In case there are no rows, an error is still thrown
-	if err == sql.ErrNoRows {
-		http.Error(w, "Student with the given ID not found!", http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+	versions, wildcard, err := ifMatchVersions(r)
+	if err != nil {
+		writePreconditionError(w, err)
 		return
 	}
 
-	updatedStudent.Id = existingStudent.Id
-	_, err = h.db.Exec("UPDATE students SET first_name = ?, last_name = ?, email = ?, class = ? WHERE id = ?",
+	// The previous state is kept for the audit log
+	before, _ := h.getStudent(r, id)
+
+	tenant, tenantArgs := tenantCondition(r)
+	condition, conditionArgs := versionCondition(versions, wildcard)
+	args := []any{
 		updatedStudent.FirstName,
 		updatedStudent.LastName,
 		updatedStudent.Email,
 		updatedStudent.Class,
+		contextUsername(r),
 		id,
+	}
+	res, err := h.db.Exec("UPDATE students SET first_name = ?, last_name = ?, email = ?, class = ?, version = version + 1, updated_by = ? WHERE id = ? AND "+notDeleted+tenant+condition,
+		append(append(args, tenantArgs...), conditionArgs...)...,
 	)
+	if isDuplicateEntry(err) {
+		http.Error(w, "A student with that email already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Error updating the students details", http.StatusInternalServerError)
+		return
+	}
 
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		http.Error(w, "Error updating the students details", http.StatusInternalServerError)
 		return
 	}
+	if rowsAffected == 0 {
+		h.writeStudentWriteMiss(w, r, id)
+		return
+	}
 
+	after, ok := h.writeStudent(w, r, id)
+	if ok {
+		recordChange(h.db, r, audit.ActionUpdate, "students", id, before, after)
+	}
+}
+
+// studentPatchFields lists the student fields that may be changed through PATCH /students/{id}
+var studentPatchFields = map[string]patchField{
+	"first_name": {column: "first_name"},
+	"last_name":  {column: "last_name"},
+	"email":      {column: "email"},
+	"class":      {column: "class"},
+}
+
+func (h *StudentHandler) PatchStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid Student ID", http.StatusBadRequest)
+		return
+	}
+
+	patch, err := decodeMergePatch(r)
+	if err != nil {
+		writePatchError(w, err)
+		return
+	}
+
+	versions, wildcard, err := ifMatchVersions(r)
+	if err != nil {
+		writePreconditionError(w, err)
+		return
+	}
+
+	// The previous state is kept for the audit log
+	before, _ := h.getStudent(r, id)
+
+	query, args, err := buildPatchUpdate("students", id, patch, studentPatchFields, contextRole(r), contextUsername(r))
+	if err != nil {
+		writePatchError(w, err)
+		return
+	}
+
+	if query == "" {
+		// Nothing to change, but the precondition still has to hold
+		student, err := h.getStudent(r, id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Student with the given ID not found!", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+			return
+		}
+		if !versionAccepted(student.Version, versions, wildcard) {
+			writePreconditionError(w, errPreconditionFailed)
+			return
+		}
+		h.writeStudent(w, r, id)
+		return
+	}
+
+	tenant, tenantArgs := tenantCondition(r)
+	condition, conditionArgs := versionCondition(versions, wildcard)
+	res, err := h.db.Exec(query+" AND "+notDeleted+tenant+condition, append(append(args, tenantArgs...), conditionArgs...)...)
+	if isDuplicateEntry(err) {
+		http.Error(w, "A student with that email already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Patch error:", err)
+		http.Error(w, "Error updating the students details", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		http.Error(w, "Error updating the students details", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		h.writeStudentWriteMiss(w, r, id)
+		return
+	}
+
+	after, ok := h.writeStudent(w, r, id)
+	if ok {
+		recordChange(h.db, r, audit.ActionUpdate, "students", id, before, after)
+	}
+}
+
+// studentImportSpec maps spreadsheet columns onto students for POST /students/import
+var studentImportSpec = importSpec{
+	resource: "students",
+	table:    "students",
+	fields: []importField{
+		{name: "first_name", required: true},
+		{name: "last_name", required: true},
+		{name: "email", required: true},
+		{name: "class", required: true},
+	},
+}
+
+func (h *StudentHandler) ImportStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	handleImport(w, r, h.db, studentImportSpec)
+}
+
+// GetStudentHistoryHandler lists every stored version of a student, including versions from before a soft delete
+func (h *StudentHandler) GetStudentHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Student ID", http.StatusBadRequest)
+		return
+	}
+
+	// History rows carry no school, the live row decides whether the caller may see them
+	if _, err := h.getStudentIncludingDeleted(r, id); err != nil {
+		http.Error(w, "No history found for that ID", http.StatusNotFound)
+		return
+	}
+
+	writeHistory(w, r, h.db, "students", studentColumns, id, scanStudent)
+}
+
+// GetStudentEnrollmentsHandler lists the classes a student was enrolled in, one per academic year, newest first
+func (h *StudentHandler) GetStudentEnrollmentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Student ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.getStudentIncludingDeleted(r, id); err != nil {
+		http.Error(w, "Student with that ID does not exist", http.StatusNotFound)
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT e.id, e.student_id, e.academic_year_id, e.class, e.status, e.created_at, COALESCE(e.archived_at, '')
+		FROM enrollments e JOIN academic_years y ON y.id = e.academic_year_id
+		WHERE e.student_id = ? ORDER BY y.start_date DESC`, id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the enrollments", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	enrollments := make([]models.Enrollment, 0)
+	for rows.Next() {
+		var enrollment models.Enrollment
+		err = rows.Scan(&enrollment.Id, &enrollment.StudentId, &enrollment.AcademicYearId, &enrollment.Class, &enrollment.Status, &enrollment.CreatedAt, &enrollment.ArchivedAt)
+		if err != nil {
+			log.Println("Scan error:", err)
+			http.Error(w, "Error retrieving the enrollments", http.StatusInternalServerError)
+			return
+		}
+		enrollments = append(enrollments, enrollment)
+	}
+
+	writeList(w, r, enrollments)
+}
+
+// RestoreStudentHandler brings back a soft-deleted student, admin only
+func (h *StudentHandler) RestoreStudentHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := utils.AuthorizeUser(contextRole(r), "admin")
+	if err != nil {
+		http.Error(w, "Only admins may restore deleted records", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Student ID", http.StatusBadRequest)
+		return
+	}
+
+	before, _ := h.getStudentIncludingDeleted(r, id)
+	err = restoreRow(h.db, r, "students", id)
+	if err != nil {
+		if !errors.Is(err, errRestoreNotFound) && !errors.Is(err, errRestoreNotDeleted) {
+			log.Println("Restore error:", err)
+		}
+		writeRestoreError(w, err)
+		return
+	}
+
+	after, ok := h.writeStudent(w, r, id)
+	if ok {
+		recordChange(h.db, r, audit.ActionRestore, "students", id, before, after)
+	}
+}
+
+// studentExportSpec exports the same columns the list endpoint can filter on
+var studentExportSpec = exportSpec{
+	resource:      "students",
+	table:         "students",
+	columns:       studentListColumns,
+	defaultFields: []string{"id", "first_name", "last_name", "email", "class"},
+}
+
+func (h *StudentHandler) ExportStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	handleExport(w, r, h.db, studentExportSpec)
+}
+
+// studentColumns lists the columns scanned by scanStudent, in order
+const studentColumns = "id, first_name, last_name, email, class, version, COALESCE(deleted_at, ''), COALESCE(deleted_by, '')"
+
+func scanStudent(row rowScanner) (models.Student, error) {
+	var student models.Student
+	err := row.Scan(
+		&student.Id,
+		&student.FirstName,
+		&student.LastName,
+		&student.Email,
+		&student.Class,
+		&student.Version,
+		&student.DeletedAt,
+		&student.DeletedBy,
+	)
+	return student, err
+}
+
+func (h *StudentHandler) getStudent(r *http.Request, id int) (models.Student, error) {
+	tenant, tenantArgs := tenantCondition(r)
+	return scanStudent(h.db.QueryRow("SELECT "+studentColumns+" FROM students WHERE id = ? AND "+notDeleted+tenant, append([]any{id}, tenantArgs...)...))
+}
+
+// getStudentIncludingDeleted also finds soft-deleted students that have not been purged yet
+func (h *StudentHandler) getStudentIncludingDeleted(r *http.Request, id int) (models.Student, error) {
+	tenant, tenantArgs := tenantCondition(r)
+	return scanStudent(h.db.QueryRow("SELECT "+studentColumns+" FROM students WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...))
+}
+
+// writeStudent responds with the current state of a student after a successful write
+func (h *StudentHandler) writeStudent(w http.ResponseWriter, r *http.Request, id int) (models.Student, bool) {
+	student, err := h.getStudent(r, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Student with the given ID not found!", http.StatusNotFound)
+		return student, false
+	} else if err != nil {
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return student, false
+	}
+
+	w.Header().Set("ETag", versionETag(student.Version))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedStudent)
+	json.NewEncoder(w).Encode(student)
+	return student, true
+}
+
+// writeStudentWriteMiss explains why a conditional write touched no rows:
+// either the student is gone or its version no longer matches If-Match
+func (h *StudentHandler) writeStudentWriteMiss(w http.ResponseWriter, r *http.Request, id int) {
+	_, err := h.getStudent(r, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "The student does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	writePreconditionError(w, errPreconditionFailed)
 }
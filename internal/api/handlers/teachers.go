@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"ClassConnect/internal/audit"
 	"ClassConnect/internal/models"
 	"ClassConnect/pkg/utils"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -19,34 +21,45 @@ func NewTeacherHandler(db *sql.DB) *TeachersHandler {
 	return &TeachersHandler{db: db}
 }
 
-func (h *TeachersHandler) GetTeachersHandler(w http.ResponseWriter, _ *http.Request) {
-	rows, err := h.db.Query("SELECT * FROM teachers;")
+// teacherListColumns whitelists the teacher fields list endpoints may filter, sort and select on
+var teacherListColumns = map[string]listColumn{
+	"id":         {column: "id", numeric: true},
+	"first_name": {column: "first_name"},
+	"last_name":  {column: "last_name"},
+	"email":      {column: "email"},
+	"class":      {column: "class"},
+	"subject":    {column: "subject"},
+	"school_id":  {column: "school_id", numeric: true},
+}
+
+func (h *TeachersHandler) GetTeachersHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListQuery(r.URL.Query(), teacherListColumns)
 	if err != nil {
-		http.Error(w, "Error retrieving all the teachers", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
-	teachersList := make([]models.Teacher, 0)
-	for rows.Next() {
-		var teacher models.Teacher
-		err = rows.Scan(&teacher.Id, &teacher.FirstName, &teacher.LastName, &teacher.Email, &teacher.Class, &teacher.Subject)
-		if err != nil {
-			http.Error(w, "Error scanning database results", http.StatusInternalServerError)
-			return
-		}
-		teachersList = append(teachersList, teacher)
+
+	status, err := applyDeletedScope(r, &params)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
 	}
-	response := struct {
-		Status string           `json:"status"`
-		Count  int              `json:"count"`
-		Data   []models.Teacher `json:"data"`
-	}{
-		Status: "success",
-		Count:  len(teachersList),
-		Data:   teachersList,
+	applyTenantScope(r, &params)
+
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+
+	result, err := queryPage(h.db, "teachers", teacherColumns, params, pageParams, scanTeacher)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving all the teachers", http.StatusInternalServerError)
+		return
+	}
+
+	writePage(w, r, result, params.fields)
 }
 
 func (h *TeachersHandler) GetTeacherByIdhandler(w http.ResponseWriter, r *http.Request) {
@@ -57,69 +70,71 @@ func (h *TeachersHandler) GetTeacherByIdhandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	var teacher models.Teacher
-	err = h.db.QueryRow("SELECT * FROM teachers WHERE id = ?", id).Scan(
-		&teacher.Id,
-		&teacher.FirstName,
-		&teacher.LastName,
-		&teacher.Email,
-		&teacher.Class,
-		&teacher.Subject,
-	)
+	if r.URL.Query().Has("as_of") {
+		if _, err := h.getTeacherIncludingDeleted(r, id); err != nil {
+			http.Error(w, "Teacher with that ID does not exist in the database!", http.StatusNotFound)
+			return
+		}
+		writeAsOf(w, r, h.db, "teachers", teacherColumns, id, scanTeacher)
+		return
+	}
+
+	teacher, err := h.getTeacher(r, id)
 	if err != nil {
 		http.Error(w, "Teacher with that ID does not exist in the database!", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(teacher)
+	writeJSONWithETag(w, r, versionETag(teacher.Version), teacher)
 }
 
 func (h *TeachersHandler) CreateTeachersHandler(w http.ResponseWriter, r *http.Request) {
+	atomic, err := getAtomicParam(r)
+	if err != nil {
+		http.Error(w, "Invalid atomic parameter", http.StatusBadRequest)
+		return
+	}
+
 	var newTeachers []models.Teacher
-	err := json.NewDecoder(r.Body).Decode(&newTeachers)
+	err = json.NewDecoder(r.Body).Decode(&newTeachers)
 	if err != nil {
 		http.Error(w, "Invalid Request body", http.StatusBadRequest)
 		return
 	}
 
-	stmt, err := h.db.Prepare("INSERT INTO teachers(first_name, last_name, email, class, subject) VALUES(?,?,?,?,?)")
-	if err != nil {
-		http.Error(w, "Error in preparing SQL query", http.StatusInternalServerError)
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
 		return
 	}
-	defer stmt.Close()
 
-	addedTeachers := make([]models.Teacher, len(newTeachers))
+	rows := make([]bulkRow, len(newTeachers))
 	for i, newTeacher := range newTeachers {
-		res, err := stmt.Exec(newTeacher.FirstName, newTeacher.LastName, newTeacher.Email, newTeacher.Class, newTeacher.Subject)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Error inserting data into the database", http.StatusInternalServerError)
-			return
-		}
-		lastId, err := res.LastInsertId()
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Error getting last insert id", http.StatusInternalServerError)
-			return
+		rows[i].args = []any{newTeacher.FirstName, newTeacher.LastName, newTeacher.Email, newTeacher.Class, newTeacher.Subject, contextUsername(r), schoolId}
+	}
+
+	results, err := bulkInsert(h.db, atomic, "INSERT INTO teachers(first_name, last_name, email, class, subject, updated_by, school_id) VALUES(?,?,?,?,?,?,?)", rows)
+	if err != nil && !errors.Is(err, errBulkRolledBack) {
+		log.Println(err)
+		http.Error(w, "Error inserting data into the database", http.StatusInternalServerError)
+		return
+	}
+
+	addedTeachers := make([]models.Teacher, 0, len(newTeachers))
+	if err == nil {
+		for i, result := range results {
+			if result.Error != "" {
+				continue
+			}
+			newTeachers[i].Id = result.Id
+			addedTeachers = append(addedTeachers, newTeachers[i])
 		}
-		newTeacher.Id = int(lastId)
-		addedTeachers[i] = newTeacher
 	}
 
-	response := struct {
-		Status string           `json:"status"`
-		Count  int              `json:"count"`
-		Data   []models.Teacher `json:"data"`
-	}{
-		Status: "success",
-		Count:  len(addedTeachers),
-		Data:   addedTeachers,
+	for _, added := range addedTeachers {
+		recordChange(h.db, r, audit.ActionCreate, "teachers", added.Id, nil, added)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
 
+	writeBulkResponse(w, results, err, addedTeachers)
 }
 
 func (h *TeachersHandler) DeleteTeachersHandler(w http.ResponseWriter, r *http.Request) {
@@ -130,14 +145,16 @@ func (h *TeachersHandler) DeleteTeachersHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	res, err := h.db.Exec("DELETE FROM teachers WHERE id = ?", id)
+	versions, wildcard, err := ifMatchVersions(r)
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "Error deleting the teacher", http.StatusInternalServerError)
+		writePreconditionError(w, err)
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	// The previous state is kept for the audit log
+	before, _ := h.getTeacher(r, id)
+
+	rowsAffected, err := softDeleteRow(h.db, r, "teachers", id, versions, wildcard)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Error deleting the teacher", http.StatusInternalServerError)
@@ -145,11 +162,13 @@ func (h *TeachersHandler) DeleteTeachersHandler(w http.ResponseWriter, r *http.R
 	}
 
 	if rowsAffected == 0 {
-		log.Println(err)
-		http.Error(w, "The teacher does not exist", http.StatusInternalServerError)
+		h.writeTeacherWriteMiss(w, r, id)
 		return
 	}
 
+	after, _ := h.getTeacherIncludingDeleted(r, id)
+	recordChange(h.db, r, audit.ActionDelete, "teachers", id, before, after)
+
 	response := struct {
 		Status string `json:"status"`
 		Id     int    `json:"id"`
@@ -178,41 +197,51 @@ func (h *TeachersHandler) UpdateTeachersHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	var existingTeacher models.Teacher
-	err = h.db.QueryRow("SELECT * FROM teachers WHERE id = ?", id).Scan(
-		&existingTeacher.Id,
-		&existingTeacher.FirstName,
-		&existingTeacher.LastName,
-		&existingTeacher.Email,
-		&existingTeacher.Class,
-		&existingTeacher.Subject,
-	)
-	// In case there are no rows, an error is still thrown
-	if err == sql.ErrNoRows {
-		http.Error(w, "Teacher with the given ID not found!", http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+	versions, wildcard, err := ifMatchVersions(r)
+	if err != nil {
+		writePreconditionError(w, err)
 		return
 	}
 
-	updatedTeacher.Id = existingTeacher.Id
-	_, err = h.db.Exec("UPDATE teachers SET first_name = ?, last_name = ?, email = ?, class = ?, subject = ? WHERE id = ?",
+	// The previous state is kept for the audit log
+	before, _ := h.getTeacher(r, id)
+
+	tenant, tenantArgs := tenantCondition(r)
+	condition, conditionArgs := versionCondition(versions, wildcard)
+	args := []any{
 		updatedTeacher.FirstName,
 		updatedTeacher.LastName,
 		updatedTeacher.Email,
 		updatedTeacher.Class,
 		updatedTeacher.Subject,
+		contextUsername(r),
 		id,
+	}
+	res, err := h.db.Exec("UPDATE teachers SET first_name = ?, last_name = ?, email = ?, class = ?, subject = ?, version = version + 1, updated_by = ? WHERE id = ? AND "+notDeleted+tenant+condition,
+		append(append(args, tenantArgs...), conditionArgs...)...,
 	)
+	if isDuplicateEntry(err) {
+		http.Error(w, "A teacher with that email already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Error updating the teachers details", http.StatusInternalServerError)
+		return
+	}
 
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
 		http.Error(w, "Error updating the teachers details", http.StatusInternalServerError)
 		return
 	}
+	if rowsAffected == 0 {
+		h.writeTeacherWriteMiss(w, r, id)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedTeacher)
+	after, ok := h.writeTeacher(w, r, id)
+	if ok {
+		recordChange(h.db, r, audit.ActionUpdate, "teachers", id, before, after)
+	}
 }
 
 func (h *TeachersHandler) GetStudentsByTeacherId(w http.ResponseWriter, r *http.Request) {
@@ -223,41 +252,255 @@ func (h *TeachersHandler) GetStudentsByTeacherId(w http.ResponseWriter, r *http.
 		return
 	}
 
-	teacherId := r.PathValue("id")
-	var students []models.Student
+	teacherId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Teacher ID", http.StatusBadRequest)
+		return
+	}
+
+	params, err := parseListQuery(r.URL.Query(), studentListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params.addScope(notDeleted)
+	applyTenantScope(r, &params)
+	tenant, tenantArgs := tenantCondition(r)
+	params.addScope("class = (SELECT class FROM teachers WHERE id = ? AND "+notDeleted+tenant+")", append([]any{teacherId}, tenantArgs...)...)
 
-	rows, err := h.db.Query("SELECT * FROM students WHERE class = (SELECT class FROM teachers WHERE id = ?)", teacherId)
+	pageParams, err := getPageParams(r, params)
 	if err != nil {
-		http.Error(w, "Error getting students under the given teacher", http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var student models.Student
-		err = rows.Scan(&student.Id, &student.FirstName, &student.LastName, &student.Email, &student.Class)
-		if err != nil {
-			http.Error(w, "Error querying the database", http.StatusInternalServerError)
+	result, err := queryPage(h.db, "students", studentColumns, params, pageParams, scanStudent)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error querying the database", http.StatusInternalServerError)
+		return
+	}
+
+	writePage(w, r, result, params.fields)
+}
+
+// teacherPatchFields lists the teacher fields that may be changed through PATCH /teachers/{id}
+var teacherPatchFields = map[string]patchField{
+	"first_name": {column: "first_name"},
+	"last_name":  {column: "last_name"},
+	"email":      {column: "email"},
+	"class":      {column: "class"},
+	"subject":    {column: "subject"},
+}
+
+func (h *TeachersHandler) PatchTeachersHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid Teacher ID", http.StatusBadRequest)
+		return
+	}
+
+	patch, err := decodeMergePatch(r)
+	if err != nil {
+		writePatchError(w, err)
+		return
+	}
+
+	versions, wildcard, err := ifMatchVersions(r)
+	if err != nil {
+		writePreconditionError(w, err)
+		return
+	}
+
+	// The previous state is kept for the audit log
+	before, _ := h.getTeacher(r, id)
+
+	query, args, err := buildPatchUpdate("teachers", id, patch, teacherPatchFields, contextRole(r), contextUsername(r))
+	if err != nil {
+		writePatchError(w, err)
+		return
+	}
+
+	if query == "" {
+		// Nothing to change, but the precondition still has to hold
+		teacher, err := h.getTeacher(r, id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Teacher with the given ID not found!", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
 			return
 		}
-		students = append(students, student)
+		if !versionAccepted(teacher.Version, versions, wildcard) {
+			writePreconditionError(w, errPreconditionFailed)
+			return
+		}
+		h.writeTeacher(w, r, id)
+		return
+	}
+
+	tenant, tenantArgs := tenantCondition(r)
+	condition, conditionArgs := versionCondition(versions, wildcard)
+	res, err := h.db.Exec(query+" AND "+notDeleted+tenant+condition, append(append(args, tenantArgs...), conditionArgs...)...)
+	if isDuplicateEntry(err) {
+		http.Error(w, "A teacher with that email already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("Patch error:", err)
+		http.Error(w, "Error updating the teachers details", http.StatusInternalServerError)
+		return
 	}
 
-	err = rows.Err()
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		http.Error(w, "Error querying the database", http.StatusInternalServerError)
+		http.Error(w, "Error updating the teachers details", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		h.writeTeacherWriteMiss(w, r, id)
 		return
 	}
 
-	response := struct {
-		Status string           `json:"status"`
-		Count  int              `json:"count"`
-		Data   []models.Student `json:"data"`
-	}{
-		Status: "Success",
-		Count:  len(students),
-		Data:   students,
+	after, ok := h.writeTeacher(w, r, id)
+	if ok {
+		recordChange(h.db, r, audit.ActionUpdate, "teachers", id, before, after)
 	}
+}
+
+// teacherImportSpec maps spreadsheet columns onto teachers for POST /teachers/import
+var teacherImportSpec = importSpec{
+	resource: "teachers",
+	table:    "teachers",
+	fields: []importField{
+		{name: "first_name", required: true},
+		{name: "last_name", required: true},
+		{name: "email", required: true},
+		{name: "class", required: true},
+		{name: "subject", required: true},
+	},
+}
+
+func (h *TeachersHandler) ImportTeachersHandler(w http.ResponseWriter, r *http.Request) {
+	handleImport(w, r, h.db, teacherImportSpec)
+}
+
+// GetTeacherHistoryHandler lists every stored version of a teacher, including versions from before a soft delete
+func (h *TeachersHandler) GetTeacherHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Teacher ID", http.StatusBadRequest)
+		return
+	}
+
+	// History rows carry no school, the live row decides whether the caller may see them
+	if _, err := h.getTeacherIncludingDeleted(r, id); err != nil {
+		http.Error(w, "No history found for that ID", http.StatusNotFound)
+		return
+	}
+
+	writeHistory(w, r, h.db, "teachers", teacherColumns, id, scanTeacher)
+}
+
+// RestoreTeacherHandler brings back a soft-deleted teacher, admin only
+func (h *TeachersHandler) RestoreTeacherHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := utils.AuthorizeUser(contextRole(r), "admin")
+	if err != nil {
+		http.Error(w, "Only admins may restore deleted records", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Teacher ID", http.StatusBadRequest)
+		return
+	}
+
+	before, _ := h.getTeacherIncludingDeleted(r, id)
+	err = restoreRow(h.db, r, "teachers", id)
+	if err != nil {
+		if !errors.Is(err, errRestoreNotFound) && !errors.Is(err, errRestoreNotDeleted) {
+			log.Println("Restore error:", err)
+		}
+		writeRestoreError(w, err)
+		return
+	}
+
+	after, ok := h.writeTeacher(w, r, id)
+	if ok {
+		recordChange(h.db, r, audit.ActionRestore, "teachers", id, before, after)
+	}
+}
+
+// teacherExportSpec exports the same columns the list endpoint can filter on
+var teacherExportSpec = exportSpec{
+	resource:      "teachers",
+	table:         "teachers",
+	columns:       teacherListColumns,
+	defaultFields: []string{"id", "first_name", "last_name", "email", "class", "subject"},
+}
+
+func (h *TeachersHandler) ExportTeachersHandler(w http.ResponseWriter, r *http.Request) {
+	handleExport(w, r, h.db, teacherExportSpec)
+}
+
+// teacherColumns lists the columns scanned by scanTeacher, in order
+const teacherColumns = "id, first_name, last_name, email, class, subject, version, COALESCE(deleted_at, ''), COALESCE(deleted_by, '')"
+
+func scanTeacher(row rowScanner) (models.Teacher, error) {
+	var teacher models.Teacher
+	err := row.Scan(
+		&teacher.Id,
+		&teacher.FirstName,
+		&teacher.LastName,
+		&teacher.Email,
+		&teacher.Class,
+		&teacher.Subject,
+		&teacher.Version,
+		&teacher.DeletedAt,
+		&teacher.DeletedBy,
+	)
+	return teacher, err
+}
+
+func (h *TeachersHandler) getTeacher(r *http.Request, id int) (models.Teacher, error) {
+	tenant, tenantArgs := tenantCondition(r)
+	return scanTeacher(h.db.QueryRow("SELECT "+teacherColumns+" FROM teachers WHERE id = ? AND "+notDeleted+tenant, append([]any{id}, tenantArgs...)...))
+}
+
+// getTeacherIncludingDeleted also finds soft-deleted teachers that have not been purged yet
+func (h *TeachersHandler) getTeacherIncludingDeleted(r *http.Request, id int) (models.Teacher, error) {
+	tenant, tenantArgs := tenantCondition(r)
+	return scanTeacher(h.db.QueryRow("SELECT "+teacherColumns+" FROM teachers WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...))
+}
+
+// writeTeacher responds with the current state of a teacher after a successful write
+func (h *TeachersHandler) writeTeacher(w http.ResponseWriter, r *http.Request, id int) (models.Teacher, bool) {
+	teacher, err := h.getTeacher(r, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Teacher with the given ID not found!", http.StatusNotFound)
+		return teacher, false
+	} else if err != nil {
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return teacher, false
+	}
+
+	w.Header().Set("ETag", versionETag(teacher.Version))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(teacher)
+	return teacher, true
+}
+
+// writeTeacherWriteMiss explains why a conditional write touched no rows:
+// either the teacher is gone or its version no longer matches If-Match
+func (h *TeachersHandler) writeTeacherWriteMiss(w http.ResponseWriter, r *http.Request, id int) {
+	_, err := h.getTeacher(r, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "The teacher does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	writePreconditionError(w, errPreconditionFailed)
 }
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"ClassConnect/pkg/utils"
+	"errors"
+	"net/http"
+)
+
+var errSchoolRequired = errors.New("select a school with the X-School-ID header or the school subdomain")
+
+// contextSchool returns the school resolved by the tenant middleware.
+// 0 means every school and is only ever set for super admins
+func contextSchool(r *http.Request) int {
+	schoolId, _ := r.Context().Value(utils.ContextKey("schoolId")).(int)
+	return schoolId
+}
+
+// tenantCondition returns the WHERE fragment restricting a statement to the current school,
+// or nothing for a super admin acting across the district
+func tenantCondition(r *http.Request) (string, []any) {
+	schoolId := contextSchool(r)
+	if schoolId == 0 {
+		return "", nil
+	}
+	return " AND school_id = ?", []any{schoolId}
+}
+
+// applyTenantScope restricts a list query to the current school
+func applyTenantScope(r *http.Request, params *listQuery) {
+	applyTenantScopeOn(r, params, "school_id")
+}
+
+// applyTenantScopeOn is applyTenantScope for lists joining several tables, column naming the school of the listed table
+func applyTenantScopeOn(r *http.Request, params *listQuery, column string) {
+	if schoolId := contextSchool(r); schoolId != 0 {
+		params.addScope(column+" = ?", schoolId)
+	}
+}
+
+// requireSchool returns the school new records are created in, writing a 400 when a super admin has not picked one
+func requireSchool(w http.ResponseWriter, r *http.Request) (int, bool) {
+	schoolId := contextSchool(r)
+	if schoolId == 0 {
+		http.Error(w, errSchoolRequired.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	return schoolId, true
+}
+
+// canAssignRole keeps the district-level role out of reach of school admins
+func canAssignRole(r *http.Request, role string) bool {
+	return role != utils.SuperAdminRole || contextRole(r) == utils.SuperAdminRole
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/models"
+	"ClassConnect/internal/transcript"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// maxCourseCredits is the most credits a subject may be worth
+const maxCourseCredits = 20
+
+// transcriptsAccess guards the grading scale, course credits and revoking transcripts
+var transcriptsAccess = roleAccess{roles: []string{"admin", "manager"}, denied: "Only admins and managers may manage transcripts"}
+
+type TranscriptsHandler struct {
+	db *sql.DB
+}
+
+func NewTranscriptsHandler(db *sql.DB) *TranscriptsHandler {
+	return &TranscriptsHandler{db: db}
+}
+
+// GetScaleHandler returns the grading scale of the school from the highest band down
+func (h *TranscriptsHandler) GetScaleHandler(w http.ResponseWriter, r *http.Request) {
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+	scale, err := transcript.LoadScale(h.db, schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the grading scale", http.StatusInternalServerError)
+		return
+	}
+	writeList(w, r, scale)
+}
+
+// SetScaleHandler replaces the grading scale of the school. An empty scale brings back the default 4.0 scale
+func (h *TranscriptsHandler) SetScaleHandler(w http.ResponseWriter, r *http.Request) {
+	if !transcriptsAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var scale []models.GradeBand
+	err := json.NewDecoder(r.Body).Decode(&scale)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	err = validateScale(scale)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	before, err := transcript.LoadScale(h.db, schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error saving the grading scale", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error saving the grading scale", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM gpa_scale_bands WHERE school_id = ?", schoolId)
+	for _, band := range scale {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT INTO gpa_scale_bands(school_id, min_percent, letter, points) VALUES(?,?,?,?)", schoolId, band.MinPercent, band.Letter, band.Points)
+	}
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error saving the grading scale", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error saving the grading scale", http.StatusInternalServerError)
+		return
+	}
+
+	after, err := transcript.LoadScale(h.db, schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error saving the grading scale", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionUpdate, "gpa_scale_bands", schoolId, before, after)
+	writeList(w, r, after)
+}
+
+// GetCreditsHandler lists the subjects of the school with configured credits
+func (h *TranscriptsHandler) GetCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+	credits, err := h.loadCredits(schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the course credits", http.StatusInternalServerError)
+		return
+	}
+	writeList(w, r, credits)
+}
+
+// SetCreditsHandler replaces the course credits of the school with [{subject, credits}]. Subjects left out count for
+// one credit, and subjects worth 0 credits are left out of GPAs
+func (h *TranscriptsHandler) SetCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	if !transcriptsAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var credits []models.CourseCredit
+	err := json.NewDecoder(r.Body).Decode(&credits)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	subjects := make([]string, 0, len(credits))
+	for i := range credits {
+		credit := &credits[i]
+		credit.Subject = strings.TrimSpace(credit.Subject)
+		if credit.Subject == "" {
+			http.Error(w, fmt.Sprintf("credit %d: subject is required", i), http.StatusBadRequest)
+			return
+		}
+		if credit.Credits < 0 || credit.Credits > maxCourseCredits {
+			http.Error(w, fmt.Sprintf("credit %d: credits must be between 0 and %d", i, maxCourseCredits), http.StatusBadRequest)
+			return
+		}
+		if slices.Contains(subjects, strings.ToLower(credit.Subject)) {
+			http.Error(w, fmt.Sprintf("credit %d: %s is listed twice", i, credit.Subject), http.StatusBadRequest)
+			return
+		}
+		subjects = append(subjects, strings.ToLower(credit.Subject))
+	}
+	before, err := h.loadCredits(schoolId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error saving the course credits", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Error saving the course credits", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM course_credits WHERE school_id = ?", schoolId)
+	for _, credit := range credits {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT INTO course_credits(school_id, subject, credits) VALUES(?,?,?)", schoolId, credit.Subject, credit.Credits)
+	}
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error saving the course credits", http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Error saving the course credits", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "course_credits", schoolId, before, credits)
+	writeList(w, r, credits)
+}
+
+// GetTranscriptHandler returns a student's transcript with per-term and cumulative GPAs as JSON. With ?format=pdf an
+// admin or manager issues an official transcript instead: a signed PDF with a code third parties can verify it by
+func (h *TranscriptsHandler) GetTranscriptHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, _, ok := loadStudentSchool(h.db, w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "pdf" {
+		http.Error(w, "format must be json or pdf", http.StatusBadRequest)
+		return
+	}
+	if format == "pdf" && !transcriptsAccess.allow(w, r) {
+		return
+	}
+
+	t, err := transcript.Load(h.db, studentId)
+	if errors.Is(err, transcript.ErrStudentNotFound) {
+		http.Error(w, "Student with that ID does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Transcript error:", err)
+		http.Error(w, "Error compiling the transcript", http.StatusInternalServerError)
+		return
+	}
+	if format != "pdf" {
+		writeJSONWithETag(w, r, "", t)
+		return
+	}
+
+	t, err = transcript.Issue(h.db, t, contextUsername(r))
+	if errors.Is(err, transcript.ErrSigningKeyMissing) {
+		log.Println("Transcript error:", err)
+		http.Error(w, "Official transcripts are not configured", http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		log.Println("Transcript error:", err)
+		http.Error(w, "Error issuing the transcript", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(h.db, r, audit.ActionCreate, "transcripts", t.Code, nil, map[string]any{"student_id": t.StudentId, "cumulative_gpa": t.CumulativeGPA})
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", transcript.Filename(t)))
+	err = transcript.Render(t, w)
+	if err != nil {
+		log.Println("Transcript render error:", err)
+	}
+}
+
+// GetIssuedTranscriptsHandler lists the official transcripts issued to a student, most recent first
+func (h *TranscriptsHandler) GetIssuedTranscriptsHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, _, ok := loadStudentSchool(h.db, w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query("SELECT code, cumulative_gpa, COALESCE(issued_by, ''), issued_at, COALESCE(revoked_at, '') FROM transcripts WHERE student_id = ? ORDER BY issued_at DESC, id DESC", studentId)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the transcripts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	issued := make([]models.IssuedTranscript, 0)
+	for rows.Next() {
+		var t models.IssuedTranscript
+		err = rows.Scan(&t.Code, &t.CumulativeGPA, &t.IssuedBy, &t.IssuedAt, &t.RevokedAt)
+		if err != nil {
+			log.Println("Scan error:", err)
+			http.Error(w, "Error retrieving the transcripts", http.StatusInternalServerError)
+			return
+		}
+		issued = append(issued, t)
+	}
+	writeList(w, r, issued)
+}
+
+// RevokeTranscriptHandler marks an official transcript as revoked, for instance after a grade was corrected.
+// Verifying it afterwards reports it as revoked
+func (h *TranscriptsHandler) RevokeTranscriptHandler(w http.ResponseWriter, r *http.Request) {
+	if !transcriptsAccess.allow(w, r) {
+		return
+	}
+	code := transcript.NormalizeCode(r.PathValue("code"))
+
+	tenant, tenantArgs := tenantCondition(r)
+	res, err := h.db.Exec("UPDATE transcripts SET revoked_at = CURRENT_TIMESTAMP WHERE code = ? AND revoked_at IS NULL"+tenant, append([]any{code}, tenantArgs...)...)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error revoking the transcript", http.StatusInternalServerError)
+		return
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		http.Error(w, "Error revoking the transcript", http.StatusInternalServerError)
+		return
+	}
+	if affected == 0 {
+		http.Error(w, "No transcript with that code is in force", http.StatusNotFound)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "transcripts", code, map[string]any{"revoked": false}, map[string]any{"revoked": true})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyTranscriptHandler lets anyone holding a transcript check it by its code, without logging in. It answers with
+// the transcript as issued so it can be compared with the copy at hand
+func (h *TranscriptsHandler) VerifyTranscriptHandler(w http.ResponseWriter, r *http.Request) {
+	verification, err := transcript.Verify(h.db, r.PathValue("code"))
+	if errors.Is(err, transcript.ErrTranscriptNotFound) {
+		http.Error(w, "No transcript was issued with that code", http.StatusNotFound)
+		return
+	} else if errors.Is(err, transcript.ErrSigningKeyMissing) {
+		log.Println("Transcript error:", err)
+		http.Error(w, "Transcript verification is not available", http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		log.Println("Transcript error:", err)
+		http.Error(w, "Error verifying the transcript", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(verification)
+}
+
+func (h *TranscriptsHandler) loadCredits(schoolId int) ([]models.CourseCredit, error) {
+	rows, err := h.db.Query("SELECT subject, credits FROM course_credits WHERE school_id = ? ORDER BY subject", schoolId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make([]models.CourseCredit, 0)
+	for rows.Next() {
+		var credit models.CourseCredit
+		err = rows.Scan(&credit.Subject, &credit.Credits)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, credit)
+	}
+	return credits, rows.Err()
+}
+
+// validateScale checks a grading scale and orders it from the highest band down. Every percentage must fall in a
+// band, so the lowest band starts at 0, and a higher band may not be worth fewer points
+func validateScale(scale []models.GradeBand) error {
+	if len(scale) == 0 {
+		return nil
+	}
+	for i := range scale {
+		band := &scale[i]
+		band.Letter = strings.TrimSpace(band.Letter)
+		if band.Letter == "" || len(band.Letter) > 5 {
+			return fmt.Errorf("band %d: letter must be 1 to 5 characters", i)
+		}
+		if band.MinPercent < 0 || band.MinPercent > 100 {
+			return fmt.Errorf("band %d: min_percent must be between 0 and 100", i)
+		}
+		if band.Points < 0 || band.Points > 10 {
+			return fmt.Errorf("band %d: points must be between 0 and 10", i)
+		}
+	}
+	slices.SortFunc(scale, func(a, b models.GradeBand) int {
+		switch {
+		case a.MinPercent > b.MinPercent:
+			return -1
+		case a.MinPercent < b.MinPercent:
+			return 1
+		}
+		return 0
+	})
+	for i := 1; i < len(scale); i++ {
+		if scale[i].MinPercent == scale[i-1].MinPercent {
+			return fmt.Errorf("two bands start at %g%%", scale[i].MinPercent)
+		}
+		if scale[i].Points > scale[i-1].Points {
+			return fmt.Errorf("band %s is worth more points than the higher band %s", scale[i].Letter, scale[i-1].Letter)
+		}
+	}
+	if scale[len(scale)-1].MinPercent != 0 {
+		return errors.New("the lowest band must start at 0")
+	}
+	return nil
+}
@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"ClassConnect/internal/audit"
+	"ClassConnect/internal/models"
+	"ClassConnect/internal/webhooks"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// lifecycleEvents names the webhook event of each audited action on a student, teacher or exec
+var lifecycleEvents = map[string]string{
+	audit.ActionCreate:  "created",
+	audit.ActionUpdate:  "updated",
+	audit.ActionDelete:  "deleted",
+	audit.ActionRestore: "restored",
+}
+
+// recordChange writes the audit entry for a change to a student, teacher or exec and notifies the webhooks subscribed to it
+func recordChange(db *sql.DB, r *http.Request, action, resource string, id int, before, after any) {
+	audit.Record(db, r, action, resource, id, before, after)
+	notifyChange(db, r, action, resource, id, before, after)
+}
+
+// notifyChange queues the webhook events of a change: the lifecycle event, plus class_changed when an update moved
+// a student or teacher to another class
+func notifyChange(db *sql.DB, r *http.Request, action, resource string, id int, before, after any) {
+	suffix, ok := lifecycleEvents[action]
+	if !ok {
+		return
+	}
+	schoolId := contextSchool(r)
+	if schoolId == 0 {
+		err := db.QueryRow("SELECT school_id FROM "+resource+" WHERE id = ?", id).Scan(&schoolId)
+		if err != nil {
+			log.Println("Webhook school lookup error:", err)
+			return
+		}
+	}
+
+	prefix := strings.TrimSuffix(resource, "s")
+	webhooks.NotifyChange(db, schoolId, prefix+"."+suffix, before, after)
+
+	fromClass, hasClass := recordClass(before)
+	toClass, _ := recordClass(after)
+	if action == audit.ActionUpdate && hasClass && fromClass != toClass {
+		webhooks.NotifyChange(db, schoolId, prefix+".class_changed", before, after)
+	}
+}
+
+// recordClass returns the class of a student or teacher state
+func recordClass(state any) (string, bool) {
+	switch record := state.(type) {
+	case models.Student:
+		return record.Class, true
+	case models.Teacher:
+		return record.Class, true
+	}
+	return "", false
+}
+
+// webhooksAccess keeps webhook subscriptions and their deliveries to admins
+var webhooksAccess = roleAccess{roles: []string{"admin"}, denied: "Only admins may manage webhooks"}
+
+type WebhooksHandler struct {
+	db *sql.DB
+}
+
+func NewWebhooksHandler(db *sql.DB) *WebhooksHandler {
+	return &WebhooksHandler{db: db}
+}
+
+// webhookPatch holds the fields PATCH /webhooks/{id} may change, absent fields are kept
+type webhookPatch struct {
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+}
+
+func (h *WebhooksHandler) GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if !webhooksAccess.allow(w, r) {
+		return
+	}
+
+	params, err := parseListQuery(r.URL.Query(), webhookListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	applyTenantScope(r, &params)
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := queryPage(h.db, "webhooks", "id, url, event_types, active, COALESCE(created_by, ''), created_at", params, pageParams, scanWebhook)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the webhooks", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+func (h *WebhooksHandler) GetWebhookByIdHandler(w http.ResponseWriter, r *http.Request) {
+	if !webhooksAccess.allow(w, r) {
+		return
+	}
+	hook, ok := h.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	writeJSONWithETag(w, r, "", hook)
+}
+
+// CreateWebhookHandler subscribes a URL to event types. A secret is generated unless one is given,
+// and this is the only response that contains it
+func (h *WebhooksHandler) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !webhooksAccess.allow(w, r) {
+		return
+	}
+	schoolId, ok := requireSchool(w, r)
+	if !ok {
+		return
+	}
+
+	var hook models.Webhook
+	err := json.NewDecoder(r.Body).Decode(&hook)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	err = validateWebhook(r.Context(), hook.URL, hook.EventTypes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if hook.Secret == "" {
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		if err != nil {
+			http.Error(w, "Error creating the webhook", http.StatusInternalServerError)
+			return
+		}
+		hook.Secret = hex.EncodeToString(secret)
+	}
+	active := true
+	hook.Active = &active
+	hook.CreatedBy = contextUsername(r)
+
+	res, err := h.db.Exec("INSERT INTO webhooks(school_id, url, secret, event_types, active, created_by) VALUES(?,?,?,?,?,?)",
+		schoolId, hook.URL, hook.Secret, strings.Join(hook.EventTypes, ","), active, hook.CreatedBy,
+	)
+	if err != nil {
+		log.Println("Insert error:", err)
+		http.Error(w, "Error creating the webhook", http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, "Error creating the webhook", http.StatusInternalServerError)
+		return
+	}
+	hook.Id = int(id)
+
+	logged := hook
+	logged.Secret = ""
+	audit.Record(h.db, r, audit.ActionCreate, "webhooks", hook.Id, nil, logged)
+	writeCreated(w, hook)
+}
+
+// PatchWebhookHandler changes the URL, the event types or pauses and resumes deliveries with active
+func (h *WebhooksHandler) PatchWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !webhooksAccess.allow(w, r) {
+		return
+	}
+	before, ok := h.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var patch webhookPatch
+	err := json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	after := before
+	if patch.URL != nil {
+		after.URL = *patch.URL
+	}
+	if patch.EventTypes != nil {
+		after.EventTypes = patch.EventTypes
+	}
+	if patch.Active != nil {
+		after.Active = patch.Active
+	}
+	err = validateWebhook(r.Context(), after.URL, after.EventTypes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.db.Exec("UPDATE webhooks SET url = ?, event_types = ?, active = ? WHERE id = ?", after.URL, strings.Join(after.EventTypes, ","), *after.Active, after.Id)
+	if err != nil {
+		log.Println("Update error:", err)
+		http.Error(w, "Error updating the webhook", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionUpdate, "webhooks", after.Id, before, after)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(after)
+}
+
+// DeleteWebhookHandler removes a webhook together with its queued deliveries and their logs
+func (h *WebhooksHandler) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !webhooksAccess.allow(w, r) {
+		return
+	}
+	before, ok := h.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := h.db.Exec("DELETE FROM webhooks WHERE id = ?", before.Id)
+	if err != nil {
+		log.Println("Delete error:", err)
+		http.Error(w, "Error deleting the webhook", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(h.db, r, audit.ActionDelete, "webhooks", before.Id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PingWebhookHandler queues a webhook.ping delivery to check that the receiver is reachable and verifies signatures
+func (h *WebhooksHandler) PingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !webhooksAccess.allow(w, r) {
+		return
+	}
+	hook, ok := h.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var schoolId int
+	err := h.db.QueryRow("SELECT school_id FROM webhooks WHERE id = ?", hook.Id).Scan(&schoolId)
+	if err == nil {
+		err = webhooks.Enqueue(h.db, hook.Id, schoolId, webhooks.TypePing, map[string]any{"webhook_id": hook.Id})
+	}
+	if err != nil {
+		log.Println("Webhook ping error:", err)
+		http.Error(w, "Error queueing the ping", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/webhooks/%d/deliveries", hook.Id))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// GetDeliveriesHandler lists the deliveries of a webhook, newest first, filtered by ?status= or ?event_type=
+func (h *WebhooksHandler) GetDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if !webhooksAccess.allow(w, r) {
+		return
+	}
+	params, err := parseListQuery(r.URL.Query(), deliveryListColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hook, ok := h.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := params.defaultSort("-id", deliveryListColumns); err != nil {
+		log.Println("Sort error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return
+	}
+	params.addScope("webhook_id = ?", hook.Id)
+	pageParams, err := getPageParams(r, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The payload is left out of the list, it is shown with each delivery
+	result, err := queryPage(h.db, "webhook_deliveries", deliveryColumns, params, pageParams, func(row rowScanner) (models.WebhookDelivery, error) {
+		delivery, _, err := scanDelivery(row)
+		return delivery, err
+	})
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the deliveries", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, r, result, params.fields)
+}
+
+// GetDeliveryHandler returns a delivery with its payload and the log of every attempt
+func (h *WebhooksHandler) GetDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	if !webhooksAccess.allow(w, r) {
+		return
+	}
+	delivery, ok := h.loadDelivery(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query("SELECT attempt, COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, attempted_at FROM webhook_delivery_attempts WHERE delivery_id = ? ORDER BY id", delivery.Id)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Error retrieving the delivery", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	delivery.AttemptLog = make([]models.WebhookAttempt, 0)
+	for rows.Next() {
+		var attempt models.WebhookAttempt
+		err = rows.Scan(&attempt.Attempt, &attempt.StatusCode, &attempt.Error, &attempt.DurationMs, &attempt.AttemptedAt)
+		if err != nil {
+			log.Println("Scan error:", err)
+			http.Error(w, "Error retrieving the delivery", http.StatusInternalServerError)
+			return
+		}
+		delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// RedeliverHandler queues a delivery again, whatever its status, with a fresh set of attempts
+func (h *WebhooksHandler) RedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	if !webhooksAccess.allow(w, r) {
+		return
+	}
+	delivery, ok := h.loadDelivery(w, r)
+	if !ok {
+		return
+	}
+
+	err := webhooks.Redeliver(h.db, delivery.Id)
+	if err != nil {
+		log.Println("Redeliver error:", err)
+		http.Error(w, "Error queueing the delivery", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/webhooks/%d/deliveries/%d", delivery.WebhookId, delivery.Id))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deliveryColumns are the columns scanDelivery reads, the payload comes last
+// webhookListColumns whitelists the webhook fields the list may filter, sort and select on
+var webhookListColumns = map[string]listColumn{
+	"id":         {column: "id", numeric: true},
+	"url":        {column: "url"},
+	"active":     {column: "active", boolean: true},
+	"created_by": {column: "created_by"},
+	"created_at": {column: "created_at"},
+}
+
+// deliveryListColumns whitelists the delivery fields the list may filter, sort and select on
+var deliveryListColumns = map[string]listColumn{
+	"id":         {column: "id", numeric: true},
+	"event_type": {column: "event_type"},
+	"status":     {column: "status"},
+	"attempts":   {column: "attempts", numeric: true},
+	"created_at": {column: "created_at"},
+}
+
+const deliveryColumns = "id, webhook_id, event_type, status, attempts, next_attempt_at, COALESCE(last_status_code, 0), COALESCE(last_error, ''), created_at, COALESCE(delivered_at, ''), payload"
+
+func scanDelivery(row rowScanner) (models.WebhookDelivery, string, error) {
+	var delivery models.WebhookDelivery
+	var payload string
+	err := row.Scan(&delivery.Id, &delivery.WebhookId, &delivery.EventType, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+		&delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt, &payload,
+	)
+	if delivery.Status != "pending" {
+		delivery.NextAttemptAt = ""
+	}
+	return delivery, payload, err
+}
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var hook models.Webhook
+	var types string
+	var active bool
+	err := row.Scan(&hook.Id, &hook.URL, &types, &active, &hook.CreatedBy, &hook.CreatedAt)
+	hook.EventTypes = strings.Split(types, ",")
+	hook.Active = &active
+	return hook, err
+}
+
+// loadWebhook reads the webhook of the path's {id} within the current school, writing the error response itself when it cannot
+func (h *WebhooksHandler) loadWebhook(w http.ResponseWriter, r *http.Request) (models.Webhook, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return models.Webhook{}, false
+	}
+
+	tenant, tenantArgs := tenantCondition(r)
+	hook, err := scanWebhook(h.db.QueryRow("SELECT id, url, event_types, active, COALESCE(created_by, ''), created_at FROM webhooks WHERE id = ?"+tenant, append([]any{id}, tenantArgs...)...))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Webhook with that ID does not exist", http.StatusNotFound)
+		return hook, false
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return hook, false
+	}
+	return hook, true
+}
+
+// loadDelivery reads the delivery of the path's {deliveryId}, which has to belong to the path's webhook
+func (h *WebhooksHandler) loadDelivery(w http.ResponseWriter, r *http.Request) (models.WebhookDelivery, bool) {
+	hook, ok := h.loadWebhook(w, r)
+	if !ok {
+		return models.WebhookDelivery{}, false
+	}
+	deliveryId, err := strconv.ParseInt(r.PathValue("deliveryId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return models.WebhookDelivery{}, false
+	}
+
+	delivery, payload, err := scanDelivery(h.db.QueryRow("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = ? AND webhook_id = ?", deliveryId, hook.Id))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Delivery with that ID does not exist", http.StatusNotFound)
+		return delivery, false
+	} else if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Unable to retrieve data", http.StatusInternalServerError)
+		return delivery, false
+	}
+	delivery.Payload = json.RawMessage(payload)
+	return delivery, true
+}
+
+// validateWebhook checks the receiver URL, which must resolve to public addresses only, and that every event type exists
+func validateWebhook(ctx context.Context, rawURL string, eventTypes []string) error {
+	link, err := url.Parse(rawURL)
+	if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Hostname() == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	err = webhooks.CheckHost(ctx, link.Hostname())
+	if errors.Is(err, webhooks.ErrInternalAddress) {
+		return err
+	} else if err != nil {
+		return errors.New("url host could not be resolved")
+	}
+	if len(eventTypes) == 0 {
+		return errors.New("at least one event type is required")
+	}
+	for _, eventType := range eventTypes {
+		if !webhooks.ValidEventType(eventType) {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
@@ -15,6 +15,12 @@ func Compress(next http.Handler) http.Handler {
 			return
 		}
 
+		// Event streams are flushed as events happen and WebSockets take over the connection, neither can be gzipped
+		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") || strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Set response header
 		w.Header().Set("Content-Encoding", "gzip")
 		gz := gzip.NewWriter(w)
@@ -21,7 +21,8 @@ func Cors(next http.Handler) http.Handler {
 		}
 
 		// Set the cors headers
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match, X-Request-ID, X-School-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Link, X-Request-ID")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
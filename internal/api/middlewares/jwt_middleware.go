@@ -55,6 +55,7 @@ func JWTMiddleware(next http.Handler) http.Handler {
 		ctx = context.WithValue(ctx, utils.ContextKey("expiresAt"), claims["exp"])
 		ctx = context.WithValue(ctx, utils.ContextKey("username"), claims["user"])
 		ctx = context.WithValue(ctx, utils.ContextKey("userId"), claims["uid"])
+		ctx = context.WithValue(ctx, utils.ContextKey("school"), claims["school"])
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"ClassConnect/pkg/utils"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// validRequestId limits client supplied request IDs to something safe to log and store
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID tags every request with an ID, reusing a well-formed X-Request-ID header from the client
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get("X-Request-ID")
+		if !validRequestId.MatchString(requestId) {
+			idBytes := make([]byte, 16)
+			_, err := rand.Read(idBytes)
+			if err != nil {
+				http.Error(w, "Error generating request ID", http.StatusInternalServerError)
+				return
+			}
+			requestId = hex.EncodeToString(idBytes)
+		}
+
+		w.Header().Set("X-Request-ID", requestId)
+		ctx := context.WithValue(r.Context(), utils.ContextKey("requestId"), requestId)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"ClassConnect/pkg/utils"
+	"net/http"
+	"strings"
+)
+
+// RoleScope limits the accounts of a role to the paths starting with one of the allowed prefixes and refuses
+// everything else with a 403. It runs inside the JWT middleware, which stores the role in the context
+func RoleScope(role string, allowedPrefixes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userRole, _ := r.Context().Value(utils.ContextKey("role")).(string)
+			if userRole != role {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for _, prefix := range allowedPrefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Your account does not have access to this resource", http.StatusForbidden)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"ClassConnect/pkg/utils"
+	"context"
+	"database/sql"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultSchoolId is the school of requests that neither carry a school claim nor come through a school's subdomain,
+// which keeps single-school deployments working without any tenant configuration
+const defaultSchoolId = 1
+
+// TenantMiddleware resolves the school a request acts on and stores its ID in the context under "schoolId".
+// Only super admins choose the school, through the X-School-ID header or the subdomain, or none at all to act across
+// the whole district, which is stored as school 0. Other authenticated users are pinned to the school in their token,
+// the default school for tokens without one, and asking for another one is refused. Anonymous requests, the public
+// routes left out of the JWT middleware, act on the school of the subdomain or the default school; the header is not
+// theirs to set.
+// Subdomains are only considered when TENANT_BASE_DOMAIN is set, e.g. "springfield.classconnect.example"
+// resolves the school with subdomain "springfield" for a base domain of "classconnect.example"
+func TenantMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value(utils.ContextKey("role")).(string)
+			claim, _ := r.Context().Value(utils.ContextKey("school")).(string)
+
+			var requested int
+			var err error
+			if role == "" {
+				requested, err = subdomainSchool(db, r)
+			} else {
+				requested, err = requestedSchool(db, r)
+			}
+			if err == sql.ErrNoRows {
+				http.Error(w, "Unknown school", http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, "Invalid school", http.StatusBadRequest)
+				return
+			}
+
+			var schoolId int
+			switch {
+			case role == utils.SuperAdminRole:
+				schoolId = requested
+			case role == "":
+				schoolId = requested
+				if schoolId == 0 {
+					schoolId = defaultSchoolId
+				}
+			default:
+				schoolId = defaultSchoolId
+				if claim != "" {
+					schoolId, err = strconv.Atoi(claim)
+					if err != nil {
+						http.Error(w, "Invalid login token", http.StatusUnauthorized)
+						return
+					}
+				}
+				if requested != 0 && requested != schoolId {
+					http.Error(w, "Access to that school is not allowed", http.StatusForbidden)
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), utils.ContextKey("schoolId"), schoolId)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestedSchool returns the school named by the X-School-ID header or the subdomain, 0 when neither is present
+func requestedSchool(db *sql.DB, r *http.Request) (int, error) {
+	if header := r.Header.Get("X-School-ID"); header != "" {
+		id, err := strconv.Atoi(header)
+		if err != nil {
+			return 0, err
+		}
+		err = db.QueryRow("SELECT id FROM schools WHERE id = ?", id).Scan(&id)
+		return id, err
+	}
+	return subdomainSchool(db, r)
+}
+
+// subdomainSchool returns the school of the request's subdomain, 0 when there is none
+func subdomainSchool(db *sql.DB, r *http.Request) (int, error) {
+	baseDomain := os.Getenv("TENANT_BASE_DOMAIN")
+	if baseDomain == "" {
+		return 0, nil
+	}
+	host := r.Host
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		host = host[:i]
+	}
+	subdomain, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(baseDomain))
+	if !ok || subdomain == "" || strings.Contains(subdomain, ".") {
+		return 0, nil
+	}
+
+	var id int
+	err := db.QueryRow("SELECT id FROM schools WHERE subdomain = ?", subdomain).Scan(&id)
+	return id, err
+}
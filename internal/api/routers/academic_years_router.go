@@ -0,0 +1,32 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func academicYearsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	academicYearsHandler := handlers.NewAcademicYearsHandler(db)
+
+	// Academic year routes, terms and class sections belong to a year
+	mux.HandleFunc("GET /academic-years/", academicYearsHandler.GetAcademicYearsHandler)
+	mux.HandleFunc("POST /academic-years/", academicYearsHandler.CreateAcademicYearHandler)
+	mux.HandleFunc("GET /academic-years/{id}", academicYearsHandler.GetAcademicYearByIdHandler)
+
+	mux.HandleFunc("GET /academic-years/{id}/terms", academicYearsHandler.GetTermsHandler)
+	mux.HandleFunc("POST /academic-years/{id}/terms", academicYearsHandler.CreateTermHandler)
+	mux.HandleFunc("GET /academic-years/{id}/sections", academicYearsHandler.GetSectionsHandler)
+	mux.HandleFunc("POST /academic-years/{id}/sections", academicYearsHandler.CreateSectionHandler)
+	mux.HandleFunc("POST /academic-years/{id}/promotions", academicYearsHandler.PromoteClassHandler)
+
+	return mux
+}
@@ -0,0 +1,35 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func admissionsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	admissionsHandler := handlers.NewAdmissionsHandler(db)
+
+	// Public submission, applicants follow their application and send further documents by its reference
+	mux.HandleFunc("POST /admissions/apply", admissionsHandler.SubmitApplicationHandler)
+	mux.HandleFunc("GET /admissions/apply/{reference}", admissionsHandler.GetApplicationStatusHandler)
+	mux.HandleFunc("POST /admissions/apply/{reference}/documents", admissionsHandler.UploadDocumentsHandler)
+
+	// Review of the applications by the school
+	mux.HandleFunc("GET /admissions/applications", admissionsHandler.GetApplicationsHandler)
+	mux.HandleFunc("GET /admissions/applications/{id}", admissionsHandler.GetApplicationHandler)
+	mux.HandleFunc("PUT /admissions/applications/{id}/status", admissionsHandler.SetStatusHandler)
+	mux.HandleFunc("PUT /admissions/applications/{id}/assignee", admissionsHandler.SetAssigneeHandler)
+	mux.HandleFunc("POST /admissions/applications/{id}/notes", admissionsHandler.CreateNoteHandler)
+	mux.HandleFunc("GET /admissions/applications/{id}/documents/{documentId}", admissionsHandler.DownloadDocumentHandler)
+	mux.HandleFunc("POST /admissions/applications/{id}/convert", admissionsHandler.ConvertApplicationHandler)
+
+	return mux
+}
@@ -0,0 +1,31 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func announcementsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	announcementsHandler := handlers.NewAnnouncementsHandler(db)
+
+	// Announcement routes, the feed only holds what is published to the caller
+	mux.HandleFunc("GET /announcements/", announcementsHandler.GetAnnouncementsHandler)
+	mux.HandleFunc("POST /announcements/", announcementsHandler.CreateAnnouncementHandler)
+	mux.HandleFunc("GET /announcements/feed", announcementsHandler.GetFeedHandler)
+
+	mux.HandleFunc("GET /announcements/{id}", announcementsHandler.GetAnnouncementByIdHandler)
+	mux.HandleFunc("DELETE /announcements/{id}", announcementsHandler.DeleteAnnouncementHandler)
+	mux.HandleFunc("POST /announcements/{id}/read", announcementsHandler.MarkAnnouncementReadHandler)
+	mux.HandleFunc("GET /announcements/{id}/reads", announcementsHandler.GetReadReceiptsHandler)
+
+	return mux
+}
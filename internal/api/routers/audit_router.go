@@ -0,0 +1,25 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func auditRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	auditHandler := handlers.NewAuditHandler(db)
+
+	// Audit log routes, admin only
+	mux.HandleFunc("GET /audit", auditHandler.GetAuditLogHandler)
+	mux.HandleFunc("GET /audit/verify", auditHandler.VerifyAuditLogHandler)
+
+	return mux
+}
@@ -0,0 +1,34 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func calendarRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	calendarHandler := handlers.NewCalendarHandler(db)
+
+	// Calendar routes, listing expands recurring events into their occurrences
+	mux.HandleFunc("GET /calendar/events", calendarHandler.GetEventsHandler)
+	mux.HandleFunc("POST /calendar/events", calendarHandler.CreateEventHandler)
+	mux.HandleFunc("GET /calendar/events/{id}", calendarHandler.GetEventByIdHandler)
+	mux.HandleFunc("PUT /calendar/events/{id}", calendarHandler.UpdateEventHandler)
+	mux.HandleFunc("DELETE /calendar/events/{id}", calendarHandler.DeleteEventHandler)
+	mux.HandleFunc("GET /calendar/non-school-days", calendarHandler.GetNonSchoolDaysHandler)
+
+	// iCalendar subscriptions, the feed itself is authenticated by its token instead of a login
+	mux.HandleFunc("POST /calendar/feed-token", calendarHandler.CreateFeedTokenHandler)
+	mux.HandleFunc("DELETE /calendar/feed-token", calendarHandler.DeleteFeedTokenHandler)
+	mux.HandleFunc("GET /calendar/feed/{token}", calendarHandler.FeedHandler)
+
+	return mux
+}
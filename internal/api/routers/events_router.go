@@ -0,0 +1,25 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func eventsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	eventsHandler := handlers.NewEventsHandler(db)
+
+	// Real-time notifications, as Server-Sent Events or over a WebSocket
+	mux.HandleFunc("GET /events/stream", eventsHandler.StreamEventsHandler)
+	mux.HandleFunc("GET /events/ws", eventsHandler.EventsWebSocketHandler)
+
+	return mux
+}
@@ -0,0 +1,42 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func examsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	examsHandler := handlers.NewExamsHandler(db)
+
+	// Exam room routes
+	mux.HandleFunc("GET /exams/rooms", examsHandler.GetRoomsHandler)
+	mux.HandleFunc("POST /exams/rooms", examsHandler.CreateRoomHandler)
+	mux.HandleFunc("PUT /exams/rooms/{id}", examsHandler.UpdateRoomHandler)
+	mux.HandleFunc("DELETE /exams/rooms/{id}", examsHandler.DeleteRoomHandler)
+
+	// Exam session routes, scheduling refuses sessions that clash with another one
+	mux.HandleFunc("GET /exams/sessions", examsHandler.GetSessionsHandler)
+	mux.HandleFunc("POST /exams/sessions", examsHandler.CreateSessionHandler)
+	mux.HandleFunc("GET /exams/sessions/{id}", examsHandler.GetSessionHandler)
+	mux.HandleFunc("PUT /exams/sessions/{id}", examsHandler.UpdateSessionHandler)
+	mux.HandleFunc("DELETE /exams/sessions/{id}", examsHandler.DeleteSessionHandler)
+	mux.HandleFunc("GET /exams/sessions/{id}/conflicts", examsHandler.GetSessionConflictsHandler)
+
+	// Invigilators and seating plans of a session
+	mux.HandleFunc("PUT /exams/sessions/{id}/invigilators", examsHandler.SetInvigilatorsHandler)
+	mux.HandleFunc("POST /exams/sessions/{id}/invigilators/auto", examsHandler.AutoAssignInvigilatorsHandler)
+	mux.HandleFunc("POST /exams/sessions/{id}/seating", examsHandler.CreateSeatingHandler)
+	mux.HandleFunc("GET /exams/sessions/{id}/seating", examsHandler.GetSeatingHandler)
+	mux.HandleFunc("GET /exams/sessions/{id}/rooms/{roomId}/seating-list", examsHandler.GetSeatingListHandler)
+
+	return mux
+}
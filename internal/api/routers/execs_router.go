@@ -19,11 +19,15 @@ func execsRouter() *http.ServeMux {
 
 	// Execs routes
 	mux.HandleFunc("GET /execs/", execsHandler.GetExecsHandler)
+	mux.HandleFunc("GET /execs/export", execsHandler.ExportExecsHandler)
 	mux.HandleFunc("POST /execs/", execsHandler.CreateExecsHandler)
 
 	mux.HandleFunc("GET /execs/{id}", execsHandler.GetExecByIdHandler)
 	mux.HandleFunc("PUT /execs/{id}", execsHandler.UpdateExecsHandler)
+	mux.HandleFunc("PATCH /execs/{id}", execsHandler.PatchExecsHandler)
 	mux.HandleFunc("DELETE /execs/{id}", execsHandler.DeleteExecsHandler)
+	mux.HandleFunc("GET /execs/{id}/history", execsHandler.GetExecHistoryHandler)
+	mux.HandleFunc("POST /execs/{id}/restore", execsHandler.RestoreExecHandler)
 
 	mux.HandleFunc("POST /execs/login/", execsHandler.LoginHandler)
 	mux.HandleFunc("POST /execs/logout/", execsHandler.LogoutHandler)
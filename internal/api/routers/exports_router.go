@@ -0,0 +1,25 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func exportsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	exportsHandler := handlers.NewExportsHandler(db)
+
+	// Asynchronous export routes
+	mux.HandleFunc("GET /exports/{id}", exportsHandler.GetExportByIdHandler)
+	mux.HandleFunc("GET /exports/{id}/download", exportsHandler.DownloadExportHandler)
+
+	return mux
+}
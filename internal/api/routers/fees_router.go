@@ -0,0 +1,48 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func feesRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	feesHandler := handlers.NewFeesHandler(db)
+
+	// Fee structures per class and academic year, invoices are generated from them
+	mux.HandleFunc("GET /fees/structures", feesHandler.GetStructuresHandler)
+	mux.HandleFunc("POST /fees/structures", feesHandler.CreateStructureHandler)
+	mux.HandleFunc("GET /fees/structures/{id}", feesHandler.GetStructureHandler)
+	mux.HandleFunc("PUT /fees/structures/{id}", feesHandler.UpdateStructureHandler)
+	mux.HandleFunc("DELETE /fees/structures/{id}", feesHandler.DeleteStructureHandler)
+	mux.HandleFunc("POST /fees/structures/{id}/invoices", feesHandler.GenerateInvoicesHandler)
+
+	// Standing discounts and scholarships of students
+	mux.HandleFunc("GET /fees/discounts", feesHandler.GetDiscountsHandler)
+	mux.HandleFunc("POST /fees/discounts", feesHandler.CreateDiscountHandler)
+	mux.HandleFunc("DELETE /fees/discounts/{id}", feesHandler.DeleteDiscountHandler)
+
+	// Invoices and their payments
+	mux.HandleFunc("GET /fees/invoices", feesHandler.GetInvoicesHandler)
+	mux.HandleFunc("POST /fees/invoices", feesHandler.CreateInvoiceHandler)
+	mux.HandleFunc("GET /fees/invoices/{id}", feesHandler.GetInvoiceHandler)
+	mux.HandleFunc("POST /fees/invoices/{id}/discounts", feesHandler.AddInvoiceDiscountHandler)
+	mux.HandleFunc("POST /fees/invoices/{id}/void", feesHandler.VoidInvoiceHandler)
+	mux.HandleFunc("POST /fees/invoices/{id}/remind", feesHandler.RemindInvoiceHandler)
+	mux.HandleFunc("POST /fees/invoices/{id}/payments", feesHandler.CreatePaymentHandler)
+	mux.HandleFunc("DELETE /fees/payments/{id}", feesHandler.DeletePaymentHandler)
+
+	// Statements of what guardians owe across their children, /fees/statement is the guardian's own
+	mux.HandleFunc("GET /fees/guardians/{id}/statement", feesHandler.GetStatementHandler)
+	mux.HandleFunc("GET /fees/statement", feesHandler.GetOwnStatementHandler)
+
+	return mux
+}
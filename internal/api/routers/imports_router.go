@@ -0,0 +1,24 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func importsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	importsHandler := handlers.NewImportsHandler(db)
+
+	// Import job routes
+	mux.HandleFunc("GET /imports/{id}", importsHandler.GetImportByIdHandler)
+
+	return mux
+}
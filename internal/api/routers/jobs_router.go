@@ -0,0 +1,29 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func jobsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	jobsHandler := handlers.NewJobsHandler(db)
+
+	// Background job routes, admins only
+	mux.HandleFunc("GET /jobs/", jobsHandler.GetJobsHandler)
+	mux.HandleFunc("GET /jobs/schedules", jobsHandler.GetSchedulesHandler)
+
+	mux.HandleFunc("GET /jobs/{id}", jobsHandler.GetJobByIdHandler)
+	mux.HandleFunc("POST /jobs/{id}/retry", jobsHandler.RetryJobHandler)
+	mux.HandleFunc("POST /jobs/{id}/cancel", jobsHandler.CancelJobHandler)
+
+	return mux
+}
@@ -0,0 +1,37 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func leaveRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	leaveHandler := handlers.NewLeaveHandler(db)
+
+	// Approval chains of teacher and student leave
+	mux.HandleFunc("GET /leave/chains", leaveHandler.GetChainsHandler)
+	mux.HandleFunc("PUT /leave/chains", leaveHandler.SetChainsHandler)
+
+	// Requests and their approval
+	mux.HandleFunc("GET /leave/requests", leaveHandler.GetRequestsHandler)
+	mux.HandleFunc("POST /leave/requests", leaveHandler.CreateRequestHandler)
+	mux.HandleFunc("GET /leave/requests/{id}", leaveHandler.GetRequestHandler)
+	mux.HandleFunc("POST /leave/requests/{id}/approve", leaveHandler.ApproveRequestHandler)
+	mux.HandleFunc("POST /leave/requests/{id}/reject", leaveHandler.RejectRequestHandler)
+	mux.HandleFunc("POST /leave/requests/{id}/cancel", leaveHandler.CancelRequestHandler)
+
+	// Lessons and invigilations of teachers on leave, and their substitutes
+	mux.HandleFunc("GET /leave/cover", leaveHandler.GetCoverHandler)
+	mux.HandleFunc("PUT /leave/cover/{id}", leaveHandler.SetCoverHandler)
+
+	return mux
+}
@@ -0,0 +1,41 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func messagesRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	messagesHandler := handlers.NewMessagesHandler(db)
+
+	// Messaging routes, threads are visible to their participants
+	mux.HandleFunc("GET /messages/threads", messagesHandler.GetThreadsHandler)
+	mux.HandleFunc("POST /messages/threads", messagesHandler.CreateThreadHandler)
+	mux.HandleFunc("GET /messages/unread", messagesHandler.GetUnreadHandler)
+	mux.HandleFunc("GET /messages/contacts", messagesHandler.GetContactsHandler)
+
+	mux.HandleFunc("GET /messages/threads/{id}", messagesHandler.GetThreadHandler)
+	mux.HandleFunc("GET /messages/threads/{id}/messages", messagesHandler.GetThreadMessagesHandler)
+	mux.HandleFunc("POST /messages/threads/{id}/messages", messagesHandler.SendMessageHandler)
+	mux.HandleFunc("POST /messages/threads/{id}/read", messagesHandler.MarkThreadReadHandler)
+
+	// Moderation, admins only
+	mux.HandleFunc("POST /messages/threads/{id}/lock", messagesHandler.LockThreadHandler)
+	mux.HandleFunc("POST /messages/threads/{id}/unlock", messagesHandler.UnlockThreadHandler)
+	mux.HandleFunc("POST /messages/{id}/hide", messagesHandler.HideMessageHandler)
+	mux.HandleFunc("POST /messages/{id}/unhide", messagesHandler.UnhideMessageHandler)
+	mux.HandleFunc("GET /messages/blocks", messagesHandler.GetBlocksHandler)
+	mux.HandleFunc("POST /messages/blocks", messagesHandler.CreateBlockHandler)
+	mux.HandleFunc("DELETE /messages/blocks/{execId}", messagesHandler.DeleteBlockHandler)
+
+	return mux
+}
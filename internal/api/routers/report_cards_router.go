@@ -0,0 +1,24 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func reportCardsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	reportCardsHandler := handlers.NewReportCardsHandler(db)
+
+	// Report cards of a whole class, written in the background and downloaded through /exports/{id}
+	mux.HandleFunc("POST /report-cards/", reportCardsHandler.CreateReportCardBatchHandler)
+
+	return mux
+}
@@ -5,10 +5,46 @@ import (
 )
 
 func Router() *http.ServeMux {
+	lvRouter := leaveRouter()
+	admRouter := admissionsRouter()
+	feRouter := feesRouter()
+	trRouter := transcriptsRouter()
+	xmRouter := examsRouter()
+	calRouter := calendarRouter()
+	msgRouter := messagesRouter()
+	jbRouter := jobsRouter()
+	whRouter := webhooksRouter()
+	evRouter := eventsRouter()
+	anRouter := announcementsRouter()
+	rcRouter := reportCardsRouter()
+	ayRouter := academicYearsRouter()
+	schRouter := schoolsRouter()
+	aRouter := auditRouter()
+	exRouter := exportsRouter()
+	iRouter := importsRouter()
+	srchRouter := searchRouter()
 	eRouter := execsRouter()
 	sRouter := studentsRouter()
 	tRouter := teachersRouter()
 
+	admRouter.Handle("/", lvRouter)
+	feRouter.Handle("/", admRouter)
+	trRouter.Handle("/", feRouter)
+	xmRouter.Handle("/", trRouter)
+	calRouter.Handle("/", xmRouter)
+	msgRouter.Handle("/", calRouter)
+	jbRouter.Handle("/", msgRouter)
+	whRouter.Handle("/", jbRouter)
+	evRouter.Handle("/", whRouter)
+	anRouter.Handle("/", evRouter)
+	rcRouter.Handle("/", anRouter)
+	ayRouter.Handle("/", rcRouter)
+	schRouter.Handle("/", ayRouter)
+	aRouter.Handle("/", schRouter)
+	exRouter.Handle("/", aRouter)
+	iRouter.Handle("/", exRouter)
+	srchRouter.Handle("/", iRouter)
+	eRouter.Handle("/", srchRouter)
 	sRouter.Handle("/", eRouter)
 	tRouter.Handle("/", sRouter)
 	return tRouter
@@ -0,0 +1,26 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func schoolsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	schoolsHandler := handlers.NewSchoolsHandler(db)
+
+	// Tenant routes, only super admins may add schools
+	mux.HandleFunc("GET /schools/", schoolsHandler.GetSchoolsHandler)
+	mux.HandleFunc("POST /schools/", schoolsHandler.CreateSchoolHandler)
+	mux.HandleFunc("GET /schools/{id}", schoolsHandler.GetSchoolByIdHandler)
+
+	return mux
+}
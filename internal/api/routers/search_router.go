@@ -0,0 +1,24 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func searchRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	searchHandler := handlers.NewSearchHandler(db)
+
+	// Search routes
+	mux.HandleFunc("GET /search", searchHandler.SearchHandler)
+
+	return mux
+}
@@ -16,14 +16,38 @@ func studentsRouter() *http.ServeMux {
 
 	mux := http.NewServeMux()
 	studentHandler := handlers.NewStudentHandler(db)
+	reportCardsHandler := handlers.NewReportCardsHandler(db)
+	transcriptsHandler := handlers.NewTranscriptsHandler(db)
 
 	// Student routes
 	mux.HandleFunc("GET /students/", studentHandler.GetStudentsHandler)
+	mux.HandleFunc("GET /students/export", studentHandler.ExportStudentsHandler)
 	mux.HandleFunc("POST /students/", studentHandler.CreateStudentsHandler)
+	mux.HandleFunc("POST /students/import", studentHandler.ImportStudentsHandler)
 
 	mux.HandleFunc("GET /students/{id}", studentHandler.GetStudentByIdHandler)
 	mux.HandleFunc("PUT /students/{id}", studentHandler.UpdateStudentsHandler)
+	mux.HandleFunc("PATCH /students/{id}", studentHandler.PatchStudentsHandler)
 	mux.HandleFunc("DELETE /students/{id}", studentHandler.DeleteStudentsHandler)
+	mux.HandleFunc("GET /students/{id}/history", studentHandler.GetStudentHistoryHandler)
+	mux.HandleFunc("GET /students/{id}/enrollments", studentHandler.GetStudentEnrollmentsHandler)
+	mux.HandleFunc("POST /students/{id}/restore", studentHandler.RestoreStudentHandler)
+
+	// Guardian accounts of a student, who may message the student's teachers
+	mux.HandleFunc("GET /students/{id}/guardians", studentHandler.GetGuardiansHandler)
+	mux.HandleFunc("PUT /students/{id}/guardians", studentHandler.SetGuardiansHandler)
+
+	// Term results of a student and the report card compiled from them
+	mux.HandleFunc("GET /students/{id}/grades", reportCardsHandler.GetGradesHandler)
+	mux.HandleFunc("PUT /students/{id}/grades", reportCardsHandler.SetGradesHandler)
+	mux.HandleFunc("GET /students/{id}/attendance", reportCardsHandler.GetAttendanceHandler)
+	mux.HandleFunc("PUT /students/{id}/attendance", reportCardsHandler.SetAttendanceHandler)
+	mux.HandleFunc("PUT /students/{id}/remarks", reportCardsHandler.SetTermRemarkHandler)
+	mux.HandleFunc("GET /students/{id}/report-card", reportCardsHandler.GetReportCardHandler)
+
+	// Transcripts with GPAs over every term, ?format=pdf issues an official one
+	mux.HandleFunc("GET /students/{id}/transcript", transcriptsHandler.GetTranscriptHandler)
+	mux.HandleFunc("GET /students/{id}/transcripts", transcriptsHandler.GetIssuedTranscriptsHandler)
 
 	return mux
 }
@@ -19,11 +19,16 @@ func teachersRouter() *http.ServeMux {
 
 	// Teacher routes
 	mux.HandleFunc("GET /teachers/", teacherHandler.GetTeachersHandler)
+	mux.HandleFunc("GET /teachers/export", teacherHandler.ExportTeachersHandler)
 	mux.HandleFunc("POST /teachers/", teacherHandler.CreateTeachersHandler)
+	mux.HandleFunc("POST /teachers/import", teacherHandler.ImportTeachersHandler)
 
 	mux.HandleFunc("GET /teachers/{id}", teacherHandler.GetTeacherByIdhandler)
 	mux.HandleFunc("PUT /teachers/{id}", teacherHandler.UpdateTeachersHandler)
+	mux.HandleFunc("PATCH /teachers/{id}", teacherHandler.PatchTeachersHandler)
 	mux.HandleFunc("DELETE /teachers/{id}", teacherHandler.DeleteTeachersHandler)
+	mux.HandleFunc("GET /teachers/{id}/history", teacherHandler.GetTeacherHistoryHandler)
+	mux.HandleFunc("POST /teachers/{id}/restore", teacherHandler.RestoreTeacherHandler)
 
 	mux.HandleFunc("GET /teachers/{id}/students", teacherHandler.GetStudentsByTeacherId)
 
@@ -0,0 +1,31 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func transcriptsRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	transcriptsHandler := handlers.NewTranscriptsHandler(db)
+
+	// GPA settings of the school
+	mux.HandleFunc("GET /gpa/scale", transcriptsHandler.GetScaleHandler)
+	mux.HandleFunc("PUT /gpa/scale", transcriptsHandler.SetScaleHandler)
+	mux.HandleFunc("GET /gpa/credits", transcriptsHandler.GetCreditsHandler)
+	mux.HandleFunc("PUT /gpa/credits", transcriptsHandler.SetCreditsHandler)
+
+	// Official transcripts, verification is public so that universities can check them without an account
+	mux.HandleFunc("POST /transcripts/{code}/revoke", transcriptsHandler.RevokeTranscriptHandler)
+	mux.HandleFunc("GET /transcripts/verify/{code}", transcriptsHandler.VerifyTranscriptHandler)
+
+	return mux
+}
@@ -0,0 +1,34 @@
+package routers
+
+import (
+	"ClassConnect/internal/api/handlers"
+	"ClassConnect/internal/repository/sqlconnect"
+	"log"
+	"net/http"
+)
+
+func webhooksRouter() *http.ServeMux {
+	db, err := sqlconnect.ConnectDB()
+	if err != nil {
+		log.Fatal("Error:", err)
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	webhooksHandler := handlers.NewWebhooksHandler(db)
+
+	// Webhook routes, admins only
+	mux.HandleFunc("GET /webhooks/", webhooksHandler.GetWebhooksHandler)
+	mux.HandleFunc("POST /webhooks/", webhooksHandler.CreateWebhookHandler)
+
+	mux.HandleFunc("GET /webhooks/{id}", webhooksHandler.GetWebhookByIdHandler)
+	mux.HandleFunc("PATCH /webhooks/{id}", webhooksHandler.PatchWebhookHandler)
+	mux.HandleFunc("DELETE /webhooks/{id}", webhooksHandler.DeleteWebhookHandler)
+	mux.HandleFunc("POST /webhooks/{id}/ping", webhooksHandler.PingWebhookHandler)
+
+	mux.HandleFunc("GET /webhooks/{id}/deliveries", webhooksHandler.GetDeliveriesHandler)
+	mux.HandleFunc("GET /webhooks/{id}/deliveries/{deliveryId}", webhooksHandler.GetDeliveryHandler)
+	mux.HandleFunc("POST /webhooks/{id}/deliveries/{deliveryId}/redeliver", webhooksHandler.RedeliverHandler)
+
+	return mux
+}
@@ -0,0 +1,355 @@
+package audit
+
+import (
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCreate         = "create"
+	ActionUpdate         = "update"
+	ActionDelete         = "delete"
+	ActionImport         = "import"
+	ActionLogin          = "login"
+	ActionLoginFailed    = "login_failed"
+	ActionLogout         = "logout"
+	ActionPasswordChange = "password_change"
+	ActionPasswordForgot = "password_forgot"
+	ActionPasswordReset  = "password_reset"
+	ActionRestore        = "restore"
+	ActionPurge          = "purge"
+	ActionPromote        = "promote"
+)
+
+// timeLayout matches how MariaDB renders DATETIME(6), so hashes can be recomputed from stored rows
+const timeLayout = "2006-01-02 15:04:05.000000"
+
+// genesisHash is the previous hash of the very first entry
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Actor identifies who performed an audited action
+type Actor struct {
+	Id       string
+	Username string
+	Role     string
+}
+
+// ActorFromRequest reads the actor from the JWT claims the middleware stored in the request context
+func ActorFromRequest(r *http.Request) Actor {
+	ctx := r.Context()
+	return Actor{
+		Id:       contextString(ctx.Value(utils.ContextKey("userId"))),
+		Username: contextString(ctx.Value(utils.ContextKey("username"))),
+		Role:     contextString(ctx.Value(utils.ContextKey("role"))),
+	}
+}
+
+// Record appends an entry for the current request. before and after are the states of the record
+// around the change (either may be nil).
+// Failures are logged rather than returned so a broken audit log never hides a change that already happened.
+// Record is for authenticated requests, a change recorded without an actor means its route skipped the JWT middleware
+// and is logged so it gets noticed; anonymous requests use RecordAs
+func Record(db *sql.DB, r *http.Request, action, resource string, resourceId any, before, after any) {
+	actor := ActorFromRequest(r)
+	if actor.Id == "" && actor.Role == "" {
+		log.Printf("Audit: %s of %s %v recorded without an actor on %s", action, resource, resourceId, r.URL.Path)
+	}
+	RecordAs(db, r, actor, action, resource, resourceId, before, after)
+}
+
+// RecordAs is Record for requests that are not authenticated yet, such as logins and password resets
+func RecordAs(db *sql.DB, r *http.Request, actor Actor, action, resource string, resourceId any, before, after any) {
+	entry := models.AuditEntry{
+		ActorId:       actor.Id,
+		ActorUsername: actor.Username,
+		ActorRole:     actor.Role,
+		Action:        action,
+		Resource:      resource,
+		CreatedAt:     time.Now().UTC().Format(timeLayout),
+	}
+	if r != nil {
+		entry.IP = clientIP(r)
+		entry.RequestId = contextString(r.Context().Value(utils.ContextKey("requestId")))
+		entry.SchoolId, _ = r.Context().Value(utils.ContextKey("schoolId")).(int)
+	}
+	if resourceId != nil {
+		entry.ResourceId = fmt.Sprint(resourceId)
+	}
+
+	err := appendEntry(db, entry, before, after)
+	if err != nil {
+		log.Printf("Audit error (%s %s %s): %v\n", action, resource, entry.ResourceId, err)
+	}
+}
+
+// SystemActor is the actor of changes made by background jobs rather than a request
+var SystemActor = Actor{Username: "system", Role: "system"}
+
+// RecordSystem is Record for background jobs, which have no request to take the actor, IP or request id from
+func RecordSystem(db *sql.DB, action, resource string, resourceId any, before, after any) {
+	RecordAs(db, nil, SystemActor, action, resource, resourceId, before, after)
+}
+
+func appendEntry(db *sql.DB, entry models.AuditEntry, before, after any) error {
+	var err error
+	entry.Before, err = MarshalState(before)
+	if err != nil {
+		return err
+	}
+	entry.After, err = MarshalState(after)
+	if err != nil {
+		return err
+	}
+	entry.Diff, err = Diff(entry.Before, entry.After)
+	if err != nil {
+		return err
+	}
+
+	diff, err := json.Marshal(entry.Diff)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The single head row serializes writers so every entry links to exactly one predecessor
+	err = tx.QueryRow("SELECT hash FROM audit_chain_head WHERE id = 1 FOR UPDATE").Scan(&entry.PrevHash)
+	if err == sql.ErrNoRows {
+		entry.PrevHash = genesisHash
+		_, err = tx.Exec("INSERT INTO audit_chain_head(id, hash) VALUES(1, ?)", genesisHash)
+	}
+	if err != nil {
+		return err
+	}
+	entry.Hash = Hash(entry)
+
+	_, err = tx.Exec(`INSERT INTO audit_log(school_id, actor_id, actor_username, actor_role, action, resource, resource_id, before_state, after_state, diff, ip, request_id, created_at, prev_hash, hash)
+		VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		entry.SchoolId, entry.ActorId, entry.ActorUsername, entry.ActorRole, entry.Action, entry.Resource, entry.ResourceId,
+		nullableJSON(entry.Before), nullableJSON(entry.After), diff, entry.IP, entry.RequestId, entry.CreatedAt, entry.PrevHash, entry.Hash,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE audit_chain_head SET hash = ? WHERE id = 1", entry.Hash)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Columns lists the audit_log columns read by Scan, in order
+const Columns = "id, school_id, actor_id, actor_username, actor_role, action, resource, resource_id, before_state, after_state, diff, ip, request_id, created_at, prev_hash, hash"
+
+// Scan reads an audit_log row selected with Columns
+func Scan(row interface{ Scan(dest ...any) error }) (models.AuditEntry, error) {
+	var entry models.AuditEntry
+	var before, after, diff []byte
+	err := row.Scan(
+		&entry.Id, &entry.SchoolId, &entry.ActorId, &entry.ActorUsername, &entry.ActorRole, &entry.Action, &entry.Resource, &entry.ResourceId,
+		&before, &after, &diff, &entry.IP, &entry.RequestId, &entry.CreatedAt, &entry.PrevHash, &entry.Hash,
+	)
+	if err != nil {
+		return entry, err
+	}
+
+	if len(before) > 0 {
+		entry.Before = json.RawMessage(before)
+	}
+	if len(after) > 0 {
+		entry.After = json.RawMessage(after)
+	}
+	if len(diff) > 0 {
+		err = json.Unmarshal(diff, &entry.Diff)
+	}
+	return entry, err
+}
+
+// VerifyResult reports the outcome of walking the hash chain
+type VerifyResult struct {
+	Valid    bool `json:"valid"`
+	Checked  int  `json:"checked"`
+	BrokenAt int  `json:"broken_at,omitempty"`
+}
+
+// Verify recomputes every hash in order and checks each entry links to its predecessor.
+// It stops at the first entry that was altered, removed or inserted out of band
+func Verify(db *sql.DB) (VerifyResult, error) {
+	result := VerifyResult{Valid: true}
+
+	rows, err := db.Query("SELECT " + Columns + " FROM audit_log ORDER BY id ASC")
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	prevHash := genesisHash
+	for rows.Next() {
+		entry, err := Scan(rows)
+		if err != nil {
+			return result, err
+		}
+		result.Checked++
+
+		if entry.PrevHash != prevHash || Hash(entry) != entry.Hash {
+			result.Valid = false
+			result.BrokenAt = entry.Id
+			return result, nil
+		}
+		prevHash = entry.Hash
+	}
+	if err = rows.Err(); err != nil {
+		return result, err
+	}
+
+	// Entries deleted from the end of the log would leave the head pointing at a missing hash
+	var head string
+	err = db.QueryRow("SELECT hash FROM audit_chain_head WHERE id = 1").Scan(&head)
+	if err != nil && err != sql.ErrNoRows {
+		return result, err
+	}
+	if err == nil && head != prevHash {
+		result.Valid = false
+	}
+	return result, nil
+}
+
+// Hash computes the chained hash of an entry from its previous hash and content
+func Hash(entry models.AuditEntry) string {
+	content := struct {
+		PrevHash string `json:"prev_hash"`
+		// SchoolId is omitted when zero so entries written before multi-tenancy still verify
+		SchoolId      int             `json:"school_id,omitempty"`
+		ActorId       string          `json:"actor_id"`
+		ActorUsername string          `json:"actor_username"`
+		ActorRole     string          `json:"actor_role"`
+		Action        string          `json:"action"`
+		Resource      string          `json:"resource"`
+		ResourceId    string          `json:"resource_id"`
+		Before        json.RawMessage `json:"before"`
+		After         json.RawMessage `json:"after"`
+		IP            string          `json:"ip"`
+		RequestId     string          `json:"request_id"`
+		CreatedAt     string          `json:"created_at"`
+	}{
+		PrevHash:      entry.PrevHash,
+		SchoolId:      entry.SchoolId,
+		ActorId:       entry.ActorId,
+		ActorUsername: entry.ActorUsername,
+		ActorRole:     entry.ActorRole,
+		Action:        entry.Action,
+		Resource:      entry.Resource,
+		ResourceId:    entry.ResourceId,
+		Before:        canonicalJSON(entry.Before),
+		After:         canonicalJSON(entry.After),
+		IP:            entry.IP,
+		RequestId:     entry.RequestId,
+		CreatedAt:     entry.CreatedAt,
+	}
+	encoded, _ := json.Marshal(content)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// Diff lists the top-level fields whose values differ between two JSON object states
+func Diff(before, after json.RawMessage) (map[string]models.AuditFieldDiff, error) {
+	beforeFields := make(map[string]any)
+	afterFields := make(map[string]any)
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &beforeFields); err != nil {
+			return nil, err
+		}
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &afterFields); err != nil {
+			return nil, err
+		}
+	}
+
+	diff := make(map[string]models.AuditFieldDiff)
+	for field, from := range beforeFields {
+		to := afterFields[field]
+		if !reflect.DeepEqual(from, to) {
+			diff[field] = models.AuditFieldDiff{From: from, To: to}
+		}
+	}
+	for field, to := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			diff[field] = models.AuditFieldDiff{From: nil, To: to}
+		}
+	}
+	return diff, nil
+}
+
+// MarshalState encodes a record state, dropping sensitive fields that must never reach the log or leave the API
+func MarshalState(state any) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	if json.Unmarshal(encoded, &fields) != nil {
+		return encoded, nil
+	}
+	for _, sensitive := range []string{"password", "password_reset_code", "password_reset_token"} {
+		delete(fields, sensitive)
+	}
+	return json.Marshal(fields)
+}
+
+// canonicalJSON re-encodes a JSON document with sorted object keys so stored states hash the same
+// way no matter how the database hands them back
+func canonicalJSON(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return json.RawMessage("null")
+	}
+	var value any
+	if json.Unmarshal(raw, &value) != nil {
+		return raw
+	}
+	encoded, _ := json.Marshal(value)
+	return encoded
+}
+
+func nullableJSON(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return []byte(raw)
+}
+
+func contextString(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// clientIP returns the address of the direct peer without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,255 @@
+package calendar
+
+import (
+	"ClassConnect/internal/models"
+	"database/sql"
+	"errors"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DateLayout is how all-day events and days are written
+	DateLayout = "2006-01-02"
+	// TimeLayout is how timed events are written, a wall clock time of the school without a zone
+	TimeLayout = "2006-01-02T15:04"
+	// DBTimeLayout is how the DATETIME columns of events are written and read back
+	DBTimeLayout = "2006-01-02 15:04:05"
+)
+
+// Columns are the columns of calendar_events that Scan reads
+const Columns = "id, title, COALESCE(description, ''), COALESCE(location, ''), category, scope, COALESCE(scope_value, ''), starts_at, ends_at, all_day, COALESCE(rrule, ''), COALESCE(created_by, ''), created_at"
+
+// Window keeps the events with an occurrence that may overlap [from, to), taking the two bounds as DATETIME values
+const Window = " AND starts_at < ? AND (last_ends_at IS NULL OR last_ends_at > ?)"
+
+const defaultSchoolDays = "MO,TU,WE,TH,FR"
+
+// Scanner is satisfied by both *sql.Row and *sql.Rows
+type Scanner interface {
+	Scan(dest ...any) error
+}
+
+// Scan reads an event selected with Columns, converting its times from the database into the API's layouts
+func Scan(row Scanner) (models.CalendarEvent, error) {
+	var event models.CalendarEvent
+	var startsAt, endsAt string
+	err := row.Scan(&event.Id, &event.Title, &event.Description, &event.Location, &event.Category, &event.Scope, &event.ScopeValue,
+		&startsAt, &endsAt, &event.AllDay, &event.RRule, &event.CreatedBy, &event.CreatedAt,
+	)
+	if err != nil {
+		return event, err
+	}
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{{startsAt, &event.StartsAt}, {endsAt, &event.EndsAt}} {
+		t, err := time.Parse(DBTimeLayout, field.value)
+		if err != nil {
+			return event, err
+		}
+		*field.target = format(t, event.AllDay)
+	}
+	return event, nil
+}
+
+// Span parses the times of an event and returns its start and the end of its first occurrence, excluded.
+// All-day events end at the midnight after their last day
+func Span(event models.CalendarEvent) (time.Time, time.Time, error) {
+	layout := TimeLayout
+	if event.AllDay {
+		layout = DateLayout
+	}
+	start, err := time.Parse(layout, event.StartsAt)
+	if err != nil {
+		return start, start, errors.New("starts_at must be " + layoutName(event.AllDay))
+	}
+	end, err := time.Parse(layout, event.EndsAt)
+	if err != nil {
+		return start, end, errors.New("ends_at must be " + layoutName(event.AllDay))
+	}
+	if event.AllDay {
+		end = end.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return start, end, errors.New("ends_at must be after starts_at")
+	}
+	return start, end, nil
+}
+
+func layoutName(allDay bool) string {
+	if allDay {
+		return "a YYYY-MM-DD date for all-day events"
+	}
+	return "a YYYY-MM-DDTHH:MM time"
+}
+
+// LastEnd is when the last occurrence of an event ends, excluded, or the zero time for events that repeat forever
+func LastEnd(event models.CalendarEvent) (time.Time, error) {
+	start, end, err := Span(event)
+	if err != nil || event.RRule == "" {
+		return end, err
+	}
+	rule, err := ParseRule(event.RRule)
+	if err != nil || !rule.Bounded() {
+		return time.Time{}, err
+	}
+	last := start
+	rule.Each(start, func(t time.Time) bool {
+		last = t
+		return true
+	})
+	return last.Add(end.Sub(start)), nil
+}
+
+// Occurrences lists the occurrences of an event that overlap [from, to), each a copy of the event with its own times
+func Occurrences(event models.CalendarEvent, from, to time.Time) ([]models.CalendarEvent, error) {
+	start, end, err := Span(event)
+	if err != nil {
+		return nil, err
+	}
+	duration := end.Sub(start)
+	if event.RRule == "" {
+		if start.Before(to) && end.After(from) {
+			return []models.CalendarEvent{event}, nil
+		}
+		return nil, nil
+	}
+
+	rule, err := ParseRule(event.RRule)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]models.CalendarEvent, 0)
+	rule.Each(start, func(t time.Time) bool {
+		if !t.Before(to) {
+			return false
+		}
+		if t.Add(duration).After(from) {
+			occurrence := event
+			occurrence.StartsAt = format(t, event.AllDay)
+			last := t.Add(duration)
+			if event.AllDay {
+				last = last.AddDate(0, 0, -1)
+			}
+			occurrence.EndsAt = format(last, event.AllDay)
+			list = append(list, occurrence)
+		}
+		return true
+	})
+	return list, nil
+}
+
+// Expand lists the occurrences of every event overlapping [from, to), ordered by start
+func Expand(events []models.CalendarEvent, from, to time.Time) ([]models.CalendarEvent, error) {
+	list := make([]models.CalendarEvent, 0, len(events))
+	for _, event := range events {
+		occurrences, err := Occurrences(event, from, to)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, occurrences...)
+	}
+	// The layouts sort like the times they hold, and an all-day event comes before the timed ones of its day
+	sort.SliceStable(list, func(i, j int) bool { return list[i].StartsAt < list[j].StartsAt })
+	return list, nil
+}
+
+func format(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format(DateLayout)
+	}
+	return t.Format(TimeLayout)
+}
+
+// SchoolDays are the weekdays the school is open, from SCHOOL_DAYS. Monday to Friday by default or when it is invalid
+func SchoolDays() []time.Weekday {
+	days, ok := parseWeekdays(os.Getenv("SCHOOL_DAYS"))
+	if !ok {
+		days, _ = parseWeekdays(defaultSchoolDays)
+	}
+	return days
+}
+
+// parseWeekdays reads a comma separated list of two letter weekdays such as "MO,TU"
+func parseWeekdays(value string) ([]time.Weekday, bool) {
+	if value == "" {
+		return nil, false
+	}
+	days := make([]time.Weekday, 0, 7)
+	for _, day := range strings.Split(strings.ToUpper(value), ",") {
+		weekday, ok := weekdays[strings.TrimSpace(day)]
+		if !ok {
+			return nil, false
+		}
+		days = append(days, weekday)
+	}
+	return days, true
+}
+
+// NonSchoolDays lists the days between from and to, both YYYY-MM-DD dates and both included, on which the school is
+// closed: days outside SCHOOL_DAYS and days covered by an occurrence of one of the school's holidays
+func NonSchoolDays(db *sql.DB, schoolId int, from, to string) ([]models.NonSchoolDay, error) {
+	first, err := time.Parse(DateLayout, from)
+	if err != nil {
+		return nil, err
+	}
+	last, err := time.Parse(DateLayout, to)
+	if err != nil {
+		return nil, err
+	}
+	end := last.AddDate(0, 0, 1)
+
+	rows, err := db.Query("SELECT "+Columns+" FROM calendar_events WHERE school_id = ? AND category = 'holiday' AND scope = 'school'"+Window,
+		schoolId, end.Format(DBTimeLayout), first.Format(DBTimeLayout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	holidays := make([]models.CalendarEvent, 0)
+	for rows.Next() {
+		event, err := Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		holidays = append(holidays, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	occurrences, err := Expand(holidays, first, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// Holidays are all-day events. A holiday names the day even when it falls on a weekend
+	reasons := make(map[string]string)
+	for _, occurrence := range occurrences {
+		start, stop, err := Span(occurrence)
+		if err != nil {
+			return nil, err
+		}
+		for day := start; day.Before(stop); day = day.AddDate(0, 0, 1) {
+			date := day.Format(DateLayout)
+			if _, ok := reasons[date]; !ok {
+				reasons[date] = occurrence.Title
+			}
+		}
+	}
+
+	schoolDays := SchoolDays()
+	days := make([]models.NonSchoolDay, 0)
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		date := day.Format(DateLayout)
+		if reason, ok := reasons[date]; ok {
+			days = append(days, models.NonSchoolDay{Date: date, Reason: reason})
+		} else if !slices.Contains(schoolDays, day.Weekday()) {
+			days = append(days, models.NonSchoolDay{Date: date, Reason: "weekend"})
+		}
+	}
+	return days, nil
+}
@@ -0,0 +1,105 @@
+package calendar
+
+import (
+	"ClassConnect/internal/models"
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest content line RFC 5545 allows, without the line break
+const maxLineOctets = 75
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// WriteICS writes events as an iCalendar (RFC 5545) calendar named name. Recurring events keep their RRULE so
+// calendar applications expand them, and times are floating, shown as the same wall clock time wherever the reader is
+func WriteICS(w io.Writer, name string, events []models.CalendarEvent, stamp time.Time) error {
+	out := &icsWriter{w: bufio.NewWriter(w)}
+	out.line("BEGIN", "VCALENDAR")
+	out.line("VERSION", "2.0")
+	out.line("PRODID", "-//ClassConnect//Calendar//EN")
+	out.line("CALSCALE", "GREGORIAN")
+	out.line("METHOD", "PUBLISH")
+	out.line("X-WR-CALNAME", escapeText(name))
+	out.line("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+	out.line("X-PUBLISHED-TTL", "PT1H")
+
+	for _, event := range events {
+		start, end, err := Span(event)
+		if err != nil {
+			return fmt.Errorf("event %d: %w", event.Id, err)
+		}
+		out.line("BEGIN", "VEVENT")
+		out.line("UID", fmt.Sprintf("event-%d@classconnect", event.Id))
+		out.line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		if event.AllDay {
+			out.line("DTSTART;VALUE=DATE", start.Format("20060102"))
+			out.line("DTEND;VALUE=DATE", end.Format("20060102"))
+		} else {
+			out.line("DTSTART", start.Format("20060102T150405"))
+			out.line("DTEND", end.Format("20060102T150405"))
+		}
+		if event.RRule != "" {
+			rule, err := ParseRule(event.RRule)
+			if err != nil {
+				return fmt.Errorf("event %d: %w", event.Id, err)
+			}
+			out.line("RRULE", rule.String(event.AllDay))
+		}
+		out.line("SUMMARY", escapeText(event.Title))
+		if event.Description != "" {
+			out.line("DESCRIPTION", escapeText(event.Description))
+		}
+		if event.Location != "" {
+			out.line("LOCATION", escapeText(event.Location))
+		}
+		out.line("CATEGORIES", escapeText(strings.ToUpper(event.Category)))
+		if event.Category == "holiday" {
+			out.line("TRANSP", "TRANSPARENT")
+		}
+		out.line("END", "VEVENT")
+	}
+
+	out.line("END", "VCALENDAR")
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// escapeText escapes a TEXT value, whose backslashes, semicolons, commas and line breaks are special
+func escapeText(value string) string {
+	return textEscaper.Replace(value)
+}
+
+// icsWriter writes content lines, keeping the first error
+type icsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes "name:value" folded into lines of at most 75 octets, each continuation starting with a space.
+// Lines are only broken between characters, never inside a multi-byte one
+func (o *icsWriter) line(name, value string) {
+	if o.err != nil {
+		return
+	}
+	content := name + ":" + value
+	var b strings.Builder
+	width := 0
+	for _, r := range content {
+		size := utf8.RuneLen(r)
+		if width+size > maxLineOctets {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	_, o.err = o.w.WriteString(b.String())
+}
@@ -0,0 +1,302 @@
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPeriods bounds how many days, weeks, months or years a rule is walked, so rules that never match again end
+const maxPeriods = 100000
+
+// maxCount is the largest COUNT accepted
+const maxCount = 1000
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Rule is the subset of an RFC 5545 recurrence rule the calendar supports: FREQ (DAILY, WEEKLY, MONTHLY or YEARLY),
+// INTERVAL, COUNT or UNTIL, and the BYDAY (plain weekdays), BYMONTHDAY and BYMONTH filters
+type Rule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	ByMonth    []time.Month
+}
+
+// ParseRule parses the value of an RRULE, with or without the "RRULE:" prefix
+func ParseRule(value string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	value = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "RRULE:")
+	if value == "" {
+		return rule, errors.New("the rule is empty")
+	}
+
+	for _, part := range strings.Split(value, ";") {
+		name, val, ok := strings.Cut(part, "=")
+		if !ok || val == "" {
+			return rule, fmt.Errorf("invalid rule part %q", part)
+		}
+		switch name {
+		case "FREQ":
+			if val != "DAILY" && val != "WEEKLY" && val != "MONTHLY" && val != "YEARLY" {
+				return rule, errors.New("FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY")
+			}
+			rule.Freq = val
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return rule, errors.New("INTERVAL must be a positive number")
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 || n > maxCount {
+				return rule, fmt.Errorf("COUNT must be between 1 and %d", maxCount)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(val)
+			if err != nil {
+				return rule, err
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return rule, fmt.Errorf("BYDAY only takes weekdays such as MO or FR, not %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return rule, fmt.Errorf("invalid BYMONTHDAY %q", day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, month := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(month)
+				if err != nil || n < 1 || n > 12 {
+					return rule, fmt.Errorf("invalid BYMONTH %q", month)
+				}
+				rule.ByMonth = append(rule.ByMonth, time.Month(n))
+			}
+		case "WKST":
+			if val != "MO" {
+				return rule, errors.New("only WKST=MO is supported")
+			}
+		default:
+			return rule, fmt.Errorf("unsupported rule part %s", name)
+		}
+	}
+
+	if rule.Freq == "" {
+		return rule, errors.New("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return rule, errors.New("COUNT and UNTIL cannot be combined")
+	}
+	return rule, nil
+}
+
+// parseUntil reads an UNTIL date or date-time. Event times are wall clock times of the school, so a UTC marker is ignored,
+// and a date includes the whole day
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102", value); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	t, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+	if err != nil {
+		return t, errors.New("UNTIL must be a YYYYMMDD date or a YYYYMMDDTHHMMSS time")
+	}
+	return t, nil
+}
+
+// Bounded tells whether the rule ends, through COUNT or UNTIL
+func (r Rule) Bounded() bool {
+	return r.Count > 0 || !r.Until.IsZero()
+}
+
+// String formats the rule back into an RRULE value. All-day events get a date UNTIL, as RFC 5545 requires it to have
+// the same type as the start
+func (r Rule) String(allDay bool) string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		if allDay {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102T150405"))
+		}
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, 0, len(r.ByMonth))
+		for _, month := range r.ByMonth {
+			months = append(months, strconv.Itoa(int(month)))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, 0, len(r.ByMonthDay))
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, day := range r.ByDay {
+			days = append(days, strings.ToUpper(day.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Each calls yield with every occurrence starting at start, in order, until yield returns false or the rule ends.
+// As in RFC 5545 the start always counts as the first occurrence
+func (r Rule) Each(start time.Time, yield func(time.Time) bool) {
+	count := 0
+	emit := func(t time.Time) bool {
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+		count++
+		if !yield(t) {
+			return false
+		}
+		return r.Count == 0 || count < r.Count
+	}
+
+	if !emit(start) {
+		return
+	}
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range r.candidates(start, period*r.Interval) {
+			if !t.After(start) {
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// candidates are the occurrences of the period offset days, weeks, months or years after the start's, in order
+func (r Rule) candidates(start time.Time, offset int) []time.Time {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+
+	var list []time.Time
+	switch r.Freq {
+	case "DAILY":
+		day := start.AddDate(0, 0, offset)
+		if r.matchesDay(day) && r.matchesMonthDay(day) && r.matchesMonth(day) {
+			list = append(list, day)
+		}
+	case "WEEKLY":
+		monday := start.AddDate(0, 0, -((int(start.Weekday())+6)%7)+7*offset)
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		for i := 0; i < 7; i++ {
+			day := monday.AddDate(0, 0, i)
+			if slices.Contains(days, day.Weekday()) && r.matchesMonth(day) {
+				list = append(list, day)
+			}
+		}
+	case "MONTHLY":
+		first := at(start.Year(), start.Month()+time.Month(offset), 1)
+		if r.matchesMonth(first) {
+			list = r.daysOfMonth(first, start.Day(), at)
+		}
+	case "YEARLY":
+		year := start.Year() + offset
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{start.Month()}
+		}
+		for month := time.January; month <= time.December; month++ {
+			if slices.Contains(months, month) {
+				list = append(list, r.daysOfMonth(at(year, month, 1), start.Day(), at)...)
+			}
+		}
+	}
+	return list
+}
+
+// daysOfMonth lists the days of first's month the rule selects: BYMONTHDAY, every BYDAY weekday, or the start's day.
+// Days the month does not have, such as the 31st of April, are skipped
+func (r Rule) daysOfMonth(first time.Time, startDay int, at func(int, time.Month, int) time.Time) []time.Time {
+	length := first.AddDate(0, 1, -1).Day()
+	var days []int
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, day := range r.ByMonthDay {
+			if day < 0 {
+				day = length + day + 1
+			}
+			if day >= 1 && day <= length {
+				days = append(days, day)
+			}
+		}
+	case len(r.ByDay) > 0:
+		for day := 1; day <= length; day++ {
+			days = append(days, day)
+		}
+	case startDay <= length:
+		days = append(days, startDay)
+	}
+	slices.Sort(days)
+	days = slices.Compact(days)
+
+	list := make([]time.Time, 0, len(days))
+	for _, day := range days {
+		t := at(first.Year(), first.Month(), day)
+		if r.matchesDay(t) {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+func (r Rule) matchesDay(t time.Time) bool {
+	return len(r.ByDay) == 0 || slices.Contains(r.ByDay, t.Weekday())
+}
+
+func (r Rule) matchesMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	length := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+	for _, day := range r.ByMonthDay {
+		if day == t.Day() || length+day+1 == t.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) matchesMonth(t time.Time) bool {
+	return len(r.ByMonth) == 0 || slices.Contains(r.ByMonth, t.Month())
+}
@@ -0,0 +1,187 @@
+package calendar
+
+import (
+	"ClassConnect/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "FREQ=DAILY", want: "FREQ=DAILY"},
+		{value: "rrule:freq=weekly;byday=mo,we", want: "FREQ=WEEKLY;BYDAY=MO,WE"},
+		{value: "FREQ=WEEKLY;INTERVAL=2;UNTIL=20261218T170000Z;BYDAY=FR", want: "FREQ=WEEKLY;INTERVAL=2;UNTIL=20261218T170000;BYDAY=FR"},
+		{value: "FREQ=YEARLY;BYMONTH=12;BYMONTHDAY=-1;COUNT=5;WKST=MO", want: "FREQ=YEARLY;COUNT=5;BYMONTH=12;BYMONTHDAY=-1"},
+		{value: "", wantErr: true},
+		{value: "INTERVAL=2", wantErr: true},
+		{value: "FREQ", wantErr: true},
+		{value: "FREQ=HOURLY", wantErr: true},
+		{value: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+		{value: "FREQ=DAILY;COUNT=0", wantErr: true},
+		{value: "FREQ=DAILY;COUNT=1001", wantErr: true},
+		{value: "FREQ=DAILY;COUNT=2;UNTIL=20260101", wantErr: true},
+		{value: "FREQ=DAILY;UNTIL=2026-01-01", wantErr: true},
+		{value: "FREQ=MONTHLY;BYDAY=1MO", wantErr: true},
+		{value: "FREQ=MONTHLY;BYMONTHDAY=0", wantErr: true},
+		{value: "FREQ=MONTHLY;BYMONTHDAY=32", wantErr: true},
+		{value: "FREQ=YEARLY;BYMONTH=13", wantErr: true},
+		{value: "FREQ=WEEKLY;WKST=SU", wantErr: true},
+		{value: "FREQ=MONTHLY;BYSETPOS=1", wantErr: true},
+	}
+	for _, test := range tests {
+		rule, err := ParseRule(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseRule(%q) error = %v, wantErr %v", test.value, err, test.wantErr)
+			continue
+		}
+		if err == nil {
+			if got := rule.String(false); got != test.want {
+				t.Errorf("ParseRule(%q).String() = %q, want %q", test.value, got, test.want)
+			}
+		}
+	}
+}
+
+func TestRuleStringAllDay(t *testing.T) {
+	rule, err := ParseRule("FREQ=WEEKLY;UNTIL=20261218")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rule.Until, time.Date(2026, 12, 18, 23, 59, 59, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Until = %s, want the end of the day %s", got, want)
+	}
+	if got := rule.String(true); got != "FREQ=WEEKLY;UNTIL=20261218" {
+		t.Errorf("String(true) = %q, want a date UNTIL", got)
+	}
+}
+
+func TestRuleEach(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		start string
+		want  string
+	}{
+		{"daily count", "FREQ=DAILY;COUNT=3", "2026-09-07T08:00", "2026-09-07T08:00 2026-09-08T08:00 2026-09-09T08:00"},
+		{"school days", "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;COUNT=4", "2026-09-11T08:00", "2026-09-11T08:00 2026-09-14T08:00 2026-09-15T08:00 2026-09-16T08:00"},
+		{"weekly on two days", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", "2026-09-07T08:00", "2026-09-07T08:00 2026-09-09T08:00 2026-09-14T08:00 2026-09-16T08:00"},
+		{"every other week", "FREQ=WEEKLY;INTERVAL=2;COUNT=3", "2026-09-07T08:00", "2026-09-07T08:00 2026-09-21T08:00 2026-10-05T08:00"},
+		{"until a date includes the day", "FREQ=DAILY;UNTIL=20260909", "2026-09-07T08:00", "2026-09-07T08:00 2026-09-08T08:00 2026-09-09T08:00"},
+		{"until a time", "FREQ=DAILY;UNTIL=20260909T070000", "2026-09-07T08:00", "2026-09-07T08:00 2026-09-08T08:00"},
+		{"monthly skips short months", "FREQ=MONTHLY;COUNT=3", "2026-01-31T08:00", "2026-01-31T08:00 2026-03-31T08:00 2026-05-31T08:00"},
+		{"last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3", "2026-01-31T08:00", "2026-01-31T08:00 2026-02-28T08:00 2026-03-31T08:00"},
+		{"every friday of october", "FREQ=MONTHLY;BYDAY=FR;BYMONTH=10;COUNT=6", "2026-10-02T08:00",
+			"2026-10-02T08:00 2026-10-09T08:00 2026-10-16T08:00 2026-10-23T08:00 2026-10-30T08:00 2027-10-01T08:00"},
+		{"yearly on a leap day", "FREQ=YEARLY;COUNT=3", "2024-02-29T08:00", "2024-02-29T08:00 2028-02-29T08:00 2032-02-29T08:00"},
+		{"start counts even off the rule", "FREQ=WEEKLY;BYDAY=TU;COUNT=2", "2026-09-07T08:00", "2026-09-07T08:00 2026-09-08T08:00"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := ParseRule(test.rule)
+			if err != nil {
+				t.Fatalf("ParseRule(%q) error = %v", test.rule, err)
+			}
+			start, err := time.Parse(TimeLayout, test.start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			rule.Each(start, func(occurrence time.Time) bool {
+				got = append(got, occurrence.Format(TimeLayout))
+				return len(got) < 20
+			})
+			if strings.Join(got, " ") != test.want {
+				t.Errorf("Each() = %v, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	day := func(value string) time.Time {
+		parsed, err := time.Parse(DateLayout, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name     string
+		event    models.CalendarEvent
+		from, to string
+		want     string
+	}{
+		{
+			name:  "two-day event repeating weekly",
+			event: models.CalendarEvent{StartsAt: "2026-12-21", EndsAt: "2026-12-22", AllDay: true, RRule: "FREQ=WEEKLY;COUNT=3"},
+			from:  "2026-12-29", to: "2027-01-10",
+			want: "2026-12-28/2026-12-29 2027-01-04/2027-01-05",
+		},
+		{
+			name:  "single event inside the window",
+			event: models.CalendarEvent{StartsAt: "2026-09-07T08:00", EndsAt: "2026-09-07T09:30"},
+			from:  "2026-09-07", to: "2026-09-08",
+			want: "2026-09-07T08:00/2026-09-07T09:30",
+		},
+		{
+			name:  "single event before the window",
+			event: models.CalendarEvent{StartsAt: "2026-09-06T08:00", EndsAt: "2026-09-06T09:30"},
+			from:  "2026-09-07", to: "2026-09-08",
+			want: "",
+		},
+		{
+			name:  "window end is excluded",
+			event: models.CalendarEvent{StartsAt: "2026-09-07T08:00", EndsAt: "2026-09-07T09:00", RRule: "FREQ=DAILY"},
+			from:  "2026-09-07", to: "2026-09-09",
+			want: "2026-09-07T08:00/2026-09-07T09:00 2026-09-08T08:00/2026-09-08T09:00",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			occurrences, err := Occurrences(test.event, day(test.from), day(test.to))
+			if err != nil {
+				t.Fatalf("Occurrences() error = %v", err)
+			}
+			got := make([]string, 0, len(occurrences))
+			for _, occurrence := range occurrences {
+				got = append(got, occurrence.StartsAt+"/"+occurrence.EndsAt)
+			}
+			if strings.Join(got, " ") != test.want {
+				t.Errorf("Occurrences() = %v, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLastEnd(t *testing.T) {
+	tests := []struct {
+		name  string
+		event models.CalendarEvent
+		want  string
+	}{
+		{"single event", models.CalendarEvent{StartsAt: "2026-09-07T08:00", EndsAt: "2026-09-07T09:30"}, "2026-09-07T09:30"},
+		{"bounded rule", models.CalendarEvent{StartsAt: "2026-09-07T08:00", EndsAt: "2026-09-07T09:30", RRule: "FREQ=DAILY;COUNT=3"}, "2026-09-09T09:30"},
+		{"all-day event ends at midnight", models.CalendarEvent{StartsAt: "2026-09-07", EndsAt: "2026-09-07", AllDay: true, RRule: "FREQ=WEEKLY;COUNT=2"}, "2026-09-15T00:00"},
+		{"endless rule", models.CalendarEvent{StartsAt: "2026-09-07T08:00", EndsAt: "2026-09-07T09:30", RRule: "FREQ=WEEKLY"}, ""},
+	}
+	for _, test := range tests {
+		end, err := LastEnd(test.event)
+		if err != nil {
+			t.Errorf("%s: LastEnd() error = %v", test.name, err)
+			continue
+		}
+		got := ""
+		if !end.IsZero() {
+			got = end.Format(TimeLayout)
+		}
+		if got != test.want {
+			t.Errorf("%s: LastEnd() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
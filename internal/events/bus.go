@@ -0,0 +1,206 @@
+package events
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReplaySize = 1000
+	defaultHeartbeat  = 25 * time.Second
+	// subscriberBuffer is how many events may wait for a slow subscriber before it is disconnected
+	subscriberBuffer = 64
+)
+
+// Event types published by the API
+const (
+	TypeAttendanceAbsent      = "attendance.absent"
+	TypeGradePosted           = "grade.posted"
+	TypeAnnouncementPublished = "announcement.published"
+	TypeMessageReceived       = "message.received"
+	TypeLeaveUpdated          = "leave.updated"
+)
+
+// Event is a notification delivered to the subscribers it is addressed to
+type Event struct {
+	Id        int64     `json:"id"`
+	Type      string    `json:"type"`
+	SchoolId  int       `json:"school_id"`
+	Data      any       `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+	Audience  Audience  `json:"-"`
+}
+
+// Audience selects who receives an event within its school. A subscriber matches when any of the selectors does
+type Audience struct {
+	All     bool
+	Roles   []string
+	UserIds []string
+	// Classes and Courses reach the accounts teaching that class or subject
+	Classes []string
+	Courses []string
+}
+
+// Subscriber describes who is listening and to which event types, an empty Types means all of them.
+// SchoolId 0 receives events of every school
+type Subscriber struct {
+	SchoolId int
+	Role     string
+	UserId   string
+	Classes  []string
+	Courses  []string
+	Types    []string
+	// SeeAll receives every event of its schools regardless of the audience, as district-wide super admins do
+	SeeAll bool
+}
+
+// Matches reports whether an event is addressed to the subscriber
+func (s Subscriber) Matches(e Event) bool {
+	if s.SchoolId != 0 && s.SchoolId != e.SchoolId {
+		return false
+	}
+	if len(s.Types) > 0 && !slices.Contains(s.Types, e.Type) {
+		return false
+	}
+	a := e.Audience
+	if s.SeeAll || a.All || slices.Contains(a.Roles, s.Role) || (s.UserId != "" && slices.Contains(a.UserIds, s.UserId)) {
+		return true
+	}
+	for _, class := range s.Classes {
+		if slices.Contains(a.Classes, class) {
+			return true
+		}
+	}
+	for _, course := range s.Courses {
+		if slices.Contains(a.Courses, course) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives matching events on C until it is closed. C is closed when the subscriber falls too far behind
+type Subscription struct {
+	C          <-chan Event
+	ch         chan Event
+	subscriber Subscriber
+	bus        *Bus
+}
+
+// Close stops the delivery of events
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// Bus is an in-process publish and subscribe hub that keeps the most recent events for replay
+type Bus struct {
+	mu          sync.Mutex
+	nextId      int64
+	recent      []Event
+	replaySize  int
+	subscribers map[*Subscription]struct{}
+}
+
+func NewBus(replaySize int) *Bus {
+	return &Bus{nextId: 1, replaySize: replaySize, subscribers: make(map[*Subscription]struct{})}
+}
+
+// defaultBus is the bus handlers publish to, its replay size comes from EVENT_REPLAY_SIZE
+var defaultBus = NewBus(replaySize())
+
+// HeartbeatInterval is how often idle streams are pinged to keep proxies from closing them, from EVENTS_HEARTBEAT
+func HeartbeatInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("EVENTS_HEARTBEAT"))
+	if err != nil || interval <= 0 {
+		interval = defaultHeartbeat
+	}
+	return interval
+}
+
+func replaySize() int {
+	size, err := strconv.Atoi(os.Getenv("EVENT_REPLAY_SIZE"))
+	if err != nil || size < 0 {
+		size = defaultReplaySize
+	}
+	return size
+}
+
+// Publish sends an event to the subscribers of the default bus
+func Publish(eventType string, schoolId int, audience Audience, data any) {
+	defaultBus.Publish(eventType, schoolId, audience, data)
+}
+
+// Subscribe registers on the default bus, see Bus.Subscribe
+func Subscribe(subscriber Subscriber, lastEventId int64) (*Subscription, []Event, bool) {
+	return defaultBus.Subscribe(subscriber, lastEventId)
+}
+
+// Publish numbers the event, keeps it for replay and hands it to every matching subscriber without blocking
+func (b *Bus) Publish(eventType string, schoolId int, audience Audience, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := Event{Id: b.nextId, Type: eventType, SchoolId: schoolId, Data: data, CreatedAt: time.Now().UTC(), Audience: audience}
+	b.nextId++
+
+	if b.replaySize > 0 {
+		if len(b.recent) == b.replaySize {
+			b.recent = append(b.recent[:0], b.recent[1:]...)
+		}
+		b.recent = append(b.recent, event)
+	}
+
+	for sub := range b.subscribers {
+		if !sub.subscriber.Matches(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// A subscriber that stopped reading is dropped rather than holding up everyone else
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// Subscribe registers a subscriber and returns the matching events published after lastEventId, which the caller should
+// deliver before reading from the subscription. complete is false when events after lastEventId have already left the
+// replay buffer or were published before a restart, so the client should reload its state instead
+func (b *Bus) Subscribe(subscriber Subscriber, lastEventId int64) (*Subscription, []Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, subscriber: subscriber, bus: b}
+	b.subscribers[sub] = struct{}{}
+
+	if lastEventId <= 0 {
+		return sub, nil, true
+	}
+
+	oldest := b.nextId
+	if len(b.recent) > 0 {
+		oldest = b.recent[0].Id
+	}
+	complete := lastEventId < b.nextId && oldest <= lastEventId+1
+	missed := make([]Event, 0)
+	for _, event := range b.recent {
+		if event.Id > lastEventId && subscriber.Matches(event) {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed, complete
+}
+
+func (b *Bus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,42 @@
+package events
+
+import "testing"
+
+func TestGuardianReceivesStudentEvents(t *testing.T) {
+	// The audience the report card handlers give a student's grades and absences
+	audience := Audience{Roles: []string{"admin", "manager"}, UserIds: []string{"7"}, Classes: []string{"5A"}}
+	tests := []struct {
+		name       string
+		subscriber Subscriber
+		eventType  string
+		want       bool
+	}{
+		{"guardian gets a grade", Subscriber{SchoolId: 1, Role: "guardian", UserId: "7"}, TypeGradePosted, true},
+		{"guardian gets an absence", Subscriber{SchoolId: 1, Role: "guardian", UserId: "7"}, TypeAttendanceAbsent, true},
+		{"another guardian", Subscriber{SchoolId: 1, Role: "guardian", UserId: "8"}, TypeGradePosted, false},
+		{"guardian of another school", Subscriber{SchoolId: 2, Role: "guardian", UserId: "7"}, TypeGradePosted, false},
+		{"guardian filtering types", Subscriber{SchoolId: 1, Role: "guardian", UserId: "7", Types: []string{TypeMessageReceived}}, TypeAttendanceAbsent, false},
+		{"class teacher", Subscriber{SchoolId: 1, Role: "teacher", UserId: "3", Classes: []string{"5A"}}, TypeAttendanceAbsent, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bus := NewBus(10)
+			sub, _, _ := bus.Subscribe(test.subscriber, 0)
+			defer sub.Close()
+
+			bus.Publish(test.eventType, 1, audience, nil)
+			select {
+			case event := <-sub.C:
+				if !test.want {
+					t.Errorf("received %s event %d, want none", event.Type, event.Id)
+				} else if event.Type != test.eventType {
+					t.Errorf("received %s event, want %s", event.Type, test.eventType)
+				}
+			default:
+				if test.want {
+					t.Errorf("received no %s event, want one", test.eventType)
+				}
+			}
+		})
+	}
+}
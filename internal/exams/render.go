@@ -0,0 +1,108 @@
+package exams
+
+import (
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Layout of the seating list, in points
+const (
+	margin       = 50.0
+	bottomMargin = 70.0
+	bodySize     = 10.0
+	lineHeight   = 16.0
+)
+
+// unsafeFilename matches what is dropped from room names when naming seating lists
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// seatColumns are the x positions of the seating list columns
+var seatColumns = struct{ seat, position, name, class, signature float64 }{margin, 95, 150, 340, 410}
+
+// RenderSeatingList writes the printable seating list of one room of a session as a PDF: the session, the
+// invigilators and one line per seat in seat order, with room for the student's signature
+func RenderSeatingList(w io.Writer, school string, session models.ExamSession, room models.ExamSessionRoom, seats []models.ExamSeat) error {
+	doc := utils.NewPDFDocument()
+	doc.AddPage()
+	y := utils.PDFPageHeight - margin - 10
+
+	doc.Text(margin, y, 18, true, school)
+	y -= lineHeight * 1.6
+	title := session.Course
+	if session.Title != "" {
+		title += " – " + session.Title
+	}
+	doc.Text(margin, y, 13, false, "Seating List – "+title)
+	y -= lineHeight * 1.6
+
+	invigilators := make([]string, 0, len(room.Invigilators))
+	for _, invigilator := range room.Invigilators {
+		invigilators = append(invigilators, invigilator.Name)
+	}
+	if len(invigilators) == 0 {
+		invigilators = append(invigilators, "Not assigned")
+	}
+	for _, field := range [][2]string{
+		{"Room", room.Name},
+		{"Time", fmt.Sprintf("%s to %s (%d minutes)", strings.Replace(session.StartsAt, "T", " ", 1), strings.Replace(session.EndsAt, "T", " ", 1), session.DurationMinutes)},
+		{"Classes", strings.Join(session.Classes, ", ")},
+		{"Invigilators", strings.Join(invigilators, ", ")},
+		{"Students", fmt.Sprintf("%d of %d seats", len(seats), room.Capacity)},
+	} {
+		doc.Text(margin, y, bodySize, true, field[0])
+		doc.Text(130, y, bodySize, false, field[1])
+		y -= lineHeight
+	}
+	doc.Line(margin, y+lineHeight/2, utils.PDFPageWidth-margin, y+lineHeight/2, 0.5)
+	y -= lineHeight
+
+	header := func() {
+		doc.Text(seatColumns.seat, y, bodySize, true, "Seat")
+		doc.Text(seatColumns.position, y, bodySize, true, "Row/Col")
+		doc.Text(seatColumns.name, y, bodySize, true, "Student")
+		doc.Text(seatColumns.class, y, bodySize, true, "Class")
+		doc.Text(seatColumns.signature, y, bodySize, true, "Signature")
+		y -= lineHeight
+	}
+	header()
+	for _, seat := range seats {
+		if y < bottomMargin {
+			doc.AddPage()
+			y = utils.PDFPageHeight - margin
+			header()
+		}
+		doc.Text(seatColumns.seat, y, bodySize, false, fmt.Sprint(seat.Seat))
+		doc.Text(seatColumns.position, y, bodySize, false, fmt.Sprintf("%d / %d", seat.Row, seat.Column))
+		doc.Text(seatColumns.name, y, bodySize, false, truncate(seat.LastName+", "+seat.FirstName, 34))
+		doc.Text(seatColumns.class, y, bodySize, false, truncate(seat.Class, 12))
+		doc.Line(seatColumns.signature, y-2, utils.PDFPageWidth-margin, y-2, 0.3)
+		y -= lineHeight
+	}
+	if len(seats) == 0 {
+		doc.Text(margin, y, bodySize, false, "No students are seated in this room.")
+	}
+
+	doc.Text(margin, margin-20, 8, false, "Generated by ClassConnect on "+time.Now().Format("2006-01-02"))
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// SeatingListFilename names the seating list of a room, e.g. 12-main-hall.pdf
+func SeatingListFilename(session models.ExamSession, room models.ExamSessionRoom) string {
+	name := strings.Trim(unsafeFilename.ReplaceAllString(room.Name, "-"), "-")
+	return fmt.Sprintf("%d-%s.pdf", session.Id, strings.ToLower(name))
+}
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "…"
+}
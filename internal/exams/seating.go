@@ -0,0 +1,176 @@
+package exams
+
+import (
+	"ClassConnect/internal/models"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrNotEnoughSeats is returned when the rooms of a session cannot seat every candidate
+var ErrNotEnoughSeats = errors.New("not enough seats")
+
+// Seat builds a seating plan for the candidates, whose student fields are set, across the rooms.
+// Each class is spread over the rooms in proportion to their capacity, then every room is filled front to back,
+// giving each seat to the class with the most students left that differs from the neighbours to the left and in
+// front. When no such class is left a seat stays empty if the room can spare it, otherwise the student is seated
+// next to a classmate
+func Seat(candidates []models.ExamSeat, rooms []models.ExamRoom) ([]models.ExamSeat, error) {
+	capacity := 0
+	for _, room := range rooms {
+		capacity += room.Capacity
+	}
+	if len(candidates) > capacity {
+		return nil, fmt.Errorf("%w: the rooms seat %d but %d students sit the exam", ErrNotEnoughSeats, capacity, len(candidates))
+	}
+
+	sorted := slices.Clone(candidates)
+	slices.SortFunc(sorted, func(a, b models.ExamSeat) int {
+		if c := strings.Compare(a.Class, b.Class); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.LastName, b.LastName); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.FirstName, b.FirstName); c != 0 {
+			return c
+		}
+		return a.StudentId - b.StudentId
+	})
+
+	shares := roomShares(len(sorted), rooms)
+	byRoom := make([][]models.ExamSeat, len(rooms))
+	for _, candidate := range sorted {
+		// The room furthest from its share takes the next student, so every class is spread evenly
+		best := -1
+		for i := range rooms {
+			if len(byRoom[i]) >= shares[i] {
+				continue
+			}
+			if best == -1 || len(byRoom[i])*shares[best] < len(byRoom[best])*shares[i] {
+				best = i
+			}
+		}
+		byRoom[best] = append(byRoom[best], candidate)
+	}
+
+	seats := make([]models.ExamSeat, 0, len(sorted))
+	for i, room := range rooms {
+		seats = append(seats, seatRoom(byRoom[i], room)...)
+	}
+	return seats, nil
+}
+
+// Adjacent counts the seats with a student of the same class right next to them on the left or right, or directly
+// in front or behind
+func Adjacent(seats []models.ExamSeat) int {
+	type position struct{ room, row, column int }
+	classes := make(map[position]string, len(seats))
+	for _, seat := range seats {
+		classes[position{seat.RoomId, seat.Row, seat.Column}] = seat.Class
+	}
+	count := 0
+	for _, seat := range seats {
+		for _, neighbour := range []position{
+			{seat.RoomId, seat.Row, seat.Column - 1}, {seat.RoomId, seat.Row, seat.Column + 1},
+			{seat.RoomId, seat.Row - 1, seat.Column}, {seat.RoomId, seat.Row + 1, seat.Column},
+		} {
+			if class, ok := classes[neighbour]; ok && class == seat.Class {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// roomShares splits n students over the rooms in proportion to their capacity
+func roomShares(n int, rooms []models.ExamRoom) []int {
+	capacity := 0
+	for _, room := range rooms {
+		capacity += room.Capacity
+	}
+	shares := make([]int, len(rooms))
+	if capacity == 0 {
+		return shares
+	}
+	left := n
+	for i, room := range rooms {
+		shares[i] = n * room.Capacity / capacity
+		left -= shares[i]
+	}
+	for left > 0 {
+		for i, room := range rooms {
+			if left > 0 && shares[i] < room.Capacity {
+				shares[i]++
+				left--
+			}
+		}
+	}
+	return shares
+}
+
+// seatRoom fills one room with its share of the students
+func seatRoom(students []models.ExamSeat, room models.ExamRoom) []models.ExamSeat {
+	perRow := room.SeatsPerRow
+	if perRow < 1 {
+		perRow = room.Capacity
+	}
+
+	queues := make(map[string][]models.ExamSeat)
+	classes := make([]string, 0)
+	for _, student := range students {
+		if _, ok := queues[student.Class]; !ok {
+			classes = append(classes, student.Class)
+		}
+		queues[student.Class] = append(queues[student.Class], student)
+	}
+	// pick returns the class with the most students left, other than the excluded ones
+	pick := func(exclude ...string) (string, bool) {
+		best, found := "", false
+		for _, class := range classes {
+			if len(queues[class]) == 0 || slices.Contains(exclude, class) {
+				continue
+			}
+			if !found || len(queues[class]) > len(queues[best]) {
+				best, found = class, true
+			}
+		}
+		return best, found
+	}
+
+	occupied := make([]*string, room.Capacity)
+	seats := make([]models.ExamSeat, 0, len(students))
+	remaining := len(students)
+	for i := 0; i < room.Capacity && remaining > 0; i++ {
+		row, column := i/perRow, i%perRow
+		neighbours := make([]string, 0, 2)
+		if column > 0 && occupied[i-1] != nil {
+			neighbours = append(neighbours, *occupied[i-1])
+		}
+		if row > 0 && occupied[i-perRow] != nil {
+			neighbours = append(neighbours, *occupied[i-perRow])
+		}
+
+		class, ok := pick(neighbours...)
+		if !ok {
+			if room.Capacity-i > remaining {
+				continue
+			}
+			class, _ = pick()
+		}
+
+		seat := queues[class][0]
+		queues[class] = queues[class][1:]
+		seat.RoomId = room.Id
+		seat.RoomName = room.Name
+		seat.Seat = i + 1
+		seat.Row = row + 1
+		seat.Column = column + 1
+		occupied[i] = &seat.Class
+		seats = append(seats, seat)
+		remaining--
+	}
+	return seats
+}
@@ -0,0 +1,149 @@
+package exams
+
+import (
+	"ClassConnect/internal/models"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSeat(t *testing.T) {
+	tests := []struct {
+		name         string
+		classes      string // the class of each candidate, one letter per student
+		rooms        []models.ExamRoom
+		wantPerRoom  []int
+		wantAdjacent int
+		wantErr      error
+	}{
+		{
+			name:        "checkerboard of two classes",
+			classes:     "AAAABBBB",
+			rooms:       []models.ExamRoom{{Id: 1, Capacity: 8, SeatsPerRow: 4}},
+			wantPerRoom: []int{8},
+		},
+		{
+			name:        "spare seats keep one class apart",
+			classes:     "AAA",
+			rooms:       []models.ExamRoom{{Id: 1, Capacity: 6, SeatsPerRow: 3}},
+			wantPerRoom: []int{3},
+		},
+		{
+			name:         "a full room of one class",
+			classes:      "AAAA",
+			rooms:        []models.ExamRoom{{Id: 1, Capacity: 4, SeatsPerRow: 2}},
+			wantPerRoom:  []int{4},
+			wantAdjacent: 4,
+		},
+		{
+			name:        "rooms share by capacity",
+			classes:     "AAABBB",
+			rooms:       []models.ExamRoom{{Id: 1, Capacity: 10, SeatsPerRow: 5}, {Id: 2, Capacity: 5, SeatsPerRow: 5}},
+			wantPerRoom: []int{4, 2},
+		},
+		{
+			name:        "no seats per row fills a single row",
+			classes:     "AB",
+			rooms:       []models.ExamRoom{{Id: 1, Capacity: 3}},
+			wantPerRoom: []int{2},
+		},
+		{
+			name:    "more students than seats",
+			classes: "AAAB",
+			rooms:   []models.ExamRoom{{Id: 1, Capacity: 2}, {Id: 2, Capacity: 1}},
+			wantErr: ErrNotEnoughSeats,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candidates := make([]models.ExamSeat, 0, len(test.classes))
+			for i, class := range test.classes {
+				candidates = append(candidates, models.ExamSeat{StudentId: i + 1, Class: string(class)})
+			}
+			seats, err := Seat(candidates, test.rooms)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Seat() error = %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			seated := make([]int, 0, len(seats))
+			perRoom := make([]int, len(test.rooms))
+			for _, seat := range seats {
+				seated = append(seated, seat.StudentId)
+				i := slices.IndexFunc(test.rooms, func(room models.ExamRoom) bool { return room.Id == seat.RoomId })
+				if i == -1 {
+					t.Fatalf("student %d seated in unknown room %d", seat.StudentId, seat.RoomId)
+				}
+				perRoom[i]++
+				room := test.rooms[i]
+				perRow := room.SeatsPerRow
+				if perRow < 1 {
+					perRow = room.Capacity
+				}
+				if seat.Seat < 1 || seat.Seat > room.Capacity || seat.Row != (seat.Seat-1)/perRow+1 || seat.Column != (seat.Seat-1)%perRow+1 {
+					t.Errorf("student %d at seat %d row %d column %d of a room of %d by %d", seat.StudentId, seat.Seat, seat.Row, seat.Column, room.Capacity, perRow)
+				}
+			}
+			slices.Sort(seated)
+			if len(seated) != len(candidates) || len(slices.Compact(seated)) != len(candidates) {
+				t.Errorf("Seat() seated %v, want every candidate once", seated)
+			}
+			if !slices.Equal(perRoom, test.wantPerRoom) {
+				t.Errorf("students per room = %v, want %v", perRoom, test.wantPerRoom)
+			}
+			if got := Adjacent(seats); got != test.wantAdjacent {
+				t.Errorf("Adjacent() = %d, want %d", got, test.wantAdjacent)
+			}
+		})
+	}
+}
+
+func TestAdjacent(t *testing.T) {
+	seat := func(room, row, column int, class string) models.ExamSeat {
+		return models.ExamSeat{RoomId: room, Row: row, Column: column, Class: class}
+	}
+	tests := []struct {
+		name  string
+		seats []models.ExamSeat
+		want  int
+	}{
+		{"side by side", []models.ExamSeat{seat(1, 1, 1, "A"), seat(1, 1, 2, "A")}, 2},
+		{"one behind the other", []models.ExamSeat{seat(1, 1, 1, "A"), seat(1, 2, 1, "A")}, 2},
+		{"diagonal", []models.ExamSeat{seat(1, 1, 1, "A"), seat(1, 2, 2, "A")}, 0},
+		{"different classes", []models.ExamSeat{seat(1, 1, 1, "A"), seat(1, 1, 2, "B")}, 0},
+		{"different rooms", []models.ExamSeat{seat(1, 1, 1, "A"), seat(2, 1, 2, "A")}, 0},
+		{"counted once per student", []models.ExamSeat{seat(1, 1, 2, "A"), seat(1, 1, 1, "A"), seat(1, 1, 3, "A"), seat(1, 2, 2, "A")}, 4},
+		{"no seats", nil, 0},
+	}
+	for _, test := range tests {
+		if got := Adjacent(test.seats); got != test.want {
+			t.Errorf("%s: Adjacent() = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRoomShares(t *testing.T) {
+	tests := []struct {
+		n          int
+		capacities []int
+		want       []int
+	}{
+		{5, []int{3, 3}, []int{3, 2}},
+		{6, []int{10, 5}, []int{4, 2}},
+		{7, []int{10, 1}, []int{7, 0}},
+		{3, []int{1, 1, 1}, []int{1, 1, 1}},
+		{0, []int{4}, []int{0}},
+		{2, []int{0}, []int{0}},
+	}
+	for _, test := range tests {
+		rooms := make([]models.ExamRoom, 0, len(test.capacities))
+		for _, capacity := range test.capacities {
+			rooms = append(rooms, models.ExamRoom{Capacity: capacity})
+		}
+		if got := roomShares(test.n, rooms); !slices.Equal(got, test.want) {
+			t.Errorf("roomShares(%d, %v) = %v, want %v", test.n, test.capacities, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package fees
+
+import (
+	"ClassConnect/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Invoice statuses, derived from the payments, the due date and whether the invoice was voided
+const (
+	StatusOpen          = "open"
+	StatusPartiallyPaid = "partially_paid"
+	StatusPaid          = "paid"
+	StatusOverdue       = "overdue"
+	StatusVoid          = "void"
+)
+
+// DateLayout is how issue, due and payment dates are written
+const DateLayout = "2006-01-02"
+
+var ErrGuardianNotFound = errors.New("guardian not found")
+
+// Columns are the columns Scan reads from Tables
+const Columns = "i.id, i.student_id, s.first_name, s.last_name, s.class, COALESCE(i.fee_structure_id, 0), COALESCE(f.name, ''), i.issue_date, i.due_date, i.total, " +
+	paid + ", COALESCE(i.notes, ''), i.reminders, COALESCE(i.last_reminded_at, ''), " +
+	"COALESCE(i.created_by, ''), i.created_at, COALESCE(i.voided_at, '')"
+
+// Tables are invoices i joined with their students s and fee_structures f
+const Tables = "invoices i JOIN students s ON s.id = i.student_id LEFT JOIN fee_structures f ON f.id = i.fee_structure_id"
+
+// paid is what has been paid against invoice i
+const paid = "COALESCE((SELECT SUM(p.amount) FROM fee_payments p WHERE p.invoice_id = i.id), 0)"
+
+// Load reads the invoices matching a condition on invoices i, students s and fee_structures f, by due date,
+// with their lines and amounts. Payments are only read by LoadPayments
+func Load(db *sql.DB, condition string, args ...any) ([]models.Invoice, error) {
+	rows, err := db.Query("SELECT "+Columns+" FROM "+Tables+" WHERE "+condition+" ORDER BY i.due_date, i.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := make([]models.Invoice, 0)
+	for rows.Next() {
+		invoice, err := Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, invoice)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return invoices, LoadLines(db, invoices)
+}
+
+// Scan reads a row of Columns
+func Scan(row interface{ Scan(dest ...any) error }) (models.Invoice, error) {
+	var invoice models.Invoice
+	err := row.Scan(&invoice.Id, &invoice.StudentId, &invoice.FirstName, &invoice.LastName, &invoice.Class, &invoice.FeeStructureId, &invoice.FeeStructure,
+		&invoice.IssueDate, &invoice.DueDate, &invoice.Total, &invoice.Paid, &invoice.Notes, &invoice.Reminders, &invoice.LastRemindedAt,
+		&invoice.CreatedBy, &invoice.CreatedAt, &invoice.VoidedAt,
+	)
+	invoice.Number = Number(invoice.Id)
+	invoice.Lines = make([]models.InvoiceLine, 0)
+	return invoice, err
+}
+
+// LoadLines reads the lines of scanned invoices and settles them
+func LoadLines(db *sql.DB, invoices []models.Invoice) error {
+	if len(invoices) == 0 {
+		return nil
+	}
+	byId := make(map[int]int, len(invoices))
+	ids := make([]any, 0, len(invoices))
+	for i, invoice := range invoices {
+		byId[invoice.Id] = i
+		ids = append(ids, invoice.Id)
+	}
+	lineRows, err := db.Query("SELECT invoice_id, kind, description, amount FROM invoice_lines WHERE invoice_id IN (?"+strings.Repeat(",?", len(ids)-1)+") ORDER BY id", ids...)
+	if err != nil {
+		return err
+	}
+	defer lineRows.Close()
+	for lineRows.Next() {
+		var id int
+		var line models.InvoiceLine
+		err = lineRows.Scan(&id, &line.Kind, &line.Description, &line.Amount)
+		if err != nil {
+			return err
+		}
+		invoice := &invoices[byId[id]]
+		invoice.Lines = append(invoice.Lines, line)
+	}
+	if err = lineRows.Err(); err != nil {
+		return err
+	}
+
+	today := time.Now().Format(DateLayout)
+	for i := range invoices {
+		Settle(&invoices[i], today)
+	}
+	return nil
+}
+
+// LoadPayments reads the payments of an invoice in the order they were made
+func LoadPayments(db *sql.DB, invoiceId int) ([]models.Payment, error) {
+	rows, err := db.Query("SELECT id, invoice_id, amount, method, COALESCE(reference, ''), paid_on, COALESCE(recorded_by, ''), created_at FROM fee_payments WHERE invoice_id = ? ORDER BY paid_on, id", invoiceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := make([]models.Payment, 0)
+	for rows.Next() {
+		var payment models.Payment
+		err = rows.Scan(&payment.Id, &payment.InvoiceId, &payment.Amount, &payment.Method, &payment.Reference, &payment.PaidOn, &payment.RecordedBy, &payment.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// StatusCondition is the condition on Tables matching the invoices Settle gives a status on the day, unpaid
+// matching every invoice still owed. It is empty for an unknown status
+func StatusCondition(status, today string) (string, []any) {
+	owed := "i.voided_at IS NULL AND i.total - " + paid + " > 0"
+	switch status {
+	case StatusVoid:
+		return "i.voided_at IS NOT NULL", nil
+	case StatusPaid:
+		return "i.voided_at IS NULL AND i.total - " + paid + " <= 0", nil
+	case StatusOverdue:
+		return owed + " AND i.due_date < ?", []any{today}
+	case StatusPartiallyPaid:
+		return owed + " AND i.due_date >= ? AND " + paid + " > 0", []any{today}
+	case StatusOpen:
+		return owed + " AND i.due_date >= ? AND " + paid + " <= 0", []any{today}
+	case "unpaid":
+		return owed, nil
+	}
+	return "", nil
+}
+
+// Settle works out the subtotal, discounts, balance and status of an invoice from its lines, total and payments
+func Settle(invoice *models.Invoice, today string) {
+	invoice.Subtotal, invoice.Discounts = 0, 0
+	for _, line := range invoice.Lines {
+		if line.Kind == "fee" {
+			invoice.Subtotal += line.Amount
+		} else {
+			invoice.Discounts += line.Amount
+		}
+	}
+	invoice.Subtotal = Round(invoice.Subtotal)
+	invoice.Discounts = Round(invoice.Discounts)
+	invoice.Balance = Round(invoice.Total - invoice.Paid)
+
+	switch {
+	case invoice.VoidedAt != "":
+		invoice.Status = StatusVoid
+	case invoice.Balance <= 0:
+		invoice.Status = StatusPaid
+	case invoice.DueDate < today:
+		invoice.Status = StatusOverdue
+	case invoice.Paid > 0:
+		invoice.Status = StatusPartiallyPaid
+	default:
+		invoice.Status = StatusOpen
+	}
+}
+
+// Total is what the lines of an invoice come to: the fees less the discounts, never below zero
+func Total(lines []models.InvoiceLine) float64 {
+	var total float64
+	for _, line := range lines {
+		if line.Kind == "fee" {
+			total += line.Amount
+		} else {
+			total -= line.Amount
+		}
+	}
+	return math.Max(Round(total), 0)
+}
+
+// Discount turns a student's standing discount into the invoice line taking it off fees worth subtotal
+func Discount(discount models.FeeDiscount, subtotal float64) models.InvoiceLine {
+	amount := discount.Amount
+	if discount.Percent > 0 {
+		amount = subtotal * discount.Percent / 100
+	}
+	description := discount.Description
+	if discount.Percent > 0 {
+		description = fmt.Sprintf("%s (%g%%)", description, discount.Percent)
+	}
+	return models.InvoiceLine{Kind: discount.Kind, Description: description, Amount: Round(math.Min(amount, subtotal))}
+}
+
+// Statement compiles what a guardian of the school owes across their children. Void invoices are left out
+func Statement(db *sql.DB, schoolId, guardianId int) (models.FeeStatement, error) {
+	statement := models.FeeStatement{GuardianId: guardianId, Students: make([]models.StudentStatement, 0), GeneratedAt: time.Now().UTC().Format(time.RFC3339)}
+	var firstName, lastName string
+	err := db.QueryRow("SELECT first_name, last_name, email FROM execs WHERE id = ? AND school_id = ? AND deleted_at IS NULL", guardianId, schoolId).Scan(
+		&firstName, &lastName, &statement.Email,
+	)
+	if err == sql.ErrNoRows {
+		return statement, ErrGuardianNotFound
+	} else if err != nil {
+		return statement, err
+	}
+	statement.Name = firstName + " " + lastName
+
+	invoices, err := Load(db, "i.voided_at IS NULL AND s.deleted_at IS NULL AND i.school_id = ? AND i.student_id IN (SELECT g.student_id FROM student_guardians g WHERE g.exec_id = ?)", schoolId, guardianId)
+	if err != nil {
+		return statement, err
+	}
+
+	rows, err := db.Query("SELECT s.id, s.first_name, s.last_name, s.class FROM student_guardians g JOIN students s ON s.id = g.student_id AND s.deleted_at IS NULL WHERE g.exec_id = ? ORDER BY s.first_name, s.id", guardianId)
+	if err != nil {
+		return statement, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		student := models.StudentStatement{Invoices: make([]models.Invoice, 0)}
+		err = rows.Scan(&student.StudentId, &student.FirstName, &student.LastName, &student.Class)
+		if err != nil {
+			return statement, err
+		}
+		for _, invoice := range invoices {
+			if invoice.StudentId != student.StudentId {
+				continue
+			}
+			student.Invoices = append(student.Invoices, invoice)
+			student.Balance += invoice.Balance
+			statement.Total += invoice.Total
+			statement.Paid += invoice.Paid
+			if invoice.Status == StatusOverdue {
+				statement.Overdue += invoice.Balance
+			}
+		}
+		student.Balance = Round(student.Balance)
+		statement.Students = append(statement.Students, student)
+	}
+	statement.Total = Round(statement.Total)
+	statement.Paid = Round(statement.Paid)
+	statement.Balance = Round(statement.Total - statement.Paid)
+	statement.Overdue = Round(statement.Overdue)
+	return statement, rows.Err()
+}
+
+// Number is the invoice number printed for an invoice ID
+func Number(id int) string {
+	return fmt.Sprintf("INV-%06d", id)
+}
+
+// Round rounds an amount to cents
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
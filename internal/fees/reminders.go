@@ -0,0 +1,109 @@
+package fees
+
+import (
+	"ClassConnect/internal/models"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultReminderDays = 7
+
+// Reminder is an overdue invoice to remind the guardians of the student about
+type Reminder struct {
+	SchoolId   int
+	Invoice    models.Invoice
+	Recipients []string
+}
+
+// ReminderInterval returns how long to wait between two reminders of the same invoice, FEE_REMINDER_DAYS days
+// (7 by default)
+func ReminderInterval() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("FEE_REMINDER_DAYS"))
+	if err != nil || days <= 0 {
+		days = defaultReminderDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// DueReminders lists the overdue invoices of every school whose guardians were not reminded within the interval.
+// Invoices of students without a guardian account are left out since there is nobody to write to
+func DueReminders(db *sql.DB, interval time.Duration) ([]Reminder, error) {
+	now := time.Now()
+	invoices, err := Load(db, "i.voided_at IS NULL AND s.deleted_at IS NULL AND i.due_date < ? AND (i.last_reminded_at IS NULL OR i.last_reminded_at < ?)",
+		now.Format(DateLayout), now.Add(-interval).Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	reminders := make([]Reminder, 0)
+	for _, invoice := range invoices {
+		if invoice.Status != StatusOverdue {
+			continue
+		}
+		reminder, err := ReminderFor(db, invoice)
+		if err != nil {
+			return nil, err
+		}
+		if len(reminder.Recipients) > 0 {
+			reminders = append(reminders, reminder)
+		}
+	}
+	return reminders, nil
+}
+
+// ReminderFor addresses a reminder about an invoice to the active guardian accounts of its student
+func ReminderFor(db *sql.DB, invoice models.Invoice) (Reminder, error) {
+	reminder := Reminder{Invoice: invoice, Recipients: make([]string, 0)}
+	err := db.QueryRow("SELECT school_id FROM invoices WHERE id = ?", invoice.Id).Scan(&reminder.SchoolId)
+	if err != nil {
+		return reminder, err
+	}
+	rows, err := db.Query("SELECT e.email FROM student_guardians g JOIN execs e ON e.id = g.exec_id WHERE g.student_id = ? AND e.deleted_at IS NULL AND e.inactive_status = FALSE ORDER BY e.id", invoice.StudentId)
+	if err != nil {
+		return reminder, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var email string
+		err = rows.Scan(&email)
+		if err != nil {
+			return reminder, err
+		}
+		reminder.Recipients = append(reminder.Recipients, email)
+	}
+	return reminder, rows.Err()
+}
+
+// MarkReminded records that the guardians were reminded about an invoice
+func MarkReminded(db *sql.DB, invoiceId int) error {
+	_, err := db.Exec("UPDATE invoices SET reminders = reminders + 1, last_reminded_at = NOW() WHERE id = ?", invoiceId)
+	return err
+}
+
+// ReminderEmail writes the subject and plain text body of a reminder
+func ReminderEmail(invoice models.Invoice) (string, string) {
+	subject := fmt.Sprintf("Payment reminder: invoice %s for %s %s", invoice.Number, invoice.FirstName, invoice.LastName)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Dear parent or guardian,\n\n")
+	fmt.Fprintf(&body, "Invoice %s for %s %s was due on %s and %.2f of its %.2f are still outstanding.\n\n",
+		invoice.Number, invoice.FirstName, invoice.LastName, invoice.DueDate, invoice.Balance, invoice.Total)
+	for _, line := range invoice.Lines {
+		amount := line.Amount
+		if line.Kind != "fee" {
+			amount = -amount
+		}
+		fmt.Fprintf(&body, "  %-40s %10.2f\n", line.Description, amount)
+	}
+	if invoice.Paid > 0 {
+		fmt.Fprintf(&body, "  %-40s %10.2f\n", "Paid", -invoice.Paid)
+	}
+	fmt.Fprintf(&body, "  %-40s %10.2f\n\n", "Balance", invoice.Balance)
+	fmt.Fprintf(&body, "Please settle the balance at your earliest convenience, or contact the school office if you have already paid.\n")
+	return subject, body.String()
+}
@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros are the shorthands accepted in place of the five fields
+var cronMacros = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// CronSpec is a parsed cron expression: minute, hour, day of month, month and day of week
+type CronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a "*" day field. As in cron, when both day fields are restricted either may match
+	domAny, dowAny bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseCron parses a standard five field cron expression such as "*/15 * * * *" or "0 3 * * 1-5", or one of
+// @hourly, @daily, @weekly, @monthly and @yearly. Sunday is 0 or 7
+func ParseCron(expr string) (CronSpec, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return CronSpec{}, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	sets := make([]uint64, len(cronFields))
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return CronSpec{}, err
+		}
+		sets[i] = set
+	}
+	// Sunday may be written as 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return CronSpec{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: parts[2] == "*", dowAny: parts[4] == "*",
+	}, nil
+}
+
+// parseCronField turns a comma separated list of *, n, a-b and any of them with a /step into a bit set
+func parseCronField(part string, field cronField) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(part, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q in the %s field", stepPart, field.name)
+			}
+		}
+
+		low, high := field.min, field.max
+		if rangePart != "*" {
+			lowStr, highStr, isRange := strings.Cut(rangePart, "-")
+			var err error
+			low, err = strconv.Atoi(lowStr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q in the %s field", rangePart, field.name)
+			}
+			high = low
+			if isRange {
+				high, err = strconv.Atoi(highStr)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %q in the %s field", rangePart, field.name)
+				}
+			} else if hasStep {
+				high = field.max
+			}
+			if low < field.min || high > field.max || low > high {
+				return 0, fmt.Errorf("%q is out of range for the %s field (%d-%d)", rangePart, field.name, field.min, field.max)
+			}
+		}
+
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+	return set, nil
+}
+
+// Matches reports whether the schedule fires in the minute of t
+func (c CronSpec) Matches(t time.Time) bool {
+	return c.minute&(1<<t.Minute()) != 0 && c.hour&(1<<t.Hour()) != 0 && c.month&(1<<int(t.Month())) != 0 && c.dayMatches(t)
+}
+
+func (c CronSpec) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<t.Day()) != 0
+	dowMatch := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first minute after t in which the schedule fires, or the zero time if it never does within five years,
+// as for February 30th
+func (c CronSpec) Next(t time.Time) time.Time {
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		switch {
+		case c.month&(1<<int(next.Month())) == 0:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+		case !c.dayMatches(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+		case c.hour&(1<<next.Hour()) == 0:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+		case c.minute&(1<<next.Minute()) == 0:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"*/15 * * * *", false},
+		{"0 3 * * 1-5", false},
+		{"0,30 8-17/2 1 1,7 0", false},
+		{"  @daily  ", false},
+		{"0 12 * * 7", false},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"*/x * * * *", true},
+		{"a * * * *", true},
+		{"1-b * * * *", true},
+		{"@every 5m", true},
+	}
+	for _, test := range tests {
+		_, err := ParseCron(test.expr)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseCron(%q) error = %v, wantErr %v", test.expr, err, test.wantErr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04:05", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string
+	}{
+		{"every quarter hour", "*/15 * * * *", "2026-03-10 10:07:30", "2026-03-10 10:15:00"},
+		{"strictly after the current minute", "30 9 * * *", "2026-03-10 09:30:00", "2026-03-11 09:30:00"},
+		{"rolls over the hour", "*/15 * * * *", "2026-03-10 10:59:59", "2026-03-10 11:00:00"},
+		{"weekdays skip the weekend", "0 3 * * 1-5", "2026-10-16 04:00:00", "2026-10-19 03:00:00"},
+		{"monthly rolls over the year", "@monthly", "2026-12-15 12:00:00", "2027-01-01 00:00:00"},
+		{"yearly", "@yearly", "2026-01-01 00:00:00", "2027-01-01 00:00:00"},
+		{"sunday written as 7", "0 12 * * 7", "2026-10-19 08:00:00", "2026-10-25 12:00:00"},
+		{"either restricted day field matches", "0 0 13 * 5", "2026-10-19 08:00:00", "2026-10-23 00:00:00"},
+		{"day of month alone", "0 0 13 * *", "2026-10-19 08:00:00", "2026-11-13 00:00:00"},
+		{"leap day", "0 0 29 2 *", "2026-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"range with a step", "0 8-17/4 * * *", "2026-03-10 12:01:00", "2026-03-10 16:00:00"},
+		{"never fires", "0 0 30 2 *", "2026-01-01 00:00:00", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := ParseCron(test.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error = %v", test.expr, err)
+			}
+			got := spec.Next(at(test.from))
+			if test.want == "" {
+				if !got.IsZero() {
+					t.Errorf("Next(%s) = %s, want the zero time", test.from, got)
+				}
+				return
+			}
+			if want := at(test.want); !got.Equal(want) {
+				t.Errorf("Next(%s) = %s, want %s", test.from, got, want)
+			}
+			if !spec.Matches(got) {
+				t.Errorf("Matches(%s) = false for the time Next returned", got)
+			}
+		})
+	}
+}
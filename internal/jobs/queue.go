@@ -0,0 +1,401 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Job statuses. A failed attempt puts the job back to queued until it runs out of attempts and becomes dead
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+	StatusCancelled = "cancelled"
+)
+
+const (
+	defaultMaxAttempts   = 5
+	defaultWorkers       = 4
+	defaultRetentionDays = 14
+	firstRetryDelay      = 10 * time.Second
+	maxRetryDelay        = time.Hour
+	// leaseDuration is how long a claimed job stays with its worker without a heartbeat, after which another worker
+	// may take it over
+	leaseDuration = 5 * time.Minute
+	pollInterval  = 2 * time.Second
+	// maxErrorLength fits the last_error column
+	maxErrorLength = 1000
+)
+
+// Job is a claimed job as handed to its handler
+type Job struct {
+	Id          int64
+	SchoolId    int
+	Type        string
+	Payload     json.RawMessage
+	Attempt     int
+	MaxAttempts int
+}
+
+// Final reports whether this is the last attempt, so a handler can record a failure for good
+func (j Job) Final() bool {
+	return j.Attempt >= j.MaxAttempts
+}
+
+// Handler runs a job. A returned error retries it later, unless it is marked Permanent
+type Handler func(ctx context.Context, job Job) error
+
+type registration struct {
+	handler     Handler
+	maxAttempts int
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+// wake nudges an idle worker when a job is queued so it does not wait for the next poll
+var wake = make(chan struct{}, 1)
+
+// instanceId tells the replicas apart in locked_by
+var instanceId = newInstanceId()
+
+// Register sets the handler of a job type and how many times it is attempted, 0 meaning the default of 5
+func Register(jobType string, maxAttempts int, handler Handler) {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[jobType] = registration{handler: handler, maxAttempts: maxAttempts}
+}
+
+func lookup(jobType string) (registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	reg, ok := registry[jobType]
+	return reg, ok
+}
+
+// permanentError fails a job without retrying it
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error that retrying cannot fix, such as a malformed payload. The job goes straight to dead
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Enqueue queues a job to run as soon as a worker is free and returns its ID.
+// schoolId 0 is a system job, createdBy may be empty
+func Enqueue(db *sql.DB, schoolId int, jobType string, payload any, createdBy string) (int64, error) {
+	id, _, err := enqueue(db, schoolId, jobType, payload, createdBy, time.Now(), "")
+	return id, err
+}
+
+// enqueue inserts a job due at runAt. A non-empty uniqueKey makes the insert a no-op when a job with the same key
+// exists, created reports which happened
+func enqueue(db *sql.DB, schoolId int, jobType string, payload any, createdBy string, runAt time.Time, uniqueKey string) (int64, bool, error) {
+	reg, ok := lookup(jobType)
+	if !ok {
+		return 0, false, fmt.Errorf("unknown job type %q", jobType)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, false, err
+	}
+
+	res, err := db.Exec(`INSERT INTO jobs(school_id, type, payload, max_attempts, run_at, unique_key, created_by) VALUES(?,?,?,?,?,?,?)
+		ON DUPLICATE KEY UPDATE id = id`,
+		nullable(schoolId), jobType, string(body), reg.maxAttempts, runAt.UTC(), nullableString(uniqueKey), nullableString(createdBy),
+	)
+	if err != nil {
+		return 0, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, false, nil
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, false, err
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return id, true, nil
+}
+
+// Retry queues a dead or cancelled job again with a fresh set of attempts. It reports false when the job is in another status
+func Retry(db *sql.DB, id int64) (bool, error) {
+	res, err := db.Exec("UPDATE jobs SET status = ?, attempts = 0, run_at = UTC_TIMESTAMP(6), locked_by = NULL, locked_until = NULL, finished_at = NULL WHERE id = ? AND status IN (?, ?)",
+		StatusQueued, id, StatusDead, StatusCancelled,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if n > 0 {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return n > 0, err
+}
+
+// Cancel stops a queued job from running. It reports false when the job is no longer queued
+func Cancel(db *sql.DB, id int64) (bool, error) {
+	res, err := db.Exec("UPDATE jobs SET status = ?, finished_at = UTC_TIMESTAMP(6) WHERE id = ? AND status = ?", StatusCancelled, id, StatusQueued)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Workers is the number of jobs each replica runs at once, from JOB_WORKERS
+func Workers() int {
+	workers, err := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	if err != nil || workers < 1 {
+		workers = defaultWorkers
+	}
+	return workers
+}
+
+// StartWorkers runs Workers() workers in the background. The queue lives in the database, so every replica can run
+// workers and a job claimed by a replica that dies is picked up again once its lease expires
+func StartWorkers(db *sql.DB) {
+	for range Workers() {
+		go func() {
+			ticker := time.NewTicker(pollInterval)
+			defer ticker.Stop()
+			for {
+				for {
+					ran, err := runNext(db)
+					if err != nil {
+						log.Println("Job worker error:", err)
+					}
+					if !ran {
+						break
+					}
+				}
+				select {
+				case <-ticker.C:
+				case <-wake:
+				}
+			}
+		}()
+	}
+}
+
+// runNext claims the next due job and runs it, reporting whether there was one
+func runNext(db *sql.DB) (bool, error) {
+	job, ok, err := claim(db)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	// Only a job whose worker died mid-run is claimed beyond its last attempt
+	if job.Attempt > job.MaxAttempts {
+		return true, finish(db, job, Permanent(errors.New("the worker running the last attempt stopped")))
+	}
+	reg, registered := lookup(job.Type)
+	if !registered {
+		return true, finish(db, job, Permanent(fmt.Errorf("no handler for job type %q", job.Type)))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan struct{})
+	go heartbeat(db, job.Id, stop, cancel)
+
+	jobErr := run(ctx, reg.handler, job)
+	close(stop)
+	cancel()
+	return true, finish(db, job, jobErr)
+}
+
+// run calls the handler, turning a panic into a failed attempt so one bad job cannot take the worker down
+func run(ctx context.Context, handler Handler, job Job) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// claim takes the oldest due job, or one whose worker stopped renewing its lease. Conditional updates make sure only
+// one worker of all replicas wins a job
+func claim(db *sql.DB) (Job, bool, error) {
+	rows, err := db.Query(`SELECT id FROM jobs WHERE (status = ? AND run_at <= UTC_TIMESTAMP(6)) OR (status = ? AND locked_until < UTC_TIMESTAMP(6))
+		ORDER BY run_at LIMIT 10`, StatusQueued, StatusRunning,
+	)
+	if err != nil {
+		return Job{}, false, err
+	}
+	candidates := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return Job{}, false, err
+		}
+		candidates = append(candidates, id)
+	}
+	rows.Close()
+
+	for _, id := range candidates {
+		res, err := db.Exec(`UPDATE jobs SET status = ?, attempts = attempts + 1, locked_by = ?, locked_until = UTC_TIMESTAMP(6) + INTERVAL ? SECOND,
+			started_at = COALESCE(started_at, UTC_TIMESTAMP(6))
+			WHERE id = ? AND ((status = ? AND run_at <= UTC_TIMESTAMP(6)) OR (status = ? AND locked_until < UTC_TIMESTAMP(6)))`,
+			StatusRunning, instanceId, int(leaseDuration/time.Second), id, StatusQueued, StatusRunning,
+		)
+		if err != nil {
+			return Job{}, false, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+
+		job := Job{Id: id}
+		var schoolId sql.NullInt64
+		var payload string
+		err = db.QueryRow("SELECT school_id, type, payload, attempts, max_attempts FROM jobs WHERE id = ?", id).Scan(
+			&schoolId, &job.Type, &payload, &job.Attempt, &job.MaxAttempts,
+		)
+		if err != nil {
+			return Job{}, false, err
+		}
+		job.SchoolId = int(schoolId.Int64)
+		job.Payload = json.RawMessage(payload)
+		return job, true, nil
+	}
+	return Job{}, false, nil
+}
+
+// heartbeat renews the lease of a running job until stop is closed, and cancels the job if the lease was lost
+func heartbeat(db *sql.DB, id int64, stop <-chan struct{}, cancel context.CancelFunc) {
+	ticker := time.NewTicker(leaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			res, err := db.Exec("UPDATE jobs SET locked_until = UTC_TIMESTAMP(6) + INTERVAL ? SECOND WHERE id = ? AND status = ? AND locked_by = ?",
+				int(leaseDuration/time.Second), id, StatusRunning, instanceId,
+			)
+			if err != nil {
+				log.Printf("Job %d heartbeat error: %v\n", id, err)
+				continue
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				log.Printf("Job %d lost its lease, stopping it\n", id)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// finish records the outcome of an attempt: succeeded, queued again after a backoff, or dead
+func finish(db *sql.DB, job Job, jobErr error) error {
+	var err error
+	var permanent permanentError
+	switch {
+	case jobErr == nil:
+		_, err = db.Exec("UPDATE jobs SET status = ?, last_error = NULL, locked_by = NULL, locked_until = NULL, finished_at = UTC_TIMESTAMP(6) WHERE id = ? AND locked_by = ?",
+			StatusSucceeded, job.Id, instanceId,
+		)
+	case job.Final() || errors.As(jobErr, &permanent):
+		log.Printf("Job %d (%s) is dead after %d attempts: %v\n", job.Id, job.Type, job.Attempt, jobErr)
+		_, err = db.Exec("UPDATE jobs SET status = ?, last_error = ?, locked_by = NULL, locked_until = NULL, finished_at = UTC_TIMESTAMP(6) WHERE id = ? AND locked_by = ?",
+			StatusDead, truncate(jobErr.Error()), job.Id, instanceId,
+		)
+	default:
+		_, err = db.Exec("UPDATE jobs SET status = ?, last_error = ?, locked_by = NULL, locked_until = NULL, run_at = UTC_TIMESTAMP(6) + INTERVAL ? SECOND WHERE id = ? AND locked_by = ?",
+			StatusQueued, truncate(jobErr.Error()), int(RetryDelay(job.Attempt)/time.Second), job.Id, instanceId,
+		)
+	}
+	return err
+}
+
+// Retention is how long succeeded and cancelled jobs are kept, from JOB_RETENTION_DAYS. Dead jobs are kept until
+// they are retried
+func Retention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("JOB_RETENTION_DAYS"))
+	if err != nil || days < 1 {
+		days = defaultRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Cleanup deletes succeeded and cancelled jobs that finished more than retention ago
+func Cleanup(db *sql.DB, retention time.Duration) (int64, error) {
+	res, err := db.Exec("DELETE FROM jobs WHERE status IN (?, ?) AND finished_at < UTC_TIMESTAMP(6) - INTERVAL ? SECOND",
+		StatusSucceeded, StatusCancelled, int64(retention/time.Second),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RetryDelay is the wait after a failed attempt: 10s, 20s, 40s and so on, capped at an hour
+func RetryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func newInstanceId() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+func nullable(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func nullableString(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func truncate(text string) string {
+	if len(text) > maxErrorLength {
+		return text[:maxErrorLength]
+	}
+	return text
+}
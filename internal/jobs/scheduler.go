@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schedulerTick is well under a minute so that no minute is skipped
+const schedulerTick = 15 * time.Second
+
+// Schedule is a recurring task: the job of Type is queued every time Spec fires, in the server's time zone
+type Schedule struct {
+	Name string
+	Spec string
+	Type string
+	cron CronSpec
+}
+
+// Next is the next time the schedule fires after t
+func (s Schedule) Next(t time.Time) time.Time {
+	return s.cron.Next(t)
+}
+
+var (
+	schedulesMu sync.RWMutex
+	schedules   = make([]Schedule, 0)
+)
+
+// AddSchedule registers a recurring job. The job type must be registered as well
+func AddSchedule(name, spec, jobType string) error {
+	cron, err := ParseCron(spec)
+	if err != nil {
+		return fmt.Errorf("schedule %s: %w", name, err)
+	}
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	schedules = append(schedules, Schedule{Name: name, Spec: spec, Type: jobType, cron: cron})
+	return nil
+}
+
+// Schedules lists the registered schedules by name
+func Schedules() []Schedule {
+	schedulesMu.RLock()
+	defer schedulesMu.RUnlock()
+	list := slices.Clone(schedules)
+	slices.SortFunc(list, func(a, b Schedule) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+// StartScheduler queues the scheduled jobs as they fall due. Every replica runs the scheduler, and each run is queued
+// under a unique key made of the schedule and the minute it is for, so only the first replica to get there creates it
+func StartScheduler(db *sql.DB) {
+	go func() {
+		last := time.Now().Truncate(time.Minute).Add(-time.Minute)
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			now := time.Now().Truncate(time.Minute)
+			// Walking every minute since the last tick catches up on minutes a slow tick or a paused process missed
+			for minute := last.Add(time.Minute); !minute.After(now); minute = minute.Add(time.Minute) {
+				for _, schedule := range Schedules() {
+					if schedule.cron.Matches(minute) {
+						queueRun(db, schedule, minute)
+					}
+				}
+				last = minute
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func queueRun(db *sql.DB, schedule Schedule, minute time.Time) {
+	key := fmt.Sprintf("schedule:%s:%d", schedule.Name, minute.Unix())
+	id, created, err := enqueue(db, 0, schedule.Type, map[string]any{"schedule": schedule.Name, "scheduled_for": minute.UTC()}, "scheduler", minute, key)
+	if err != nil {
+		log.Printf("Error queueing scheduled job %s: %v\n", schedule.Name, err)
+	} else if created {
+		log.Printf("Queued scheduled job %s as job %d\n", schedule.Name, id)
+	}
+}
@@ -0,0 +1,97 @@
+package leave
+
+import (
+	"ClassConnect/internal/calendar"
+	"ClassConnect/internal/models"
+	"database/sql"
+	"time"
+)
+
+// Apply reflects approved leave in the rest of the school. Student leave excuses the student on each school day of
+// the leave, turning absences already recorded into excused ones but leaving days the student was present or late
+// alone. Teacher leave lists the class and subject of the teacher, and the exams they invigilate, as needing cover
+func Apply(tx *sql.Tx, schoolId int, request models.LeaveRequest, days []string, username string) error {
+	if request.Kind == KindStudent {
+		for _, day := range days {
+			// The assignments run in order, so leave_id and updated_by still see the status before the update
+			_, err := tx.Exec(`INSERT INTO attendance(school_id, student_id, date, status, updated_by, leave_id) VALUES(?,?,?,'excused',?,?)
+				ON DUPLICATE KEY UPDATE leave_id = IF(status IN ('absent', 'excused'), VALUES(leave_id), leave_id),
+				updated_by = IF(status = 'absent', VALUES(updated_by), updated_by), status = IF(status = 'absent', 'excused', status)`,
+				schoolId, request.StudentId, day, username, request.Id,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var class, subject string
+	err := tx.QueryRow("SELECT class, subject FROM teachers WHERE id = ?", request.TeacherId).Scan(&class, &subject)
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		_, err = tx.Exec("INSERT INTO leave_cover(school_id, leave_id, teacher_id, date, class, subject) VALUES(?,?,?,?,?,?)",
+			schoolId, request.Id, request.TeacherId, day, class, subject,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO leave_cover(school_id, leave_id, teacher_id, date, subject, exam_session_id)
+		SELECT ?, ?, i.teacher_id, DATE(s.starts_at), s.course, s.id FROM exam_invigilators i JOIN exam_sessions s ON s.id = i.session_id
+		WHERE i.teacher_id = ? AND s.starts_at >= ? AND s.starts_at < ? + INTERVAL 1 DAY`,
+		schoolId, request.Id, request.TeacherId, request.StartDate, request.EndDate,
+	)
+	return err
+}
+
+// Revert undoes what Apply did for leave that is cancelled. Days still to come lose the excused attendance written
+// ahead of them, and days gone by are absences again since the student was away without leave
+func Revert(tx *sql.Tx, request models.LeaveRequest) error {
+	if request.Kind == KindTeacher {
+		_, err := tx.Exec("DELETE FROM leave_cover WHERE leave_id = ?", request.Id)
+		return err
+	}
+	today := time.Now().Format(calendar.DateLayout)
+	_, err := tx.Exec("DELETE FROM attendance WHERE leave_id = ? AND date >= ?", request.Id, today)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE attendance SET status = 'absent', leave_id = NULL WHERE leave_id = ?", request.Id)
+	return err
+}
+
+// Covering maps the days between from and to on which a student is on approved leave to the leave's ID
+func Covering(db *sql.DB, studentId int, from, to string) (map[string]int, error) {
+	rows, err := db.Query("SELECT id, start_date, end_date FROM leave_requests WHERE student_id = ? AND status = ? AND start_date <= ? AND end_date >= ?",
+		studentId, StatusApproved, to, from,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	covered := make(map[string]int)
+	for rows.Next() {
+		var id int
+		var start, end string
+		err = rows.Scan(&id, &start, &end)
+		if err != nil {
+			return nil, err
+		}
+		first, err := time.Parse(calendar.DateLayout, start)
+		if err != nil {
+			return nil, err
+		}
+		last, err := time.Parse(calendar.DateLayout, end)
+		if err != nil {
+			return nil, err
+		}
+		for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+			covered[day.Format(calendar.DateLayout)] = id
+		}
+	}
+	return covered, rows.Err()
+}
@@ -0,0 +1,260 @@
+package leave
+
+import (
+	"ClassConnect/internal/calendar"
+	"ClassConnect/internal/models"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Kinds of leave
+const (
+	KindTeacher = "teacher"
+	KindStudent = "student"
+)
+
+// Statuses of requests and of the steps of their approval chain
+const (
+	StatusPending   = "pending"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+	StatusCancelled = "cancelled"
+	StatusWaiting   = "waiting"
+)
+
+// RoleTeacher in a chain is approved by the teachers of the student's class rather than by a role
+const RoleTeacher = "teacher"
+
+// MaxSteps is the length of the longest approval chain
+const MaxSteps = 5
+
+// MaxDays is the longest range a request may cover, in calendar days
+const MaxDays = 90
+
+// defaultChains are the chains of schools that did not configure their own: the class teacher approves student
+// leave and a manager approves teacher leave
+var defaultChains = map[string][]string{
+	KindStudent: {RoleTeacher},
+	KindTeacher: {"manager"},
+}
+
+var ErrLeaveNotFound = errors.New("leave request not found")
+
+// Columns are the columns Scan reads from Tables
+const Columns = "l.id, l.kind, COALESCE(l.teacher_id, 0), COALESCE(l.student_id, 0), TRIM(CONCAT(COALESCE(t.first_name, s.first_name, ''), ' ', COALESCE(t.last_name, s.last_name, ''))), " +
+	"COALESCE(t.class, s.class, ''), l.start_date, l.end_date, l.days, l.reason, l.status, l.step, COALESCE(l.requested_by, ''), COALESCE(l.requested_by_id, 0), l.created_at, COALESCE(l.decided_at, '')"
+
+// Tables are leave_requests l joined with teachers t and students s, the teacher or student on leave
+const Tables = "leave_requests l LEFT JOIN teachers t ON t.id = l.teacher_id LEFT JOIN students s ON s.id = l.student_id"
+
+// Chains returns the approval chain of each kind of leave of a school
+func Chains(db *sql.DB, schoolId int) ([]models.LeaveChain, error) {
+	configured := make(map[string][]string)
+	rows, err := db.Query("SELECT kind, steps FROM leave_chains WHERE school_id = ?", schoolId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, steps string
+		err = rows.Scan(&kind, &steps)
+		if err != nil {
+			return nil, err
+		}
+		configured[kind] = splitSteps(steps)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	chains := make([]models.LeaveChain, 0, 2)
+	for _, kind := range []string{KindStudent, KindTeacher} {
+		steps, ok := configured[kind]
+		if !ok {
+			chains = append(chains, models.LeaveChain{Kind: kind, Steps: defaultChains[kind], Default: true})
+			continue
+		}
+		chains = append(chains, models.LeaveChain{Kind: kind, Steps: steps})
+	}
+	return chains, nil
+}
+
+// Chain returns the approval chain of a kind of leave of a school
+func Chain(db *sql.DB, schoolId int, kind string) ([]string, error) {
+	chains, err := Chains(db, schoolId)
+	if err != nil {
+		return nil, err
+	}
+	for _, chain := range chains {
+		if chain.Kind == kind {
+			return chain.Steps, nil
+		}
+	}
+	return nil, nil
+}
+
+// JoinSteps writes the roles of a chain as they are stored
+func JoinSteps(steps []string) string {
+	return strings.Join(steps, ",")
+}
+
+func splitSteps(steps string) []string {
+	if steps == "" {
+		return []string{}
+	}
+	return strings.Split(steps, ",")
+}
+
+// Load reads the requests matching a condition on leave_requests l, teachers t and students s, latest start first,
+// with their approvals and the cover of teacher leave
+func Load(db *sql.DB, condition string, args ...any) ([]models.LeaveRequest, error) {
+	rows, err := db.Query("SELECT "+Columns+" FROM "+Tables+" WHERE "+condition+" ORDER BY l.start_date DESC, l.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]models.LeaveRequest, 0)
+	for rows.Next() {
+		request, err := Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return requests, LoadDetails(db, requests)
+}
+
+// Scan reads a row of Columns
+func Scan(row interface{ Scan(dest ...any) error }) (models.LeaveRequest, error) {
+	var request models.LeaveRequest
+	err := row.Scan(&request.Id, &request.Kind, &request.TeacherId, &request.StudentId, &request.Name, &request.Class, &request.StartDate, &request.EndDate,
+		&request.Days, &request.Reason, &request.Status, &request.Step, &request.RequestedBy, &request.RequestedById, &request.CreatedAt, &request.DecidedAt,
+	)
+	request.Approvals = make([]models.LeaveApproval, 0)
+	return request, err
+}
+
+// LoadDetails reads the approvals of scanned requests and the cover of teacher leave
+func LoadDetails(db *sql.DB, requests []models.LeaveRequest) error {
+	if len(requests) == 0 {
+		return nil
+	}
+	byId := make(map[int]int, len(requests))
+	ids := make([]any, 0, len(requests))
+	for i, request := range requests {
+		byId[request.Id] = i
+		ids = append(ids, request.Id)
+	}
+	placeholders := "(?" + strings.Repeat(",?", len(ids)-1) + ")"
+
+	approvalRows, err := db.Query("SELECT leave_id, position, role, status, COALESCE(decided_by, ''), COALESCE(comment, ''), COALESCE(decided_at, '') FROM leave_approvals WHERE leave_id IN "+
+		placeholders+" ORDER BY position", ids...)
+	if err != nil {
+		return err
+	}
+	defer approvalRows.Close()
+	for approvalRows.Next() {
+		var id int
+		var approval models.LeaveApproval
+		err = approvalRows.Scan(&id, &approval.Position, &approval.Role, &approval.Status, &approval.DecidedBy, &approval.Comment, &approval.DecidedAt)
+		if err != nil {
+			return err
+		}
+		request := &requests[byId[id]]
+		request.Approvals = append(request.Approvals, approval)
+	}
+	if err = approvalRows.Err(); err != nil {
+		return err
+	}
+
+	cover, err := LoadCover(db, "c.leave_id IN "+placeholders, ids...)
+	if err != nil {
+		return err
+	}
+	for _, lesson := range cover {
+		request := &requests[byId[lesson.LeaveId]]
+		request.Cover = append(request.Cover, lesson)
+	}
+	return nil
+}
+
+// LoadOne reads one request by ID
+func LoadOne(db *sql.DB, id int) (models.LeaveRequest, error) {
+	requests, err := Load(db, "l.id = ?", id)
+	if err != nil {
+		return models.LeaveRequest{}, err
+	}
+	if len(requests) == 0 {
+		return models.LeaveRequest{}, ErrLeaveNotFound
+	}
+	return requests[0], nil
+}
+
+// CoverColumns are the columns ScanCover reads from CoverTables
+const CoverColumns = "c.id, c.leave_id, c.teacher_id, TRIM(CONCAT(t.first_name, ' ', t.last_name)), c.date, COALESCE(c.class, ''), COALESCE(c.subject, ''), " +
+	"COALESCE(c.exam_session_id, 0), COALESCE(c.substitute_id, 0), COALESCE(TRIM(CONCAT(sub.first_name, ' ', sub.last_name)), '')"
+
+// CoverTables are leave_cover c joined with the teacher on leave t and the substitute sub
+const CoverTables = "leave_cover c JOIN teachers t ON t.id = c.teacher_id LEFT JOIN teachers sub ON sub.id = c.substitute_id"
+
+// LoadCover reads the cover matching a condition on leave_cover c, by date
+func LoadCover(db *sql.DB, condition string, args ...any) ([]models.LeaveCover, error) {
+	rows, err := db.Query("SELECT "+CoverColumns+" FROM "+CoverTables+" WHERE "+condition+" ORDER BY c.date, c.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cover := make([]models.LeaveCover, 0)
+	for rows.Next() {
+		lesson, err := ScanCover(rows)
+		if err != nil {
+			return nil, err
+		}
+		cover = append(cover, lesson)
+	}
+	return cover, rows.Err()
+}
+
+// ScanCover reads a row of CoverColumns
+func ScanCover(row interface{ Scan(dest ...any) error }) (models.LeaveCover, error) {
+	var lesson models.LeaveCover
+	err := row.Scan(&lesson.Id, &lesson.LeaveId, &lesson.TeacherId, &lesson.TeacherName, &lesson.Date, &lesson.Class, &lesson.Subject,
+		&lesson.ExamSessionId, &lesson.SubstituteId, &lesson.SubstituteName,
+	)
+	return lesson, err
+}
+
+// SchoolDays lists the days between from and to, both YYYY-MM-DD dates and both included, on which the school is open
+func SchoolDays(db *sql.DB, schoolId int, from, to string) ([]string, error) {
+	first, err := time.Parse(calendar.DateLayout, from)
+	if err != nil {
+		return nil, err
+	}
+	last, err := time.Parse(calendar.DateLayout, to)
+	if err != nil {
+		return nil, err
+	}
+	closed, err := calendar.NonSchoolDays(db, schoolId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	skip := make(map[string]bool, len(closed))
+	for _, day := range closed {
+		skip[day.Date] = true
+	}
+
+	days := make([]string, 0)
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		if date := day.Format(calendar.DateLayout); !skip[date] {
+			days = append(days, date)
+		}
+	}
+	return days, nil
+}
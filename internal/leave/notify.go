@@ -0,0 +1,96 @@
+package leave
+
+import (
+	"ClassConnect/internal/models"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Approvers lists the emails of the active accounts that may approve the pending step of a request: the accounts with
+// the step's role or, for a teacher step, the accounts of the teachers of the student's class
+func Approvers(db *sql.DB, schoolId int, request models.LeaveRequest) ([]string, error) {
+	if request.Status != StatusPending || request.Step >= len(request.Approvals) {
+		return []string{}, nil
+	}
+	role := request.Approvals[request.Step].Role
+
+	query := "SELECT email FROM execs WHERE school_id = ? AND role = ? AND inactive_status = FALSE AND deleted_at IS NULL"
+	args := []any{schoolId, role}
+	if role == RoleTeacher {
+		query = `SELECT DISTINCT e.email FROM execs e JOIN teachers t ON t.email = e.email AND t.school_id = e.school_id AND t.deleted_at IS NULL
+			WHERE e.school_id = ? AND t.class = ? AND e.inactive_status = FALSE AND e.deleted_at IS NULL`
+		args = []any{schoolId, request.Class}
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := make([]string, 0)
+	for rows.Next() {
+		var email string
+		err = rows.Scan(&email)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+// Requester returns the email of the account that made a request, empty when it no longer exists
+func Requester(db *sql.DB, request models.LeaveRequest) (string, error) {
+	var email string
+	err := db.QueryRow("SELECT email FROM execs WHERE id = ? AND deleted_at IS NULL", request.RequestedById).Scan(&email)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return email, err
+}
+
+// StatusEmail writes the subject and plain text body of the email telling the requester where their request stands
+func StatusEmail(request models.LeaveRequest) (string, string) {
+	var news string
+	switch request.Status {
+	case StatusPending:
+		news = fmt.Sprintf("is waiting for the approval of the %s", describeRole(request.Approvals[request.Step].Role))
+	case StatusApproved:
+		news = "was approved"
+	case StatusRejected:
+		news = "was rejected"
+	case StatusCancelled:
+		news = "was cancelled"
+	}
+	subject := fmt.Sprintf("Leave of %s from %s to %s: %s", request.Name, request.StartDate, request.EndDate, request.Status)
+	body := fmt.Sprintf("The leave request of %s from %s to %s (%d school days) %s.\n", request.Name, request.StartDate, request.EndDate, request.Days, news)
+	if comment := lastComment(request); comment != "" {
+		body += "\nComment: " + comment + "\n"
+	}
+	return subject, body
+}
+
+// ApprovalEmail writes the subject and plain text body of the email asking approvers to decide on a request
+func ApprovalEmail(request models.LeaveRequest) (string, string) {
+	subject := fmt.Sprintf("Leave request of %s awaiting your approval", request.Name)
+	body := fmt.Sprintf("%s asked for leave for %s from %s to %s (%d school days).\n\nReason: %s\n\nApprove or reject it with POST /leave/requests/%d/approve or /reject.\n",
+		request.RequestedBy, request.Name, request.StartDate, request.EndDate, request.Days, request.Reason, request.Id)
+	return subject, body
+}
+
+func describeRole(role string) string {
+	if role == RoleTeacher {
+		return "class teacher"
+	}
+	return strings.ReplaceAll(role, "_", " ")
+}
+
+func lastComment(request models.LeaveRequest) string {
+	for i := len(request.Approvals) - 1; i >= 0; i-- {
+		if request.Approvals[i].Comment != "" {
+			return request.Approvals[i].Comment
+		}
+	}
+	return ""
+}
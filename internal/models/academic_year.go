@@ -0,0 +1,71 @@
+package models
+
+// AcademicYear is a school year such as "2024-2025", dates use the YYYY-MM-DD format
+type AcademicYear struct {
+	Id        int    `json:"id,omitempty"`
+	Name      string `json:"name"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	IsCurrent bool   `json:"is_current"`
+}
+
+// Term is a period within an academic year
+type Term struct {
+	Id             int    `json:"id,omitempty"`
+	AcademicYearId int    `json:"academic_year_id"`
+	Name           string `json:"name"`
+	StartDate      string `json:"start_date"`
+	EndDate        string `json:"end_date"`
+}
+
+// ClassSection is a class as it exists in one academic year.
+// NextClass names the class its students move up to, empty for a final year class whose students graduate
+type ClassSection struct {
+	Id             int    `json:"id,omitempty"`
+	AcademicYearId int    `json:"academic_year_id"`
+	Name           string `json:"name"`
+	NextClass      string `json:"next_class,omitempty"`
+}
+
+// Enrollment records which class a student attended in an academic year and how the year ended
+type Enrollment struct {
+	Id             int    `json:"id"`
+	StudentId      int    `json:"student_id"`
+	AcademicYearId int    `json:"academic_year_id"`
+	Class          string `json:"class"`
+	Status         string `json:"status"`
+	CreatedAt      string `json:"created_at,omitempty"`
+	ArchivedAt     string `json:"archived_at,omitempty"`
+}
+
+// PromotionRequest moves the students of one class from an academic year into the next one
+type PromotionRequest struct {
+	Class    string `json:"class"`
+	ToYearId int    `json:"to_year_id"`
+	HoldBack []int  `json:"hold_back"`
+	Graduate []int  `json:"graduate"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+// PromotionMove is the outcome of a promotion for one student
+type PromotionMove struct {
+	StudentId int    `json:"student_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	FromClass string `json:"from_class"`
+	ToClass   string `json:"to_class,omitempty"`
+	Outcome   string `json:"outcome"`
+}
+
+// PromotionResult summarises a promotion, or what it would do in dry-run mode
+type PromotionResult struct {
+	Status     string          `json:"status"`
+	Class      string          `json:"class"`
+	FromYearId int             `json:"from_year_id"`
+	ToYearId   int             `json:"to_year_id"`
+	DryRun     bool            `json:"dry_run"`
+	Promoted   int             `json:"promoted"`
+	HeldBack   int             `json:"held_back"`
+	Graduated  int             `json:"graduated"`
+	Moves      []PromotionMove `json:"moves"`
+}
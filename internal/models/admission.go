@@ -0,0 +1,83 @@
+package models
+
+// Application is a request to admit a student, from submission to its conversion into a Student. Status is submitted,
+// under_review, interview, offered, accepted, rejected or waitlisted
+type Application struct {
+	Id             int                   `json:"id,omitempty"`
+	Reference      string                `json:"reference,omitempty"`
+	Status         string                `json:"status,omitempty"`
+	FirstName      string                `json:"first_name"`
+	LastName       string                `json:"last_name"`
+	DateOfBirth    string                `json:"date_of_birth"`
+	Email          string                `json:"email"`
+	Class          string                `json:"class"`
+	AcademicYearId int                   `json:"academic_year_id,omitempty"`
+	PreviousSchool string                `json:"previous_school,omitempty"`
+	Guardians      []ApplicationGuardian `json:"guardians"`
+	AssignedTo     int                   `json:"assigned_to,omitempty"`
+	AssignedName   string                `json:"assigned_name,omitempty"`
+	StudentId      int                   `json:"student_id,omitempty"`
+	Documents      []ApplicationDocument `json:"documents"`
+	Notes          []ApplicationNote     `json:"notes,omitempty"`
+	History        []ApplicationStage    `json:"history,omitempty"`
+	SubmittedAt    string                `json:"submitted_at,omitempty"`
+	UpdatedAt      string                `json:"updated_at,omitempty"`
+	ConvertedAt    string                `json:"converted_at,omitempty"`
+}
+
+// ApplicationGuardian is a parent or guardian named on an application, the first one is contacted about it
+type ApplicationGuardian struct {
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone,omitempty"`
+	Relationship string `json:"relationship,omitempty"`
+}
+
+// ApplicationDocument describes a file uploaded with an application, its content is only served on download
+type ApplicationDocument struct {
+	Id          int    `json:"id"`
+	Kind        string `json:"kind"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	UploadedAt  string `json:"uploaded_at"`
+}
+
+// ApplicationNote is a remark of a reviewer, never shown to the applicant
+type ApplicationNote struct {
+	Id        int    `json:"id"`
+	Author    string `json:"author"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ApplicationStage records a move of an application from one status to another
+type ApplicationStage struct {
+	From      string `json:"from,omitempty"`
+	To        string `json:"to"`
+	Reason    string `json:"reason,omitempty"`
+	ChangedBy string `json:"changed_by,omitempty"`
+	ChangedAt string `json:"changed_at"`
+}
+
+// ApplicationReceipt is what applicants see of their application, looked up by its reference
+type ApplicationReceipt struct {
+	Reference   string `json:"reference"`
+	Status      string `json:"status"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Class       string `json:"class"`
+	Documents   int    `json:"documents"`
+	SubmittedAt string `json:"submitted_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// Admission is the outcome of converting an accepted application: the new student, the guardian accounts linked to it,
+// and the emails of the accounts created for guardians who had none and were invited to set a password
+type Admission struct {
+	Application Application `json:"application"`
+	Student     Student     `json:"student"`
+	Guardians   []Guardian  `json:"guardians"`
+	Invited     []string    `json:"invited"`
+}
@@ -0,0 +1,38 @@
+package models
+
+// Announcement is a message published to an audience within a school.
+// PublishAt and ExpireAt are RFC 3339 timestamps; an announcement without ExpireAt stays in the feed
+type Announcement struct {
+	Id          int          `json:"id,omitempty"`
+	Title       string       `json:"title"`
+	Body        string       `json:"body"`
+	Attachments []Attachment `json:"attachments"`
+	Audiences   []Audience   `json:"audiences"`
+	PublishAt   string       `json:"publish_at,omitempty"`
+	ExpireAt    string       `json:"expire_at,omitempty"`
+	CreatedBy   string       `json:"created_by,omitempty"`
+	CreatedAt   string       `json:"created_at,omitempty"`
+	ReadCount   int          `json:"read_count"`
+	// Read is set in the feed, telling whether the caller has read the announcement
+	Read *bool `json:"read,omitempty"`
+}
+
+// Attachment links a file to an announcement or a message
+type Attachment struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Audience selects who an announcement is for. Type is one of all, role, class, course or user;
+// Value holds the role, class, subject or exec ID and is empty for all
+type Audience struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
+
+// ReadReceipt records that a user has read an announcement
+type ReadReceipt struct {
+	UserId   int    `json:"user_id"`
+	Username string `json:"username"`
+	ReadAt   string `json:"read_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "encoding/json"
+
+// AuditEntry is one immutable record in the audit log.
+// Each entry's hash covers its own content and the previous entry's hash, forming a tamper-evident chain
+type AuditEntry struct {
+	Id            int                       `json:"id"`
+	SchoolId      int                       `json:"school_id,omitempty"`
+	ActorId       string                    `json:"actor_id,omitempty"`
+	ActorUsername string                    `json:"actor_username,omitempty"`
+	ActorRole     string                    `json:"actor_role,omitempty"`
+	Action        string                    `json:"action"`
+	Resource      string                    `json:"resource"`
+	ResourceId    string                    `json:"resource_id,omitempty"`
+	Before        json.RawMessage           `json:"before,omitempty"`
+	After         json.RawMessage           `json:"after,omitempty"`
+	Diff          map[string]AuditFieldDiff `json:"diff,omitempty"`
+	IP            string                    `json:"ip,omitempty"`
+	RequestId     string                    `json:"request_id,omitempty"`
+	CreatedAt     string                    `json:"created_at"`
+	PrevHash      string                    `json:"prev_hash"`
+	Hash          string                    `json:"hash"`
+}
+
+// AuditFieldDiff holds the old and new value of a changed field
+type AuditFieldDiff struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// BulkItemResult reports the outcome of a single item in a bulk create request
+type BulkItemResult struct {
+	Index int    `json:"index"`
+	Id    int    `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
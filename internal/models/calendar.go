@@ -0,0 +1,34 @@
+package models
+
+// CalendarEvent is a dated entry of a school's calendar: an event, a holiday, an exam or a meeting.
+// Scope is school for everyone, or class or course with the class or subject in ScopeValue.
+// Times are wall clock times of the school: YYYY-MM-DDTHH:MM, or YYYY-MM-DD dates for all-day events whose
+// EndsAt is the last day included. RRule optionally repeats the event, e.g. "FREQ=WEEKLY;BYDAY=MO,WE"
+type CalendarEvent struct {
+	Id          int    `json:"id,omitempty"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Category    string `json:"category"`
+	Scope       string `json:"scope"`
+	ScopeValue  string `json:"scope_value,omitempty"`
+	StartsAt    string `json:"starts_at"`
+	EndsAt      string `json:"ends_at"`
+	AllDay      bool   `json:"all_day"`
+	RRule       string `json:"rrule,omitempty"`
+	CreatedBy   string `json:"created_by,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+}
+
+// NonSchoolDay is a day without school, either a weekend day or a day covered by a holiday
+type NonSchoolDay struct {
+	Date   string `json:"date"`
+	Reason string `json:"reason"`
+}
+
+// CalendarFeed is the caller's iCalendar subscription. The token is only returned when it is created
+type CalendarFeed struct {
+	Token     string `json:"token"`
+	URL       string `json:"url"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
@@ -0,0 +1,76 @@
+package models
+
+// ExamRoom is a room exams are sat in. Its seats are numbered from 1, front to back and left to right,
+// in rows of SeatsPerRow
+type ExamRoom struct {
+	Id          int    `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Capacity    int    `json:"capacity"`
+	SeatsPerRow int    `json:"seats_per_row"`
+	CreatedAt   string `json:"created_at,omitempty"`
+}
+
+// ExamSession is an exam of a course sat by every student of Classes at the same time, in one or more rooms.
+// StartsAt is a wall clock time of the school, YYYY-MM-DDTHH:MM, and EndsAt follows from DurationMinutes
+type ExamSession struct {
+	Id              int               `json:"id,omitempty"`
+	Course          string            `json:"course"`
+	Title           string            `json:"title,omitempty"`
+	StartsAt        string            `json:"starts_at"`
+	DurationMinutes int               `json:"duration_minutes"`
+	EndsAt          string            `json:"ends_at,omitempty"`
+	Classes         []string          `json:"classes"`
+	RoomIds         []int             `json:"room_ids,omitempty"`
+	Rooms           []ExamSessionRoom `json:"rooms"`
+	Candidates      int               `json:"candidates"`
+	Seated          int               `json:"seated"`
+	CreatedBy       string            `json:"created_by,omitempty"`
+	CreatedAt       string            `json:"created_at,omitempty"`
+}
+
+// ExamSessionRoom is a room booked for a session with the teachers invigilating in it
+type ExamSessionRoom struct {
+	Id           int               `json:"id"`
+	Name         string            `json:"name"`
+	Capacity     int               `json:"capacity"`
+	Invigilators []ExamInvigilator `json:"invigilators"`
+}
+
+// ExamInvigilator assigns a teacher to watch over a room during a session
+type ExamInvigilator struct {
+	RoomId    int    `json:"room_id"`
+	TeacherId int    `json:"teacher_id"`
+	Name      string `json:"name,omitempty"`
+}
+
+// ExamSeat is where a student sits during a session. Row and Column count from 1 at the front left
+type ExamSeat struct {
+	RoomId    int    `json:"room_id"`
+	RoomName  string `json:"room_name"`
+	Seat      int    `json:"seat"`
+	Row       int    `json:"row"`
+	Column    int    `json:"column"`
+	StudentId int    `json:"student_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Class     string `json:"class"`
+}
+
+// ExamSeatingPlan is the seating of a session. Adjacent counts the students with a classmate right next to, in front
+// of or behind them, which only happens when the rooms are too full to keep the classes apart
+type ExamSeatingPlan struct {
+	SessionId int        `json:"session_id"`
+	Seated    int        `json:"seated"`
+	Adjacent  int        `json:"adjacent"`
+	Seats     []ExamSeat `json:"seats"`
+}
+
+// ExamConflict is a clash between a session and another one at an overlapping time. Type is class (students of the
+// class would sit both), student (a student already seated in the other session), room or invigilator
+type ExamConflict struct {
+	Type      string `json:"type"`
+	SessionId int    `json:"session_id"`
+	Course    string `json:"course"`
+	StartsAt  string `json:"starts_at"`
+	Detail    string `json:"detail"`
+}
@@ -15,6 +15,9 @@ type Exec struct {
 	PasswordCodeExpires sql.NullString `json:"password_code_expires,omitempty"`
 	InactiveStatus      bool           `json:"inactive_status,omitempty"`
 	Role                string         `json:"role,omitempty"`
+	Version             int            `json:"version,omitempty"`
+	DeletedAt           string         `json:"deleted_at,omitempty"`
+	DeletedBy           string         `json:"deleted_by,omitempty"`
 }
 
 type UpdatePasswordRequest struct {
@@ -0,0 +1,16 @@
+package models
+
+// ExportJob tracks an asynchronous export whose file is downloaded once it completes
+type ExportJob struct {
+	Id          int    `json:"id"`
+	Resource    string `json:"resource"`
+	SchoolId    int    `json:"school_id,omitempty"`
+	Format      string `json:"format"`
+	Status      string `json:"status"`
+	RowCount    int    `json:"row_count"`
+	Error       string `json:"error,omitempty"`
+	DownloadURL string `json:"download_url,omitempty"`
+	CreatedBy   string `json:"created_by,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	FinishedAt  string `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,118 @@
+package models
+
+// FeeItem is one line of a fee structure, such as tuition or a lab fee
+type FeeItem struct {
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+// FeeStructure is what the students of a class pay for an academic year, invoices are generated from it
+type FeeStructure struct {
+	Id             int       `json:"id,omitempty"`
+	Name           string    `json:"name"`
+	AcademicYearId int       `json:"academic_year_id"`
+	Class          string    `json:"class"`
+	Items          []FeeItem `json:"items"`
+	Total          float64   `json:"total"`
+	Invoices       int       `json:"invoices"`
+	CreatedBy      string    `json:"created_by,omitempty"`
+	CreatedAt      string    `json:"created_at,omitempty"`
+}
+
+// FeeDiscount is a standing discount or scholarship of a student for an academic year, applied to the invoices
+// generated for that year. Either Percent of the fees or a fixed Amount is taken off
+type FeeDiscount struct {
+	Id             int     `json:"id,omitempty"`
+	StudentId      int     `json:"student_id"`
+	AcademicYearId int     `json:"academic_year_id"`
+	Kind           string  `json:"kind"`
+	Description    string  `json:"description"`
+	Percent        float64 `json:"percent,omitempty"`
+	Amount         float64 `json:"amount,omitempty"`
+	CreatedBy      string  `json:"created_by,omitempty"`
+	CreatedAt      string  `json:"created_at,omitempty"`
+}
+
+// InvoiceLine is a fee charged on an invoice or, with Kind discount or scholarship, an amount taken off it
+type InvoiceLine struct {
+	Kind        string  `json:"kind"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+// Invoice is a bill of a student. Status is open, partially_paid, paid, overdue or void
+type Invoice struct {
+	Id             int           `json:"id,omitempty"`
+	Number         string        `json:"number"`
+	StudentId      int           `json:"student_id"`
+	FirstName      string        `json:"first_name"`
+	LastName       string        `json:"last_name"`
+	Class          string        `json:"class"`
+	FeeStructureId int           `json:"fee_structure_id,omitempty"`
+	FeeStructure   string        `json:"fee_structure,omitempty"`
+	IssueDate      string        `json:"issue_date"`
+	DueDate        string        `json:"due_date"`
+	Status         string        `json:"status"`
+	Lines          []InvoiceLine `json:"lines"`
+	Subtotal       float64       `json:"subtotal"`
+	Discounts      float64       `json:"discounts"`
+	Total          float64       `json:"total"`
+	Paid           float64       `json:"paid"`
+	Balance        float64       `json:"balance"`
+	Notes          string        `json:"notes,omitempty"`
+	Reminders      int           `json:"reminders"`
+	LastRemindedAt string        `json:"last_reminded_at,omitempty"`
+	Payments       []Payment     `json:"payments,omitempty"`
+	CreatedBy      string        `json:"created_by,omitempty"`
+	CreatedAt      string        `json:"created_at,omitempty"`
+	VoidedAt       string        `json:"voided_at,omitempty"`
+}
+
+// Payment is money received against an invoice, which may be less than its balance
+type Payment struct {
+	Id         int     `json:"id,omitempty"`
+	InvoiceId  int     `json:"invoice_id"`
+	Amount     float64 `json:"amount"`
+	Method     string  `json:"method"`
+	Reference  string  `json:"reference,omitempty"`
+	PaidOn     string  `json:"paid_on"`
+	RecordedBy string  `json:"recorded_by,omitempty"`
+	CreatedAt  string  `json:"created_at,omitempty"`
+}
+
+// InvoiceBatch generates the invoices of a fee structure, for every student of its class or only StudentIds
+type InvoiceBatch struct {
+	IssueDate  string `json:"issue_date"`
+	DueDate    string `json:"due_date"`
+	StudentIds []int  `json:"student_ids,omitempty"`
+}
+
+// InvoiceBatchResult reports the invoices a batch created. Students already invoiced for the structure are skipped
+type InvoiceBatchResult struct {
+	Created  int       `json:"created"`
+	Skipped  int       `json:"skipped"`
+	Invoices []Invoice `json:"invoices"`
+}
+
+// FeeStatement is what a guardian owes across all of their children
+type FeeStatement struct {
+	GuardianId  int                `json:"guardian_id"`
+	Name        string             `json:"name"`
+	Email       string             `json:"email"`
+	Students    []StudentStatement `json:"students"`
+	Total       float64            `json:"total"`
+	Paid        float64            `json:"paid"`
+	Balance     float64            `json:"balance"`
+	Overdue     float64            `json:"overdue"`
+	GeneratedAt string             `json:"generated_at"`
+}
+
+// StudentStatement lists the invoices of one child on a guardian's statement, void invoices left out
+type StudentStatement struct {
+	StudentId int       `json:"student_id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Class     string    `json:"class"`
+	Invoices  []Invoice `json:"invoices"`
+	Balance   float64   `json:"balance"`
+}
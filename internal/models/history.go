@@ -0,0 +1,9 @@
+package models
+
+// RecordVersion is one stored version of a student, teacher or exec, with who made the change and when
+type RecordVersion[T any] struct {
+	Version   int    `json:"version"`
+	ChangedBy string `json:"changed_by,omitempty"`
+	ChangedAt string `json:"changed_at"`
+	Record    T      `json:"record"`
+}
@@ -0,0 +1,27 @@
+package models
+
+// ImportJob records one spreadsheet import and its outcome
+type ImportJob struct {
+	Id         int               `json:"id"`
+	Resource   string            `json:"resource"`
+	SchoolId   int               `json:"school_id"`
+	Filename   string            `json:"filename"`
+	Status     string            `json:"status"`
+	DryRun     bool              `json:"dry_run"`
+	TotalRows  int               `json:"total_rows"`
+	Created    int               `json:"created"`
+	Updated    int               `json:"updated"`
+	Skipped    int               `json:"skipped"`
+	Mapping    map[string]string `json:"mapping"`
+	Errors     []ImportRowError  `json:"errors"`
+	CreatedBy  string            `json:"created_by,omitempty"`
+	CreatedAt  string            `json:"created_at,omitempty"`
+	FinishedAt string            `json:"finished_at,omitempty"`
+}
+
+// ImportRowError reports why a spreadsheet row was skipped. Rows are numbered as in the spreadsheet, the header being row 1
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// Job is a background job as shown by the job endpoints. Payloads are left out since they may hold secrets such as
+// password reset links
+type Job struct {
+	Id          int64  `json:"id"`
+	SchoolId    int    `json:"school_id,omitempty"`
+	Type        string `json:"type"`
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"max_attempts"`
+	RunAt       string `json:"run_at"`
+	LastError   string `json:"last_error,omitempty"`
+	CreatedBy   string `json:"created_by,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	StartedAt   string `json:"started_at,omitempty"`
+	FinishedAt  string `json:"finished_at,omitempty"`
+}
+
+// JobSchedule is a recurring job and when it next runs
+type JobSchedule struct {
+	Name      string `json:"name"`
+	Spec      string `json:"spec"`
+	Type      string `json:"type"`
+	NextRunAt string `json:"next_run_at,omitempty"`
+}
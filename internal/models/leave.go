@@ -0,0 +1,63 @@
+package models
+
+// LeaveRequest is a request for a teacher or a student to be away between two dates, both included. Kind is teacher
+// or student and Status is pending, approved, rejected or cancelled. Step is the position of the approval awaited
+type LeaveRequest struct {
+	Id          int             `json:"id,omitempty"`
+	Kind        string          `json:"kind"`
+	TeacherId   int             `json:"teacher_id,omitempty"`
+	StudentId   int             `json:"student_id,omitempty"`
+	Name        string          `json:"name,omitempty"`
+	Class       string          `json:"class,omitempty"`
+	StartDate   string          `json:"start_date"`
+	EndDate     string          `json:"end_date"`
+	Days        int             `json:"days"`
+	Reason      string          `json:"reason"`
+	Status      string          `json:"status,omitempty"`
+	Step        int             `json:"step"`
+	Approvals   []LeaveApproval `json:"approvals"`
+	Cover       []LeaveCover    `json:"cover,omitempty"`
+	RequestedBy string          `json:"requested_by,omitempty"`
+	// RequestedById is the exec account that made the request, a guardian for most student leave
+	RequestedById int    `json:"requested_by_id,omitempty"`
+	CreatedAt     string `json:"created_at,omitempty"`
+	DecidedAt     string `json:"decided_at,omitempty"`
+}
+
+// LeaveApproval is one step of the approval chain of a request, approved by an account with Role. Status is waiting
+// until the steps before it are approved, then pending, approved or rejected
+type LeaveApproval struct {
+	Position  int    `json:"position"`
+	Role      string `json:"role"`
+	Status    string `json:"status"`
+	DecidedBy string `json:"decided_by,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	DecidedAt string `json:"decided_at,omitempty"`
+}
+
+// LeaveChain is the approval chain of a kind of leave: the roles approving it, in order. An empty chain approves
+// requests as soon as they are made, and Default marks a school that kept the built-in chain
+type LeaveChain struct {
+	Kind    string   `json:"kind"`
+	Steps   []string `json:"steps"`
+	Default bool     `json:"default,omitempty"`
+}
+
+// LeaveCover is a lesson or an exam invigilation left without a teacher by approved leave, waiting for a substitute
+type LeaveCover struct {
+	Id             int    `json:"id"`
+	LeaveId        int    `json:"leave_id"`
+	TeacherId      int    `json:"teacher_id"`
+	TeacherName    string `json:"teacher_name,omitempty"`
+	Date           string `json:"date"`
+	Class          string `json:"class,omitempty"`
+	Subject        string `json:"subject,omitempty"`
+	ExamSessionId  int    `json:"exam_session_id,omitempty"`
+	SubstituteId   int    `json:"substitute_id,omitempty"`
+	SubstituteName string `json:"substitute_name,omitempty"`
+}
+
+// LeaveDecision is the comment an approver leaves with an approval, a rejection or a cancellation
+type LeaveDecision struct {
+	Comment string `json:"comment"`
+}
@@ -0,0 +1,63 @@
+package models
+
+// MessageThread is a conversation between accounts. UnreadCount is the caller's, Messages is only filled for a single thread
+type MessageThread struct {
+	Id            int                  `json:"id"`
+	Subject       string               `json:"subject"`
+	Participants  []MessageParticipant `json:"participants"`
+	CreatedBy     int                  `json:"created_by"`
+	CreatedAt     string               `json:"created_at"`
+	LastMessageAt string               `json:"last_message_at,omitempty"`
+	Locked        bool                 `json:"locked"`
+	UnreadCount   int                  `json:"unread_count"`
+	Messages      []Message            `json:"messages,omitempty"`
+}
+
+// MessageParticipant is an account taking part in a thread
+type MessageParticipant struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// Message is one message of a thread. The body of a hidden message is only shown to admins
+type Message struct {
+	Id           int64        `json:"id"`
+	ThreadId     int          `json:"thread_id"`
+	SenderId     int          `json:"sender_id"`
+	Body         string       `json:"body"`
+	Attachments  []Attachment `json:"attachments"`
+	CreatedAt    string       `json:"created_at"`
+	Hidden       bool         `json:"hidden,omitempty"`
+	HiddenReason string       `json:"hidden_reason,omitempty"`
+}
+
+// NewMessageThread starts a thread with its first message
+type NewMessageThread struct {
+	Subject        string       `json:"subject"`
+	ParticipantIds []int        `json:"participant_ids"`
+	Body           string       `json:"body"`
+	Attachments    []Attachment `json:"attachments"`
+}
+
+// MessageBlock stops an account from sending messages
+type MessageBlock struct {
+	ExecId    int    `json:"exec_id"`
+	Reason    string `json:"reason,omitempty"`
+	BlockedBy string `json:"blocked_by,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// UnreadCount is the number of unread messages of a thread
+type UnreadCount struct {
+	ThreadId    int `json:"thread_id"`
+	UnreadCount int `json:"unread_count"`
+}
+
+// Guardian links a guardian account to a student
+type Guardian struct {
+	ExecId       int    `json:"exec_id"`
+	Name         string `json:"name,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Relationship string `json:"relationship,omitempty"`
+}
@@ -0,0 +1,59 @@
+package models
+
+// Grade is a student's result in one subject for a term
+type Grade struct {
+	Id        int     `json:"id,omitempty"`
+	StudentId int     `json:"student_id"`
+	TermId    int     `json:"term_id"`
+	Subject   string  `json:"subject"`
+	Score     float64 `json:"score"`
+	MaxScore  float64 `json:"max_score"`
+	Remark    string  `json:"remark,omitempty"`
+}
+
+// AttendanceRecord is a student's attendance on one school day.
+// Status is one of present, absent, late or excused
+type AttendanceRecord struct {
+	Id        int    `json:"id,omitempty"`
+	StudentId int    `json:"student_id"`
+	Date      string `json:"date"`
+	Status    string `json:"status"`
+}
+
+// AttendanceSummary counts a student's attendance over a period. Rate is the share of days present or late, in percent
+type AttendanceSummary struct {
+	Days    int     `json:"days"`
+	Present int     `json:"present"`
+	Absent  int     `json:"absent"`
+	Late    int     `json:"late"`
+	Excused int     `json:"excused"`
+	Rate    float64 `json:"rate"`
+}
+
+// TermRemark is the teacher's overall remark on a student for a term
+type TermRemark struct {
+	StudentId int    `json:"student_id"`
+	TermId    int    `json:"term_id"`
+	Remark    string `json:"remark"`
+	UpdatedBy string `json:"updated_by,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// ReportCard is everything printed on a student's report card for a term
+type ReportCard struct {
+	School       string            `json:"school"`
+	AcademicYear string            `json:"academic_year"`
+	Term         Term              `json:"term"`
+	Student      Student           `json:"student"`
+	Grades       []Grade           `json:"grades"`
+	Average      float64           `json:"average"`
+	Attendance   AttendanceSummary `json:"attendance"`
+	Remark       string            `json:"remark,omitempty"`
+	RemarkBy     string            `json:"remark_by,omitempty"`
+}
+
+// ReportCardBatch asks for the report cards of a whole class as one ZIP archive
+type ReportCardBatch struct {
+	Class  string `json:"class"`
+	TermId int    `json:"term_id"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// School is a tenant, every student, teacher and exec belongs to exactly one
+type School struct {
+	Id        int    `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Subdomain string `json:"subdomain"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// SearchResult is a single ranked hit returned by GET /search
+type SearchResult struct {
+	Type      string  `json:"type"`
+	Id        int     `json:"id"`
+	FirstName string  `json:"first_name"`
+	LastName  string  `json:"last_name"`
+	Email     string  `json:"email,omitempty"`
+	Class     string  `json:"class,omitempty"`
+	Score     float64 `json:"score"`
+}
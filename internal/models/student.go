@@ -6,4 +6,7 @@ type Student struct {
 	LastName  string `json:"last_name,omitempty"`
 	Email     string `json:"email,omitempty"`
 	Class     string `json:"class,omitempty"`
+	Version   int    `json:"version,omitempty"`
+	DeletedAt string `json:"deleted_at,omitempty"`
+	DeletedBy string `json:"deleted_by,omitempty"`
 }
@@ -7,4 +7,7 @@ type Teacher struct {
 	Email     string `json:"email"`
 	Class     string `json:"class"`
 	Subject   string `json:"subject"`
+	Version   int    `json:"version"`
+	DeletedAt string `json:"deleted_at,omitempty"`
+	DeletedBy string `json:"deleted_by,omitempty"`
 }
@@ -0,0 +1,72 @@
+package models
+
+// GradeBand maps every percentage from MinPercent up to the next band to a letter and its grade points
+type GradeBand struct {
+	MinPercent float64 `json:"min_percent"`
+	Letter     string  `json:"letter"`
+	Points     float64 `json:"points"`
+}
+
+// CourseCredit is the weight of a subject in GPAs. Subjects without one count for one credit
+type CourseCredit struct {
+	Subject string  `json:"subject"`
+	Credits float64 `json:"credits"`
+}
+
+// TranscriptCourse is a final course grade on a transcript
+type TranscriptCourse struct {
+	Subject string  `json:"subject"`
+	Percent float64 `json:"percent"`
+	Letter  string  `json:"letter"`
+	Points  float64 `json:"points"`
+	Credits float64 `json:"credits"`
+}
+
+// TranscriptTerm is a term on a transcript with its courses and GPA
+type TranscriptTerm struct {
+	TermId       int                `json:"term_id"`
+	Term         string             `json:"term"`
+	AcademicYear string             `json:"academic_year"`
+	Class        string             `json:"class"`
+	StartDate    string             `json:"start_date"`
+	EndDate      string             `json:"end_date"`
+	Courses      []TranscriptCourse `json:"courses"`
+	Credits      float64            `json:"credits"`
+	GPA          float64            `json:"gpa"`
+}
+
+// Transcript is a student's academic record with per-term and cumulative GPAs.
+// Code, IssuedBy and IssuedAt are only set on official transcripts
+type Transcript struct {
+	Code          string           `json:"code,omitempty"`
+	School        string           `json:"school"`
+	StudentId     int              `json:"student_id"`
+	FirstName     string           `json:"first_name"`
+	LastName      string           `json:"last_name"`
+	Class         string           `json:"class"`
+	Terms         []TranscriptTerm `json:"terms"`
+	Credits       float64          `json:"credits"`
+	CumulativeGPA float64          `json:"cumulative_gpa"`
+	MaxPoints     float64          `json:"max_points"`
+	Scale         []GradeBand      `json:"scale"`
+	IssuedBy      string           `json:"issued_by,omitempty"`
+	IssuedAt      string           `json:"issued_at,omitempty"`
+}
+
+// IssuedTranscript lists an official transcript of a student without its content
+type IssuedTranscript struct {
+	Code          string  `json:"code"`
+	CumulativeGPA float64 `json:"cumulative_gpa"`
+	IssuedBy      string  `json:"issued_by,omitempty"`
+	IssuedAt      string  `json:"issued_at"`
+	RevokedAt     string  `json:"revoked_at,omitempty"`
+}
+
+// TranscriptVerification answers a third party checking a transcript by its code. Status is valid, revoked, or
+// invalid when the stored transcript no longer matches its signature
+type TranscriptVerification struct {
+	Code       string      `json:"code"`
+	Status     string      `json:"status"`
+	RevokedAt  string      `json:"revoked_at,omitempty"`
+	Transcript *Transcript `json:"transcript,omitempty"`
+}
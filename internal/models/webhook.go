@@ -0,0 +1,38 @@
+package models
+
+// Webhook is an outbound subscription. The secret signs every delivery and is only returned when the webhook is created
+type Webhook struct {
+	Id         int      `json:"id,omitempty"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active,omitempty"`
+	CreatedBy  string   `json:"created_by,omitempty"`
+	CreatedAt  string   `json:"created_at,omitempty"`
+}
+
+// WebhookDelivery is one event queued for a webhook. Status is pending until it is delivered (succeeded) or runs out
+// of attempts (failed)
+type WebhookDelivery struct {
+	Id             int64            `json:"id"`
+	WebhookId      int              `json:"webhook_id"`
+	EventType      string           `json:"event_type"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  string           `json:"next_attempt_at,omitempty"`
+	LastStatusCode int              `json:"last_status_code,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	CreatedAt      string           `json:"created_at"`
+	DeliveredAt    string           `json:"delivered_at,omitempty"`
+	Payload        any              `json:"payload,omitempty"`
+	AttemptLog     []WebhookAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookAttempt logs one HTTP request made for a delivery
+type WebhookAttempt struct {
+	Attempt     int    `json:"attempt"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	DurationMs  int    `json:"duration_ms"`
+	AttemptedAt string `json:"attempted_at"`
+}
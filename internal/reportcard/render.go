@@ -0,0 +1,175 @@
+package reportcard
+
+import (
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Layout of the report card template, in points
+const (
+	margin       = 50.0
+	bottomMargin = 70.0
+	bodySize     = 10.0
+	lineHeight   = 15.0
+)
+
+// gradeColumns are the x positions of the grades table columns
+var gradeColumns = struct{ subject, score, percent, remark float64 }{margin, 220, 290, 345}
+
+// page tracks the drawing position while the template is filled in, starting new pages as they fill up
+type page struct {
+	doc *utils.PDFDocument
+	y   float64
+}
+
+func (p *page) line(x, size float64, bold bool, text string) {
+	p.doc.Text(x, p.y, size, bold, text)
+}
+
+func (p *page) advance(height float64) {
+	p.y -= height
+	if p.y < bottomMargin {
+		p.doc.AddPage()
+		p.y = utils.PDFPageHeight - margin
+	}
+}
+
+func (p *page) rule() {
+	p.doc.Line(margin, p.y+lineHeight/2, utils.PDFPageWidth-margin, p.y+lineHeight/2, 0.5)
+}
+
+func (p *page) heading(text string) {
+	p.advance(lineHeight)
+	p.line(margin, 12, true, text)
+	p.advance(lineHeight * 1.2)
+}
+
+// Render fills the report card template and writes the PDF
+func Render(card models.ReportCard, w io.Writer) error {
+	doc := utils.NewPDFDocument()
+	doc.AddPage()
+	p := &page{doc: doc, y: utils.PDFPageHeight - margin - 10}
+
+	p.line(margin, 18, true, card.School)
+	p.advance(lineHeight * 1.6)
+	p.line(margin, 13, false, fmt.Sprintf("Report Card – %s, %s", card.Term.Name, card.AcademicYear))
+	p.advance(lineHeight * 1.6)
+
+	student := card.Student
+	p.line(margin, bodySize, true, "Student")
+	p.line(130, bodySize, false, fmt.Sprintf("%s %s", student.FirstName, student.LastName))
+	p.advance(lineHeight)
+	p.line(margin, bodySize, true, "Class")
+	p.line(130, bodySize, false, student.Class)
+	p.advance(lineHeight)
+	p.line(margin, bodySize, true, "Term")
+	p.line(130, bodySize, false, fmt.Sprintf("%s to %s", card.Term.StartDate, card.Term.EndDate))
+	p.advance(lineHeight)
+	p.rule()
+
+	p.heading("Grades")
+	if len(card.Grades) == 0 {
+		p.line(margin, bodySize, false, "No grades were recorded for this term.")
+		p.advance(lineHeight)
+	} else {
+		p.line(gradeColumns.subject, bodySize, true, "Subject")
+		p.line(gradeColumns.score, bodySize, true, "Score")
+		p.line(gradeColumns.percent, bodySize, true, "%")
+		p.line(gradeColumns.remark, bodySize, true, "Remark")
+		p.advance(lineHeight)
+		for _, grade := range card.Grades {
+			percent := 0.0
+			if grade.MaxScore > 0 {
+				percent = grade.Score / grade.MaxScore * 100
+			}
+			p.line(gradeColumns.subject, bodySize, false, truncate(grade.Subject, 30))
+			p.line(gradeColumns.score, bodySize, false, fmt.Sprintf("%g / %g", grade.Score, grade.MaxScore))
+			p.line(gradeColumns.percent, bodySize, false, fmt.Sprintf("%.1f", percent))
+			remark := wrap(grade.Remark, charsPerLine(utils.PDFPageWidth-margin-gradeColumns.remark))
+			for i, text := range remark {
+				if i > 0 {
+					p.advance(lineHeight)
+				}
+				p.line(gradeColumns.remark, bodySize, false, text)
+			}
+			p.advance(lineHeight)
+		}
+		p.line(gradeColumns.subject, bodySize, true, "Average")
+		p.line(gradeColumns.percent, bodySize, true, fmt.Sprintf("%.1f", card.Average))
+		p.advance(lineHeight)
+	}
+	p.rule()
+
+	p.heading("Attendance")
+	attendance := card.Attendance
+	if attendance.Days == 0 {
+		p.line(margin, bodySize, false, "No attendance was recorded for this term.")
+	} else {
+		p.line(margin, bodySize, false, fmt.Sprintf("%d days recorded: %d present, %d late, %d absent, %d excused. Attendance rate %.1f%%",
+			attendance.Days, attendance.Present, attendance.Late, attendance.Absent, attendance.Excused, attendance.Rate))
+	}
+	p.advance(lineHeight)
+	p.rule()
+
+	p.heading("Teacher's Remarks")
+	if card.Remark == "" {
+		p.line(margin, bodySize, false, "No remarks.")
+		p.advance(lineHeight)
+	} else {
+		for _, text := range strings.Split(card.Remark, "\n") {
+			for _, wrapped := range wrap(text, charsPerLine(utils.PDFPageWidth-2*margin)) {
+				p.line(margin, bodySize, false, wrapped)
+				p.advance(lineHeight)
+			}
+		}
+		if card.RemarkBy != "" {
+			p.line(margin, bodySize, false, "– "+card.RemarkBy)
+			p.advance(lineHeight)
+		}
+	}
+
+	doc.Text(margin, margin-20, 8, false, "Generated by ClassConnect on "+time.Now().Format("2006-01-02"))
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// charsPerLine estimates how many characters of body text fit in a width, Helvetica averages about half an em per character
+func charsPerLine(width float64) int {
+	return int(width / (bodySize * 0.5))
+}
+
+// wrap splits text into lines of at most width characters at word boundaries
+func wrap(text string, width int) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	lines := make([]string, 0, 1)
+	current := ""
+	for _, word := range words {
+		switch {
+		case current == "":
+			current = word
+		case len(current)+1+len(word) <= width:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	return append(lines, current)
+}
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "…"
+}
@@ -0,0 +1,182 @@
+package reportcard
+
+import (
+	"ClassConnect/internal/calendar"
+	"ClassConnect/internal/models"
+	"archive/zip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrStudentNotFound = errors.New("student not found")
+	ErrTermNotFound    = errors.New("term not found")
+)
+
+// unsafeFilename matches what is dropped from student names when naming the files of an archive
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// Load compiles the report card of a live student for a term of the student's school
+func Load(db *sql.DB, studentId, termId int) (models.ReportCard, error) {
+	var card models.ReportCard
+	var schoolId int
+	student := &card.Student
+	err := db.QueryRow("SELECT s.id, s.first_name, s.last_name, s.email, s.class, s.school_id, sc.name FROM students s JOIN schools sc ON sc.id = s.school_id WHERE s.id = ? AND s.deleted_at IS NULL", studentId).Scan(
+		&student.Id, &student.FirstName, &student.LastName, &student.Email, &student.Class, &schoolId, &card.School,
+	)
+	if err == sql.ErrNoRows {
+		return card, ErrStudentNotFound
+	} else if err != nil {
+		return card, err
+	}
+
+	term := &card.Term
+	err = db.QueryRow("SELECT t.id, t.academic_year_id, t.name, t.start_date, t.end_date, y.name FROM terms t JOIN academic_years y ON y.id = t.academic_year_id WHERE t.id = ? AND t.school_id = ?", termId, schoolId).Scan(
+		&term.Id, &term.AcademicYearId, &term.Name, &term.StartDate, &term.EndDate, &card.AcademicYear,
+	)
+	if err == sql.ErrNoRows {
+		return card, ErrTermNotFound
+	} else if err != nil {
+		return card, err
+	}
+
+	// The class the student attended that year, which differs from the current one once they were promoted
+	err = db.QueryRow("SELECT class FROM enrollments WHERE student_id = ? AND academic_year_id = ?", studentId, term.AcademicYearId).Scan(&student.Class)
+	if err != nil && err != sql.ErrNoRows {
+		return card, err
+	}
+
+	card.Grades, err = LoadGrades(db, studentId, termId)
+	if err != nil {
+		return card, err
+	}
+	if len(card.Grades) > 0 {
+		var total float64
+		for _, grade := range card.Grades {
+			if grade.MaxScore > 0 {
+				total += grade.Score / grade.MaxScore * 100
+			}
+		}
+		card.Average = round1(total / float64(len(card.Grades)))
+	}
+
+	card.Attendance, err = SummarizeAttendance(db, schoolId, studentId, term.StartDate, term.EndDate)
+	if err != nil {
+		return card, err
+	}
+
+	var remarkBy sql.NullString
+	err = db.QueryRow("SELECT remark, updated_by FROM term_remarks WHERE student_id = ? AND term_id = ?", studentId, termId).Scan(&card.Remark, &remarkBy)
+	if err != nil && err != sql.ErrNoRows {
+		return card, err
+	}
+	card.RemarkBy = remarkBy.String
+	return card, nil
+}
+
+// LoadGrades reads a student's grades for a term ordered by subject
+func LoadGrades(db *sql.DB, studentId, termId int) ([]models.Grade, error) {
+	rows, err := db.Query("SELECT id, student_id, term_id, subject, score, max_score, remark FROM grades WHERE student_id = ? AND term_id = ? ORDER BY subject", studentId, termId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grades := make([]models.Grade, 0)
+	for rows.Next() {
+		var grade models.Grade
+		err = rows.Scan(&grade.Id, &grade.StudentId, &grade.TermId, &grade.Subject, &grade.Score, &grade.MaxScore, &grade.Remark)
+		if err != nil {
+			return nil, err
+		}
+		grades = append(grades, grade)
+	}
+	return grades, rows.Err()
+}
+
+// SummarizeAttendance counts a student's attendance between two YYYY-MM-DD dates, both included.
+// Records on days the school turned out to be closed, such as a holiday added afterwards, are left out
+func SummarizeAttendance(db *sql.DB, schoolId, studentId int, from, to string) (models.AttendanceSummary, error) {
+	var summary models.AttendanceSummary
+	days, err := calendar.NonSchoolDays(db, schoolId, from, to)
+	if err != nil {
+		return summary, err
+	}
+	closed := make(map[string]bool, len(days))
+	for _, day := range days {
+		closed[day.Date] = true
+	}
+
+	rows, err := db.Query("SELECT date, status FROM attendance WHERE student_id = ? AND date BETWEEN ? AND ?", studentId, from, to)
+	if err != nil {
+		return summary, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var date, status string
+		err = rows.Scan(&date, &status)
+		if err != nil {
+			return summary, err
+		}
+		if closed[date] {
+			continue
+		}
+		switch status {
+		case "present":
+			summary.Present++
+		case "absent":
+			summary.Absent++
+		case "late":
+			summary.Late++
+		case "excused":
+			summary.Excused++
+		}
+		summary.Days++
+	}
+	if summary.Days > 0 {
+		summary.Rate = round1(float64(summary.Present+summary.Late) / float64(summary.Days) * 100)
+	}
+	return summary, rows.Err()
+}
+
+// WriteArchive writes a ZIP with one report card PDF per student and returns how many cards it holds.
+// Students that were deleted while the archive was being written are left out
+func WriteArchive(db *sql.DB, w io.Writer, studentIds []int, termId int) (int, error) {
+	archive := zip.NewWriter(w)
+	count := 0
+	for _, studentId := range studentIds {
+		card, err := Load(db, studentId, termId)
+		if errors.Is(err, ErrStudentNotFound) {
+			continue
+		} else if err != nil {
+			return count, err
+		}
+
+		file, err := archive.Create(Filename(card))
+		if err != nil {
+			return count, err
+		}
+		err = Render(card, file)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, archive.Close()
+}
+
+// Filename names a report card's PDF after the student and the term
+func Filename(card models.ReportCard) string {
+	name := strings.Trim(unsafeFilename.ReplaceAllString(fmt.Sprintf("%s-%s-%s", card.Student.LastName, card.Student.FirstName, card.Term.Name), "-"), "-")
+	return fmt.Sprintf("%d-%s.pdf", card.Student.Id, strings.ToLower(name))
+}
+
+func round1(n float64) float64 {
+	return math.Round(n*10) / 10
+}
@@ -0,0 +1,771 @@
+package sqlconnect
+
+// schema holds the statements run by InitDB, in order.
+// Every statement must be idempotent since it runs on each startup
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS teachers(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		first_name VARCHAR(255) NOT NULL,
+		last_name VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL UNIQUE,
+		class VARCHAR(255) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		INDEX(email)
+	);`,
+	`CREATE TABLE IF NOT EXISTS students(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		first_name VARCHAR(255) NOT NULL,
+		last_name VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL UNIQUE,
+		class VARCHAR(255) NOT NULL,
+		INDEX(email)
+	);`,
+	`CREATE TABLE IF NOT EXISTS execs(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		first_name VARCHAR(255) NOT NULL,
+		last_name VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL UNIQUE,
+		username VARCHAR(255) NOT NULL UNIQUE,
+		password VARCHAR(255) NOT NULL,
+		password_changed_at VARCHAR(255),
+		user_created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		password_reset_token VARCHAR(255),
+		inactive_status BOOLEAN NOT NULL DEFAULT FALSE,
+		role VARCHAR(50) NOT NULL,
+		INDEX(email)
+	);`,
+
+	// Row versions used for optimistic concurrency (ETag / If-Match)
+	`ALTER TABLE teachers ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;`,
+	`ALTER TABLE students ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;`,
+	`ALTER TABLE execs ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;`,
+
+	// Soft deletes, purged after the retention period
+	`ALTER TABLE teachers ADD COLUMN IF NOT EXISTS deleted_at DATETIME NULL, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255) NULL, ADD INDEX IF NOT EXISTS idx_teachers_deleted_at (deleted_at);`,
+	`ALTER TABLE students ADD COLUMN IF NOT EXISTS deleted_at DATETIME NULL, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255) NULL, ADD INDEX IF NOT EXISTS idx_students_deleted_at (deleted_at);`,
+	`ALTER TABLE execs ADD COLUMN IF NOT EXISTS deleted_at DATETIME NULL, ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255) NULL, ADD INDEX IF NOT EXISTS idx_execs_deleted_at (deleted_at);`,
+
+	// Full-text indexes backing GET /search
+	`CREATE FULLTEXT INDEX IF NOT EXISTS ft_students_search ON students(first_name, last_name, email, class);`,
+	`CREATE FULLTEXT INDEX IF NOT EXISTS ft_teachers_search ON teachers(first_name, last_name, email, class, subject);`,
+	`CREATE FULLTEXT INDEX IF NOT EXISTS ft_execs_search ON execs(first_name, last_name, email, username);`,
+
+	// Spreadsheet imports
+	`CREATE TABLE IF NOT EXISTS import_jobs(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		resource VARCHAR(50) NOT NULL,
+		filename VARCHAR(255) NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+		total_rows INT NOT NULL DEFAULT 0,
+		created INT NOT NULL DEFAULT 0,
+		updated INT NOT NULL DEFAULT 0,
+		skipped INT NOT NULL DEFAULT 0,
+		mapping JSON,
+		errors JSON,
+		created_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		finished_at TIMESTAMP NULL
+	);`,
+
+	// Asynchronous exports
+	`CREATE TABLE IF NOT EXISTS export_jobs(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		resource VARCHAR(50) NOT NULL,
+		format VARCHAR(10) NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		row_count INT NOT NULL DEFAULT 0,
+		path VARCHAR(1024),
+		error VARCHAR(255),
+		created_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		finished_at TIMESTAMP NULL
+	);`,
+
+	// Append-only, hash-chained audit log
+	`CREATE TABLE IF NOT EXISTS audit_log(
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		actor_id VARCHAR(50) NOT NULL DEFAULT '',
+		actor_username VARCHAR(255) NOT NULL DEFAULT '',
+		actor_role VARCHAR(50) NOT NULL DEFAULT '',
+		action VARCHAR(50) NOT NULL,
+		resource VARCHAR(50) NOT NULL,
+		resource_id VARCHAR(50) NOT NULL DEFAULT '',
+		before_state JSON,
+		after_state JSON,
+		diff JSON,
+		ip VARCHAR(45) NOT NULL DEFAULT '',
+		request_id VARCHAR(64) NOT NULL DEFAULT '',
+		created_at DATETIME(6) NOT NULL,
+		prev_hash CHAR(64) NOT NULL,
+		hash CHAR(64) NOT NULL,
+		INDEX idx_audit_actor (actor_username),
+		INDEX idx_audit_resource (resource, resource_id),
+		INDEX idx_audit_created_at (created_at)
+	);`,
+	`CREATE TABLE IF NOT EXISTS audit_chain_head(
+		id INT PRIMARY KEY,
+		hash CHAR(64) NOT NULL
+	);`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+		FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit log is append-only';`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+		FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit log is append-only';`,
+
+	// Change history, one row per version of a student, teacher or exec.
+	// Triggers copy every inserted row and every update that bumps the version, so no write path can skip it
+	`ALTER TABLE teachers ADD COLUMN IF NOT EXISTS updated_by VARCHAR(255) NULL;`,
+	`ALTER TABLE students ADD COLUMN IF NOT EXISTS updated_by VARCHAR(255) NULL;`,
+	`ALTER TABLE execs ADD COLUMN IF NOT EXISTS updated_by VARCHAR(255) NULL;`,
+	`CREATE TABLE IF NOT EXISTS teachers_history(
+		history_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		id INT NOT NULL,
+		first_name VARCHAR(255),
+		last_name VARCHAR(255),
+		email VARCHAR(255),
+		class VARCHAR(255),
+		subject VARCHAR(255),
+		version INT NOT NULL,
+		deleted_at DATETIME NULL,
+		deleted_by VARCHAR(255),
+		changed_by VARCHAR(255),
+		changed_at DATETIME(6) NOT NULL,
+		UNIQUE KEY uq_teachers_history_version (id, version),
+		INDEX idx_teachers_history_changed_at (id, changed_at)
+	);`,
+	`CREATE TRIGGER IF NOT EXISTS teachers_history_insert AFTER INSERT ON teachers FOR EACH ROW
+		INSERT INTO teachers_history(id, first_name, last_name, email, class, subject, version, deleted_at, deleted_by, changed_by, changed_at)
+		VALUES(NEW.id, NEW.first_name, NEW.last_name, NEW.email, NEW.class, NEW.subject, NEW.version, NEW.deleted_at, NEW.deleted_by, NEW.updated_by, UTC_TIMESTAMP(6));`,
+	`CREATE TRIGGER IF NOT EXISTS teachers_history_update AFTER UPDATE ON teachers FOR EACH ROW
+		INSERT INTO teachers_history(id, first_name, last_name, email, class, subject, version, deleted_at, deleted_by, changed_by, changed_at)
+		SELECT NEW.id, NEW.first_name, NEW.last_name, NEW.email, NEW.class, NEW.subject, NEW.version, NEW.deleted_at, NEW.deleted_by, NEW.updated_by, UTC_TIMESTAMP(6) FROM DUAL WHERE NEW.version <> OLD.version;`,
+	`INSERT INTO teachers_history(id, first_name, last_name, email, class, subject, version, deleted_at, deleted_by, changed_by, changed_at)
+		SELECT id, first_name, last_name, email, class, subject, version, deleted_at, deleted_by, updated_by, UTC_TIMESTAMP(6) FROM teachers WHERE id NOT IN (SELECT id FROM teachers_history);`,
+	`CREATE TABLE IF NOT EXISTS students_history(
+		history_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		id INT NOT NULL,
+		first_name VARCHAR(255),
+		last_name VARCHAR(255),
+		email VARCHAR(255),
+		class VARCHAR(255),
+		version INT NOT NULL,
+		deleted_at DATETIME NULL,
+		deleted_by VARCHAR(255),
+		changed_by VARCHAR(255),
+		changed_at DATETIME(6) NOT NULL,
+		UNIQUE KEY uq_students_history_version (id, version),
+		INDEX idx_students_history_changed_at (id, changed_at)
+	);`,
+	`CREATE TRIGGER IF NOT EXISTS students_history_insert AFTER INSERT ON students FOR EACH ROW
+		INSERT INTO students_history(id, first_name, last_name, email, class, version, deleted_at, deleted_by, changed_by, changed_at)
+		VALUES(NEW.id, NEW.first_name, NEW.last_name, NEW.email, NEW.class, NEW.version, NEW.deleted_at, NEW.deleted_by, NEW.updated_by, UTC_TIMESTAMP(6));`,
+	`CREATE TRIGGER IF NOT EXISTS students_history_update AFTER UPDATE ON students FOR EACH ROW
+		INSERT INTO students_history(id, first_name, last_name, email, class, version, deleted_at, deleted_by, changed_by, changed_at)
+		SELECT NEW.id, NEW.first_name, NEW.last_name, NEW.email, NEW.class, NEW.version, NEW.deleted_at, NEW.deleted_by, NEW.updated_by, UTC_TIMESTAMP(6) FROM DUAL WHERE NEW.version <> OLD.version;`,
+	`INSERT INTO students_history(id, first_name, last_name, email, class, version, deleted_at, deleted_by, changed_by, changed_at)
+		SELECT id, first_name, last_name, email, class, version, deleted_at, deleted_by, updated_by, UTC_TIMESTAMP(6) FROM students WHERE id NOT IN (SELECT id FROM students_history);`,
+	`CREATE TABLE IF NOT EXISTS execs_history(
+		history_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		id INT NOT NULL,
+		first_name VARCHAR(255),
+		last_name VARCHAR(255),
+		email VARCHAR(255),
+		username VARCHAR(255),
+		password_changed_at VARCHAR(255),
+		user_created_at TIMESTAMP NULL,
+		inactive_status BOOLEAN,
+		role VARCHAR(50),
+		version INT NOT NULL,
+		deleted_at DATETIME NULL,
+		deleted_by VARCHAR(255),
+		changed_by VARCHAR(255),
+		changed_at DATETIME(6) NOT NULL,
+		UNIQUE KEY uq_execs_history_version (id, version),
+		INDEX idx_execs_history_changed_at (id, changed_at)
+	);`,
+	`CREATE TRIGGER IF NOT EXISTS execs_history_insert AFTER INSERT ON execs FOR EACH ROW
+		INSERT INTO execs_history(id, first_name, last_name, email, username, password_changed_at, user_created_at, inactive_status, role, version, deleted_at, deleted_by, changed_by, changed_at)
+		VALUES(NEW.id, NEW.first_name, NEW.last_name, NEW.email, NEW.username, NEW.password_changed_at, NEW.user_created_at, NEW.inactive_status, NEW.role, NEW.version, NEW.deleted_at, NEW.deleted_by, NEW.updated_by, UTC_TIMESTAMP(6));`,
+	`CREATE TRIGGER IF NOT EXISTS execs_history_update AFTER UPDATE ON execs FOR EACH ROW
+		INSERT INTO execs_history(id, first_name, last_name, email, username, password_changed_at, user_created_at, inactive_status, role, version, deleted_at, deleted_by, changed_by, changed_at)
+		SELECT NEW.id, NEW.first_name, NEW.last_name, NEW.email, NEW.username, NEW.password_changed_at, NEW.user_created_at, NEW.inactive_status, NEW.role, NEW.version, NEW.deleted_at, NEW.deleted_by, NEW.updated_by, UTC_TIMESTAMP(6) FROM DUAL WHERE NEW.version <> OLD.version;`,
+	`INSERT INTO execs_history(id, first_name, last_name, email, username, password_changed_at, user_created_at, inactive_status, role, version, deleted_at, deleted_by, changed_by, changed_at)
+		SELECT id, first_name, last_name, email, username, password_changed_at, user_created_at, inactive_status, role, version, deleted_at, deleted_by, updated_by, UTC_TIMESTAMP(6) FROM execs WHERE id NOT IN (SELECT id FROM execs_history);`,
+
+	// Schools are the tenants, every student, teacher and exec belongs to one.
+	// Rows that predate multi-tenancy are assigned to the default school with id 1
+	`CREATE TABLE IF NOT EXISTS schools(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		subdomain VARCHAR(63) NOT NULL UNIQUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`,
+	`INSERT IGNORE INTO schools(id, name, subdomain) VALUES(1, 'Default School', 'default');`,
+	`ALTER TABLE teachers ADD COLUMN IF NOT EXISTS school_id INT NOT NULL DEFAULT 1, ADD INDEX IF NOT EXISTS idx_teachers_school (school_id);`,
+	`ALTER TABLE students ADD COLUMN IF NOT EXISTS school_id INT NOT NULL DEFAULT 1, ADD INDEX IF NOT EXISTS idx_students_school (school_id);`,
+	`ALTER TABLE execs ADD COLUMN IF NOT EXISTS school_id INT NOT NULL DEFAULT 1, ADD INDEX IF NOT EXISTS idx_execs_school (school_id);`,
+	// Student and teacher emails only need to be unique within a school. Exec emails and usernames stay
+	// unique across the district since they are used to log in before the school is known
+	`ALTER TABLE teachers DROP INDEX IF EXISTS email, ADD UNIQUE INDEX IF NOT EXISTS uq_teachers_school_email (school_id, email);`,
+	`ALTER TABLE students DROP INDEX IF EXISTS email, ADD UNIQUE INDEX IF NOT EXISTS uq_students_school_email (school_id, email);`,
+	`ALTER TABLE import_jobs ADD COLUMN IF NOT EXISTS school_id INT NOT NULL DEFAULT 1;`,
+	`ALTER TABLE export_jobs ADD COLUMN IF NOT EXISTS school_id INT NOT NULL DEFAULT 1;`,
+	`ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS school_id INT NOT NULL DEFAULT 0, ADD INDEX IF NOT EXISTS idx_audit_school (school_id);`,
+
+	// Academic years, terms, class sections and the yearly enrollment of students
+	`CREATE TABLE IF NOT EXISTS academic_years(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		name VARCHAR(50) NOT NULL,
+		start_date DATE NOT NULL,
+		end_date DATE NOT NULL,
+		is_current BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE KEY uq_academic_years_school_name (school_id, name)
+	);`,
+	`CREATE TABLE IF NOT EXISTS terms(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		academic_year_id INT NOT NULL,
+		name VARCHAR(50) NOT NULL,
+		start_date DATE NOT NULL,
+		end_date DATE NOT NULL,
+		UNIQUE KEY uq_terms_year_name (academic_year_id, name),
+		FOREIGN KEY (academic_year_id) REFERENCES academic_years(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS class_sections(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		academic_year_id INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		next_class VARCHAR(255),
+		UNIQUE KEY uq_class_sections_year_name (academic_year_id, name),
+		FOREIGN KEY (academic_year_id) REFERENCES academic_years(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS enrollments(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		student_id INT NOT NULL,
+		academic_year_id INT NOT NULL,
+		class VARCHAR(255) NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		archived_at TIMESTAMP NULL,
+		UNIQUE KEY uq_enrollments_student_year (student_id, academic_year_id),
+		INDEX idx_enrollments_year_class (academic_year_id, class),
+		FOREIGN KEY (academic_year_id) REFERENCES academic_years(id),
+		FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE
+	);`,
+
+	// Term grades, daily attendance and the remarks printed on report cards
+	`CREATE TABLE IF NOT EXISTS grades(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		student_id INT NOT NULL,
+		term_id INT NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		score DECIMAL(6,2) NOT NULL,
+		max_score DECIMAL(6,2) NOT NULL DEFAULT 100,
+		remark VARCHAR(500) NOT NULL DEFAULT '',
+		updated_by VARCHAR(255),
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		UNIQUE KEY uq_grades_student_term_subject (student_id, term_id, subject),
+		FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+		FOREIGN KEY (term_id) REFERENCES terms(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS attendance(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		student_id INT NOT NULL,
+		date DATE NOT NULL,
+		status VARCHAR(10) NOT NULL,
+		updated_by VARCHAR(255),
+		UNIQUE KEY uq_attendance_student_date (student_id, date),
+		FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS term_remarks(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		student_id INT NOT NULL,
+		term_id INT NOT NULL,
+		remark TEXT NOT NULL,
+		updated_by VARCHAR(255),
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		UNIQUE KEY uq_term_remarks_student_term (student_id, term_id),
+		FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+		FOREIGN KEY (term_id) REFERENCES terms(id) ON DELETE CASCADE
+	);`,
+
+	// Announcements, who they are addressed to and who has read them
+	`CREATE TABLE IF NOT EXISTS announcements(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		title VARCHAR(255) NOT NULL,
+		body TEXT NOT NULL,
+		attachments TEXT,
+		publish_at DATETIME NOT NULL,
+		expire_at DATETIME NULL,
+		created_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_announcements_school_publish (school_id, publish_at)
+	);`,
+	`CREATE TABLE IF NOT EXISTS announcement_audiences(
+		announcement_id INT NOT NULL,
+		type VARCHAR(10) NOT NULL,
+		value VARCHAR(255) NOT NULL DEFAULT '',
+		PRIMARY KEY (announcement_id, type, value),
+		INDEX idx_announcement_audiences_target (type, value),
+		FOREIGN KEY (announcement_id) REFERENCES announcements(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS announcement_reads(
+		announcement_id INT NOT NULL,
+		user_id INT NOT NULL,
+		username VARCHAR(255) NOT NULL,
+		read_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (announcement_id, user_id),
+		FOREIGN KEY (announcement_id) REFERENCES announcements(id) ON DELETE CASCADE
+	);`,
+	// announced marks the announcements whose announcement.published event went out, those created before it already had
+	`ALTER TABLE announcements ADD COLUMN IF NOT EXISTS announced BOOLEAN NOT NULL DEFAULT TRUE;`,
+
+	// Webhook subscriptions and their durable delivery queue, every attempt is logged
+	`CREATE TABLE IF NOT EXISTS webhooks(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		url VARCHAR(2048) NOT NULL,
+		secret VARCHAR(255) NOT NULL,
+		event_types TEXT NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		created_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_webhooks_school (school_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries(
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		webhook_id INT NOT NULL,
+		event_type VARCHAR(100) NOT NULL,
+		payload MEDIUMTEXT NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME(6) NOT NULL,
+		last_status_code INT,
+		last_error VARCHAR(255),
+		created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+		delivered_at DATETIME(6) NULL,
+		INDEX idx_webhook_deliveries_due (status, next_attempt_at),
+		INDEX idx_webhook_deliveries_webhook (webhook_id, id),
+		FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS webhook_delivery_attempts(
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		delivery_id BIGINT NOT NULL,
+		attempt INT NOT NULL,
+		status_code INT,
+		error VARCHAR(255),
+		duration_ms INT NOT NULL,
+		attempted_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+		INDEX idx_webhook_delivery_attempts_delivery (delivery_id),
+		FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE
+	);`,
+	// Background jobs shared by every replica. unique_key keeps a scheduled run from being queued twice
+	`CREATE TABLE IF NOT EXISTS jobs(
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NULL,
+		type VARCHAR(100) NOT NULL,
+		payload MEDIUMTEXT NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'queued',
+		attempts INT NOT NULL DEFAULT 0,
+		max_attempts INT NOT NULL,
+		run_at DATETIME(6) NOT NULL,
+		locked_by VARCHAR(255) NULL,
+		locked_until DATETIME(6) NULL,
+		last_error VARCHAR(1000) NULL,
+		unique_key VARCHAR(255) NULL,
+		created_by VARCHAR(255),
+		created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+		started_at DATETIME(6) NULL,
+		finished_at DATETIME(6) NULL,
+		UNIQUE KEY uq_jobs_unique_key (unique_key),
+		INDEX idx_jobs_due (status, run_at),
+		INDEX idx_jobs_school (school_id, id)
+	);`,
+	// Guardian accounts of students, and direct messages between accounts with their moderation state
+	`CREATE TABLE IF NOT EXISTS student_guardians(
+		student_id INT NOT NULL,
+		exec_id INT NOT NULL,
+		school_id INT NOT NULL,
+		relationship VARCHAR(50),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (student_id, exec_id),
+		INDEX idx_student_guardians_exec (exec_id),
+		FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+		FOREIGN KEY (exec_id) REFERENCES execs(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS message_threads(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		created_by INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_message_at TIMESTAMP NULL,
+		locked_at TIMESTAMP NULL,
+		locked_by VARCHAR(255),
+		INDEX idx_message_threads_school (school_id, last_message_at)
+	);`,
+	`CREATE TABLE IF NOT EXISTS message_participants(
+		thread_id INT NOT NULL,
+		exec_id INT NOT NULL,
+		last_read_id BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (thread_id, exec_id),
+		INDEX idx_message_participants_exec (exec_id),
+		FOREIGN KEY (thread_id) REFERENCES message_threads(id) ON DELETE CASCADE,
+		FOREIGN KEY (exec_id) REFERENCES execs(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS messages(
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		thread_id INT NOT NULL,
+		sender_id INT NOT NULL,
+		body TEXT NOT NULL,
+		attachments TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		hidden_at TIMESTAMP NULL,
+		hidden_by VARCHAR(255),
+		hidden_reason VARCHAR(255),
+		INDEX idx_messages_thread (thread_id, id),
+		INDEX idx_messages_created (created_at),
+		FOREIGN KEY (thread_id) REFERENCES message_threads(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS message_blocks(
+		exec_id INT PRIMARY KEY,
+		school_id INT NOT NULL,
+		reason VARCHAR(255),
+		blocked_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_message_blocks_school (school_id),
+		FOREIGN KEY (exec_id) REFERENCES execs(id) ON DELETE CASCADE
+	);`,
+	// Calendar events with their recurrence, and the tokens of the iCalendar subscriptions.
+	// last_ends_at is when the last occurrence ends, NULL for events that repeat forever
+	`CREATE TABLE IF NOT EXISTS calendar_events(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		title VARCHAR(255) NOT NULL,
+		description TEXT,
+		location VARCHAR(255),
+		category VARCHAR(20) NOT NULL,
+		scope VARCHAR(10) NOT NULL,
+		scope_value VARCHAR(255),
+		starts_at DATETIME NOT NULL,
+		ends_at DATETIME NOT NULL,
+		all_day BOOLEAN NOT NULL DEFAULT FALSE,
+		rrule VARCHAR(255),
+		last_ends_at DATETIME NULL,
+		created_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_calendar_events_school (school_id, starts_at),
+		INDEX idx_calendar_events_category (school_id, category)
+	);`,
+	`CREATE TABLE IF NOT EXISTS calendar_feed_tokens(
+		exec_id INT PRIMARY KEY,
+		school_id INT NOT NULL,
+		token_hash CHAR(64) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP NULL,
+		UNIQUE KEY uq_calendar_feed_tokens_hash (token_hash),
+		FOREIGN KEY (exec_id) REFERENCES execs(id) ON DELETE CASCADE
+	);`,
+	// Exam rooms and sessions, with the classes sitting them, their rooms, invigilators and seating plans
+	`CREATE TABLE IF NOT EXISTS exam_rooms(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		capacity INT NOT NULL,
+		seats_per_row INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE KEY uq_exam_rooms_school_name (school_id, name)
+	);`,
+	`CREATE TABLE IF NOT EXISTS exam_sessions(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		course VARCHAR(255) NOT NULL,
+		title VARCHAR(255),
+		starts_at DATETIME NOT NULL,
+		ends_at DATETIME NOT NULL,
+		duration_minutes INT NOT NULL,
+		created_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_exam_sessions_school (school_id, starts_at)
+	);`,
+	`CREATE TABLE IF NOT EXISTS exam_session_classes(
+		session_id INT NOT NULL,
+		class VARCHAR(255) NOT NULL,
+		PRIMARY KEY (session_id, class),
+		FOREIGN KEY (session_id) REFERENCES exam_sessions(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS exam_session_rooms(
+		session_id INT NOT NULL,
+		room_id INT NOT NULL,
+		PRIMARY KEY (session_id, room_id),
+		INDEX idx_exam_session_rooms_room (room_id),
+		FOREIGN KEY (session_id) REFERENCES exam_sessions(id) ON DELETE CASCADE,
+		FOREIGN KEY (room_id) REFERENCES exam_rooms(id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS exam_invigilators(
+		session_id INT NOT NULL,
+		teacher_id INT NOT NULL,
+		room_id INT NOT NULL,
+		PRIMARY KEY (session_id, teacher_id),
+		INDEX idx_exam_invigilators_teacher (teacher_id),
+		FOREIGN KEY (session_id, room_id) REFERENCES exam_session_rooms(session_id, room_id) ON DELETE CASCADE,
+		FOREIGN KEY (teacher_id) REFERENCES teachers(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS exam_seats(
+		session_id INT NOT NULL,
+		student_id INT NOT NULL,
+		room_id INT NOT NULL,
+		seat INT NOT NULL,
+		seat_row INT NOT NULL,
+		seat_column INT NOT NULL,
+		PRIMARY KEY (session_id, student_id),
+		UNIQUE KEY uq_exam_seats_seat (session_id, room_id, seat),
+		FOREIGN KEY (session_id, room_id) REFERENCES exam_session_rooms(session_id, room_id) ON DELETE CASCADE,
+		FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE
+	);`,
+
+	// GPA scales, course credits and the official transcripts issued to students. Transcripts keep their signed
+	// content, so they stay verifiable after the student's grades change or the student is purged
+	`CREATE TABLE IF NOT EXISTS gpa_scale_bands(
+		school_id INT NOT NULL,
+		min_percent DECIMAL(5,2) NOT NULL,
+		letter VARCHAR(5) NOT NULL,
+		points DECIMAL(4,2) NOT NULL,
+		PRIMARY KEY (school_id, min_percent)
+	);`,
+	`CREATE TABLE IF NOT EXISTS course_credits(
+		school_id INT NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		credits DECIMAL(4,2) NOT NULL,
+		PRIMARY KEY (school_id, subject)
+	);`,
+	`CREATE TABLE IF NOT EXISTS transcripts(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		student_id INT NOT NULL,
+		code VARCHAR(20) NOT NULL UNIQUE,
+		cumulative_gpa DECIMAL(4,2) NOT NULL,
+		content MEDIUMTEXT NOT NULL,
+		signature CHAR(64) NOT NULL,
+		issued_by VARCHAR(255),
+		issued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		revoked_at TIMESTAMP NULL,
+		INDEX idx_transcripts_student (student_id)
+	);`,
+
+	// Fee structures per class and year, standing discounts and scholarships, invoices and the payments against them.
+	// Invoices are voided rather than deleted and keep their total, so payments always have an invoice to belong to.
+	// They are financial records and outlive their student, whom the retention purge keeps while invoices remain
+	`CREATE TABLE IF NOT EXISTS fee_structures(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		academic_year_id INT NOT NULL,
+		class VARCHAR(255) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		created_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE KEY uq_fee_structures_year_class_name (academic_year_id, class, name),
+		FOREIGN KEY (academic_year_id) REFERENCES academic_years(id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS fee_structure_items(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		fee_structure_id INT NOT NULL,
+		description VARCHAR(255) NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		FOREIGN KEY (fee_structure_id) REFERENCES fee_structures(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS fee_discounts(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		student_id INT NOT NULL,
+		academic_year_id INT NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		description VARCHAR(255) NOT NULL,
+		percent DECIMAL(5,2) NOT NULL DEFAULT 0,
+		amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+		created_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_fee_discounts_student_year (student_id, academic_year_id),
+		FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+		FOREIGN KEY (academic_year_id) REFERENCES academic_years(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS invoices(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		student_id INT NOT NULL,
+		fee_structure_id INT NULL,
+		issue_date DATE NOT NULL,
+		due_date DATE NOT NULL,
+		total DECIMAL(10,2) NOT NULL,
+		notes VARCHAR(500),
+		reminders INT NOT NULL DEFAULT 0,
+		last_reminded_at DATETIME NULL,
+		created_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		voided_at DATETIME NULL,
+		voided_by VARCHAR(255),
+		UNIQUE KEY uq_invoices_structure_student (fee_structure_id, student_id),
+		INDEX idx_invoices_school_due (school_id, due_date),
+		INDEX idx_invoices_student (student_id),
+		CONSTRAINT fk_invoices_student FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE RESTRICT,
+		FOREIGN KEY (fee_structure_id) REFERENCES fee_structures(id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS invoice_lines(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		invoice_id INT NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		description VARCHAR(255) NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS fee_payments(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		invoice_id INT NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		method VARCHAR(20) NOT NULL,
+		reference VARCHAR(255),
+		paid_on DATE NOT NULL,
+		recorded_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_fee_payments_invoice (invoice_id),
+		FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE
+	);`,
+	// Databases created before invoices outlived their student still cascade through the unnamed key
+	`ALTER TABLE invoices DROP FOREIGN KEY IF EXISTS invoices_ibfk_1,
+		ADD CONSTRAINT fk_invoices_student FOREIGN KEY IF NOT EXISTS (student_id) REFERENCES students(id) ON DELETE RESTRICT;`,
+
+	// Admission applications submitted by the public, their guardians, documents, reviewer notes and the history of
+	// their statuses. Documents are kept in the database so that every replica can serve them
+	`CREATE TABLE IF NOT EXISTS admission_applications(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		reference VARCHAR(11) NOT NULL UNIQUE,
+		status VARCHAR(20) NOT NULL,
+		first_name VARCHAR(255) NOT NULL,
+		last_name VARCHAR(255) NOT NULL,
+		date_of_birth DATE NOT NULL,
+		email VARCHAR(255) NOT NULL,
+		class VARCHAR(255) NOT NULL,
+		academic_year_id INT NULL,
+		previous_school VARCHAR(255),
+		assigned_to INT NULL,
+		student_id INT NULL,
+		submitted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		converted_at DATETIME NULL,
+		converted_by VARCHAR(255),
+		INDEX idx_admission_applications_school_status (school_id, status),
+		INDEX idx_admission_applications_assigned (assigned_to),
+		FOREIGN KEY (academic_year_id) REFERENCES academic_years(id) ON DELETE SET NULL,
+		FOREIGN KEY (assigned_to) REFERENCES execs(id) ON DELETE SET NULL,
+		FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE SET NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS admission_guardians(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		application_id INT NOT NULL,
+		first_name VARCHAR(255) NOT NULL,
+		last_name VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL,
+		phone VARCHAR(50),
+		relationship VARCHAR(50),
+		FOREIGN KEY (application_id) REFERENCES admission_applications(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS admission_documents(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		application_id INT NOT NULL,
+		kind VARCHAR(50) NOT NULL,
+		filename VARCHAR(255) NOT NULL,
+		content_type VARCHAR(50) NOT NULL,
+		size INT NOT NULL,
+		content MEDIUMBLOB NOT NULL,
+		uploaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (application_id) REFERENCES admission_applications(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS admission_notes(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		application_id INT NOT NULL,
+		author VARCHAR(255) NOT NULL,
+		body TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (application_id) REFERENCES admission_applications(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS admission_stages(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		application_id INT NOT NULL,
+		from_status VARCHAR(20),
+		to_status VARCHAR(20) NOT NULL,
+		reason VARCHAR(500),
+		changed_by VARCHAR(255),
+		changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (application_id) REFERENCES admission_applications(id) ON DELETE CASCADE
+	);`,
+	// Leave requests of teachers and students, the approval chain each kind follows, each request's own copy of the
+	// chain and the lessons and invigilations approved teacher leave leaves without cover
+	`CREATE TABLE IF NOT EXISTS leave_chains(
+		school_id INT NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		steps VARCHAR(255) NOT NULL,
+		updated_by VARCHAR(255),
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (school_id, kind)
+	);`,
+	`CREATE TABLE IF NOT EXISTS leave_requests(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		teacher_id INT NULL,
+		student_id INT NULL,
+		start_date DATE NOT NULL,
+		end_date DATE NOT NULL,
+		days INT NOT NULL,
+		reason VARCHAR(1000) NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		step INT NOT NULL DEFAULT 0,
+		requested_by VARCHAR(255),
+		requested_by_id INT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		decided_at DATETIME NULL,
+		INDEX idx_leave_requests_school (school_id, status, start_date),
+		INDEX idx_leave_requests_teacher (teacher_id, start_date),
+		INDEX idx_leave_requests_student (student_id, start_date),
+		FOREIGN KEY (teacher_id) REFERENCES teachers(id) ON DELETE CASCADE,
+		FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS leave_approvals(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		leave_id INT NOT NULL,
+		position INT NOT NULL,
+		role VARCHAR(50) NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		decided_by VARCHAR(255),
+		comment VARCHAR(500),
+		decided_at DATETIME NULL,
+		UNIQUE KEY uq_leave_approvals_position (leave_id, position),
+		FOREIGN KEY (leave_id) REFERENCES leave_requests(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS leave_cover(
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		school_id INT NOT NULL,
+		leave_id INT NOT NULL,
+		teacher_id INT NOT NULL,
+		date DATE NOT NULL,
+		class VARCHAR(255),
+		subject VARCHAR(255),
+		exam_session_id INT NULL,
+		substitute_id INT NULL,
+		updated_by VARCHAR(255),
+		INDEX idx_leave_cover_school (school_id, date),
+		FOREIGN KEY (leave_id) REFERENCES leave_requests(id) ON DELETE CASCADE
+	);`,
+	// leave_id marks the attendance approved student leave excused
+	`ALTER TABLE attendance ADD COLUMN IF NOT EXISTS leave_id INT NULL;`,
+}
@@ -27,19 +27,11 @@ func InitDB() error {
 		return err
 	}
 
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS teachers(
-			id INT AUTO_INCREMENT PRIMARY KEY, 
-			first_name VARCHAR(255) NOT NULL,
-			last_name VARCHAR(255) NOT NULL,
-			email VARCHAR(255) NOT NULL UNIQUE,
-			class VARCHAR(255) NOT NULL, 
-			subject VARCHAR(255) NOT NULL,
-			INDEX(email)
-		);
-	`)
-	if err != nil {
-		return err
+	for _, statement := range schema {
+		_, err = db.Exec(statement)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
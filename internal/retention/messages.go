@@ -0,0 +1,56 @@
+package retention
+
+import (
+	"ClassConnect/internal/audit"
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+)
+
+// MessageRetention is how long messages are kept, from MESSAGE_RETENTION_DAYS. Zero, the default, keeps them forever
+func MessageRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("MESSAGE_RETENTION_DAYS"))
+	if err != nil || days < 1 {
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PurgeMessages permanently removes messages older than retention, then the threads left without messages.
+// The audit log records how many were removed rather than their contents
+func PurgeMessages(db *sql.DB, retention time.Duration) (int, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+	seconds := int64(retention / time.Second)
+	purged := 0
+	for {
+		res, err := db.Exec("DELETE FROM messages WHERE created_at < NOW() - INTERVAL ? SECOND LIMIT ?", seconds, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+		purged += int(n)
+		if n < purgeBatchSize {
+			break
+		}
+	}
+
+	res, err := db.Exec("DELETE FROM message_threads WHERE NOT EXISTS (SELECT 1 FROM messages m WHERE m.thread_id = message_threads.id) AND COALESCE(last_message_at, created_at) < NOW() - INTERVAL ? SECOND", seconds)
+	if err != nil {
+		return purged, err
+	}
+	threads, err := res.RowsAffected()
+	if err != nil {
+		return purged, err
+	}
+
+	if purged > 0 {
+		audit.RecordSystem(db, audit.ActionPurge, "messages", nil, nil, map[string]any{"messages": purged, "threads": threads, "older_than_days": seconds / 86400})
+	}
+	return purged, nil
+}
@@ -0,0 +1,137 @@
+package retention
+
+import (
+	"ClassConnect/internal/audit"
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetentionDays = 30
+	defaultPurgeSchedule = "0 3 * * *"
+	// purgeBatchSize bounds how many rows of a table are loaded at once
+	purgeBatchSize = 500
+)
+
+// Tables lists the soft-deletable tables swept by the purge
+var Tables = []string{"students", "teachers", "execs"}
+
+// kept holds, per table, the condition of rows that are never purged and why. Invoices are financial records that
+// must outlive the student, and the foreign key refuses to delete a student who still has some
+var kept = map[string]struct{ condition, reason string }{
+	"students": {"EXISTS (SELECT 1 FROM invoices i WHERE i.student_id = students.id)", "they have invoices"},
+}
+
+// RetentionPeriod is how long soft-deleted rows are kept, from SOFT_DELETE_RETENTION_DAYS
+func RetentionPeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("SOFT_DELETE_RETENTION_DAYS"))
+	if err != nil || days < 1 {
+		days = defaultRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PurgeSchedule is when the purge runs as a cron expression, from PURGE_SCHEDULE. Daily at 03:00 by default
+func PurgeSchedule() string {
+	schedule := os.Getenv("PURGE_SCHEDULE")
+	if schedule == "" {
+		schedule = defaultPurgeSchedule
+	}
+	return schedule
+}
+
+// Purge permanently removes rows that were soft-deleted longer than retention ago.
+// Every removed row is written to the audit log with its last state
+func Purge(db *sql.DB, retention time.Duration) (int, error) {
+	seconds := int64(retention / time.Second)
+	purged := 0
+	for _, table := range Tables {
+		expired := "deleted_at < NOW() - INTERVAL ? SECOND"
+		if keep, ok := kept[table]; ok {
+			var count int
+			err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE "+expired+" AND "+keep.condition, seconds).Scan(&count)
+			if err != nil {
+				return purged, err
+			}
+			if count > 0 {
+				log.Printf("Purge: keeping %d %s past retention because %s\n", count, table, keep.reason)
+			}
+			expired += " AND NOT " + keep.condition
+		}
+
+		for {
+			rows, err := loadExpired(db, table, expired, seconds)
+			if err != nil {
+				return purged, err
+			}
+
+			for _, row := range rows {
+				// The condition is repeated in case the row was restored or became kept since it was loaded
+				res, err := db.Exec("DELETE FROM "+table+" WHERE id = ? AND "+expired, row["id"], seconds)
+				if err != nil {
+					return purged, err
+				}
+				rowsAffected, err := res.RowsAffected()
+				if err != nil {
+					return purged, err
+				}
+				if rowsAffected > 0 {
+					// The change history goes with the record, the audit entry below keeps its final state
+					_, err = db.Exec("DELETE FROM "+table+"_history WHERE id = ?", row["id"])
+					if err != nil {
+						return purged, err
+					}
+					purged++
+					audit.RecordSystem(db, audit.ActionPurge, table, row["id"], row, nil)
+				}
+			}
+
+			if len(rows) < purgeBatchSize {
+				break
+			}
+		}
+	}
+	return purged, nil
+}
+
+// loadExpired reads a batch of the rows matching condition, which selects the expired rows that may go, as column maps.
+// They become the audit log's before state
+func loadExpired(db *sql.DB, table, condition string, seconds int64) ([]map[string]any, error) {
+	rows, err := db.Query("SELECT * FROM "+table+" WHERE "+condition+" ORDER BY id LIMIT ?", seconds, purgeBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make([]map[string]any, 0)
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			if values[i].Valid {
+				row[column] = values[i].String
+			} else {
+				row[column] = nil
+			}
+		}
+		expired = append(expired, row)
+	}
+	return expired, rows.Err()
+}
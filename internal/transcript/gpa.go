@@ -0,0 +1,111 @@
+package transcript
+
+import (
+	"ClassConnect/internal/models"
+	"database/sql"
+	"math"
+	"slices"
+	"strings"
+)
+
+// DefaultScale is the 4.0 scale used by schools that have not configured their own
+var DefaultScale = []models.GradeBand{
+	{MinPercent: 90, Letter: "A", Points: 4},
+	{MinPercent: 80, Letter: "B", Points: 3},
+	{MinPercent: 70, Letter: "C", Points: 2},
+	{MinPercent: 60, Letter: "D", Points: 1},
+	{MinPercent: 0, Letter: "F", Points: 0},
+}
+
+// defaultCredits is the weight of subjects without configured credits
+const defaultCredits = 1.0
+
+// LoadScale reads the grading scale of a school from the highest band down, or DefaultScale when it has none
+func LoadScale(db *sql.DB, schoolId int) ([]models.GradeBand, error) {
+	rows, err := db.Query("SELECT min_percent, letter, points FROM gpa_scale_bands WHERE school_id = ? ORDER BY min_percent DESC", schoolId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scale := make([]models.GradeBand, 0)
+	for rows.Next() {
+		var band models.GradeBand
+		err = rows.Scan(&band.MinPercent, &band.Letter, &band.Points)
+		if err != nil {
+			return nil, err
+		}
+		scale = append(scale, band)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(scale) == 0 {
+		return slices.Clone(DefaultScale), nil
+	}
+	return scale, nil
+}
+
+// LoadCredits reads the configured credits of a school's subjects, keyed by lower case subject
+func LoadCredits(db *sql.DB, schoolId int) (map[string]float64, error) {
+	rows, err := db.Query("SELECT subject, credits FROM course_credits WHERE school_id = ?", schoolId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make(map[string]float64)
+	for rows.Next() {
+		var subject string
+		var value float64
+		err = rows.Scan(&subject, &value)
+		if err != nil {
+			return nil, err
+		}
+		credits[strings.ToLower(subject)] = value
+	}
+	return credits, rows.Err()
+}
+
+// Band returns the band of the scale a percentage falls in. Scales are ordered from the highest band down
+// and always end with a band starting at 0
+func Band(scale []models.GradeBand, percent float64) models.GradeBand {
+	for _, band := range scale {
+		if percent >= band.MinPercent {
+			return band
+		}
+	}
+	return scale[len(scale)-1]
+}
+
+// GPA averages the grade points of the courses weighted by their credits. Courses without credits do not count
+func GPA(courses []models.TranscriptCourse) (gpa, credits float64) {
+	var points float64
+	for _, course := range courses {
+		points += course.Points * course.Credits
+		credits += course.Credits
+	}
+	if credits == 0 {
+		return 0, 0
+	}
+	return round2(points / credits), credits
+}
+
+// Course grades one term result of a subject against the scale
+func Course(grade models.Grade, scale []models.GradeBand, credits map[string]float64) models.TranscriptCourse {
+	course := models.TranscriptCourse{Subject: grade.Subject, Credits: defaultCredits}
+	if value, ok := credits[strings.ToLower(grade.Subject)]; ok {
+		course.Credits = value
+	}
+	if grade.MaxScore > 0 {
+		course.Percent = math.Round(grade.Score/grade.MaxScore*1000) / 10
+	}
+	band := Band(scale, course.Percent)
+	course.Letter = band.Letter
+	course.Points = band.Points
+	return course
+}
+
+func round2(n float64) float64 {
+	return math.Round(n*100) / 100
+}
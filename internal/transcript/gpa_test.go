@@ -0,0 +1,91 @@
+package transcript
+
+import (
+	"ClassConnect/internal/models"
+	"testing"
+)
+
+func TestBand(t *testing.T) {
+	tests := []struct {
+		percent float64
+		want    string
+	}{
+		{100, "A"},
+		{90, "A"},
+		{89.9, "B"},
+		{70, "C"},
+		{60, "D"},
+		{59.99, "F"},
+		{0, "F"},
+		{-5, "F"},
+	}
+	for _, test := range tests {
+		if got := Band(DefaultScale, test.percent); got.Letter != test.want {
+			t.Errorf("Band(%v) = %s, want %s", test.percent, got.Letter, test.want)
+		}
+	}
+}
+
+func TestCourse(t *testing.T) {
+	credits := map[string]float64{"mathematics": 2, "art": 0}
+	tests := []struct {
+		name        string
+		grade       models.Grade
+		wantPercent float64
+		wantLetter  string
+		wantPoints  float64
+		wantCredits float64
+	}{
+		{"configured credits ignore case", models.Grade{Subject: "Mathematics", Score: 44.5, MaxScore: 50}, 89, "B", 3, 2},
+		{"default credits", models.Grade{Subject: "History", Score: 19, MaxScore: 20}, 95, "A", 4, 1},
+		{"percent rounded to one decimal", models.Grade{Subject: "History", Score: 2, MaxScore: 3}, 66.7, "D", 1, 1},
+		{"zero credits kept", models.Grade{Subject: "Art", Score: 7, MaxScore: 10}, 70, "C", 2, 0},
+		{"no maximum score", models.Grade{Subject: "History", Score: 10}, 0, "F", 0, 1},
+	}
+	for _, test := range tests {
+		course := Course(test.grade, DefaultScale, credits)
+		if course.Percent != test.wantPercent || course.Letter != test.wantLetter || course.Points != test.wantPoints || course.Credits != test.wantCredits {
+			t.Errorf("%s: Course() = %+v, want %v%% %s %v points %v credits", test.name, course, test.wantPercent, test.wantLetter, test.wantPoints, test.wantCredits)
+		}
+	}
+}
+
+func TestGPA(t *testing.T) {
+	course := func(points, credits float64) models.TranscriptCourse {
+		return models.TranscriptCourse{Points: points, Credits: credits}
+	}
+	tests := []struct {
+		name        string
+		courses     []models.TranscriptCourse
+		wantGPA     float64
+		wantCredits float64
+	}{
+		{"equal weights", []models.TranscriptCourse{course(4, 1), course(3, 1)}, 3.5, 2},
+		{"weighted by credits", []models.TranscriptCourse{course(4, 2), course(2, 1)}, 3.33, 3},
+		{"fractional credits", []models.TranscriptCourse{course(3.7, 0.5), course(2.7, 1.5)}, 2.95, 2},
+		{"courses without credits do not count", []models.TranscriptCourse{course(4, 0), course(1, 1)}, 1, 1},
+		{"no credits at all", []models.TranscriptCourse{course(4, 0)}, 0, 0},
+		{"no courses", nil, 0, 0},
+	}
+	for _, test := range tests {
+		gpa, credits := GPA(test.courses)
+		if gpa != test.wantGPA || credits != test.wantCredits {
+			t.Errorf("%s: GPA() = %v over %v credits, want %v over %v", test.name, gpa, credits, test.wantGPA, test.wantCredits)
+		}
+	}
+}
+
+func TestFilename(t *testing.T) {
+	tests := []struct {
+		transcript models.Transcript
+		want       string
+	}{
+		{models.Transcript{StudentId: 7, FirstName: "Ann", LastName: "O'Neil"}, "transcript-7-o-neil-ann.pdf"},
+		{models.Transcript{StudentId: 12, FirstName: "José", LastName: "García López"}, "transcript-12-garc-a-l-pez-jos.pdf"},
+	}
+	for _, test := range tests {
+		if got := Filename(test.transcript); got != test.want {
+			t.Errorf("Filename() = %q, want %q", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package transcript
+
+import (
+	"ClassConnect/internal/models"
+	"ClassConnect/pkg/utils"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Layout of the transcript, in points
+const (
+	margin       = 50.0
+	bottomMargin = 90.0
+	bodySize     = 10.0
+	lineHeight   = 15.0
+)
+
+// courseColumns are the x positions of the course table columns
+var courseColumns = struct{ subject, percent, letter, points, credits float64 }{margin, 300, 360, 410, 470}
+
+// Render writes an official transcript as a PDF, with its verification code at the bottom of every page
+func Render(t models.Transcript, w io.Writer) error {
+	doc := utils.NewPDFDocument()
+	y := 0.0
+	newPage := func() {
+		doc.AddPage()
+		y = utils.PDFPageHeight - margin - 10
+		footer(doc, t, doc.PageCount())
+	}
+	// ensure starts a new page when fewer than lines are left on this one
+	ensure := func(lines int) {
+		if y-float64(lines)*lineHeight < bottomMargin {
+			newPage()
+		}
+	}
+	newPage()
+
+	doc.Text(margin, y, 18, true, t.School)
+	y -= lineHeight * 1.6
+	doc.Text(margin, y, 13, false, "Official Academic Transcript")
+	y -= lineHeight * 1.6
+	for _, field := range [][2]string{
+		{"Student", fmt.Sprintf("%s %s", t.FirstName, t.LastName)},
+		{"Student ID", fmt.Sprint(t.StudentId)},
+		{"Class", t.Class},
+		{"Issued", strings.Replace(strings.TrimSuffix(t.IssuedAt, "Z"), "T", " ", 1) + " UTC"},
+	} {
+		doc.Text(margin, y, bodySize, true, field[0])
+		doc.Text(130, y, bodySize, false, field[1])
+		y -= lineHeight
+	}
+	doc.Line(margin, y+lineHeight/2, utils.PDFPageWidth-margin, y+lineHeight/2, 0.5)
+	y -= lineHeight
+
+	if len(t.Terms) == 0 {
+		doc.Text(margin, y, bodySize, false, "No grades have been recorded.")
+		y -= lineHeight
+	}
+	for _, term := range t.Terms {
+		ensure(len(term.Courses) + 3)
+		doc.Text(margin, y, 12, true, fmt.Sprintf("%s, %s", term.Term, term.AcademicYear))
+		doc.Text(courseColumns.percent, y, bodySize, false, "Class "+truncate(term.Class, 24))
+		y -= lineHeight * 1.2
+		doc.Text(courseColumns.subject, y, bodySize, true, "Course")
+		doc.Text(courseColumns.percent, y, bodySize, true, "%")
+		doc.Text(courseColumns.letter, y, bodySize, true, "Grade")
+		doc.Text(courseColumns.points, y, bodySize, true, "Points")
+		doc.Text(courseColumns.credits, y, bodySize, true, "Credits")
+		y -= lineHeight
+		for _, course := range term.Courses {
+			ensure(1)
+			doc.Text(courseColumns.subject, y, bodySize, false, truncate(course.Subject, 40))
+			doc.Text(courseColumns.percent, y, bodySize, false, fmt.Sprintf("%.1f", course.Percent))
+			doc.Text(courseColumns.letter, y, bodySize, false, course.Letter)
+			doc.Text(courseColumns.points, y, bodySize, false, fmt.Sprintf("%.2f", course.Points))
+			doc.Text(courseColumns.credits, y, bodySize, false, fmt.Sprintf("%g", course.Credits))
+			y -= lineHeight
+		}
+		ensure(1)
+		doc.Text(courseColumns.subject, y, bodySize, true, "Term GPA")
+		doc.Text(courseColumns.points, y, bodySize, true, fmt.Sprintf("%.2f", term.GPA))
+		doc.Text(courseColumns.credits, y, bodySize, true, fmt.Sprintf("%g", term.Credits))
+		y -= lineHeight * 1.6
+	}
+
+	ensure(5)
+	doc.Line(margin, y+lineHeight/2, utils.PDFPageWidth-margin, y+lineHeight/2, 0.5)
+	y -= lineHeight
+	doc.Text(courseColumns.subject, y, 12, true, fmt.Sprintf("Cumulative GPA %.2f of %.2f", t.CumulativeGPA, t.MaxPoints))
+	doc.Text(courseColumns.credits, y, bodySize, true, fmt.Sprintf("%g credits", t.Credits))
+	y -= lineHeight * 1.4
+
+	bands := make([]string, 0, len(t.Scale))
+	for _, band := range t.Scale {
+		bands = append(bands, fmt.Sprintf("%s %g%%+ = %g", band.Letter, band.MinPercent, band.Points))
+	}
+	doc.Text(margin, y, 8, false, "Grading scale: "+strings.Join(bands, ", "))
+	y -= lineHeight * 3
+
+	ensure(2)
+	doc.Line(margin, y, margin+200, y, 0.5)
+	y -= lineHeight * 0.8
+	doc.Text(margin, y, bodySize, false, "Issued by "+t.IssuedBy)
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// footer prints how to verify the transcript at the bottom of a page
+func footer(doc *utils.PDFDocument, t models.Transcript, page int) {
+	doc.Text(margin, margin, 8, true, "Verification code "+t.Code)
+	doc.Text(margin, margin-12, 8, false, fmt.Sprintf("Check this transcript at /transcripts/verify/%s. Page %d", t.Code, page))
+}
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "…"
+}
@@ -0,0 +1,199 @@
+package transcript
+
+import (
+	"ClassConnect/internal/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStudentNotFound    = errors.New("student not found")
+	ErrTranscriptNotFound = errors.New("transcript not found")
+	// ErrSigningKeyMissing is returned when TRANSCRIPT_SIGNING_KEY is not set, official transcripts cannot be issued
+	// or verified without it
+	ErrSigningKeyMissing = errors.New("TRANSCRIPT_SIGNING_KEY is not set")
+)
+
+// codeAlphabet leaves out the letters and digits that are easily confused when a code is typed from paper
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// unsafeFilename matches what is dropped from student names when naming transcript files
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// Load compiles the transcript of a live student from the final grades of every term they were graded in,
+// weighted by the credits and graded on the scale of the student's school
+func Load(db *sql.DB, studentId int) (models.Transcript, error) {
+	var t models.Transcript
+	var schoolId int
+	err := db.QueryRow("SELECT s.id, s.first_name, s.last_name, s.class, s.school_id, sc.name FROM students s JOIN schools sc ON sc.id = s.school_id WHERE s.id = ? AND s.deleted_at IS NULL", studentId).Scan(
+		&t.StudentId, &t.FirstName, &t.LastName, &t.Class, &schoolId, &t.School,
+	)
+	if err == sql.ErrNoRows {
+		return t, ErrStudentNotFound
+	} else if err != nil {
+		return t, err
+	}
+
+	t.Scale, err = LoadScale(db, schoolId)
+	if err != nil {
+		return t, err
+	}
+	t.MaxPoints = t.Scale[0].Points
+	credits, err := LoadCredits(db, schoolId)
+	if err != nil {
+		return t, err
+	}
+
+	// The class of each term is the one the student was enrolled in that year, falling back to the current one
+	rows, err := db.Query(`SELECT t.id, t.name, y.name, t.start_date, t.end_date, COALESCE(e.class, ?), g.subject, g.score, g.max_score
+		FROM grades g JOIN terms t ON t.id = g.term_id JOIN academic_years y ON y.id = t.academic_year_id
+		LEFT JOIN enrollments e ON e.student_id = g.student_id AND e.academic_year_id = t.academic_year_id
+		WHERE g.student_id = ? ORDER BY t.start_date, t.id, g.subject`, t.Class, studentId,
+	)
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+
+	t.Terms = make([]models.TranscriptTerm, 0)
+	all := make([]models.TranscriptCourse, 0)
+	for rows.Next() {
+		var term models.TranscriptTerm
+		var grade models.Grade
+		err = rows.Scan(&term.TermId, &term.Term, &term.AcademicYear, &term.StartDate, &term.EndDate, &term.Class, &grade.Subject, &grade.Score, &grade.MaxScore)
+		if err != nil {
+			return t, err
+		}
+		if len(t.Terms) == 0 || t.Terms[len(t.Terms)-1].TermId != term.TermId {
+			term.Courses = make([]models.TranscriptCourse, 0)
+			t.Terms = append(t.Terms, term)
+		}
+		last := &t.Terms[len(t.Terms)-1]
+		course := Course(grade, t.Scale, credits)
+		last.Courses = append(last.Courses, course)
+		all = append(all, course)
+	}
+	if err = rows.Err(); err != nil {
+		return t, err
+	}
+
+	for i := range t.Terms {
+		t.Terms[i].GPA, t.Terms[i].Credits = GPA(t.Terms[i].Courses)
+	}
+	t.CumulativeGPA, t.Credits = GPA(all)
+	return t, nil
+}
+
+// Issue makes an official copy of a transcript: it gets a verification code, and its content is signed and kept so
+// that third parties can check it against the copy they were handed
+func Issue(db *sql.DB, t models.Transcript, issuedBy string) (models.Transcript, error) {
+	key, err := signingKey()
+	if err != nil {
+		return t, err
+	}
+	t.Code, err = newCode()
+	if err != nil {
+		return t, err
+	}
+	t.IssuedBy = issuedBy
+	t.IssuedAt = time.Now().UTC().Format(time.RFC3339)
+
+	content, err := json.Marshal(t)
+	if err != nil {
+		return t, err
+	}
+	_, err = db.Exec(`INSERT INTO transcripts(school_id, student_id, code, cumulative_gpa, content, signature, issued_by)
+		SELECT school_id, id, ?, ?, ?, ?, ? FROM students WHERE id = ?`,
+		t.Code, t.CumulativeGPA, content, Sign(key, content), issuedBy, t.StudentId,
+	)
+	return t, err
+}
+
+// Verify looks up an official transcript by its code and checks its signature
+func Verify(db *sql.DB, code string) (models.TranscriptVerification, error) {
+	verification := models.TranscriptVerification{Code: NormalizeCode(code)}
+	key, err := signingKey()
+	if err != nil {
+		return verification, err
+	}
+
+	var content []byte
+	var signature string
+	var revokedAt sql.NullString
+	err = db.QueryRow("SELECT content, signature, revoked_at FROM transcripts WHERE code = ?", verification.Code).Scan(&content, &signature, &revokedAt)
+	if err == sql.ErrNoRows {
+		return verification, ErrTranscriptNotFound
+	} else if err != nil {
+		return verification, err
+	}
+
+	if !hmac.Equal([]byte(Sign(key, content)), []byte(signature)) {
+		verification.Status = "invalid"
+		return verification, nil
+	}
+	var t models.Transcript
+	err = json.Unmarshal(content, &t)
+	if err != nil {
+		return verification, err
+	}
+	verification.Transcript = &t
+	verification.Status = "valid"
+	if revokedAt.Valid {
+		verification.Status = "revoked"
+		verification.RevokedAt = revokedAt.String
+	}
+	return verification, nil
+}
+
+// Sign computes the hex HMAC-SHA256 of a transcript's content
+func Sign(key, content []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NormalizeCode accepts codes typed in lower case or with surrounding spaces
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Filename names the PDF of a transcript after the student
+func Filename(t models.Transcript) string {
+	name := strings.Trim(unsafeFilename.ReplaceAllString(fmt.Sprintf("%s-%s", t.LastName, t.FirstName), "-"), "-")
+	return fmt.Sprintf("transcript-%d-%s.pdf", t.StudentId, strings.ToLower(name))
+}
+
+func signingKey() ([]byte, error) {
+	key := os.Getenv("TRANSCRIPT_SIGNING_KEY")
+	if key == "" {
+		return nil, ErrSigningKeyMissing
+	}
+	return []byte(key), nil
+}
+
+// newCode returns a random code of two groups of five characters, e.g. "K7QMX-3HPRA"
+func newCode() (string, error) {
+	random := make([]byte, 10)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 11)
+	for i, b := range random {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, codeAlphabet[int(b)%len(codeAlphabet)])
+	}
+	return string(code), nil
+}
@@ -0,0 +1,363 @@
+package webhooks
+
+import (
+	"ClassConnect/internal/audit"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxAttempts is how often a delivery is tried before it is marked failed
+	MaxAttempts = 8
+	// firstRetryDelay doubles after every failed attempt up to maxRetryDelay
+	firstRetryDelay = 30 * time.Second
+	maxRetryDelay   = 6 * time.Hour
+	// leaseDuration keeps a claimed delivery from being sent twice, and lets it be retried if this process dies mid-send
+	leaseDuration = 60 * time.Second
+	pollInterval  = 5 * time.Second
+	batchSize     = 20
+	timeout       = 10 * time.Second
+	// maxErrorLength fits the error columns
+	maxErrorLength = 255
+)
+
+// TypePing is sent by the test endpoint to check a receiver
+const TypePing = "webhook.ping"
+
+// EventTypes lists the events a webhook may subscribe to. "*" subscribes to all of them
+var EventTypes = []string{
+	"student.created", "student.updated", "student.class_changed", "student.deleted", "student.restored", "student.imported",
+	"teacher.created", "teacher.updated", "teacher.class_changed", "teacher.deleted", "teacher.restored", "teacher.imported",
+	"exec.created", "exec.updated", "exec.deleted", "exec.restored",
+}
+
+// Payload is the JSON body of every delivery
+type Payload struct {
+	Event      string    `json:"event"`
+	SchoolId   int       `json:"school_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// wake nudges the dispatcher when a delivery is queued so it does not wait for the next poll
+var wake = make(chan struct{}, 1)
+
+// ErrInternalAddress is returned for receivers on loopback, private, link-local or unspecified addresses, so a webhook
+// cannot be used to reach services inside the network
+var ErrInternalAddress = errors.New("url must not point to an internal address")
+
+// client checks every address it connects to, not only the one validated when the webhook was saved, since the
+// receiver's DNS may change. It does not use a proxy, which would hide the receiver's address from the check, and
+// does not follow redirects, which could lead to an internal address
+var client = &http.Client{
+	Timeout: timeout,
+	Transport: &http.Transport{
+		ForceAttemptHTTP2:   true,
+		DialContext:         (&net.Dialer{Timeout: timeout, Control: dialControl}).DialContext,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// PublicAddress reports whether webhooks may be delivered to the IP address
+func PublicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsUnspecified()
+}
+
+// CheckHost resolves a receiver host and returns ErrInternalAddress unless every address it has is public
+func CheckHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !PublicAddress(addr.IP) {
+			return ErrInternalAddress
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to internal addresses once the receiver host has been resolved
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !PublicAddress(ip) {
+		return ErrInternalAddress
+	}
+	return nil
+}
+
+// ValidEventType reports whether a webhook may subscribe to the event type
+func ValidEventType(eventType string) bool {
+	return eventType == "*" || slices.Contains(EventTypes, eventType)
+}
+
+// NotifyChange queues a record lifecycle event whose data holds the record before and after the change,
+// without the fields the audit log also leaves out
+func NotifyChange(db *sql.DB, schoolId int, eventType string, before, after any) {
+	beforeState, err := audit.MarshalState(before)
+	if err == nil {
+		var afterState json.RawMessage
+		afterState, err = audit.MarshalState(after)
+		if err == nil {
+			Notify(db, schoolId, eventType, map[string]any{"before": nullable(beforeState), "after": nullable(afterState)})
+			return
+		}
+	}
+	log.Println("Webhook payload error:", err)
+}
+
+// Notify queues an event for every active webhook of the school subscribed to it.
+// Failures are logged rather than returned, like audit entries a lost notification must not fail the change itself
+func Notify(db *sql.DB, schoolId int, eventType string, data any) {
+	rows, err := db.Query("SELECT id, event_types FROM webhooks WHERE school_id = ? AND active = TRUE", schoolId)
+	if err != nil {
+		log.Println("Webhook query error:", err)
+		return
+	}
+	subscribed := make([]int, 0)
+	for rows.Next() {
+		var id int
+		var types string
+		if rows.Scan(&id, &types) != nil {
+			continue
+		}
+		if subscribes(types, eventType) {
+			subscribed = append(subscribed, id)
+		}
+	}
+	rows.Close()
+
+	for _, webhookId := range subscribed {
+		err = Enqueue(db, webhookId, schoolId, eventType, data)
+		if err != nil {
+			log.Printf("Error queueing %s for webhook %d: %v\n", eventType, webhookId, err)
+		}
+	}
+}
+
+// Enqueue adds a delivery of an event to one webhook, due right away
+func Enqueue(db *sql.DB, webhookId, schoolId int, eventType string, data any) error {
+	body, err := json.Marshal(Payload{Event: eventType, SchoolId: schoolId, OccurredAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO webhook_deliveries(webhook_id, event_type, payload, next_attempt_at) VALUES(?,?,?,UTC_TIMESTAMP(6))", webhookId, eventType, string(body))
+	if err != nil {
+		return err
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts, keeping its attempt log
+func Redeliver(db *sql.DB, deliveryId int64) error {
+	_, err := db.Exec("UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = UTC_TIMESTAMP(6), delivered_at = NULL WHERE id = ?", deliveryId)
+	if err == nil {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return err
+}
+
+// StartDispatcher sends due deliveries in the background. The queue lives in the database, so deliveries survive
+// restarts and several API instances can share it
+func StartDispatcher(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			for {
+				sent, err := dispatchDue(db)
+				if err != nil {
+					log.Println("Webhook dispatch error:", err)
+				}
+				if sent < batchSize {
+					break
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-wake:
+			}
+		}
+	}()
+}
+
+// dispatchDue claims and sends a batch of due deliveries, returning how many it claimed
+func dispatchDue(db *sql.DB) (int, error) {
+	rows, err := db.Query("SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= UTC_TIMESTAMP(6) ORDER BY next_attempt_at LIMIT ?", batchSize)
+	if err != nil {
+		return 0, err
+	}
+	due := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, id)
+	}
+	rows.Close()
+
+	claimed := 0
+	for _, id := range due {
+		// Pushing next_attempt_at into the future is the lease, only one dispatcher wins the update
+		res, err := db.Exec("UPDATE webhook_deliveries SET next_attempt_at = UTC_TIMESTAMP(6) + INTERVAL ? SECOND WHERE id = ? AND status = 'pending' AND next_attempt_at <= UTC_TIMESTAMP(6)",
+			int(leaseDuration/time.Second), id,
+		)
+		if err != nil {
+			return claimed, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		claimed++
+		err = deliver(db, id)
+		if err != nil {
+			log.Printf("Webhook delivery %d error: %v\n", id, err)
+		}
+	}
+	return claimed, nil
+}
+
+// deliver makes one attempt at a claimed delivery and records its outcome
+func deliver(db *sql.DB, deliveryId int64) error {
+	var url, secret, eventType, payload string
+	var attempts int
+	err := db.QueryRow("SELECT w.url, w.secret, d.event_type, d.payload, d.attempts FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id WHERE d.id = ?", deliveryId).Scan(
+		&url, &secret, &eventType, &payload, &attempts,
+	)
+	if err != nil {
+		return err
+	}
+	attempts++
+
+	start := time.Now()
+	statusCode, sendErr := send(url, secret, eventType, deliveryId, []byte(payload))
+	duration := time.Since(start)
+
+	var errText any
+	if sendErr != nil {
+		errText = truncate(sendErr.Error())
+	} else if statusCode < 200 || statusCode > 299 {
+		errText = fmt.Sprintf("receiver responded with %d", statusCode)
+	}
+	var code any
+	if statusCode != 0 {
+		code = statusCode
+	}
+
+	_, err = db.Exec("INSERT INTO webhook_delivery_attempts(delivery_id, attempt, status_code, error, duration_ms) VALUES(?,?,?,?,?)",
+		deliveryId, attempts, code, errText, int(duration/time.Millisecond),
+	)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case errText == nil:
+		_, err = db.Exec("UPDATE webhook_deliveries SET status = 'succeeded', attempts = ?, last_status_code = ?, last_error = NULL, delivered_at = UTC_TIMESTAMP(6) WHERE id = ?", attempts, code, deliveryId)
+	case attempts >= MaxAttempts:
+		_, err = db.Exec("UPDATE webhook_deliveries SET status = 'failed', attempts = ?, last_status_code = ?, last_error = ? WHERE id = ?", attempts, code, errText, deliveryId)
+	default:
+		_, err = db.Exec("UPDATE webhook_deliveries SET attempts = ?, last_status_code = ?, last_error = ?, next_attempt_at = UTC_TIMESTAMP(6) + INTERVAL ? SECOND WHERE id = ?",
+			attempts, code, errText, int(RetryDelay(attempts)/time.Second), deliveryId,
+		)
+	}
+	return err
+}
+
+// RetryDelay is the wait after a failed attempt: 30s, 1m, 2m, 4m and so on, capped at 6 hours
+func RetryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// send posts a payload with its signature headers and returns the receiver's status code
+func send(url, secret, eventType string, deliveryId int64, payload []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ClassConnect-Webhooks/1.0")
+	req.Header.Set("X-ClassConnect-Event", eventType)
+	req.Header.Set("X-ClassConnect-Delivery", strconv.FormatInt(deliveryId, 10))
+	req.Header.Set("X-ClassConnect-Timestamp", timestamp)
+	req.Header.Set("X-ClassConnect-Signature", "sha256="+Sign(secret, timestamp, payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Sign computes the hex HMAC-SHA256 of "<timestamp>.<body>" with the webhook's secret. Receivers recompute it to check
+// that a delivery is authentic, and reject old timestamps to stop replays
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// subscribes reports whether the comma separated event types of a webhook include the event
+func subscribes(types, eventType string) bool {
+	for _, subscribed := range strings.Split(types, ",") {
+		if subscribed == "*" || subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func nullable(state json.RawMessage) any {
+	if len(state) == 0 {
+		return nil
+	}
+	return state
+}
+
+func truncate(text string) string {
+	if len(text) > maxErrorLength {
+		return text[:maxErrorLength]
+	}
+	return text
+}
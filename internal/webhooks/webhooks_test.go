@@ -0,0 +1,64 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, test := range tests {
+		if got := PublicAddress(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("PublicAddress(%s) = %v, want %v", test.ip, got, test.want)
+		}
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	if err := CheckHost(context.Background(), "127.0.0.1"); !errors.Is(err, ErrInternalAddress) {
+		t.Errorf("CheckHost(127.0.0.1) error = %v, want %v", err, ErrInternalAddress)
+	}
+	if err := CheckHost(context.Background(), "93.184.216.34"); err != nil {
+		t.Errorf("CheckHost(93.184.216.34) error = %v, want nil", err)
+	}
+}
+
+func TestSendRefusesInternalReceivers(t *testing.T) {
+	// The receiver listens on loopback, which the dialer must refuse even though nothing checked the URL beforehand
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("delivery reached a loopback receiver")
+	}))
+	defer receiver.Close()
+
+	if _, err := send(receiver.URL, "secret", TypePing, 1, []byte("{}")); !errors.Is(err, ErrInternalAddress) {
+		t.Errorf("send() error = %v, want %v", err, ErrInternalAddress)
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	redirect := &http.Request{}
+	if err := client.CheckRedirect(redirect, []*http.Request{{}}); err != http.ErrUseLastResponse {
+		t.Errorf("CheckRedirect() = %v, want %v", err, http.ErrUseLastResponse)
+	}
+}
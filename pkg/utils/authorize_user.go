@@ -4,7 +4,16 @@ import "errors"
 
 type ContextKey string
 
+// SuperAdminRole is the district-level role, it passes every role check and may act on any school
+const SuperAdminRole = "super_admin"
+
+// GuardianRole is the role of parent and guardian accounts, which the API server scopes to a few paths
+const GuardianRole = "guardian"
+
 func AuthorizeUser(userRole string, allowedRoles ...string) (bool, error) {
+	if userRole == SuperAdminRole {
+		return true, nil
+	}
 	for _, allowedRole := range allowedRoles {
 		if userRole == allowedRole {
 			return true, nil
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Trigrams splits a string into its lowercase character trigrams, padded so short words still produce some
+func Trigrams(s string) map[string]struct{} {
+	trigrams := make(map[string]struct{})
+	for _, word := range strings.Fields(strings.ToLower(s)) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			trigrams[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+	return trigrams
+}
+
+// TrigramSimilarity returns the Jaccard similarity of the trigram sets of a and b, between 0 and 1
+func TrigramSimilarity(a, b string) float64 {
+	ta := Trigrams(a)
+	tb := Trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for trigram := range ta {
+		if _, ok := tb[trigram]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// Soundex returns the four character American Soundex code of a word, or an empty string if it has no letters
+func Soundex(word string) string {
+	codes := map[rune]byte{
+		'b': '1', 'f': '1', 'p': '1', 'v': '1',
+		'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+		'd': '3', 't': '3',
+		'l': '4',
+		'm': '5', 'n': '5',
+		'r': '6',
+	}
+
+	result := make([]byte, 0, 4)
+	var last byte
+	for _, r := range strings.ToLower(word) {
+		if !unicode.IsLetter(r) || r > unicode.MaxASCII {
+			continue
+		}
+		code := codes[r]
+		if len(result) == 0 {
+			result = append(result, byte(unicode.ToUpper(r)))
+			last = code
+			continue
+		}
+		switch {
+		case code == 0:
+			// Vowels separate repeated codes, h and w do not
+			if r != 'h' && r != 'w' {
+				last = 0
+			}
+		case code != last:
+			result = append(result, code)
+			last = code
+		}
+		if len(result) == 4 {
+			break
+		}
+	}
+
+	if len(result) == 0 {
+		return ""
+	}
+	for len(result) < 4 {
+		result = append(result, '0')
+	}
+	return string(result)
+}
@@ -0,0 +1,70 @@
+package utils
+
+import "testing"
+
+func TestTrigrams(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"ab", 3},
+		{"Anna", 5},
+		{"anna ANNA", 5},
+		{"a b", 4},
+		{"   ", 0},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if got := len(Trigrams(test.s)); got != test.want {
+			t.Errorf("len(Trigrams(%q)) = %d, want %d", test.s, got, test.want)
+		}
+	}
+}
+
+func TestTrigramSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"anna", "anna", 1},
+		{"ANNA", "anna", 1},
+		{"smith", "smyth", 1.0 / 3},
+		{"bob", "anna", 0},
+		{"", "anna", 0},
+		{"anna", "", 0},
+	}
+	for _, test := range tests {
+		if got := TrigramSimilarity(test.a, test.b); got != test.want {
+			t.Errorf("TrigramSimilarity(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+		if got := TrigramSimilarity(test.b, test.a); got != test.want {
+			t.Errorf("TrigramSimilarity(%q, %q) = %v, want %v", test.b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestSoundex(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"Robert", "R163"},
+		{"Rupert", "R163"},
+		{"Rubin", "R150"},
+		{"Ashcraft", "A261"},
+		{"Tymczak", "T522"},
+		{"Pfister", "P236"},
+		{"Honeyman", "H555"},
+		{"O'Brien", "O165"},
+		{"Lee", "L000"},
+		{"Smith", "S530"},
+		{"smyth", "S530"},
+		{"123", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := Soundex(test.word); got != test.want {
+			t.Errorf("Soundex(%q) = %q, want %q", test.word, got, test.want)
+		}
+	}
+}
@@ -8,14 +8,15 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func SignToken(userId, username, role string) (string, error) {
+func SignToken(userId, username, role, schoolId string) (string, error) {
 	jwtSecret := os.Getenv("JWT_SECRET")
 	jwtExpiresIn := os.Getenv("JWT_EXPIRES_IN")
 
 	claims := jwt.MapClaims{
-		"uid":  userId,
-		"user": username,
-		"role": role,
+		"uid":    userId,
+		"user":   username,
+		"role":   role,
+		"school": schoolId,
 	}
 
 	if jwtExpiresIn != "" {
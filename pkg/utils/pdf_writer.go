@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// A4 page size in points, the unit of every PDFDocument coordinate. The origin is the bottom left corner
+const (
+	PDFPageWidth  = 595.28
+	PDFPageHeight = 841.89
+)
+
+// PDFDocument builds a text and line PDF in memory using the standard Helvetica fonts, so no font files are embedded.
+// Text is encoded as WinAnsi, characters outside of it are printed as "?"
+type PDFDocument struct {
+	pages []*bytes.Buffer
+}
+
+// winAnsiExtras maps the printable characters WinAnsi places in the 0x80-0x9F range, the rest of it matches Latin-1
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+func NewPDFDocument() *PDFDocument {
+	return &PDFDocument{}
+}
+
+// AddPage starts a new page, later drawing goes onto it
+func (d *PDFDocument) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// PageCount returns the number of pages added so far
+func (d *PDFDocument) PageCount() int {
+	return len(d.pages)
+}
+
+// Text draws a single line of text with its baseline starting at x, y
+func (d *PDFDocument) Text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page(), "BT /%s %s Tf %s %s Td (%s) Tj ET\n", font, pdfNumber(size), pdfNumber(x), pdfNumber(y), pdfString(text))
+}
+
+// Line draws a straight line
+func (d *PDFDocument) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(d.page(), "%s w %s %s m %s %s l S\n", pdfNumber(width), pdfNumber(x1), pdfNumber(y1), pdfNumber(x2), pdfNumber(y2))
+}
+
+// WriteTo writes the finished document
+func (d *PDFDocument) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	out := &countingWriter{w: w}
+	offsets := make([]int64, 0, 4+2*len(d.pages))
+	object := func(body string) {
+		offsets = append(offsets, out.n)
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	io.WriteString(out, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 4 are fixed, each page then takes a page object followed by its content stream
+	kids := make([]byte, 0, 8*len(d.pages))
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R ", 5+2*i)...)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", bytes.TrimSpace(kids), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfNumber(PDFPageWidth), pdfNumber(PDFPageHeight), 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := out.n
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.n, out.err
+}
+
+func (d *PDFDocument) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// pdfString encodes text as WinAnsi and escapes it for a literal string
+func pdfString(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		var b byte
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b = byte(r)
+		case winAnsiExtras[r] != 0:
+			b = winAnsiExtras[r]
+		default:
+			b = '?'
+		}
+		if b == '(' || b == ')' || b == '\\' {
+			encoded = append(encoded, '\\')
+		}
+		encoded = append(encoded, b)
+	}
+	return encoded
+}
+
+func pdfNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// countingWriter tracks the byte offsets the cross-reference table needs and keeps the first write error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
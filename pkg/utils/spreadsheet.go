@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrUnsupportedSpreadsheet = errors.New("unsupported file type, expected .csv or .xlsx")
+
+// maxXLSXColumns is the number of columns of an XLSX worksheet, the last one being XFD
+const maxXLSXColumns = 16384
+
+// ReadSpreadsheet parses a CSV or XLSX file into rows of cells, picking the format from the file name.
+// Only the first worksheet of an XLSX workbook is read. Rows that cannot be read in full keep their place in the
+// rows and are reported by their zero based index in the map, so the caller can refuse them one by one
+func ReadSpreadsheet(filename string, data []byte) ([][]string, map[int]error, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		rows, err := readCSV(data)
+		return rows, nil, err
+	case ".xlsx":
+		return readXLSX(data)
+	}
+	return nil, nil, ErrUnsupportedSpreadsheet
+}
+
+func readCSV(data []byte) ([][]string, error) {
+	// Spreadsheet programs like to prepend a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return reader.ReadAll()
+}
+
+type xlsxSharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline struct {
+				Text string `xml:"t"`
+			} `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readXLSX(data []byte) ([][]string, map[int]error, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, errors.New("invalid xlsx file")
+	}
+
+	var sharedStrings []string
+	var worksheets []*zip.File
+	for _, file := range archive.File {
+		switch {
+		case file.Name == "xl/sharedStrings.xml":
+			var parsed xlsxSharedStrings
+			err = decodeZipXML(file, &parsed)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, item := range parsed.Items {
+				text := item.Text
+				// Rich text is split into runs
+				for _, run := range item.Runs {
+					text += run.Text
+				}
+				sharedStrings = append(sharedStrings, text)
+			}
+		case strings.HasPrefix(file.Name, "xl/worksheets/") && strings.HasSuffix(file.Name, ".xml"):
+			worksheets = append(worksheets, file)
+		}
+	}
+	if len(worksheets) == 0 {
+		return nil, nil, errors.New("xlsx file has no worksheets")
+	}
+	sort.Slice(worksheets, func(i, j int) bool {
+		return worksheetNumber(worksheets[i].Name) < worksheetNumber(worksheets[j].Name)
+	})
+
+	var sheet xlsxWorksheet
+	err = decodeZipXML(worksheets[0], &sheet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	rowErrors := make(map[int]error)
+	for r, row := range sheet.Rows {
+		cells := make([]string, 0, len(row.Cells))
+		for i, cell := range row.Cells {
+			// Empty cells are left out of the file, so place each cell by its reference when there is one
+			column := i
+			if cell.Ref != "" {
+				column = columnIndex(cell.Ref)
+			}
+			if column < 0 || column >= maxXLSXColumns {
+				rowErrors[r] = fmt.Errorf("cell %.20q is outside the worksheet's %d columns", cell.Ref, maxXLSXColumns)
+				break
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(sharedStrings) {
+					return nil, nil, errors.New("xlsx file references a missing shared string")
+				}
+				cells[column] = sharedStrings[index]
+			case "inlineStr":
+				cells[column] = cell.Inline.Text
+			case "b":
+				cells[column] = strconv.FormatBool(cell.Value == "1")
+			default:
+				cells[column] = cell.Value
+			}
+		}
+		rows = append(rows, cells)
+	}
+	return rows, rowErrors, nil
+}
+
+func decodeZipXML(file *zip.File, v any) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	// Guard against decompression bombs, a roster never comes close to this
+	return xml.NewDecoder(io.LimitReader(reader, 64<<20)).Decode(v)
+}
+
+// worksheetNumber extracts N from xl/worksheets/sheetN.xml so sheet10 sorts after sheet2
+func worksheetNumber(name string) int {
+	base := strings.TrimSuffix(path.Base(name), ".xml")
+	number, err := strconv.Atoi(strings.TrimPrefix(base, "sheet"))
+	if err != nil {
+		return int(^uint(0) >> 1)
+	}
+	return number
+}
+
+// columnIndex converts the letters of a cell reference such as "AB12" into a zero based column index. References past
+// the last column of a worksheet return -1 before their letters can overflow the index
+func columnIndex(ref string) int {
+	index := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+		if index > maxXLSXColumns {
+			return -1
+		}
+	}
+	return index - 1
+}
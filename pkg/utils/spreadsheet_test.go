@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want int
+	}{
+		{"A1", 0},
+		{"Z9", 25},
+		{"AA1", 26},
+		{"AB12", 27},
+		{"XFD1", maxXLSXColumns - 1},
+		{"XFE1", -1},
+		{"XFDXFDXFD1", -1},
+		{strings.Repeat("Z", 40) + "1", -1},
+		{"12", -1},
+	}
+	for _, test := range tests {
+		if got := columnIndex(test.ref); got != test.want {
+			t.Errorf("columnIndex(%q) = %d, want %d", test.ref, got, test.want)
+		}
+	}
+}
+
+// xlsxWithRows builds a workbook whose first worksheet holds the given <row> elements
+func xlsxWithRows(t *testing.T, rows string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet.Write([]byte(`<worksheet><sheetData>` + rows + `</sheetData></worksheet>`))
+	if err = archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadSpreadsheetXLSX(t *testing.T) {
+	data := xlsxWithRows(t, `<row><c r="A1" t="inlineStr"><is><t>email</t></is></c><c r="C1" t="inlineStr"><is><t>name</t></is></c></row>`+
+		`<row><c r="A2" t="inlineStr"><is><t>a@example.com</t></is></c><c r="XFDXFDXFD2"><v>1</v></c></row>`+
+		`<row><c r="A3" t="b"><v>1</v></c><c r="B3"><v>42</v></c></row>`)
+
+	rows, readErrors, err := ReadSpreadsheet("roster.xlsx", data)
+	if err != nil {
+		t.Fatalf("ReadSpreadsheet() error = %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("ReadSpreadsheet() returned %d rows, want 3", len(rows))
+	}
+	if got := strings.Join(rows[0], ","); got != "email,,name" {
+		t.Errorf("header = %q, want %q", got, "email,,name")
+	}
+	if got := strings.Join(rows[2], ","); got != "true,42" {
+		t.Errorf("row 3 = %q, want %q", got, "true,42")
+	}
+	if _, ok := readErrors[1]; !ok || len(readErrors) != 1 {
+		t.Errorf("readErrors = %v, want only row index 1", readErrors)
+	}
+}
+
+func TestReadSpreadsheetCSV(t *testing.T) {
+	rows, readErrors, err := ReadSpreadsheet("roster.CSV", []byte("email,name\na@example.com,Ann\n"))
+	if err != nil || len(readErrors) != 0 {
+		t.Fatalf("ReadSpreadsheet() error = %v, readErrors = %v", err, readErrors)
+	}
+	if len(rows) != 2 || rows[1][1] != "Ann" {
+		t.Errorf("ReadSpreadsheet() = %v", rows)
+	}
+
+	_, _, err = ReadSpreadsheet("roster.ods", nil)
+	if err != ErrUnsupportedSpreadsheet {
+		t.Errorf("ReadSpreadsheet(.ods) error = %v, want ErrUnsupportedSpreadsheet", err)
+	}
+}
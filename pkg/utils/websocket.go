@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is the fixed key suffix of the RFC 6455 opening handshake
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWebSocketMessage bounds what a client may send, the connections are mostly server to client
+const maxWebSocketMessage = 64 << 10
+
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+var ErrWebSocketClosed = errors.New("websocket closed")
+
+// WebSocketConn is a server side WebSocket connection. Writes are safe for concurrent use
+type WebSocketConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// IsWebSocketUpgrade reports whether the request asks to switch to the WebSocket protocol
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") && headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+// UpgradeWebSocket completes the opening handshake and takes over the connection. On failure an error response has
+// already been written
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocketConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !IsWebSocketUpgrade(r) || key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket upgrades are not supported on this connection", http.StatusInternalServerError)
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " +
+		base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n"
+	_, err = rw.WriteString(response)
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &WebSocketConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// WriteText sends a text message
+func (c *WebSocketConn) WriteText(message []byte) error {
+	return c.writeFrame(wsOpText, message)
+}
+
+// Ping sends a ping, which the client answers with a pong
+func (c *WebSocketConn) Ping() error {
+	return c.writeFrame(wsOpPing, nil)
+}
+
+// Close sends a close frame and closes the connection
+func (c *WebSocketConn) Close() error {
+	c.writeFrame(wsOpClose, []byte{0x03, 0xE8})
+	return c.conn.Close()
+}
+
+func (c *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
+
+// ReadMessage returns the next text or binary message, answering pings on the way. Fragmented messages are joined.
+// It returns ErrWebSocketClosed once the client closes the connection
+func (c *WebSocketConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		var head [2]byte
+		_, err := io.ReadFull(c.reader, head[:])
+		if err != nil {
+			return nil, err
+		}
+		final := head[0]&0x80 != 0
+		opcode := head[0] & 0x0F
+		if head[1]&0x80 == 0 {
+			return nil, errors.New("websocket: client frames must be masked")
+		}
+
+		length := uint64(head[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext [2]byte
+			_, err = io.ReadFull(c.reader, ext[:])
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			_, err = io.ReadFull(c.reader, ext[:])
+			length = binary.BigEndian.Uint64(ext[:])
+			// RFC 6455 keeps the most significant bit of a 64-bit length clear
+			if err == nil && length>>63 != 0 {
+				return nil, errors.New("websocket: invalid frame length")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The frame is checked on its own first so that adding the message so far cannot overflow
+		if length > maxWebSocketMessage || length+uint64(len(message)) > maxWebSocketMessage {
+			return nil, errors.New("websocket: message too large")
+		}
+
+		var mask [4]byte
+		_, err = io.ReadFull(c.reader, mask[:])
+		if err != nil {
+			return nil, err
+		}
+		payload := make([]byte, length)
+		_, err = io.ReadFull(c.reader, payload)
+		if err != nil {
+			return nil, err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		// Control frames may arrive between the fragments of a message and are never fragmented themselves
+		switch opcode {
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload)
+			return nil, ErrWebSocketClosed
+		case wsOpPing:
+			err = c.writeFrame(wsOpPong, payload)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		}
+		message = append(message, payload...)
+		if final {
+			return message, nil
+		}
+	}
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
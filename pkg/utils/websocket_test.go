@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// clientFrame builds a masked client frame, extended lengths being written as given
+func clientFrame(first byte, payload []byte) []byte {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{first}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// hugeFrame is a masked final continuation frame announcing a 64-bit length without carrying the payload
+func hugeFrame(length uint64) []byte {
+	frame := []byte{0x80, 0x80 | 127}
+	frame = binary.BigEndian.AppendUint64(frame, length)
+	return append(frame, 1, 2, 3, 4)
+}
+
+func TestWebSocketReadMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    string
+		wantErr bool
+	}{
+		{"text", clientFrame(0x80|wsOpText, []byte("hello")), "hello", false},
+		{"16-bit length", clientFrame(0x80|wsOpText, bytes.Repeat([]byte("a"), 300)), string(bytes.Repeat([]byte("a"), 300)), false},
+		{"fragments", append(clientFrame(wsOpText, []byte("hel")), clientFrame(0x80, []byte("lo"))...), "hello", false},
+		{"ping between fragments", append(append(clientFrame(wsOpText, []byte("hel")), clientFrame(0x80|wsOpPing, []byte("p"))...), clientFrame(0x80, []byte("lo"))...), "hello", false},
+		{"unmasked", []byte{0x80 | wsOpText, 0x01, 'a'}, "", true},
+		{"too large", hugeFrame(maxWebSocketMessage + 1), "", true},
+		{"length near 2^63", hugeFrame(1<<63 - 1), "", true},
+		{"length near 2^64", hugeFrame(^uint64(0)), "", true},
+		{"length wrapping after a fragment", append(clientFrame(wsOpText, []byte("hel")), hugeFrame(^uint64(0)-1)...), "", true},
+		{"top bit set", hugeFrame(1<<63 | 5), "", true},
+		{"too large once joined", append(clientFrame(wsOpText, bytes.Repeat([]byte("a"), maxWebSocketMessage)), clientFrame(0x80, []byte("a"))...), "", true},
+		{"truncated", clientFrame(0x80|wsOpText, []byte("hello"))[:8], "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+			go io.Copy(io.Discard, client)
+
+			conn := &WebSocketConn{conn: server, reader: bufio.NewReader(bytes.NewReader(test.input))}
+			message, err := conn.ReadMessage()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("ReadMessage() = %q, want an error", message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadMessage() error = %v", err)
+			}
+			if string(message) != test.want {
+				t.Errorf("ReadMessage() = %q, want %q", message, test.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketReadMessageClose(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go io.Copy(io.Discard, client)
+
+	conn := &WebSocketConn{conn: server, reader: bufio.NewReader(bytes.NewReader(clientFrame(0x80|wsOpClose, nil)))}
+	_, err := conn.ReadMessage()
+	if !errors.Is(err, ErrWebSocketClosed) {
+		t.Errorf("ReadMessage() error = %v, want ErrWebSocketClosed", err)
+	}
+}
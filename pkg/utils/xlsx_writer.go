@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// XLSXWriter streams rows into a single-sheet XLSX workbook without holding them in memory.
+// Cells are written as inline strings or numbers, so no shared string table is needed
+type XLSXWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	row   int
+	err   error
+}
+
+var xlsxStaticParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// NewXLSXWriter writes the workbook skeleton and opens the worksheet for rows
+func NewXLSXWriter(w io.Writer) (*XLSXWriter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxStaticParts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.WriteString(file, part.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	writer := &XLSXWriter{zip: archive, sheet: bufio.NewWriter(sheet)}
+	writer.writeString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return writer, writer.err
+}
+
+// WriteRow appends a row. Integers and floats become numeric cells, everything else is written as text
+func (x *XLSXWriter) WriteRow(cells []any) error {
+	x.row++
+	x.writeString(`<row r="` + strconv.Itoa(x.row) + `">`)
+	for i, cell := range cells {
+		ref := columnName(i) + strconv.Itoa(x.row)
+		switch value := cell.(type) {
+		case nil:
+			continue
+		case int, int64, float64:
+			x.writeString(fmt.Sprintf(`<c r="%s"><v>%v</v></c>`, ref, value))
+		default:
+			x.writeString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+			if x.err == nil {
+				x.err = xml.EscapeText(x.sheet, []byte(fmt.Sprint(value)))
+			}
+			x.writeString(`</t></is></c>`)
+		}
+	}
+	x.writeString(`</row>`)
+	return x.err
+}
+
+// Close finishes the worksheet and the zip archive. It does not close the underlying writer
+func (x *XLSXWriter) Close() error {
+	x.writeString(`</sheetData></worksheet>`)
+	if x.err == nil {
+		x.err = x.sheet.Flush()
+	}
+	if x.err != nil {
+		return x.err
+	}
+	return x.zip.Close()
+}
+
+func (x *XLSXWriter) writeString(s string) {
+	if x.err != nil {
+		return
+	}
+	_, x.err = x.sheet.WriteString(s)
+}
+
+// columnName converts a zero based column index into spreadsheet letters, 0 -> A, 26 -> AA
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}